@@ -12,339 +12,412 @@ package main
 import (
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
-
-	"crypto/sha256"
 
 	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
 	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
-	"github.com/btcsuite/btcd/btcec"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
 	proto "github.com/golang/protobuf/proto"
-	"github.com/hyperledger/fabric/core/chaincode/shim"
 )
 
+/*
+	IOTRegistry is the chaincode. Its Init, Invoke and Query methods are defined by the adapter for the
+	shim generation it is built for (see stub.go).
+*/
 type IOTRegistry struct {
 }
 
 /*
-	Init is a required function in which necessary setup operations are performed.
-	In this case, no such operations are needed.
+	verifies an input signature against input public key and message (see client.Verify).
+	Non-canonical signatures are only accepted when the registry is deployed with LegacySignatures.
+	field names the signature field of the transaction in the returned BAD_SIGNATURE error.
 */
-func (t *IOTRegistry) Init(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	return nil, nil
+func verify(stub Stub, pubKeyBytes []byte, sigBytes []byte, message string, field string) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	if config.LegacySignatures {
+		err = client.VerifyLegacy(pubKeyBytes, sigBytes, message)
+	} else {
+		err = client.Verify(pubKeyBytes, sigBytes, message)
+	}
+	if err != nil {
+		return badSignature(field, "Error verifying signature: %s", err.Error())
+	}
+	return nil
 }
 
 /*
-	verifies an input signature against input public key and message.
+	checks that the nonce, aliases and typed aliases of a thing to be registered are available,
+	and returns its normalized typed aliases. Aliases are rewritten in place to their blinded form
+	when the registry blinds aliases. pending holds the keys claimed by things earlier in
+	the same transaction and is updated with the keys claimed by this thing.
 */
-func verify(pubKeyBytes []byte, sigBytes []byte, message string) (err error) {
-	//deserialize public key bytes into a public key object
-	creatorKey, err := btcec.ParsePubKey(pubKeyBytes, btcec.S256())
-	if err != nil {
-		fmt.Printf("Invalid pubkey: (%s)\n", hex.EncodeToString(pubKeyBytes))
-		return fmt.Errorf("Invalid pubkey key (%s)\n", hex.EncodeToString(pubKeyBytes))
-	}
+func checkThingAvailable(stub Stub, registerThingArgs *IOTRegistryTX.RegisterThingTX,
+	pending map[string]bool) ([]*IOTRegistryStore.TypedAlias, error) {
 
-	//DER is a standard for serialization
-	//parsing DER signature from bitcoin curve into a signature object
-	signature, err := btcec.ParseDERSignature(sigBytes, btcec.S256())
+	//check if nonce already exists
+	nonceKey := thingKey(hex.EncodeToString(registerThingArgs.Nonce))
+	nonceCheckBytes, err := stub.GetState(nonceKey)
 	if err != nil {
-		fmt.Printf("Bad Creator signature encoding\n")
-		return fmt.Errorf("Bad Creator signature encoding\n")
+		return nil, internalError(nonceKey, "Could not get Nonce (%s) State", hex.EncodeToString(registerThingArgs.Nonce))
 	}
 
-	messageBytes := sha256.Sum256([]byte(message))
+	//if nonce exists
+	if len(nonceCheckBytes) != 0 || pending[nonceKey] {
+		return nil, alreadyExists(nonceKey, "Nonce (%s) is unavailable", hex.EncodeToString(registerThingArgs.Nonce))
+	}
+	pending[nonceKey] = true
 
-	//try to verify the signature
-	success := signature.Verify(messageBytes[:], creatorKey)
-	if !success {
-		fmt.Printf("Invalid Creator Signature\n")
-		return fmt.Errorf("Invalid Creator Signature\n")
+	//blind the aliases if the registry blinds them, so that they are checked and stored blinded
+	blinding, err := getAliasBlinding(stub, registerThingArgs.RegistrantPubkey)
+	if err != nil {
+		return nil, err
+	}
+	for i, identity := range registerThingArgs.Aliases {
+		registerThingArgs.Aliases[i] = blinding.blind(identity, false)
 	}
-	return nil
-}
 
-/*
-	Invoke is the central mechanism in hyperledger for creating transactions and putting them to the ledger.
-	This function takes as arguments
-	|		a chaincode interface, called "stub"
-	|		a string which dictates which function to perform,
-	|		a slice of strings "args" that accord with some protobuf specification
-*/
-func (t *IOTRegistry) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	if len(args) == 0 {
-		fmt.Printf("Insufficient arguments found\n")
-		return nil, fmt.Errorf("Insufficient arguments found\n")
-	}
-	argsBytes, err := hex.DecodeString(args[0])
-	if err != nil {
-		fmt.Printf("Invalid argument (%s) expected hex\n", args[0])
-		return nil, fmt.Errorf("Invalid argument (%s) expected hex\n", args[0])
-	}
-
-	switch function {
-	/*
-		createRegistrant puts a "RegistrantPubkey:<RegistrantPubkey>" state to the ledger, indexed by the RegistrantPubkey.
-		TX struct: 		CreateRegistrantTX
-		Store struct: 	Owner
-	*/
-	case "createRegistrant":
-		//declare and initialize RegisterIdentity struct
-		registerNameArgs := IOTRegistryTX.CreateRegistrantTX{}
-		err = proto.Unmarshal(argsBytes, &registerNameArgs)
+	//check if any Aliases exist
+	for _, identity := range registerThingArgs.Aliases {
+		aliasCheckBytes, err := stub.GetState(aliasKey(identity))
 		if err != nil {
-			fmt.Printf("Invalid argument expected RegisterNameTX protocol buffer %s\n", err.Error())
-			return nil, fmt.Errorf("Invalid argument expected RegisterNameTX protocol buffer %s\n", err.Error())
-		}
-
-		if len(registerNameArgs.RegistrantName) == 0 {
-			fmt.Printf("length of RegistrantName (%s) is zero\n", registerNameArgs.RegistrantName)
-			return nil, fmt.Errorf("length of RegistrantName (%s) is zero\n", registerNameArgs.RegistrantName)
+			return nil, internalError(aliasKey(identity), "Could not get identity: (%s) State", identity)
 		}
-		if len(registerNameArgs.RegistrantPubkey) == 0 {
-			fmt.Printf("length of Pubkey (%s) is zero\n", registerNameArgs.RegistrantPubkey)
-			return nil, fmt.Errorf("length of Pubkey (%s) is zero\n", registerNameArgs.RegistrantPubkey)
+		//throw error if any of the Aliases already exist
+		if len(aliasCheckBytes) != 0 || pending[aliasKey(identity)] {
+			return nil, alreadyExists(aliasKey(identity), "Alias: (%s) is already in registry", identity)
 		}
-		//Validate and normalize key
-		registrantKey, err := btcec.ParsePubKey(registerNameArgs.RegistrantPubkey, btcec.S256())
+		pending[aliasKey(identity)] = true
+	}
+
+	//validate and normalize typed aliases, then check that none of them exist
+	typedAliases := make([]*IOTRegistryStore.TypedAlias, len(registerThingArgs.TypedAliases))
+	for i, typedAlias := range registerThingArgs.TypedAliases {
+		value, err := blinding.blindTypedAlias(typedAlias.Type, typedAlias.Value, typedAlias.Scoped)
 		if err != nil {
-			fmt.Printf("Public Key (%s) is invlaid\n", hex.EncodeToString(registerNameArgs.RegistrantPubkey))
-			return nil, fmt.Errorf("Public Key (%s) is invlaid\n", hex.EncodeToString(registerNameArgs.RegistrantPubkey))
+			return nil, invalidArgument("TypedAliases", "Invalid typed alias: %s", err.Error())
 		}
-		registerNameArgs.RegistrantPubkey = registrantKey.SerializeCompressed()
-
-		if len(registerNameArgs.Signature) == 0 {
-			fmt.Printf("length of Signature (%s) is zero\n", registerNameArgs.Signature)
-			return nil, fmt.Errorf("length of Signature (%s) is zero\n", registerNameArgs.Signature)
+		scope := ""
+		if typedAlias.Scoped {
+			scope = registerThingArgs.RegistrantPubkey
+		}
+		key := typedAliasKey(typedAlias.Type, scope, value)
+		if pending[key] {
+			return nil, alreadyExists(key, "Alias: (%s:%s) is repeated", typedAlias.Type, value)
 		}
-		//check if pubkey is available
-		registrantBytes, err := stub.GetState("RegistrantPubkey:" + hex.EncodeToString(registerNameArgs.RegistrantPubkey))
+		pending[key] = true
+		aliasCheckBytes, err := stub.GetState(key)
 		if err != nil {
-			fmt.Printf("Could not get RegistrantPubkey (%s) State\n", registerNameArgs.RegistrantPubkey)
-			return nil, fmt.Errorf("Could not get RegistrantPubkey (%s) State\n", registerNameArgs.RegistrantPubkey)
+			return nil, internalError(key, "Could not get identity: (%s:%s) State", typedAlias.Type, value)
 		}
-
-		//if pubkey unavailable
-		if len(registrantBytes) != 0 {
-			fmt.Printf("RegistrantPubkey (%s) is unavailable\n", registerNameArgs.RegistrantPubkey)
-			return nil, fmt.Errorf("RegistrantPubkey (%s) is unavailable\n", registerNameArgs.RegistrantPubkey)
+		if len(aliasCheckBytes) != 0 {
+			return nil, alreadyExists(key, "Alias: (%s:%s) is already in registry", typedAlias.Type, value)
 		}
+		typedAliases[i] = &IOTRegistryStore.TypedAlias{Type: typedAlias.Type, Value: value, Scope: scope}
+	}
+	return typedAliases, nil
+}
 
-		creatorKeyBytes := registerNameArgs.RegistrantPubkey
-		creatorSig := registerNameArgs.Signature
-		message := registerNameArgs.RegistrantName + ":" + hex.EncodeToString(registerNameArgs.RegistrantPubkey) + ":" + registerNameArgs.Data
+/*
+	puts the Alias, TypedAlias and Thing states of a thing that has passed checkThingAvailable.
+*/
+func putRegisteredThing(stub Stub, registerThingArgs *IOTRegistryTX.RegisterThingTX,
+	typedAliases []*IOTRegistryStore.TypedAlias) error {
+
+	for _, identity := range registerThingArgs.Aliases {
+
+		alias := IOTRegistryStore.Alias{}
+		alias.Nonce = registerThingArgs.Nonce
+		aliasStoreBytes, err := proto.Marshal(&alias)
 
-		err = verify(creatorKeyBytes, creatorSig, message)
 		if err != nil {
-			fmt.Printf("Error verifying signature (%s)\n", creatorSig)
-			return nil, fmt.Errorf("Error verifying signature (%s)\n", creatorSig)
+			return internalError(aliasKey(identity), "Error marshalling alias (%v) into bytes", alias)
 		}
-
-		//marshall into store type. Then put that variable into the state
-		store := IOTRegistryStore.Registrant{}
-		store.RegistrantName = registerNameArgs.RegistrantName
-		store.RegistrantPubkey = registerNameArgs.RegistrantPubkey
-		storeBytes, err := proto.Marshal(&store)
+		err = stub.PutState(aliasKey(identity), aliasStoreBytes)
 		if err != nil {
-			fmt.Printf("Error marshalling variable of type IOTRegistryStore.Aliases{}: (%v)\n", err.Error())
-			return nil, fmt.Errorf("Error marshalling variable of type IOTRegistryStore.Aliases{}: (%v)\n", err.Error())
+			return internalError(aliasKey(identity), "Error putting alias state :(%v)", err.Error())
 		}
+	}
 
-		err = stub.PutState("RegistrantPubkey:"+hex.EncodeToString(registerNameArgs.RegistrantPubkey), storeBytes)
+	for _, typedAlias := range typedAliases {
+		key := typedAliasKey(typedAlias.Type, typedAlias.Scope, typedAlias.Value)
+		alias := IOTRegistryStore.Alias{}
+		alias.Nonce = registerThingArgs.Nonce
+		aliasStoreBytes, err := proto.Marshal(&alias)
 		if err != nil {
-			fmt.Printf("error putting RegistrantPubkey (%s) to ledger: (%v)\n", registerNameArgs.RegistrantPubkey, err.Error())
-			return nil, fmt.Errorf("error putting RegistrantPubkey (%s) to ledger: (%v)\n", registerNameArgs.RegistrantPubkey, err.Error())
+			return internalError(key, "Error marshalling alias (%v) into bytes", alias)
 		}
-	/*
-		registerThing does, essentially, two things.
-		1.	puts a "Thing:<Nonce>" state to the ledger, indexed by the nonce.
-		|		-a thing contains a string slice of Aliases, a RegistrantPubkey, an arbitrary string of data, and the name of a specification.
-		2.	for each element of the Aliases string slice, puts an "Alias:<identity>" state to the ledger, indexed by identity.
-		|		-an Alias contains a nonce, which can be used to access its parent "thing"
-		TX struct: 		RegisterThingTX
-		Store structs: 	Things, Alias
-	*/
-	case "registerThing":
-		registerThingArgs := IOTRegistryTX.RegisterThingTX{}
-		err = proto.Unmarshal(argsBytes, &registerThingArgs)
+		err = stub.PutState(key, aliasStoreBytes)
 		if err != nil {
-			fmt.Printf("Invalid argument expected RegisterThingTX protocol buffer. Err: (%s)\n", err.Error())
-			return nil, fmt.Errorf("Invalid argument expected RegisterThingTX protocol buffer. Err: (%s)\n", err.Error())
-		}
-		if len(registerThingArgs.RegistrantPubkey) == 0 {
-			fmt.Printf("length of RegistrantPubkey (%s) is zero\n", registerThingArgs.RegistrantPubkey)
-			return nil, fmt.Errorf("length of RegistrantPubkey (%s) is zero\n", registerThingArgs.RegistrantPubkey)
-		}
-		if len(registerThingArgs.Nonce) == 0 {
-			fmt.Printf("length of Nonce (%s) is zero\n", registerThingArgs.Nonce)
-			return nil, fmt.Errorf("length of Nonce (%s) is zero\n", registerThingArgs.Nonce)
-		}
-		if len(registerThingArgs.Signature) == 0 {
-			fmt.Printf("length of Signature (%s) is zero\n", registerThingArgs.Signature)
-			return nil, fmt.Errorf("length of Signature (%s) is zero\n", registerThingArgs.Signature)
+			return internalError(key, "Error putting alias state :(%v)", err.Error())
 		}
+	}
 
-		//check if nonce already exists
-		nonceCheckBytes, err := stub.GetState("Thing:" + hex.EncodeToString(registerThingArgs.Nonce))
-		if err != nil {
-			fmt.Printf("Could not get Nonce (%s) State\n", hex.EncodeToString(registerThingArgs.Nonce))
-			return nil, fmt.Errorf("Could not get Nonce (%s) State\n", hex.EncodeToString(registerThingArgs.Nonce))
-		}
+	key := thingKey(hex.EncodeToString(registerThingArgs.Nonce))
+	store := IOTRegistryStore.Thing{}
+	store.Aliases = registerThingArgs.Aliases
+	store.RegistrantPubkey = registerThingArgs.RegistrantPubkey
+	store.Data = registerThingArgs.Data
+	store.Content = storedContent(registerThingArgs.Content)
+	store.PrivateData = storedPrivateData(registerThingArgs.PrivateData)
+	store.SpecName = registerThingArgs.Spec
+	store.TypedAliases = typedAliases
+	store.DevicePubkey = registerThingArgs.DevicePubkey
+	store.Status = initialThingStatus
+	storeBytes, err := proto.Marshal(&store)
+	if err != nil {
+		return internalError(key, "error marshalling type IOTRegistry store :(%v)", err.Error())
+	}
+	err = stub.PutState(key, storeBytes)
+	if err != nil {
+		return internalError(key, "Error putting thing state :(%v)", err.Error())
+	}
+	statusKey := thingStatusKey(store.Status, hex.EncodeToString(registerThingArgs.Nonce))
+	err = stub.PutState(statusKey, registerThingArgs.Nonce)
+	if err != nil {
+		return internalError(statusKey, "Error putting ThingStatus state :(%v)", err.Error())
+	}
+	return nil
+}
 
-		//if nonce exists
-		if len(nonceCheckBytes) != 0 {
-			fmt.Printf("Nonce (%s) is unavailable\n", hex.EncodeToString(registerThingArgs.Nonce))
-			return nil, fmt.Errorf("Nonce (%s) is unavailable\n", hex.EncodeToString(registerThingArgs.Nonce))
-		}
+/*
+	createRegistrant puts a "RegistrantPubkey:<RegistrantPubkey>" state to the ledger, indexed by the RegistrantPubkey.
+	TX struct: 		CreateRegistrantTX
+	Store struct: 	Owner
+*/
+type createRegistrantHandler struct{ txType }
 
-		//check if owner is valid id (name exists in registry)
-		checkIDBytes, err := stub.GetState("RegistrantPubkey:" + registerThingArgs.RegistrantPubkey)
-		if err != nil {
-			fmt.Printf("Failed to look up RegistrantPubkey (%s) \n", registerThingArgs.RegistrantPubkey)
-			return nil, fmt.Errorf("Failed to look up RegistrantPubkey (%s) \n", registerThingArgs.RegistrantPubkey)
-		}
+func (createRegistrantHandler) validate(tx proto.Message) error {
+	registerNameArgs := tx.(*IOTRegistryTX.CreateRegistrantTX)
+	if len(registerNameArgs.RegistrantName) == 0 {
+		return invalidArgument("RegistrantName", "length of RegistrantName (%s) is zero", registerNameArgs.RegistrantName)
+	}
+	if len(registerNameArgs.RegistrantPubkey) == 0 {
+		return invalidArgument("RegistrantPubkey", "length of Pubkey (%s) is zero", registerNameArgs.RegistrantPubkey)
+	}
+	//Validate and normalize key
+	normalized, err := client.NormalizePubkey(registerNameArgs.RegistrantPubkey)
+	if err != nil {
+		return invalidArgument("RegistrantPubkey", "Public Key (%s) is invlaid", hex.EncodeToString(registerNameArgs.RegistrantPubkey))
+	}
+	registerNameArgs.RegistrantPubkey = normalized
 
-		//if owner is not registered name
-		if len(checkIDBytes) == 0 {
-			fmt.Printf("RegistrantPubkey (%s) is not registered\n", registerThingArgs.RegistrantPubkey)
-			return nil, fmt.Errorf("RegistrantPubkey (%s) is not registered\n", registerThingArgs.RegistrantPubkey)
-		}
+	if len(registerNameArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", registerNameArgs.Signature)
+	}
+	return validateRegistrantAliasSalt(registerNameArgs)
+}
 
-		//check if any Aliases exist
-		for _, identity := range registerThingArgs.Aliases {
-			aliasCheckBytes, err := stub.GetState("Alias:" + identity)
-			if err != nil {
-				fmt.Printf("Could not get identity: (%s) State\n", identity)
-				return nil, fmt.Errorf("Could not get identity: (%s) State\n", identity)
-			}
-			//throw error if any of the Aliases already exist
-			if len(aliasCheckBytes) != 0 {
-				fmt.Printf("Alias: (%s) is already in registry\n", identity)
-				return nil, fmt.Errorf("Alias: (%s) is already in registry\n", identity)
-			}
-		}
+func (createRegistrantHandler) authorize(stub Stub, tx proto.Message) error {
+	registerNameArgs := tx.(*IOTRegistryTX.CreateRegistrantTX)
+	message := client.SignedMessage(registerNameArgs, client.CreateRegistrantMessage(registerNameArgs.RegistrantName, hex.EncodeToString(registerNameArgs.RegistrantPubkey), registerNameArgs.Data, registerNameArgs.AliasSalt))
+	return verify(stub, registerNameArgs.RegistrantPubkey, registerNameArgs.Signature, message, "Signature")
+}
 
-		ownerPubKeyBytes, err := hex.DecodeString(registerThingArgs.RegistrantPubkey)
-		if err != nil {
-			return nil, fmt.Errorf("Error decoding registrantPubkey: %s", err.Error())
-		}
+func (createRegistrantHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	registerNameArgs := tx.(*IOTRegistryTX.CreateRegistrantTX)
 
-		ownerSig := registerThingArgs.Signature
+	//check if pubkey is available
+	registrantKeyName := registrantKey(hex.EncodeToString(registerNameArgs.RegistrantPubkey))
+	registrantBytes, err := stub.GetState(registrantKeyName)
+	if err != nil {
+		return nil, internalError(registrantKeyName, "Could not get RegistrantPubkey (%s) State", hex.EncodeToString(registerNameArgs.RegistrantPubkey))
+	}
 
-		//TODO review later
-		message := registerThingArgs.RegistrantPubkey
-		for _, identity := range registerThingArgs.Aliases {
-			message += ":" + identity
-		}
-		message += ":" + registerThingArgs.Data
-		message += ":" + registerThingArgs.Spec
-		err = verify(ownerPubKeyBytes, ownerSig, message)
-		if err != nil {
-			fmt.Printf("Error verifying signature (%s)", ownerSig)
-			return nil, fmt.Errorf("Error verifying signature (%s)", ownerSig)
-		}
+	//if pubkey unavailable
+	if len(registrantBytes) != 0 {
+		return nil, alreadyExists(registrantKeyName, "RegistrantPubkey (%s) is unavailable", hex.EncodeToString(registerNameArgs.RegistrantPubkey))
+	}
 
-		for _, identity := range registerThingArgs.Aliases {
+	//marshall into store type. Then put that variable into the state
+	store := IOTRegistryStore.Registrant{}
+	store.RegistrantName = registerNameArgs.RegistrantName
+	store.RegistrantPubkey = registerNameArgs.RegistrantPubkey
+	store.AliasSalt = registerNameArgs.AliasSalt
+	storeBytes, err := proto.Marshal(&store)
+	if err != nil {
+		return nil, internalError(registrantKeyName, "Error marshalling variable of type IOTRegistryStore.Aliases{}: (%v)", err.Error())
+	}
 
-			alias := IOTRegistryStore.Alias{}
-			alias.Nonce = registerThingArgs.Nonce
-			aliasStoreBytes, err := proto.Marshal(&alias)
+	err = stub.PutState(registrantKeyName, storeBytes)
+	if err != nil {
+		return nil, internalError(registrantKeyName, "error putting RegistrantPubkey (%s) to ledger: (%v)", hex.EncodeToString(registerNameArgs.RegistrantPubkey), err.Error())
+	}
+	return nil, nil
+}
 
-			if err != nil {
-				fmt.Printf("Error marshalling alias (%v) into bytes", alias)
-				return nil, fmt.Errorf("Error marshalling alias (%v) into bytes\n", alias)
-			}
-			stub.PutState("Alias:"+identity, aliasStoreBytes)
-		}
+/*
+	normalizes a hex encoded public key in any SEC1 encoding and hex case to the lower case hex of its
+	compressed encoding (see client.NormalizePubkeyHex). Transactions normalize every pubkey field in
+	their validate phase, so signed messages, ledger keys and stored records always name a key the same way.
+*/
+func normalizePubkey(field string, pubkeyHex string) (string, error) {
+	if len(pubkeyHex) == 0 {
+		return "", invalidArgument(field, "length of %s is zero", field)
+	}
+	normalized, err := client.NormalizePubkeyHex(pubkeyHex)
+	if err != nil {
+		return "", invalidArgument(field, "%s", err.Error())
+	}
+	return normalized, nil
+}
 
-		store := IOTRegistryStore.Thing{}
-		store.Aliases = registerThingArgs.Aliases
-		store.RegistrantPubkey = registerThingArgs.RegistrantPubkey
-		store.Data = registerThingArgs.Data
-		store.SpecName = registerThingArgs.Spec
-		storeBytes, err := proto.Marshal(&store)
-		if err != nil {
-			fmt.Printf("error marshalling type IOTRegistry store :(%v)\n", err.Error())
-			return nil, fmt.Errorf("error marshalling type IOTRegistry store :(%v)\n", err.Error())
-		}
-		err = stub.PutState("Thing:"+hex.EncodeToString(registerThingArgs.Nonce), storeBytes)
-		if err != nil {
-			fmt.Printf("Error putting thing state :(%v)", err.Error())
-			return nil, fmt.Errorf("Error putting thing state :(%v)", err.Error())
-		}
-	/*
-		registerSpec puts a "Spec:<SpecName>" state to the ledger, indexed by the spec name.
-		TX struct: 		RegisterSpecTX
-		Store structs: 	Spec
-	*/
-	case "registerSpec":
-		specArgs := IOTRegistryTX.RegisterSpecTX{}
-		err = proto.Unmarshal(argsBytes, &specArgs)
-		if err != nil {
-			fmt.Printf("Invalid argument expected RegisterSpecTX protocol buffer %s\n", err.Error())
-		}
+/*
+	checks that a registrant is registered and returns its public key bytes.
+*/
+func getRegistrantPubkey(stub Stub, registrantPubkey string) ([]byte, error) {
+	registrantKeyName := registrantKey(registrantPubkey)
+	checkIDBytes, err := stub.GetState(registrantKeyName)
+	if err != nil {
+		return nil, internalError(registrantKeyName, "Failed to look up RegistrantPubkey (%s)", registrantPubkey)
+	}
+	if len(checkIDBytes) == 0 {
+		return nil, notFound(registrantKeyName, "RegistrantPubkey (%s) is not registered", registrantPubkey)
+	}
+	pubKeyBytes, err := hex.DecodeString(registrantPubkey)
+	if err != nil {
+		return nil, invalidArgument("RegistrantPubkey", "Error decoding registrantPubkey: %s", err.Error())
+	}
+	return pubKeyBytes, nil
+}
 
-		if len(specArgs.RegistrantPubkey) == 0 {
-			return nil, fmt.Errorf("length of RegistrantPubkey (%s) is zero\n", specArgs.RegistrantPubkey)
-		}
-		if len(specArgs.SpecName) == 0 {
-			return nil, fmt.Errorf("length of Nonce (%s) is zero\n", specArgs.SpecName)
-		}
-		if len(specArgs.Signature) == 0 {
-			return nil, fmt.Errorf("length of Signature (%s) is zero\n", specArgs.Signature)
-		}
+/*
+	registerThing does, essentially, two things.
+	1.	puts a "Thing:<Nonce>" state to the ledger, indexed by the nonce.
+	|		-a thing contains a string slice of Aliases, a RegistrantPubkey, an arbitrary string of data, and the name of a specification.
+	|		-instead of data, a thing may carry a ContentRef to off-chain data (see content.go)
+	|		-a thing may also carry PrivateData encrypted for its readers (see private.go)
+	2.	for each element of the Aliases string slice, puts an "Alias:<identity>" state to the ledger, indexed by identity.
+	|		-an Alias contains a nonce, which can be used to access its parent "thing"
+	|		-typed aliases (mac, imei, serial, uri) are validated, normalized and put to "TypedAlias:" states (see alias.go)
+	TX struct: 		RegisterThingTX
+	Store structs: 	Things, Alias
+*/
+type registerThingHandler struct{ txType }
+
+func (registerThingHandler) validate(tx proto.Message) error {
+	registerThingArgs := tx.(*IOTRegistryTX.RegisterThingTX)
+	var err error
+	registerThingArgs.RegistrantPubkey, err = normalizePubkey("RegistrantPubkey", registerThingArgs.RegistrantPubkey)
+	if err != nil {
+		return err
+	}
+	if len(registerThingArgs.Nonce) == 0 {
+		return invalidArgument("Nonce", "length of Nonce (%s) is zero", registerThingArgs.Nonce)
+	}
+	if len(registerThingArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", registerThingArgs.Signature)
+	}
+	err = validateContent(registerThingArgs.Content, registerThingArgs.Data)
+	if err != nil {
+		return err
+	}
+	err = validatePrivateData(registerThingArgs.PrivateData)
+	if err != nil {
+		return err
+	}
+	err = validateDevicePubkey(registerThingArgs)
+	if err != nil {
+		return err
+	}
+	return validateAliases(registerThingArgs)
+}
 
-		//check if spec already exists
-		specNameCheckBytes, err := stub.GetState("Spec:" + specArgs.SpecName)
+/*
+	checks that the untyped aliases of a thing can be used as key components.
+	Typed aliases are checked by their normalizers.
+*/
+func validateAliases(registerThingArgs *IOTRegistryTX.RegisterThingTX) error {
+	for _, identity := range registerThingArgs.Aliases {
+		err := validateKeyComponent("Aliases", identity)
 		if err != nil {
-			fmt.Printf("Could not get Spec State\n")
-			return nil, fmt.Errorf("Could not get Spec State\n")
+			return err
 		}
+	}
+	return nil
+}
 
-		//if spec already exists
-		if len(specNameCheckBytes) != 0 {
-			fmt.Printf("SpecName (%s) is unavailable\n", specArgs.SpecName)
-			return nil, fmt.Errorf("SpecName (%s) is unavailable\n", specArgs.SpecName)
-		}
+func (registerThingHandler) authorize(stub Stub, tx proto.Message) error {
+	registerThingArgs := tx.(*IOTRegistryTX.RegisterThingTX)
+	//check if owner is valid id (name exists in registry)
+	ownerPubKeyBytes, err := getRegistrantPubkey(stub, registerThingArgs.RegistrantPubkey)
+	if err != nil {
+		return err
+	}
+	return verify(stub, ownerPubKeyBytes, registerThingArgs.Signature, client.SignedMessage(registerThingArgs, client.RegisterThingMessage(registerThingArgs)), "Signature")
+}
 
-		//check if registrant is valid id (pubkey exists in registry)
-		checkIDBytes, err := stub.GetState("RegistrantPubkey:" + specArgs.RegistrantPubkey)
-		if err != nil {
-			fmt.Printf("Failed to look up RegistrantPubkey\n")
-			return nil, fmt.Errorf("Failed to look up RegistrantPubkey (%s)\n", specArgs.RegistrantPubkey)
-		}
+func (registerThingHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	registerThingArgs := tx.(*IOTRegistryTX.RegisterThingTX)
+	//check that the nonce and aliases are available
+	typedAliases, err := checkThingAvailable(stub, registerThingArgs, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+	return nil, putRegisteredThing(stub, registerThingArgs, typedAliases)
+}
 
-		//if registrant does not exist
-		if len(checkIDBytes) == 0 {
-			fmt.Printf("RegistrantPubkey is not registered\n")
-			return nil, fmt.Errorf("RegistrantPubkey is not registered %s\n", specArgs.RegistrantPubkey)
-		}
+/*
+	registerSpec puts a "Spec:<SpecName>" state to the ledger, indexed by the spec name.
+	Like a thing, a spec carries either inline Data or a ContentRef to off-chain data (see content.go).
+	TX struct: 		RegisterSpecTX
+	Store structs: 	Spec
+*/
+type registerSpecHandler struct{ txType }
 
-		ownerPubKeyBytes, err := hex.DecodeString(specArgs.RegistrantPubkey)
-		if err != nil {
-			return nil, fmt.Errorf("Error decoding registrantPubkey: %s", err.Error())
-		}
-		ownerSig := specArgs.Signature
+func (registerSpecHandler) validate(tx proto.Message) error {
+	specArgs := tx.(*IOTRegistryTX.RegisterSpecTX)
+	var err error
+	specArgs.RegistrantPubkey, err = normalizePubkey("RegistrantPubkey", specArgs.RegistrantPubkey)
+	if err != nil {
+		return err
+	}
+	err = validateKeyComponent("SpecName", specArgs.SpecName)
+	if err != nil {
+		return err
+	}
+	if len(specArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", specArgs.Signature)
+	}
+	return validateContent(specArgs.Content, specArgs.Data)
+}
 
-		//TODO review later
-		message := specArgs.SpecName + ":" + specArgs.RegistrantPubkey + ":" + specArgs.Data
-		err = verify(ownerPubKeyBytes, ownerSig, message)
-		if err != nil {
-			return nil, fmt.Errorf("Error verifying signature\n")
-		}
+func (registerSpecHandler) authorize(stub Stub, tx proto.Message) error {
+	specArgs := tx.(*IOTRegistryTX.RegisterSpecTX)
+	//check if registrant is valid id (pubkey exists in registry)
+	ownerPubKeyBytes, err := getRegistrantPubkey(stub, specArgs.RegistrantPubkey)
+	if err != nil {
+		return err
+	}
+	message := client.SignedMessage(specArgs, client.RegisterSpecMessage(specArgs.SpecName, specArgs.RegistrantPubkey, specArgs.Data, specArgs.Content))
+	return verify(stub, ownerPubKeyBytes, specArgs.Signature, message, "Signature")
+}
 
-		store := IOTRegistryStore.Spec{}
-		store.RegistrantPubkey = specArgs.RegistrantPubkey
-		store.Data = specArgs.Data
-		storeBytes, err := proto.Marshal(&store)
-		if err != nil {
-			fmt.Println(err)
-		}
-		err = stub.PutState("Spec:"+specArgs.SpecName, storeBytes)
-		if err != nil {
-			fmt.Printf(err.Error())
-			return nil, err
-		}
+func (registerSpecHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	specArgs := tx.(*IOTRegistryTX.RegisterSpecTX)
+
+	//check if spec already exists
+	key := specKey(specArgs.SpecName)
+	specNameCheckBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "Could not get Spec State")
+	}
+	if len(specNameCheckBytes) != 0 {
+		return nil, alreadyExists(key, "SpecName (%s) is unavailable", specArgs.SpecName)
+	}
+
+	store := IOTRegistryStore.Spec{}
+	store.RegistrantPubkey = specArgs.RegistrantPubkey
+	store.Data = specArgs.Data
+	store.Content = storedContent(specArgs.Content)
+	storeBytes, err := proto.Marshal(&store)
+	if err != nil {
+		return nil, internalError(key, "Error marshalling spec: (%v)", err.Error())
+	}
+	err = stub.PutState(key, storeBytes)
+	if err != nil {
+		return nil, internalError(key, "Error putting spec state: (%v)", err.Error())
 	}
 	return nil, nil
 }
@@ -367,119 +440,122 @@ func RegistrantToJSON(RegistrantName string, pubKey []byte) ([]byte, error) {
 }
 
 /*
-	Query is a mechanism for requesting information from the ledger. There are three query methods in this chaincode: owner, thing, and spec.
-	Each query will return data as a json formatted slice of bytes
+	An "owner" query requests information stored in the ledger about a particular owner.
+	If the owner is registered, the JSON will contain the owner's name and public key.
 */
-func (t *IOTRegistry) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	// fmt.Printf("function: %s\n", function)
-	switch function {
-	/*
-		An "owner" query requests information stored in the ledger about a particular owner.
-		If the owner is registered, the JSON will contain the owner's name and public key.
-	*/
-	case "owner":
-		if len(args) != 1 {
-			return nil, fmt.Errorf("No argument specified\n")
-		}
+func queryOwner(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, invalidArgument("args", "No argument specified")
+	}
 
-		owner := IOTRegistryStore.Registrant{}
+	owner := IOTRegistryStore.Registrant{}
 
-		RegistrantPubkey := args[0]
-		ownerBytes, err := stub.GetState("RegistrantPubkey:" + RegistrantPubkey)
-		if err != nil {
-			fmt.Printf(err.Error())
-			return nil, err
-		}
+	RegistrantPubkey, err := normalizePubkey("args", args[0])
+	if err != nil {
+		return nil, err
+	}
+	registrantKeyName := registrantKey(RegistrantPubkey)
+	ownerBytes, err := stub.GetState(registrantKeyName)
+	if err != nil {
+		return nil, internalError(registrantKeyName, "%s", err.Error())
+	}
 
-		if len(ownerBytes) == 0 {
-			return nil, fmt.Errorf("RegistrantPubkey (%s) does not exist\n", RegistrantPubkey)
-		}
-		err = proto.Unmarshal(ownerBytes, &owner)
-		if err != nil {
-			fmt.Printf(err.Error())
-			return nil, err
-		}
-		jsonBytes, err := RegistrantToJSON(owner.RegistrantName, owner.RegistrantPubkey)
-		fmt.Printf("\n\n\nJSONBYTES from query: (%s)\n\n", string(jsonBytes))
-		return jsonBytes, err
-		/*
-			A "thing" query requests information stored in the ledger about a particular thing.
-			Things are indexed by a Nonce, which should be a valid hex string.
-			If the thing is registered, the JSON will contain the owner's list of aliases, owner name, an arbitrary string of data, and a spec name.
-		*/
-	case "thing":
-		if len(args) != 1 {
-			return nil, fmt.Errorf("No argument specified\n")
-		}
-		alias := IOTRegistryStore.Alias{}
-		thingAlias := args[0]
-		aliasBytes, err := stub.GetState("Alias:" + thingAlias)
+	if len(ownerBytes) == 0 {
+		return nil, notFound(registrantKeyName, "RegistrantPubkey (%s) does not exist", RegistrantPubkey)
+	}
+	err = proto.Unmarshal(ownerBytes, &owner)
+	if err != nil {
+		return nil, internalError(registrantKeyName, "%s", err.Error())
+	}
+	return RegistrantToJSON(owner.RegistrantName, owner.RegistrantPubkey)
+}
+
+/*
+	A "thing" query requests information stored in the ledger about a particular thing.
+	Things are indexed by a Nonce, which should be a valid hex string.
+	The thing is looked up by one of its aliases, either a legacy alias or a typed "type:value" alias.
+	An optional second argument gives the RegistrantPubkey that a scoped typed alias belongs to.
+	If the thing is registered, the JSON will contain the owner's list of aliases, owner name, an arbitrary string of data, a spec name,
+	and its lifecycle Status with the StatusReason and StatusTimestamp of the last status change.
+*/
+func queryThing(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, invalidArgument("args", "No argument specified")
+	}
+	alias := IOTRegistryStore.Alias{}
+	thingAlias := args[0]
+	scope := ""
+	err := validateKeyComponent("args", thingAlias)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 2 {
+		scope, err = normalizePubkey("args", args[1])
 		if err != nil {
-			fmt.Printf(err.Error())
 			return nil, err
 		}
+	}
+	aliasBytes, err := getAliasState(stub, thingAlias, scope)
+	if err != nil {
+		return nil, err
+	}
 
-		if len(aliasBytes) == 0 {
-			return nil, fmt.Errorf("Thing (%s) does not exist\n", thingAlias)
-		}
+	if len(aliasBytes) == 0 {
+		return nil, notFound("", "Thing (%s) does not exist", thingAlias)
+	}
 
-		err = proto.Unmarshal(aliasBytes, &alias)
+	err = proto.Unmarshal(aliasBytes, &alias)
 
-		if err != nil {
-			fmt.Printf(err.Error())
-			return nil, err
-		}
-		thingNonce := hex.EncodeToString(alias.Nonce)
+	if err != nil {
+		return nil, internalError("", "%s", err.Error())
+	}
+	thingNonce := hex.EncodeToString(alias.Nonce)
 
-		thing := IOTRegistryStore.Thing{}
-		thingBytes, err := stub.GetState("Thing:" + thingNonce)
-		if err != nil {
-			fmt.Printf(err.Error())
-			return nil, err
-		}
+	thing := IOTRegistryStore.Thing{}
+	key := thingKey(thingNonce)
+	thingBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "%s", err.Error())
+	}
 
-		if len(thingBytes) == 0 {
-			return nil, fmt.Errorf("Thing (%s) does not exist\n", thingAlias)
-		}
-		err = proto.Unmarshal(thingBytes, &thing)
-
-		return json.Marshal(thing)
-		/*
-			A "spec" query requests information stored in the ledger about a particular specification.
-			Specs are indexed by a SpecName, which is a string.
-			If the spec is registered, the JSON will contain the owner's name and a string of data.
-		*/
-	case "spec":
-		if len(args) != 1 {
-			return nil, fmt.Errorf("no argument specified\n")
-		}
+	if len(thingBytes) == 0 {
+		return nil, notFound(key, "Thing (%s) does not exist", thingAlias)
+	}
+	err = proto.Unmarshal(thingBytes, &thing)
 
-		spec := IOTRegistryStore.Spec{}
-		specName := args[0]
+	return json.Marshal(thing)
+}
 
-		specBytes, err := stub.GetState("Spec:" + specName)
-		if err != nil {
-			fmt.Printf(err.Error())
-			return nil, err
-		}
+/*
+	A "spec" query requests information stored in the ledger about a particular specification.
+	Specs are indexed by a SpecName, which is a string.
+	If the spec is registered, the JSON will contain the owner's name and a string of data.
+*/
+func querySpec(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, invalidArgument("args", "no argument specified")
+	}
 
-		if len(specBytes) == 0 {
-			return nil, fmt.Errorf("spec (%s) does not exist\n", specName)
-		}
+	spec := IOTRegistryStore.Spec{}
+	specName := args[0]
+	err := validateKeyComponent("args", specName)
+	if err != nil {
+		return nil, err
+	}
+	key := specKey(specName)
 
-		err = proto.Unmarshal(specBytes, &spec)
-		if err != nil {
-			fmt.Printf(err.Error())
-			return nil, err
-		}
-		return json.Marshal(spec)
+	specBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "%s", err.Error())
+	}
+
+	if len(specBytes) == 0 {
+		return nil, notFound(key, "spec (%s) does not exist", specName)
 	}
-	return nil, nil
-}
 
-func main() {
-	err := shim.Start(new(IOTRegistry))
+	err = proto.Unmarshal(specBytes, &spec)
 	if err != nil {
-		fmt.Printf("Error starting chaincode: %s\n", err)
+		return nil, internalError(key, "%s", err.Error())
 	}
+	return json.Marshal(spec)
 }
@@ -13,6 +13,16 @@ It has these top-level messages:
 	Alias
 	Thing
 	Spec
+	ContentRef
+	TypedAlias
+	Group
+	EncryptedData
+	WrappedKey
+	Credential
+	FirmwareRelease
+	FirmwareReport
+	Manifest
+	StatusDelegate
 */
 package IOTRegistryStore
 
@@ -28,6 +38,7 @@ var _ = math.Inf
 type Registrant struct {
 	RegistrantName   string `protobuf:"bytes,1,opt,name=RegistrantName" json:"RegistrantName,omitempty"`
 	RegistrantPubkey []byte `protobuf:"bytes,3,opt,name=RegistrantPubkey,proto3" json:"RegistrantPubkey,omitempty"`
+	AliasSalt        []byte `protobuf:"bytes,4,opt,name=AliasSalt,proto3" json:"AliasSalt,omitempty"`
 }
 
 func (m *Registrant) Reset()         { *m = Registrant{} }
@@ -43,21 +54,196 @@ func (m *Alias) String() string { return proto.CompactTextString(m) }
 func (*Alias) ProtoMessage()    {}
 
 type Thing struct {
-	Aliases          []string `protobuf:"bytes,1,rep,name=Aliases" json:"Aliases,omitempty"`
-	RegistrantPubkey string   `protobuf:"bytes,2,opt,name=RegistrantPubkey" json:"RegistrantPubkey,omitempty"`
-	Data             string   `protobuf:"bytes,3,opt,name=Data" json:"Data,omitempty"`
-	SpecName         string   `protobuf:"bytes,4,opt,name=SpecName" json:"SpecName,omitempty"`
+	Aliases            []string       `protobuf:"bytes,1,rep,name=Aliases" json:"Aliases,omitempty"`
+	RegistrantPubkey   string         `protobuf:"bytes,2,opt,name=RegistrantPubkey" json:"RegistrantPubkey,omitempty"`
+	Data               string         `protobuf:"bytes,3,opt,name=Data" json:"Data,omitempty"`
+	SpecName           string         `protobuf:"bytes,4,opt,name=SpecName" json:"SpecName,omitempty"`
+	TypedAliases       []*TypedAlias  `protobuf:"bytes,5,rep,name=TypedAliases" json:"TypedAliases,omitempty"`
+	ParentNonce        string         `protobuf:"bytes,6,opt,name=ParentNonce" json:"ParentNonce,omitempty"`
+	Status             string         `protobuf:"bytes,7,opt,name=Status" json:"Status,omitempty"`
+	StatusReason       string         `protobuf:"bytes,8,opt,name=StatusReason" json:"StatusReason,omitempty"`
+	StatusTimestamp    int64          `protobuf:"varint,9,opt,name=StatusTimestamp" json:"StatusTimestamp,omitempty"`
+	Content            *ContentRef    `protobuf:"bytes,10,opt,name=Content" json:"Content,omitempty"`
+	PrivateData        *EncryptedData `protobuf:"bytes,11,opt,name=PrivateData" json:"PrivateData,omitempty"`
+	DevicePubkey       string         `protobuf:"bytes,12,opt,name=DevicePubkey" json:"DevicePubkey,omitempty"`
+	FirmwareVersion    string         `protobuf:"bytes,13,opt,name=FirmwareVersion" json:"FirmwareVersion,omitempty"`
+	FirmwareTimestamp  int64          `protobuf:"varint,14,opt,name=FirmwareTimestamp" json:"FirmwareTimestamp,omitempty"`
+	FirmwareReports    int64          `protobuf:"varint,15,opt,name=FirmwareReports" json:"FirmwareReports,omitempty"`
+	LinkSequence       int64          `protobuf:"varint,16,opt,name=LinkSequence" json:"LinkSequence,omitempty"`
+	StatusSequence     int64          `protobuf:"varint,17,opt,name=StatusSequence" json:"StatusSequence,omitempty"`
+	PrivateDataVersion int64          `protobuf:"varint,18,opt,name=PrivateDataVersion" json:"PrivateDataVersion,omitempty"`
+	FirmwareCounter    int64          `protobuf:"varint,19,opt,name=FirmwareCounter" json:"FirmwareCounter,omitempty"`
 }
 
 func (m *Thing) Reset()         { *m = Thing{} }
 func (m *Thing) String() string { return proto.CompactTextString(m) }
 func (*Thing) ProtoMessage()    {}
 
+func (m *Thing) GetTypedAliases() []*TypedAlias {
+	if m != nil {
+		return m.TypedAliases
+	}
+	return nil
+}
+
+func (m *Thing) GetContent() *ContentRef {
+	if m != nil {
+		return m.Content
+	}
+	return nil
+}
+
+func (m *Thing) GetPrivateData() *EncryptedData {
+	if m != nil {
+		return m.PrivateData
+	}
+	return nil
+}
+
 type Spec struct {
-	RegistrantPubkey string `protobuf:"bytes,2,opt,name=RegistrantPubkey" json:"RegistrantPubkey,omitempty"`
-	Data             string `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+	RegistrantPubkey string      `protobuf:"bytes,2,opt,name=RegistrantPubkey" json:"RegistrantPubkey,omitempty"`
+	Data             string      `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+	Content          *ContentRef `protobuf:"bytes,3,opt,name=Content" json:"Content,omitempty"`
 }
 
 func (m *Spec) Reset()         { *m = Spec{} }
 func (m *Spec) String() string { return proto.CompactTextString(m) }
 func (*Spec) ProtoMessage()    {}
+
+func (m *Spec) GetContent() *ContentRef {
+	if m != nil {
+		return m.Content
+	}
+	return nil
+}
+
+type ContentRef struct {
+	URI       string `protobuf:"bytes,1,opt,name=URI" json:"URI,omitempty"`
+	Hash      string `protobuf:"bytes,2,opt,name=Hash" json:"Hash,omitempty"`
+	Size      int64  `protobuf:"varint,3,opt,name=Size" json:"Size,omitempty"`
+	MediaType string `protobuf:"bytes,4,opt,name=MediaType" json:"MediaType,omitempty"`
+}
+
+func (m *ContentRef) Reset()         { *m = ContentRef{} }
+func (m *ContentRef) String() string { return proto.CompactTextString(m) }
+func (*ContentRef) ProtoMessage()    {}
+
+type TypedAlias struct {
+	Type  string `protobuf:"bytes,1,opt,name=Type" json:"Type,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=Value" json:"Value,omitempty"`
+	Scope string `protobuf:"bytes,3,opt,name=Scope" json:"Scope,omitempty"`
+}
+
+func (m *TypedAlias) Reset()         { *m = TypedAlias{} }
+func (m *TypedAlias) String() string { return proto.CompactTextString(m) }
+func (*TypedAlias) ProtoMessage()    {}
+
+type Group struct {
+	RegistrantPubkey string `protobuf:"bytes,1,opt,name=RegistrantPubkey" json:"RegistrantPubkey,omitempty"`
+	Data             string `protobuf:"bytes,2,opt,name=Data" json:"Data,omitempty"`
+	Version          int64  `protobuf:"varint,3,opt,name=Version" json:"Version,omitempty"`
+}
+
+func (m *Group) Reset()         { *m = Group{} }
+func (m *Group) String() string { return proto.CompactTextString(m) }
+func (*Group) ProtoMessage()    {}
+
+type EncryptedData struct {
+	Algorithm  string        `protobuf:"bytes,1,opt,name=Algorithm" json:"Algorithm,omitempty"`
+	Ciphertext []byte        `protobuf:"bytes,2,opt,name=Ciphertext,proto3" json:"Ciphertext,omitempty"`
+	Readers    []*WrappedKey `protobuf:"bytes,3,rep,name=Readers" json:"Readers,omitempty"`
+}
+
+func (m *EncryptedData) Reset()         { *m = EncryptedData{} }
+func (m *EncryptedData) String() string { return proto.CompactTextString(m) }
+func (*EncryptedData) ProtoMessage()    {}
+
+func (m *EncryptedData) GetReaders() []*WrappedKey {
+	if m != nil {
+		return m.Readers
+	}
+	return nil
+}
+
+type WrappedKey struct {
+	ReaderPubkey string `protobuf:"bytes,1,opt,name=ReaderPubkey" json:"ReaderPubkey,omitempty"`
+	Key          []byte `protobuf:"bytes,2,opt,name=Key,proto3" json:"Key,omitempty"`
+}
+
+func (m *WrappedKey) Reset()         { *m = WrappedKey{} }
+func (m *WrappedKey) String() string { return proto.CompactTextString(m) }
+func (*WrappedKey) ProtoMessage()    {}
+
+type Credential struct {
+	IssuerPubkey     string `protobuf:"bytes,1,opt,name=IssuerPubkey" json:"IssuerPubkey,omitempty"`
+	SubjectNonce     []byte `protobuf:"bytes,2,opt,name=SubjectNonce,proto3" json:"SubjectNonce,omitempty"`
+	SpecName         string `protobuf:"bytes,3,opt,name=SpecName" json:"SpecName,omitempty"`
+	CredentialHash   []byte `protobuf:"bytes,4,opt,name=CredentialHash,proto3" json:"CredentialHash,omitempty"`
+	IssuedTimestamp  int64  `protobuf:"varint,5,opt,name=IssuedTimestamp" json:"IssuedTimestamp,omitempty"`
+	Revoked          bool   `protobuf:"varint,6,opt,name=Revoked" json:"Revoked,omitempty"`
+	RevocationReason string `protobuf:"bytes,7,opt,name=RevocationReason" json:"RevocationReason,omitempty"`
+	RevokedTimestamp int64  `protobuf:"varint,8,opt,name=RevokedTimestamp" json:"RevokedTimestamp,omitempty"`
+}
+
+func (m *Credential) Reset()         { *m = Credential{} }
+func (m *Credential) String() string { return proto.CompactTextString(m) }
+func (*Credential) ProtoMessage()    {}
+
+type FirmwareRelease struct {
+	SpecName           string      `protobuf:"bytes,1,opt,name=SpecName" json:"SpecName,omitempty"`
+	Version            string      `protobuf:"bytes,2,opt,name=Version" json:"Version,omitempty"`
+	ImageHash          string      `protobuf:"bytes,3,opt,name=ImageHash" json:"ImageHash,omitempty"`
+	SigningKey         string      `protobuf:"bytes,4,opt,name=SigningKey" json:"SigningKey,omitempty"`
+	ReleaseNotes       *ContentRef `protobuf:"bytes,5,opt,name=ReleaseNotes" json:"ReleaseNotes,omitempty"`
+	PublishedTimestamp int64       `protobuf:"varint,6,opt,name=PublishedTimestamp" json:"PublishedTimestamp,omitempty"`
+	Vulnerable         bool        `protobuf:"varint,7,opt,name=Vulnerable" json:"Vulnerable,omitempty"`
+	Advisory           string      `protobuf:"bytes,8,opt,name=Advisory" json:"Advisory,omitempty"`
+	FlaggedTimestamp   int64       `protobuf:"varint,9,opt,name=FlaggedTimestamp" json:"FlaggedTimestamp,omitempty"`
+}
+
+func (m *FirmwareRelease) Reset()         { *m = FirmwareRelease{} }
+func (m *FirmwareRelease) String() string { return proto.CompactTextString(m) }
+func (*FirmwareRelease) ProtoMessage()    {}
+
+func (m *FirmwareRelease) GetReleaseNotes() *ContentRef {
+	if m != nil {
+		return m.ReleaseNotes
+	}
+	return nil
+}
+
+type FirmwareReport struct {
+	Version        string `protobuf:"bytes,1,opt,name=Version" json:"Version,omitempty"`
+	ReporterPubkey string `protobuf:"bytes,2,opt,name=ReporterPubkey" json:"ReporterPubkey,omitempty"`
+	Timestamp      int64  `protobuf:"varint,3,opt,name=Timestamp" json:"Timestamp,omitempty"`
+	Counter        int64  `protobuf:"varint,4,opt,name=Counter" json:"Counter,omitempty"`
+}
+
+func (m *FirmwareReport) Reset()         { *m = FirmwareReport{} }
+func (m *FirmwareReport) String() string { return proto.CompactTextString(m) }
+func (*FirmwareReport) ProtoMessage()    {}
+
+type Manifest struct {
+	SpecName        string `protobuf:"bytes,1,opt,name=SpecName" json:"SpecName,omitempty"`
+	SequenceNumber  int64  `protobuf:"varint,2,opt,name=SequenceNumber" json:"SequenceNumber,omitempty"`
+	Manifest        []byte `protobuf:"bytes,3,opt,name=Manifest,proto3" json:"Manifest,omitempty"`
+	Signature       []byte `protobuf:"bytes,4,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	SignerPubkey    string `protobuf:"bytes,5,opt,name=SignerPubkey" json:"SignerPubkey,omitempty"`
+	IssuedTimestamp int64  `protobuf:"varint,6,opt,name=IssuedTimestamp" json:"IssuedTimestamp,omitempty"`
+	NotBefore       int64  `protobuf:"varint,7,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter        int64  `protobuf:"varint,8,opt,name=NotAfter" json:"NotAfter,omitempty"`
+}
+
+func (m *Manifest) Reset()         { *m = Manifest{} }
+func (m *Manifest) String() string { return proto.CompactTextString(m) }
+func (*Manifest) ProtoMessage()    {}
+
+type StatusDelegate struct {
+	DelegatePubkey string `protobuf:"bytes,1,opt,name=DelegatePubkey" json:"DelegatePubkey,omitempty"`
+	Sequence       int64  `protobuf:"varint,2,opt,name=Sequence" json:"Sequence,omitempty"`
+	Revoked        bool   `protobuf:"varint,3,opt,name=Revoked" json:"Revoked,omitempty"`
+}
+
+func (m *StatusDelegate) Reset()         { *m = StatusDelegate{} }
+func (m *StatusDelegate) String() string { return proto.CompactTextString(m) }
+func (*StatusDelegate) ProtoMessage()    {}
@@ -6,12 +6,40 @@
 Package IOTRegistry is a generated protocol buffer package.
 
 It is generated from these files:
+
 	IOTRegistry.proto
 
 It has these top-level messages:
+
 	RegisterThingTX
 	CreateRegistrantTX
 	RegisterSpecTX
+	ContentRef
+	TypedAlias
+	AttachThingTX
+	DetachThingTX
+	CreateGroupTX
+	GroupMembersTX
+	DeleteGroupTX
+	RegisterThingsBatchTX
+	SetThingStatusTX
+	StatusDelegateTX
+	MigrateKeysTX
+	EncryptedData
+	WrappedKey
+	SetPrivateDataTX
+	PrivateDataReaderTX
+	IssueCredentialTX
+	RevokeCredentialTX
+	ImportSnapshotTX
+	RepairTX
+	PublishFirmwareTX
+	FlagFirmwareTX
+	ReportFirmwareTX
+	UpdateManifest
+	ManifestDependency
+	ManifestCondition
+	IssueManifestTX
 */
 package IOTRegistry
 
@@ -25,23 +53,53 @@ var _ = fmt.Errorf
 var _ = math.Inf
 
 type RegisterThingTX struct {
-	Nonce            []byte   `protobuf:"bytes,1,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
-	Aliases          []string `protobuf:"bytes,2,rep,name=Aliases" json:"Aliases,omitempty"`
-	RegistrantPubkey string   `protobuf:"bytes,3,opt,name=RegistrantPubkey" json:"RegistrantPubkey,omitempty"`
-	Signature        []byte   `protobuf:"bytes,4,opt,name=Signature,proto3" json:"Signature,omitempty"`
-	Data             string   `protobuf:"bytes,5,opt,name=Data" json:"Data,omitempty"`
-	Spec             string   `protobuf:"bytes,6,opt,name=Spec" json:"Spec,omitempty"`
+	Nonce            []byte         `protobuf:"bytes,1,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	Aliases          []string       `protobuf:"bytes,2,rep,name=Aliases" json:"Aliases,omitempty"`
+	RegistrantPubkey string         `protobuf:"bytes,3,opt,name=RegistrantPubkey" json:"RegistrantPubkey,omitempty"`
+	Signature        []byte         `protobuf:"bytes,4,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	Data             string         `protobuf:"bytes,5,opt,name=Data" json:"Data,omitempty"`
+	Spec             string         `protobuf:"bytes,6,opt,name=Spec" json:"Spec,omitempty"`
+	TypedAliases     []*TypedAlias  `protobuf:"bytes,7,rep,name=TypedAliases" json:"TypedAliases,omitempty"`
+	NotBefore        int64          `protobuf:"varint,8,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter         int64          `protobuf:"varint,9,opt,name=NotAfter" json:"NotAfter,omitempty"`
+	Content          *ContentRef    `protobuf:"bytes,10,opt,name=Content" json:"Content,omitempty"`
+	PrivateData      *EncryptedData `protobuf:"bytes,11,opt,name=PrivateData" json:"PrivateData,omitempty"`
+	DevicePubkey     string         `protobuf:"bytes,12,opt,name=DevicePubkey" json:"DevicePubkey,omitempty"`
 }
 
 func (m *RegisterThingTX) Reset()         { *m = RegisterThingTX{} }
 func (m *RegisterThingTX) String() string { return proto.CompactTextString(m) }
 func (*RegisterThingTX) ProtoMessage()    {}
 
+func (m *RegisterThingTX) GetTypedAliases() []*TypedAlias {
+	if m != nil {
+		return m.TypedAliases
+	}
+	return nil
+}
+
+func (m *RegisterThingTX) GetContent() *ContentRef {
+	if m != nil {
+		return m.Content
+	}
+	return nil
+}
+
+func (m *RegisterThingTX) GetPrivateData() *EncryptedData {
+	if m != nil {
+		return m.PrivateData
+	}
+	return nil
+}
+
 type CreateRegistrantTX struct {
 	RegistrantName   string `protobuf:"bytes,1,opt,name=RegistrantName" json:"RegistrantName,omitempty"`
 	RegistrantPubkey []byte `protobuf:"bytes,2,opt,name=RegistrantPubkey,proto3" json:"RegistrantPubkey,omitempty"`
 	Signature        []byte `protobuf:"bytes,4,opt,name=Signature,proto3" json:"Signature,omitempty"`
 	Data             string `protobuf:"bytes,3,opt,name=Data" json:"Data,omitempty"`
+	NotBefore        int64  `protobuf:"varint,5,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter         int64  `protobuf:"varint,6,opt,name=NotAfter" json:"NotAfter,omitempty"`
+	AliasSalt        []byte `protobuf:"bytes,7,opt,name=AliasSalt,proto3" json:"AliasSalt,omitempty"`
 }
 
 func (m *CreateRegistrantTX) Reset()         { *m = CreateRegistrantTX{} }
@@ -49,12 +107,384 @@ func (m *CreateRegistrantTX) String() string { return proto.CompactTextString(m)
 func (*CreateRegistrantTX) ProtoMessage()    {}
 
 type RegisterSpecTX struct {
-	SpecName         string `protobuf:"bytes,1,opt,name=SpecName" json:"SpecName,omitempty"`
-	RegistrantPubkey string `protobuf:"bytes,2,opt,name=RegistrantPubkey" json:"RegistrantPubkey,omitempty"`
-	Signature        []byte `protobuf:"bytes,3,opt,name=Signature,proto3" json:"Signature,omitempty"`
-	Data             string `protobuf:"bytes,4,opt,name=Data" json:"Data,omitempty"`
+	SpecName         string      `protobuf:"bytes,1,opt,name=SpecName" json:"SpecName,omitempty"`
+	RegistrantPubkey string      `protobuf:"bytes,2,opt,name=RegistrantPubkey" json:"RegistrantPubkey,omitempty"`
+	Signature        []byte      `protobuf:"bytes,3,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	Data             string      `protobuf:"bytes,4,opt,name=Data" json:"Data,omitempty"`
+	NotBefore        int64       `protobuf:"varint,5,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter         int64       `protobuf:"varint,6,opt,name=NotAfter" json:"NotAfter,omitempty"`
+	Content          *ContentRef `protobuf:"bytes,7,opt,name=Content" json:"Content,omitempty"`
 }
 
 func (m *RegisterSpecTX) Reset()         { *m = RegisterSpecTX{} }
 func (m *RegisterSpecTX) String() string { return proto.CompactTextString(m) }
 func (*RegisterSpecTX) ProtoMessage()    {}
+
+func (m *RegisterSpecTX) GetContent() *ContentRef {
+	if m != nil {
+		return m.Content
+	}
+	return nil
+}
+
+type ContentRef struct {
+	URI       string `protobuf:"bytes,1,opt,name=URI" json:"URI,omitempty"`
+	Hash      string `protobuf:"bytes,2,opt,name=Hash" json:"Hash,omitempty"`
+	Size      int64  `protobuf:"varint,3,opt,name=Size" json:"Size,omitempty"`
+	MediaType string `protobuf:"bytes,4,opt,name=MediaType" json:"MediaType,omitempty"`
+}
+
+func (m *ContentRef) Reset()         { *m = ContentRef{} }
+func (m *ContentRef) String() string { return proto.CompactTextString(m) }
+func (*ContentRef) ProtoMessage()    {}
+
+type TypedAlias struct {
+	Type   string `protobuf:"bytes,1,opt,name=Type" json:"Type,omitempty"`
+	Value  string `protobuf:"bytes,2,opt,name=Value" json:"Value,omitempty"`
+	Scoped bool   `protobuf:"varint,3,opt,name=Scoped" json:"Scoped,omitempty"`
+}
+
+func (m *TypedAlias) Reset()         { *m = TypedAlias{} }
+func (m *TypedAlias) String() string { return proto.CompactTextString(m) }
+func (*TypedAlias) ProtoMessage()    {}
+
+type AttachThingTX struct {
+	ParentNonce     []byte `protobuf:"bytes,1,opt,name=ParentNonce,proto3" json:"ParentNonce,omitempty"`
+	ChildNonce      []byte `protobuf:"bytes,2,opt,name=ChildNonce,proto3" json:"ChildNonce,omitempty"`
+	ParentSignature []byte `protobuf:"bytes,3,opt,name=ParentSignature,proto3" json:"ParentSignature,omitempty"`
+	ChildSignature  []byte `protobuf:"bytes,4,opt,name=ChildSignature,proto3" json:"ChildSignature,omitempty"`
+	NotBefore       int64  `protobuf:"varint,5,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter        int64  `protobuf:"varint,6,opt,name=NotAfter" json:"NotAfter,omitempty"`
+	LinkSequence    int64  `protobuf:"varint,7,opt,name=LinkSequence" json:"LinkSequence,omitempty"`
+}
+
+func (m *AttachThingTX) Reset()         { *m = AttachThingTX{} }
+func (m *AttachThingTX) String() string { return proto.CompactTextString(m) }
+func (*AttachThingTX) ProtoMessage()    {}
+
+type DetachThingTX struct {
+	ChildNonce      []byte `protobuf:"bytes,1,opt,name=ChildNonce,proto3" json:"ChildNonce,omitempty"`
+	ParentSignature []byte `protobuf:"bytes,2,opt,name=ParentSignature,proto3" json:"ParentSignature,omitempty"`
+	ChildSignature  []byte `protobuf:"bytes,3,opt,name=ChildSignature,proto3" json:"ChildSignature,omitempty"`
+	NotBefore       int64  `protobuf:"varint,4,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter        int64  `protobuf:"varint,5,opt,name=NotAfter" json:"NotAfter,omitempty"`
+	LinkSequence    int64  `protobuf:"varint,6,opt,name=LinkSequence" json:"LinkSequence,omitempty"`
+}
+
+func (m *DetachThingTX) Reset()         { *m = DetachThingTX{} }
+func (m *DetachThingTX) String() string { return proto.CompactTextString(m) }
+func (*DetachThingTX) ProtoMessage()    {}
+
+type CreateGroupTX struct {
+	GroupName        string `protobuf:"bytes,1,opt,name=GroupName" json:"GroupName,omitempty"`
+	RegistrantPubkey string `protobuf:"bytes,2,opt,name=RegistrantPubkey" json:"RegistrantPubkey,omitempty"`
+	Signature        []byte `protobuf:"bytes,3,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	Data             string `protobuf:"bytes,4,opt,name=Data" json:"Data,omitempty"`
+	NotBefore        int64  `protobuf:"varint,5,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter         int64  `protobuf:"varint,6,opt,name=NotAfter" json:"NotAfter,omitempty"`
+}
+
+func (m *CreateGroupTX) Reset()         { *m = CreateGroupTX{} }
+func (m *CreateGroupTX) String() string { return proto.CompactTextString(m) }
+func (*CreateGroupTX) ProtoMessage()    {}
+
+type GroupMembersTX struct {
+	GroupName string   `protobuf:"bytes,1,opt,name=GroupName" json:"GroupName,omitempty"`
+	Nonces    [][]byte `protobuf:"bytes,2,rep,name=Nonces,proto3" json:"Nonces,omitempty"`
+	Signature []byte   `protobuf:"bytes,3,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore int64    `protobuf:"varint,4,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter  int64    `protobuf:"varint,5,opt,name=NotAfter" json:"NotAfter,omitempty"`
+	Version   int64    `protobuf:"varint,6,opt,name=Version" json:"Version,omitempty"`
+}
+
+func (m *GroupMembersTX) Reset()         { *m = GroupMembersTX{} }
+func (m *GroupMembersTX) String() string { return proto.CompactTextString(m) }
+func (*GroupMembersTX) ProtoMessage()    {}
+
+type DeleteGroupTX struct {
+	GroupName string `protobuf:"bytes,1,opt,name=GroupName" json:"GroupName,omitempty"`
+	Signature []byte `protobuf:"bytes,2,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore int64  `protobuf:"varint,3,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter  int64  `protobuf:"varint,4,opt,name=NotAfter" json:"NotAfter,omitempty"`
+	Version   int64  `protobuf:"varint,5,opt,name=Version" json:"Version,omitempty"`
+}
+
+func (m *DeleteGroupTX) Reset()         { *m = DeleteGroupTX{} }
+func (m *DeleteGroupTX) String() string { return proto.CompactTextString(m) }
+func (*DeleteGroupTX) ProtoMessage()    {}
+
+type RegisterThingsBatchTX struct {
+	RegistrantPubkey string             `protobuf:"bytes,1,opt,name=RegistrantPubkey" json:"RegistrantPubkey,omitempty"`
+	Things           []*RegisterThingTX `protobuf:"bytes,2,rep,name=Things" json:"Things,omitempty"`
+	Signature        []byte             `protobuf:"bytes,3,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore        int64              `protobuf:"varint,4,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter         int64              `protobuf:"varint,5,opt,name=NotAfter" json:"NotAfter,omitempty"`
+}
+
+func (m *RegisterThingsBatchTX) Reset()         { *m = RegisterThingsBatchTX{} }
+func (m *RegisterThingsBatchTX) String() string { return proto.CompactTextString(m) }
+func (*RegisterThingsBatchTX) ProtoMessage()    {}
+
+func (m *RegisterThingsBatchTX) GetThings() []*RegisterThingTX {
+	if m != nil {
+		return m.Things
+	}
+	return nil
+}
+
+type SetThingStatusTX struct {
+	Nonce          []byte `protobuf:"bytes,1,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	Status         string `protobuf:"bytes,2,opt,name=Status" json:"Status,omitempty"`
+	Reason         string `protobuf:"bytes,3,opt,name=Reason" json:"Reason,omitempty"`
+	SignerPubkey   string `protobuf:"bytes,4,opt,name=SignerPubkey" json:"SignerPubkey,omitempty"`
+	Signature      []byte `protobuf:"bytes,5,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore      int64  `protobuf:"varint,6,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter       int64  `protobuf:"varint,7,opt,name=NotAfter" json:"NotAfter,omitempty"`
+	StatusSequence int64  `protobuf:"varint,8,opt,name=StatusSequence" json:"StatusSequence,omitempty"`
+}
+
+func (m *SetThingStatusTX) Reset()         { *m = SetThingStatusTX{} }
+func (m *SetThingStatusTX) String() string { return proto.CompactTextString(m) }
+func (*SetThingStatusTX) ProtoMessage()    {}
+
+type StatusDelegateTX struct {
+	RegistrantPubkey string `protobuf:"bytes,1,opt,name=RegistrantPubkey" json:"RegistrantPubkey,omitempty"`
+	DelegatePubkey   string `protobuf:"bytes,2,opt,name=DelegatePubkey" json:"DelegatePubkey,omitempty"`
+	Revoke           bool   `protobuf:"varint,3,opt,name=Revoke" json:"Revoke,omitempty"`
+	Signature        []byte `protobuf:"bytes,4,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore        int64  `protobuf:"varint,5,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter         int64  `protobuf:"varint,6,opt,name=NotAfter" json:"NotAfter,omitempty"`
+	Sequence         int64  `protobuf:"varint,7,opt,name=Sequence" json:"Sequence,omitempty"`
+}
+
+func (m *StatusDelegateTX) Reset()         { *m = StatusDelegateTX{} }
+func (m *StatusDelegateTX) String() string { return proto.CompactTextString(m) }
+func (*StatusDelegateTX) ProtoMessage()    {}
+
+type MigrateKeysTX struct {
+	Signature []byte `protobuf:"bytes,1,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore int64  `protobuf:"varint,2,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter  int64  `protobuf:"varint,3,opt,name=NotAfter" json:"NotAfter,omitempty"`
+}
+
+func (m *MigrateKeysTX) Reset()         { *m = MigrateKeysTX{} }
+func (m *MigrateKeysTX) String() string { return proto.CompactTextString(m) }
+func (*MigrateKeysTX) ProtoMessage()    {}
+
+type EncryptedData struct {
+	Algorithm  string        `protobuf:"bytes,1,opt,name=Algorithm" json:"Algorithm,omitempty"`
+	Ciphertext []byte        `protobuf:"bytes,2,opt,name=Ciphertext,proto3" json:"Ciphertext,omitempty"`
+	Readers    []*WrappedKey `protobuf:"bytes,3,rep,name=Readers" json:"Readers,omitempty"`
+}
+
+func (m *EncryptedData) Reset()         { *m = EncryptedData{} }
+func (m *EncryptedData) String() string { return proto.CompactTextString(m) }
+func (*EncryptedData) ProtoMessage()    {}
+
+func (m *EncryptedData) GetReaders() []*WrappedKey {
+	if m != nil {
+		return m.Readers
+	}
+	return nil
+}
+
+type WrappedKey struct {
+	ReaderPubkey string `protobuf:"bytes,1,opt,name=ReaderPubkey" json:"ReaderPubkey,omitempty"`
+	Key          []byte `protobuf:"bytes,2,opt,name=Key,proto3" json:"Key,omitempty"`
+}
+
+func (m *WrappedKey) Reset()         { *m = WrappedKey{} }
+func (m *WrappedKey) String() string { return proto.CompactTextString(m) }
+func (*WrappedKey) ProtoMessage()    {}
+
+type SetPrivateDataTX struct {
+	Nonce              []byte         `protobuf:"bytes,1,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	PrivateData        *EncryptedData `protobuf:"bytes,2,opt,name=PrivateData" json:"PrivateData,omitempty"`
+	Signature          []byte         `protobuf:"bytes,3,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore          int64          `protobuf:"varint,4,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter           int64          `protobuf:"varint,5,opt,name=NotAfter" json:"NotAfter,omitempty"`
+	PrivateDataVersion int64          `protobuf:"varint,6,opt,name=PrivateDataVersion" json:"PrivateDataVersion,omitempty"`
+}
+
+func (m *SetPrivateDataTX) Reset()         { *m = SetPrivateDataTX{} }
+func (m *SetPrivateDataTX) String() string { return proto.CompactTextString(m) }
+func (*SetPrivateDataTX) ProtoMessage()    {}
+
+func (m *SetPrivateDataTX) GetPrivateData() *EncryptedData {
+	if m != nil {
+		return m.PrivateData
+	}
+	return nil
+}
+
+type PrivateDataReaderTX struct {
+	Nonce              []byte      `protobuf:"bytes,1,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	Reader             *WrappedKey `protobuf:"bytes,2,opt,name=Reader" json:"Reader,omitempty"`
+	Signature          []byte      `protobuf:"bytes,3,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore          int64       `protobuf:"varint,4,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter           int64       `protobuf:"varint,5,opt,name=NotAfter" json:"NotAfter,omitempty"`
+	PrivateDataVersion int64       `protobuf:"varint,6,opt,name=PrivateDataVersion" json:"PrivateDataVersion,omitempty"`
+}
+
+func (m *PrivateDataReaderTX) Reset()         { *m = PrivateDataReaderTX{} }
+func (m *PrivateDataReaderTX) String() string { return proto.CompactTextString(m) }
+func (*PrivateDataReaderTX) ProtoMessage()    {}
+
+func (m *PrivateDataReaderTX) GetReader() *WrappedKey {
+	if m != nil {
+		return m.Reader
+	}
+	return nil
+}
+
+type IssueCredentialTX struct {
+	Credential string `protobuf:"bytes,1,opt,name=Credential" json:"Credential,omitempty"`
+}
+
+func (m *IssueCredentialTX) Reset()         { *m = IssueCredentialTX{} }
+func (m *IssueCredentialTX) String() string { return proto.CompactTextString(m) }
+func (*IssueCredentialTX) ProtoMessage()    {}
+
+type RevokeCredentialTX struct {
+	IssuerPubkey string `protobuf:"bytes,1,opt,name=IssuerPubkey" json:"IssuerPubkey,omitempty"`
+	CredentialID string `protobuf:"bytes,2,opt,name=CredentialID" json:"CredentialID,omitempty"`
+	Reason       string `protobuf:"bytes,3,opt,name=Reason" json:"Reason,omitempty"`
+	Signature    []byte `protobuf:"bytes,4,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore    int64  `protobuf:"varint,5,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter     int64  `protobuf:"varint,6,opt,name=NotAfter" json:"NotAfter,omitempty"`
+}
+
+func (m *RevokeCredentialTX) Reset()         { *m = RevokeCredentialTX{} }
+func (m *RevokeCredentialTX) String() string { return proto.CompactTextString(m) }
+func (*RevokeCredentialTX) ProtoMessage()    {}
+
+type ImportSnapshotTX struct {
+	Page      []byte `protobuf:"bytes,1,opt,name=Page,proto3" json:"Page,omitempty"`
+	Signature []byte `protobuf:"bytes,2,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore int64  `protobuf:"varint,3,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter  int64  `protobuf:"varint,4,opt,name=NotAfter" json:"NotAfter,omitempty"`
+}
+
+func (m *ImportSnapshotTX) Reset()         { *m = ImportSnapshotTX{} }
+func (m *ImportSnapshotTX) String() string { return proto.CompactTextString(m) }
+func (*ImportSnapshotTX) ProtoMessage()    {}
+
+type RepairTX struct {
+	Signature []byte `protobuf:"bytes,1,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore int64  `protobuf:"varint,2,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter  int64  `protobuf:"varint,3,opt,name=NotAfter" json:"NotAfter,omitempty"`
+	Checksum  string `protobuf:"bytes,4,opt,name=Checksum" json:"Checksum,omitempty"`
+	Sequence  int64  `protobuf:"varint,5,opt,name=Sequence" json:"Sequence,omitempty"`
+}
+
+func (m *RepairTX) Reset()         { *m = RepairTX{} }
+func (m *RepairTX) String() string { return proto.CompactTextString(m) }
+func (*RepairTX) ProtoMessage()    {}
+
+type PublishFirmwareTX struct {
+	SpecName     string      `protobuf:"bytes,1,opt,name=SpecName" json:"SpecName,omitempty"`
+	Version      string      `protobuf:"bytes,2,opt,name=Version" json:"Version,omitempty"`
+	ImageHash    string      `protobuf:"bytes,3,opt,name=ImageHash" json:"ImageHash,omitempty"`
+	SigningKey   string      `protobuf:"bytes,4,opt,name=SigningKey" json:"SigningKey,omitempty"`
+	ReleaseNotes *ContentRef `protobuf:"bytes,5,opt,name=ReleaseNotes" json:"ReleaseNotes,omitempty"`
+	Signature    []byte      `protobuf:"bytes,6,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore    int64       `protobuf:"varint,7,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter     int64       `protobuf:"varint,8,opt,name=NotAfter" json:"NotAfter,omitempty"`
+}
+
+func (m *PublishFirmwareTX) Reset()         { *m = PublishFirmwareTX{} }
+func (m *PublishFirmwareTX) String() string { return proto.CompactTextString(m) }
+func (*PublishFirmwareTX) ProtoMessage()    {}
+
+func (m *PublishFirmwareTX) GetReleaseNotes() *ContentRef {
+	if m != nil {
+		return m.ReleaseNotes
+	}
+	return nil
+}
+
+type FlagFirmwareTX struct {
+	SpecName  string `protobuf:"bytes,1,opt,name=SpecName" json:"SpecName,omitempty"`
+	Version   string `protobuf:"bytes,2,opt,name=Version" json:"Version,omitempty"`
+	Advisory  string `protobuf:"bytes,3,opt,name=Advisory" json:"Advisory,omitempty"`
+	Signature []byte `protobuf:"bytes,4,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore int64  `protobuf:"varint,5,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter  int64  `protobuf:"varint,6,opt,name=NotAfter" json:"NotAfter,omitempty"`
+}
+
+func (m *FlagFirmwareTX) Reset()         { *m = FlagFirmwareTX{} }
+func (m *FlagFirmwareTX) String() string { return proto.CompactTextString(m) }
+func (*FlagFirmwareTX) ProtoMessage()    {}
+
+type ReportFirmwareTX struct {
+	Nonce        []byte `protobuf:"bytes,1,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	Version      string `protobuf:"bytes,2,opt,name=Version" json:"Version,omitempty"`
+	SignerPubkey string `protobuf:"bytes,3,opt,name=SignerPubkey" json:"SignerPubkey,omitempty"`
+	Signature    []byte `protobuf:"bytes,4,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore    int64  `protobuf:"varint,5,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter     int64  `protobuf:"varint,6,opt,name=NotAfter" json:"NotAfter,omitempty"`
+	Counter      int64  `protobuf:"varint,7,opt,name=Counter" json:"Counter,omitempty"`
+}
+
+func (m *ReportFirmwareTX) Reset()         { *m = ReportFirmwareTX{} }
+func (m *ReportFirmwareTX) String() string { return proto.CompactTextString(m) }
+func (*ReportFirmwareTX) ProtoMessage()    {}
+
+type UpdateManifest struct {
+	SpecName        string                `protobuf:"bytes,1,opt,name=SpecName" json:"SpecName,omitempty"`
+	SequenceNumber  int64                 `protobuf:"varint,2,opt,name=SequenceNumber" json:"SequenceNumber,omitempty"`
+	Things          [][]byte              `protobuf:"bytes,3,rep,name=Things,proto3" json:"Things,omitempty"`
+	ImageDigest     string                `protobuf:"bytes,4,opt,name=ImageDigest" json:"ImageDigest,omitempty"`
+	ImageSize       int64                 `protobuf:"varint,5,opt,name=ImageSize" json:"ImageSize,omitempty"`
+	PayloadURI      string                `protobuf:"bytes,6,opt,name=PayloadURI" json:"PayloadURI,omitempty"`
+	FirmwareVersion string                `protobuf:"bytes,7,opt,name=FirmwareVersion" json:"FirmwareVersion,omitempty"`
+	Dependencies    []*ManifestDependency `protobuf:"bytes,8,rep,name=Dependencies" json:"Dependencies,omitempty"`
+	Conditions      []*ManifestCondition  `protobuf:"bytes,9,rep,name=Conditions" json:"Conditions,omitempty"`
+}
+
+func (m *UpdateManifest) Reset()         { *m = UpdateManifest{} }
+func (m *UpdateManifest) String() string { return proto.CompactTextString(m) }
+func (*UpdateManifest) ProtoMessage()    {}
+
+func (m *UpdateManifest) GetDependencies() []*ManifestDependency {
+	if m != nil {
+		return m.Dependencies
+	}
+	return nil
+}
+
+func (m *UpdateManifest) GetConditions() []*ManifestCondition {
+	if m != nil {
+		return m.Conditions
+	}
+	return nil
+}
+
+type ManifestDependency struct {
+	SpecName       string `protobuf:"bytes,1,opt,name=SpecName" json:"SpecName,omitempty"`
+	SequenceNumber int64  `protobuf:"varint,2,opt,name=SequenceNumber" json:"SequenceNumber,omitempty"`
+}
+
+func (m *ManifestDependency) Reset()         { *m = ManifestDependency{} }
+func (m *ManifestDependency) String() string { return proto.CompactTextString(m) }
+func (*ManifestDependency) ProtoMessage()    {}
+
+type ManifestCondition struct {
+	Type  string `protobuf:"bytes,1,opt,name=Type" json:"Type,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=Value" json:"Value,omitempty"`
+}
+
+func (m *ManifestCondition) Reset()         { *m = ManifestCondition{} }
+func (m *ManifestCondition) String() string { return proto.CompactTextString(m) }
+func (*ManifestCondition) ProtoMessage()    {}
+
+type IssueManifestTX struct {
+	Manifest  []byte `protobuf:"bytes,1,opt,name=Manifest,proto3" json:"Manifest,omitempty"`
+	Signature []byte `protobuf:"bytes,2,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	NotBefore int64  `protobuf:"varint,3,opt,name=NotBefore" json:"NotBefore,omitempty"`
+	NotAfter  int64  `protobuf:"varint,4,opt,name=NotAfter" json:"NotAfter,omitempty"`
+}
+
+func (m *IssueManifestTX) Reset()         { *m = IssueManifestTX{} }
+func (m *IssueManifestTX) String() string { return proto.CompactTextString(m) }
+func (*IssueManifestTX) ProtoMessage()    {}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -9,12 +8,13 @@ import (
 	"reflect"
 	"regexp"
 	"runtime"
+	"strings"
 	"testing"
 
 	proto "github.com/golang/protobuf/proto"
-	"github.com/hyperledger/fabric/core/chaincode/shim"
 
 	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
 	"github.com/btcsuite/btcd/btcec"
 )
 
@@ -72,68 +72,7 @@ func randString(n int, kindOfString string) string {
 	return string(b)
 }
 
-/*
-	generates a signature for creating a registrant based on private key and message
-*/
-func createRegistrantSig(registrantName string, registrantPubkey string, data string, privateKeyStr string) (string, error) {
-	privKeyByte, err := hex.DecodeString(privateKeyStr)
-	if err != nil {
-		return "", fmt.Errorf("error decoding hex encoded private key (%s)", privateKeyStr)
-	}
-	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), privKeyByte)
-
-	message := registrantName + ":" + registrantPubkey + ":" + data
-	messageBytes := sha256.Sum256([]byte(message))
-	sig, err := privKey.Sign(messageBytes[:])
-	if err != nil {
-		return "", fmt.Errorf("error signing message (%s) with private key (%s)", message, privateKeyStr)
-	}
-	return hex.EncodeToString(sig.Serialize()), nil
-}
-
-/*
-	generates a signature for registering a thing based on private key and message
-*/
-func generateRegisterThingSig(registrantPubkey string, aliases []string, spec string, data string, privateKeyStr string) (string, error) {
-	privKeyByte, err := hex.DecodeString(privateKeyStr)
-	if err != nil {
-		return "", fmt.Errorf("error decoding hex encoded private key (%s)", privateKeyStr)
-	}
-	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), privKeyByte)
-	message := registrantPubkey
-	for _, identity := range aliases {
-		message += ":" + identity
-	}
-	message += ":" + data
-	message += ":" + spec
-	messageBytes := sha256.Sum256([]byte(message))
-	sig, err := privKey.Sign(messageBytes[:])
-	if err != nil {
-		return "", fmt.Errorf("error signing message (%s) with private key (%s)", message, privateKeyStr)
-	}
-	return hex.EncodeToString(sig.Serialize()), nil
-}
-
-/*
-	generates a signature for registering a spec based on private key and message
-*/
-func generateRegisterSpecSig(specName string, registrantPubkey string, data string, privateKeyStr string) (string, error) {
-	privKeyByte, err := hex.DecodeString(privateKeyStr)
-	if err != nil {
-		return "", fmt.Errorf("error decoding hex encoded private key (%s)", privateKeyStr)
-	}
-	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), privKeyByte)
-
-	message := specName + ":" + registrantPubkey + ":" + data
-	messageBytes := sha256.Sum256([]byte(message))
-	sig, err := privKey.Sign(messageBytes[:])
-	if err != nil {
-		return "", fmt.Errorf("error signing message (%s) with private key (%s)", message, privateKeyStr)
-	}
-	return hex.EncodeToString(sig.Serialize()), nil
-}
-
-func checkInit(t *testing.T, stub *shim.MockStub, args []string) {
+func checkInit(t *testing.T, stub *testStub, args []string) {
 	_, err := stub.MockInit("1", "", args)
 	if err != nil {
 		fmt.Println("INIT", args, "failed", err)
@@ -144,7 +83,7 @@ func checkInit(t *testing.T, stub *shim.MockStub, args []string) {
 /*
 	register a store type "Identites" to ledger by calling to Invoke()
 */
-func createRegistrant(t *testing.T, stub *shim.MockStub, name string, data string,
+func createRegistrant(t *testing.T, stub *testStub, name string, data string,
 	privateKeyString string, pubKeyString string) error {
 
 	registrant := IOTRegistryTX.CreateRegistrantTX{}
@@ -157,11 +96,12 @@ func createRegistrant(t *testing.T, stub *shim.MockStub, name string, data strin
 	registrant.Data = data
 
 	//create signature
-	hexOwnerSig, err := createRegistrantSig(registrant.RegistrantName, hex.EncodeToString(registrant.RegistrantPubkey), registrant.Data, privateKeyString)
+	signer, err := client.NewPrivateKeySigner(privateKeyString)
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
-	registrant.Signature, err = hex.DecodeString(hexOwnerSig)
+	message := client.CreateRegistrantMessage(registrant.RegistrantName, hex.EncodeToString(registrant.RegistrantPubkey), registrant.Data, nil)
+	registrant.Signature, err = signer.Sign(client.SignedMessage(&registrant, message))
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
@@ -178,7 +118,7 @@ func createRegistrant(t *testing.T, stub *shim.MockStub, name string, data strin
 /*
 	registers a store type "Things" to ledger and an "Alias" store type for each member of string slice aliases by calling to Invoke()
 */
-func registerThing(t *testing.T, stub *shim.MockStub, nonce []byte, aliases []string,
+func registerThing(t *testing.T, stub *testStub, nonce []byte, aliases []string,
 	registrantPubKey string, spec string, data string, privateKeyString string) error {
 
 	thing := IOTRegistryTX.RegisterThingTX{}
@@ -187,18 +127,18 @@ func registerThing(t *testing.T, stub *shim.MockStub, nonce []byte, aliases []st
 	thing.Aliases = aliases
 	thing.RegistrantPubkey = registrantPubKey
 	thing.Spec = spec
+	thing.Data = data
 
 	//create signature
-	hexThingSig, err := generateRegisterThingSig(registrantPubKey, aliases, spec, data, privateKeyString)
+	signer, err := client.NewPrivateKeySigner(privateKeyString)
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
-	thing.Signature, err = hex.DecodeString(hexThingSig)
+	thing.Signature, err = signer.Sign(client.SignedMessage(&thing, client.RegisterThingMessage(&thing)))
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
 
-	thing.Data = data
 	thingBytes, err := proto.Marshal(&thing)
 	thingBytesStr := hex.EncodeToString(thingBytes)
 	_, err = stub.MockInvoke("3", "registerThing", []string{thingBytesStr})
@@ -211,7 +151,7 @@ func registerThing(t *testing.T, stub *shim.MockStub, nonce []byte, aliases []st
 /*
 	registers a store type "Spec" to ledger by calling to Invoke()
 */
-func registerSpec(t *testing.T, stub *shim.MockStub, specName string, registrantPubkey string,
+func registerSpec(t *testing.T, stub *testStub, specName string, registrantPubkey string,
 	data string, privateKeyString string) error {
 
 	registerSpec := IOTRegistryTX.RegisterSpecTX{}
@@ -221,12 +161,12 @@ func registerSpec(t *testing.T, stub *shim.MockStub, specName string, registrant
 	registerSpec.Data = data
 
 	//create signature
-	hexSpecSig, err := generateRegisterSpecSig(specName, registrantPubkey, data, privateKeyString)
+	signer, err := client.NewPrivateKeySigner(privateKeyString)
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
-
-	registerSpec.Signature, err = hex.DecodeString(hexSpecSig)
+	message := client.RegisterSpecMessage(specName, registrantPubkey, data, nil)
+	registerSpec.Signature, err = signer.Sign(client.SignedMessage(&registerSpec, message))
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
@@ -264,7 +204,7 @@ func testEq(a, b []string) bool {
 /*
 	Checks that different queries return expected values.
 */
-func checkQuery(t *testing.T, stub *shim.MockStub, function string, index string, expected registryTest) error {
+func checkQuery(t *testing.T, stub *testStub, function string, index string, expected registryTest) error {
 	var err error = nil
 	var bytes []byte
 
@@ -341,8 +281,7 @@ type registryTest struct {
 */
 func TestIOTRegistryChaincode(t *testing.T) {
 	//declaring and initializing variables for all tests
-	bst := new(IOTRegistry)
-	stub := shim.NewMockStub("IOTRegistry", bst)
+	stub := newTestStub()
 
 	var registryTestsSuccess = []registryTest{
 		{ /*private key  1*/ "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20",
@@ -398,3 +337,123 @@ func TestIOTRegistryChaincode(t *testing.T) {
 		}
 	}
 }
+
+/*
+	registers a registrant, a thing and a spec with transactions built by the client package
+*/
+func TestClientTransactions(t *testing.T) {
+	stub := newTestStub()
+
+	signer, err := client.GeneratePrivateKeySigner()
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	registrant, err := client.CreateRegistrant(signer, "Dora", "client data")
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	thing, err := client.RegisterThing(signer, []byte{0xd0}, []string{"dora-thing"},
+		[]*IOTRegistryTX.TypedAlias{{Type: "serial", Value: "D0"}}, "dora spec", "client data")
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	spec, err := client.RegisterSpec(signer, "dora spec", "client data")
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	for _, tx := range []struct {
+		function string
+		args     proto.Message
+	}{{"createRegistrant", registrant}, {"registerThing", thing}, {"registerSpec", spec}} {
+		args, err := client.EncodeArgs(tx.args)
+		if err != nil {
+			HandleError(t, err)
+			return
+		}
+		if _, err := stub.MockInvoke("3", tx.function, []string{args}); err != nil {
+			HandleError(t, fmt.Errorf("%s: %v", tx.function, err))
+			return
+		}
+	}
+	expected := registryTest{pubKeyString: client.PubkeyHex(signer), RegistrantName: "Dora", data: "client data",
+		specName: "dora spec", aliases: []string{"dora-thing"}}
+	HandleError(t, checkQuery(t, stub, "owner", expected.pubKeyString, expected))
+	HandleError(t, checkQuery(t, stub, "thing", "serial:D0", expected))
+	HandleError(t, checkQuery(t, stub, "spec", "dora spec", expected))
+}
+
+/*
+	every transaction and query accepts a registrant's key in any SEC1 encoding and hex case, and the
+	signatures are made over the normalized compressed key
+*/
+func TestPubkeyEncodings(t *testing.T) {
+	signer, err := client.NewPrivateKeySigner("94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20")
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	key, err := btcec.ParsePubKey(signer.PublicKey(), btcec.S256())
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	normalized := client.PubkeyHex(signer)
+	encodings := []struct {
+		name   string
+		pubkey string
+	}{
+		{"compressed", hex.EncodeToString(key.SerializeCompressed())},
+		{"uncompressed", hex.EncodeToString(key.SerializeUncompressed())},
+		{"hybrid", hex.EncodeToString(key.SerializeHybrid())},
+		{"upper case compressed", strings.ToUpper(hex.EncodeToString(key.SerializeCompressed()))},
+		{"upper case uncompressed", strings.ToUpper(hex.EncodeToString(key.SerializeUncompressed()))},
+	}
+	for _, encoding := range encodings {
+		stub := newTestStub()
+		registrant, err := client.CreateRegistrant(signer, "Alice", "data")
+		if err != nil {
+			HandleError(t, err)
+			return
+		}
+		registrant.RegistrantPubkey, _ = hex.DecodeString(encoding.pubkey)
+		thing, err := client.RegisterThing(signer, []byte{1}, []string{"alias"},
+			[]*IOTRegistryTX.TypedAlias{{Type: "serial", Value: "S1", Scoped: true}}, "spec", "data")
+		if err != nil {
+			HandleError(t, err)
+			return
+		}
+		thing.RegistrantPubkey = encoding.pubkey
+		spec, err := client.RegisterSpec(signer, "spec", "data")
+		if err != nil {
+			HandleError(t, err)
+			return
+		}
+		spec.RegistrantPubkey = encoding.pubkey
+		for _, tx := range []struct {
+			function string
+			args     proto.Message
+		}{{"createRegistrant", registrant}, {"registerThing", thing}, {"registerSpec", spec}} {
+			args, err := client.EncodeArgs(tx.args)
+			if err != nil {
+				HandleError(t, err)
+				return
+			}
+			if _, err := stub.MockInvoke("3", tx.function, []string{args}); err != nil {
+				HandleError(t, fmt.Errorf("%s with %s key: %v", tx.function, encoding.name, err))
+			}
+		}
+		expected := registryTest{pubKeyString: normalized, RegistrantName: "Alice", data: "data",
+			specName: "spec", aliases: []string{"alias"}}
+		HandleError(t, checkQuery(t, stub, "owner", encoding.pubkey, expected))
+		if _, err := stub.MockQuery("thing", []string{"serial:S1", encoding.pubkey}); err != nil {
+			HandleError(t, fmt.Errorf("scoped thing query with %s key: %v", encoding.name, err))
+		}
+	}
+
+	_, err = newTestStub().MockQuery("owner", []string{"04" + normalized[2:]})
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "args"))
+}
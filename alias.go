@@ -0,0 +1,306 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	Typed aliases live in their own keyspace next to the legacy untyped "Alias:<identity>" states:
+	|		"TypedAlias:<type>:*:<value>"					for aliases that are unique across the registry
+	|		"TypedAlias:<type>:<RegistrantPubkey>:<value>"	for aliases scoped to a single registrant
+	Values are normalized by their type before they are stored, so "00-11-22-33-44-55" and
+	"00:11:22:33:44:55" refer to the same mac alias.
+*/
+const globalAliasScope = "*"
+
+var aliasNormalizers = map[string]func(string) (string, error){
+	"mac":    normalizeMAC,
+	"imei":   normalizeIMEI,
+	"serial": normalizeSerial,
+	"uri":    normalizeURI,
+}
+
+/*
+	normalizes a mac address (EUI-48 or EUI-64) to lower case, colon separated form.
+*/
+func normalizeMAC(value string) (string, error) {
+	hw, err := net.ParseMAC(value)
+	if err != nil || (len(hw) != 6 && len(hw) != 8) {
+		return "", fmt.Errorf("mac alias (%s) is not a valid EUI-48 or EUI-64 address\n", value)
+	}
+	return hw.String(), nil
+}
+
+/*
+	checks that an IMEI is 15 digits with a valid Luhn check digit.
+*/
+func normalizeIMEI(value string) (string, error) {
+	if len(value) != 15 {
+		return "", fmt.Errorf("imei alias (%s) must be 15 digits\n", value)
+	}
+	sum := 0
+	for i, c := range value {
+		if c < '0' || c > '9' {
+			return "", fmt.Errorf("imei alias (%s) must be 15 digits\n", value)
+		}
+		digit := int(c - '0')
+		if i%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	if sum%10 != 0 {
+		return "", fmt.Errorf("imei alias (%s) has an invalid check digit\n", value)
+	}
+	return value, nil
+}
+
+var serialPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+/*
+	checks that a serial number is 1 to 64 characters of letters, digits, '.', '_' or '-'.
+*/
+func normalizeSerial(value string) (string, error) {
+	if !serialPattern.MatchString(value) {
+		return "", fmt.Errorf("serial alias (%s) must be 1-64 characters of [A-Za-z0-9._-]\n", value)
+	}
+	return value, nil
+}
+
+/*
+	checks that a uri is absolute. The scheme and host are lower cased.
+*/
+func normalizeURI(value string) (string, error) {
+	if len(value) > 2048 {
+		return "", fmt.Errorf("uri alias is longer than 2048 characters\n")
+	}
+	u, err := url.Parse(value)
+	if err != nil || len(u.Scheme) == 0 || (len(u.Host) == 0 && len(u.Opaque) == 0) {
+		return "", fmt.Errorf("uri alias (%s) is not an absolute uri\n", value)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	return u.String(), nil
+}
+
+/*
+	validates and normalizes the value of an alias of the given type.
+*/
+func normalizeTypedAlias(aliasType string, value string) (string, error) {
+	normalize, ok := aliasNormalizers[aliasType]
+	if !ok {
+		return "", fmt.Errorf("unknown alias type (%s)\n", aliasType)
+	}
+	return normalize(value)
+}
+
+/*
+	returns the ledger key of a typed alias. An empty scope stands for the global namespace.
+*/
+func typedAliasKey(aliasType string, scope string, value string) string {
+	if len(scope) == 0 {
+		scope = globalAliasScope
+	}
+	return compositeKey(typedAliasNamespace, aliasType, scope, value)
+}
+
+/*
+	splits a "type:value" query argument and returns the normalized, and with blinding blinded, value.
+	ok is false when the prefix is not a known alias type, in which case the argument should be treated as
+	a legacy untyped alias.
+*/
+func parseTypedAlias(arg string, blinding *aliasBlinding, scoped bool) (aliasType string, value string, ok bool) {
+	i := strings.Index(arg, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	aliasType = arg[:i]
+	if _, known := aliasNormalizers[aliasType]; !known {
+		return "", "", false
+	}
+	value, err := blinding.blindTypedAlias(aliasType, arg[i+1:], scoped)
+	if err != nil {
+		return "", "", false
+	}
+	return aliasType, value, true
+}
+
+/*
+	With BlindAliases in the config, aliases are stored blinded (see client.BlindAlias) in the same key
+	shapes, so uniqueness is checked over the blinded values:
+	|		"Alias:blinded:<digest>"
+	|		"TypedAlias:<type>:*:blinded:<digest>"					blinded with the registry AliasSalt
+	|		"TypedAlias:<type>:<RegistrantPubkey>:blinded:<digest>"	blinded with the registrant's AliasSalt, if it has one
+	Global aliases always use the registry salt, since they must collide across registrants.
+	A registrant salt is set when the registrant is created and cannot change, nor can the registry salt
+	once aliases are stored, since the stored digests could no longer be found.
+*/
+const (
+	minAliasSaltSize = 16
+	maxAliasSaltSize = 64
+)
+
+func validAliasSalt(salt []byte) bool {
+	return len(salt) >= minAliasSaltSize && len(salt) <= maxAliasSaltSize
+}
+
+/*
+	aliasBlinding blinds the aliases of one registrant. It is disabled when the registry does not blind aliases.
+*/
+type aliasBlinding struct {
+	enabled        bool
+	registrySalt   []byte
+	registrantSalt []byte
+}
+
+/*
+	returns the blinding of the aliases of a registrant. registrantPubkey may be empty for global aliases.
+*/
+func getAliasBlinding(stub Stub, registrantPubkey string) (*aliasBlinding, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	blinding := &aliasBlinding{enabled: config.BlindAliases}
+	if !blinding.enabled {
+		return blinding, nil
+	}
+	blinding.registrySalt, err = hex.DecodeString(config.AliasSalt)
+	if err != nil {
+		return nil, internalError(configKey(), "AliasSalt is not hex")
+	}
+	if len(registrantPubkey) == 0 {
+		return blinding, nil
+	}
+	key := registrantKey(registrantPubkey)
+	registrantBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "Could not get RegistrantPubkey (%s) State", registrantPubkey)
+	}
+	registrant := IOTRegistryStore.Registrant{}
+	err = proto.Unmarshal(registrantBytes, &registrant)
+	if err != nil {
+		return nil, internalError(key, "Error unmarshalling Registrant: (%v)", err.Error())
+	}
+	blinding.registrantSalt = registrant.AliasSalt
+	return blinding, nil
+}
+
+/*
+	returns the stored form of an alias: the alias itself without blinding, and otherwise the given blinded
+	form or the alias blinded with the registrant salt (scoped) or the registry salt.
+*/
+func (b *aliasBlinding) blind(alias string, scoped bool) string {
+	if !b.enabled || client.IsBlindedAlias(alias) {
+		return alias
+	}
+	if scoped && len(b.registrantSalt) != 0 {
+		return client.BlindAlias(b.registrantSalt, alias)
+	}
+	return client.BlindAlias(b.registrySalt, alias)
+}
+
+/*
+	normalizes the value of a typed alias and blinds it. A value that is already blinded cannot be
+	normalized, and is taken as is when the registry blinds aliases.
+*/
+func (b *aliasBlinding) blindTypedAlias(aliasType string, value string, scoped bool) (string, error) {
+	if b.enabled && client.IsBlindedAlias(value) {
+		if _, ok := aliasNormalizers[aliasType]; !ok {
+			return "", fmt.Errorf("unknown alias type (%s)\n", aliasType)
+		}
+		return value, nil
+	}
+	value, err := normalizeTypedAlias(aliasType, value)
+	if err != nil {
+		return "", err
+	}
+	return b.blind(value, scoped), nil
+}
+
+/*
+	rejects a config that turns alias blinding on or off, or changes the registry salt, once aliases are stored.
+*/
+func checkAliasBlindingChange(stub Stub, config *registryConfig) error {
+	stored, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	if stored.BlindAliases == config.BlindAliases && stored.AliasSalt == config.AliasSalt {
+		return nil
+	}
+	for _, namespace := range []string{aliasNamespace, typedAliasNamespace} {
+		found := false
+		err = rangeScan(stub, keyPrefix(namespace), func(key string, value []byte) error {
+			found = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if found {
+			return failedPrecondition(configKey(), "BlindAliases and AliasSalt cannot change once aliases are stored")
+		}
+	}
+	return nil
+}
+
+/*
+	checks the AliasSalt of a createRegistrant transaction.
+*/
+func validateRegistrantAliasSalt(registerNameArgs *IOTRegistryTX.CreateRegistrantTX) error {
+	if len(registerNameArgs.AliasSalt) != 0 && !validAliasSalt(registerNameArgs.AliasSalt) {
+		return invalidArgument("AliasSalt", "AliasSalt must be %d to %d bytes", minAliasSaltSize, maxAliasSaltSize)
+	}
+	return nil
+}
+
+/*
+	looks up the Alias state for a thing query.
+	|		alias only:					"type:value" resolves a global typed alias, falling back to the legacy "Alias:<alias>" state
+	|		alias and RegistrantPubkey:	"type:value" resolves an alias scoped to that registrant
+	Aliases are blinded as they were stored, see aliasBlinding.
+	returns nil if no alias is found.
+*/
+func getAliasState(stub Stub, alias string, scope string) ([]byte, error) {
+	blinding, err := getAliasBlinding(stub, scope)
+	if err != nil {
+		return nil, err
+	}
+	aliasType, value, typed := parseTypedAlias(alias, blinding, len(scope) != 0)
+	if len(scope) != 0 {
+		if !typed {
+			return nil, invalidArgument("args", "scoped alias (%s) must be of the form type:value", alias)
+		}
+		return stub.GetState(typedAliasKey(aliasType, scope, value))
+	}
+	if typed {
+		aliasBytes, err := stub.GetState(typedAliasKey(aliasType, "", value))
+		if err != nil || len(aliasBytes) != 0 {
+			return aliasBytes, err
+		}
+	}
+	return stub.GetState(aliasKey(blinding.blind(alias, false)))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	registers a thing with both legacy and typed aliases by calling to Invoke()
+*/
+func registerTypedThing(t *testing.T, stub *testStub, nonce []byte, aliases []string, typedAliases []*IOTRegistryTX.TypedAlias,
+	registrantPubKey string, spec string, data string, privateKeyString string) error {
+
+	thing := IOTRegistryTX.RegisterThingTX{}
+	thing.Nonce = nonce
+	thing.Aliases = aliases
+	thing.TypedAliases = typedAliases
+	thing.RegistrantPubkey = registrantPubKey
+	thing.Spec = spec
+	thing.Data = data
+
+	signer, err := client.NewPrivateKeySigner(privateKeyString)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	thing.Signature, err = signer.Sign(client.SignedMessage(&thing, client.RegisterThingMessage(&thing)))
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	thingBytes, err := proto.Marshal(&thing)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	_, err = stub.MockInvoke("3", "registerThing", []string{hex.EncodeToString(thingBytes)})
+	return err
+}
+
+/*
+	queries a thing by alias and returns its SpecName
+*/
+func queryThingSpec(stub *testStub, args ...string) (string, error) {
+	bytes, err := stub.MockQuery("thing", args)
+	if err != nil {
+		return "", err
+	}
+	var jsonMap map[string]interface{}
+	if err := json.Unmarshal(bytes, &jsonMap); err != nil {
+		return "", fmt.Errorf("error unmarshalling json string %s", bytes)
+	}
+	specName, _ := jsonMap["SpecName"].(string)
+	return specName, nil
+}
+
+func TestNormalizeTypedAlias(t *testing.T) {
+	var tests = []struct {
+		aliasType string
+		value     string
+		expected  string
+		valid     bool
+	}{
+		{"mac", "00-11-22-AA-BB-CC", "00:11:22:aa:bb:cc", true},
+		{"mac", "00:11:22:33:44:55:66:77", "00:11:22:33:44:55:66:77", true},
+		{"mac", "00:11:22:33:44", "", false},
+		{"imei", "490154203237518", "490154203237518", true},
+		{"imei", "490154203237517", "", false},
+		{"imei", "49015420323751a", "", false},
+		{"serial", "SN-0001_a.b", "SN-0001_a.b", true},
+		{"serial", "SN 0001", "", false},
+		{"uri", "HTTPS://Example.com/device/1", "https://example.com/device/1", true},
+		{"uri", "urn:dev:ow:10e2073a01080063", "urn:dev:ow:10e2073a01080063", true},
+		{"uri", "/relative/path", "", false},
+		{"color", "blue", "", false},
+	}
+	for _, test := range tests {
+		value, err := normalizeTypedAlias(test.aliasType, test.value)
+		if test.valid && err != nil {
+			HandleError(t, fmt.Errorf("%s alias (%s) rejected: %v", test.aliasType, test.value, err))
+		}
+		if !test.valid && err == nil {
+			HandleError(t, fmt.Errorf("%s alias (%s) accepted as (%s)", test.aliasType, test.value, value))
+		}
+		if value != test.expected {
+			HandleError(t, fmt.Errorf("%s alias (%s) normalized to (%s), expected (%s)", test.aliasType, test.value, value, test.expected))
+		}
+	}
+}
+
+func TestTypedAliases(t *testing.T) {
+	stub := newTestStub()
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	bobPriv := "166cc93d9eadb573b329b5993b9671f1521679cea90fe52e398e66c1d6373abf"
+	bobPub := "02242a1c19bc831cd95a9e5492015043250cbc17d0eceb82612ce08736b8d753a6"
+
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := createRegistrant(t, stub, "Bob", "", bobPriv, bobPub); err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	aliceAliases := []*IOTRegistryTX.TypedAlias{
+		{Type: "mac", Value: "00-11-22-33-44-55"},
+		{Type: "imei", Value: "490154203237518"},
+		{Type: "serial", Value: "SN1", Scoped: true},
+	}
+	err := registerTypedThing(t, stub, []byte{1}, []string{"legacy"}, aliceAliases, alicePub, "alice spec", "", alicePriv)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	//global typed aliases resolve through their normalized form, legacy aliases still resolve
+	for _, args := range [][]string{{"mac:00:11:22:33:44:55"}, {"mac:00-11-22-33-44-55"}, {"imei:490154203237518"}, {"legacy"}, {"serial:SN1", alicePub}} {
+		specName, err := queryThingSpec(stub, args...)
+		if err != nil {
+			HandleError(t, fmt.Errorf("query %v failed: %v", args, err))
+		} else if specName != "alice spec" {
+			HandleError(t, fmt.Errorf("query %v returned spec (%s)", args, specName))
+		}
+	}
+	//a scoped alias is not visible in the global namespace
+	if _, err := queryThingSpec(stub, "serial:SN1"); err == nil {
+		HandleError(t, fmt.Errorf("scoped alias resolved without a registrant"))
+	}
+
+	//global aliases are unique across registrants, scoped aliases only within a registrant
+	err = registerTypedThing(t, stub, []byte{2}, nil, []*IOTRegistryTX.TypedAlias{{Type: "mac", Value: "00:11:22:33:44:55"}}, bobPub, "bob spec", "", bobPriv)
+	if err == nil {
+		HandleError(t, fmt.Errorf("registered a mac alias that is already taken"))
+	}
+	err = registerTypedThing(t, stub, []byte{3}, nil, []*IOTRegistryTX.TypedAlias{{Type: "serial", Value: "SN1", Scoped: true}}, bobPub, "bob spec", "", bobPriv)
+	if err != nil {
+		HandleError(t, err)
+	}
+	specName, err := queryThingSpec(stub, "serial:SN1", bobPub)
+	if err != nil || specName != "bob spec" {
+		HandleError(t, fmt.Errorf("scoped alias for Bob returned (%s): %v", specName, err))
+	}
+
+	//invalid formats and repeated aliases are rejected
+	err = registerTypedThing(t, stub, []byte{4}, nil, []*IOTRegistryTX.TypedAlias{{Type: "imei", Value: "123"}}, bobPub, "bob spec", "", bobPriv)
+	if err == nil {
+		HandleError(t, fmt.Errorf("registered an invalid imei alias"))
+	}
+	repeated := []*IOTRegistryTX.TypedAlias{{Type: "uri", Value: "https://example.com/a"}, {Type: "uri", Value: "HTTPS://EXAMPLE.com/a"}}
+	err = registerTypedThing(t, stub, []byte{5}, nil, repeated, bobPub, "bob spec", "", bobPriv)
+	if err == nil {
+		HandleError(t, fmt.Errorf("registered a thing with a repeated alias"))
+	}
+}
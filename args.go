@@ -0,0 +1,65 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	Invoke arguments are normally a hex encoded protocol buffer in args[0]. createRegistrant, registerThing
+	and registerSpec also accept the transaction as canonical JSON (see client.EncodeJSONArgs), selected by
+	a prefix on args[0] or by a second argument:
+	|		"json:{...}"			or args {"{...}", "json"}			byte fields hex encoded
+	|		"json-base64:{...}"		or args {"{...}", "json-base64"}	byte fields base64 encoded
+	JSON arguments are converted to the protocol buffer before any checks, so signatures are verified the
+	same way whichever encoding was sent.
+*/
+var jsonArgModes = map[string]string{
+	"json":        client.ByteEncodingHex,
+	"json-base64": client.ByteEncodingBase64,
+}
+
+/*
+	returns the protocol buffer bytes of the Invoke arguments.
+*/
+func decodeInvokeArgs(function string, args []string) ([]byte, error) {
+	jsonArgs, byteEncoding, isJSON := "", "", false
+	if len(args) > 1 {
+		byteEncoding, isJSON = jsonArgModes[args[1]]
+		if !isJSON {
+			return nil, invalidArgument("args", "Invalid argument mode (%s) expected json or json-base64", args[1])
+		}
+		jsonArgs = args[0]
+	} else {
+		for mode, encoding := range jsonArgModes {
+			if strings.HasPrefix(args[0], mode+":") {
+				jsonArgs, byteEncoding, isJSON = strings.TrimPrefix(args[0], mode+":"), encoding, true
+			}
+		}
+	}
+	if !isJSON {
+		argsBytes, err := hex.DecodeString(args[0])
+		if err != nil {
+			return nil, invalidArgument("args", "Invalid argument (%s) expected hex", args[0])
+		}
+		return argsBytes, nil
+	}
+
+	tx, err := client.DecodeJSONArgs(function, []byte(jsonArgs), byteEncoding)
+	if err != nil {
+		return nil, invalidArgument("args", "Invalid JSON argument: %v", err)
+	}
+	return proto.Marshal(tx)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+)
+
+func TestJSONArgs(t *testing.T) {
+	stub := newTestStub()
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alice, err := client.NewPrivateKeySigner(alicePriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//createRegistrant as base64 JSON selected by a second argument
+	registrantTX, err := client.CreateRegistrant(alice, "Alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registrantJSON, err := client.EncodeJSONArgs(registrantTX, client.ByteEncodingBase64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stub.MockInvoke("1", "createRegistrant", []string{registrantJSON, "json-base64"}); err != nil {
+		HandleError(t, err)
+	}
+
+	//registerThing and registerSpec as hex JSON selected by a prefix
+	thingTX, err := client.RegisterThing(alice, []byte{1, 2}, []string{"json thing"}, nil, "json spec", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	thingJSON, err := client.EncodeJSONArgs(thingTX, client.ByteEncodingHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(thingJSON, `"Nonce":"0102"`) {
+		HandleError(t, fmt.Errorf("unexpected canonical JSON %s", thingJSON))
+	}
+	//the signature is over the fields, not the encoding, so a tampered field fails the same way as in a protobuf
+	tampered := strings.Replace(thingJSON, "json spec", "other spec", 1)
+	if _, err := stub.MockInvoke("2", "registerThing", []string{"json:" + tampered}); err == nil {
+		HandleError(t, fmt.Errorf("registered a thing with a tampered JSON field"))
+	}
+	if _, err := stub.MockInvoke("2", "registerThing", []string{"json:" + thingJSON}); err != nil {
+		HandleError(t, err)
+	}
+	specTX, err := client.RegisterSpec(alice, "json spec", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	specJSON, err := client.EncodeJSONArgs(specTX, client.ByteEncodingHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stub.MockInvoke("3", "registerSpec", []string{"json:" + specJSON}); err != nil {
+		HandleError(t, err)
+	}
+	if specName, err := queryThingSpec(stub, "json thing"); err != nil || specName != "json spec" {
+		HandleError(t, fmt.Errorf("thing registered from JSON returned spec (%s): %v", specName, err))
+	}
+
+	//schema errors name the offending field
+	var schemaTests = []struct {
+		function string
+		args     []string
+		expected string
+	}{
+		{"registerThing", []string{`json:{"Nonce":"0102","Alias":["x"]}`}, "unknown field (Alias)"},
+		{"registerThing", []string{`json:{"Nonce":"zz"}`}, "field (Nonce)"},
+		{"registerThing", []string{`{"Nonce":1}`, "json"}, "field (Nonce)"},
+		{"registerSpec", []string{`json:{"SpecName":["x"]}`}, "field (SpecName)"},
+		{"registerThing", []string{`json:{"TypedAliases":[{"Type":"mac","Scope":true}]}`}, "unknown field (Scope)"},
+		{"registerThing", []string{`json:[]`}, "must be an object"},
+		{"registerThing", []string{`{}`, "xml"}, "argument mode (xml)"},
+		{"attachThing", []string{`json:{}`}, "does not accept JSON"},
+	}
+	for _, test := range schemaTests {
+		_, err := stub.MockInvoke("4", test.function, test.args)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			HandleError(t, fmt.Errorf("%s %v returned (%v), expected (%s)", test.function, test.args, err, test.expected))
+		}
+	}
+}
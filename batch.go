@@ -0,0 +1,112 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	A registerThingsBatch transaction registers up to maxBatchSize things of one registrant under a single signature.
+	Instead of signing every entry, the registrant signs "registerThingsBatch:<root>", where root is the hex encoded
+	Merkle root of the entries (see client.BatchMerkleRoot):
+	|		leaf = sha256(0x00 || <Nonce> ":" <registerThing message of the entry>)
+	|		node = sha256(0x01 || left || right), an odd node is carried up to the next level unchanged
+*/
+const maxBatchSize = 10000
+
+/*
+	registerThingsBatch checks every entry of the batch, including nonces and aliases repeated within the batch,
+	before it puts any state, so that either all of the things are registered or none are.
+	TX struct: 		RegisterThingsBatchTX
+	Store structs: 	Things, Alias
+*/
+type registerThingsBatchHandler struct{ txType }
+
+func (registerThingsBatchHandler) validate(tx proto.Message) error {
+	batchArgs := tx.(*IOTRegistryTX.RegisterThingsBatchTX)
+	var err error
+	batchArgs.RegistrantPubkey, err = normalizePubkey("RegistrantPubkey", batchArgs.RegistrantPubkey)
+	if err != nil {
+		return err
+	}
+	if len(batchArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", batchArgs.Signature)
+	}
+	if len(batchArgs.Things) == 0 || len(batchArgs.Things) > maxBatchSize {
+		return invalidArgument("Things", "expected 1 to %d Things, got %d", maxBatchSize, len(batchArgs.Things))
+	}
+	for i, thing := range batchArgs.Things {
+		if len(thing.Nonce) == 0 {
+			return invalidArgument("Things", "length of Nonce of entry %d is zero", i)
+		}
+		if len(thing.Signature) != 0 {
+			return invalidArgument("Things", "entry %d has its own Signature, batch entries are covered by the batch Signature", i)
+		}
+		if thing.NotBefore != 0 || thing.NotAfter != 0 {
+			return invalidArgument("Things", "entry %d has its own validity window, batch entries are covered by the batch window", i)
+		}
+		if len(thing.RegistrantPubkey) != 0 {
+			entryPubkey, err := normalizePubkey("Things", thing.RegistrantPubkey)
+			if err != nil || entryPubkey != batchArgs.RegistrantPubkey {
+				return invalidArgument("Things", "RegistrantPubkey of entry %d (%s) does not match the batch", i, thing.RegistrantPubkey)
+			}
+		}
+		err = validateAliases(thing)
+		if err == nil {
+			err = validateContent(thing.Content, thing.Data)
+		}
+		if err == nil {
+			err = validatePrivateData(thing.PrivateData)
+		}
+		if err == nil {
+			err = validateDevicePubkey(thing)
+		}
+		if err != nil {
+			return prefixError(err, "entry %d", i)
+		}
+		thing.RegistrantPubkey = batchArgs.RegistrantPubkey
+	}
+	return nil
+}
+
+func (registerThingsBatchHandler) authorize(stub Stub, tx proto.Message) error {
+	batchArgs := tx.(*IOTRegistryTX.RegisterThingsBatchTX)
+	//check if owner is valid id (name exists in registry)
+	ownerPubKeyBytes, err := getRegistrantPubkey(stub, batchArgs.RegistrantPubkey)
+	if err != nil {
+		return err
+	}
+	message := client.SignedMessage(batchArgs, client.RegisterThingsBatchMessage(batchArgs.Things))
+	return verify(stub, ownerPubKeyBytes, batchArgs.Signature, message, "Signature")
+}
+
+func (registerThingsBatchHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	batchArgs := tx.(*IOTRegistryTX.RegisterThingsBatchTX)
+	var err error
+	pending := make(map[string]bool)
+	typedAliases := make([][]*IOTRegistryStore.TypedAlias, len(batchArgs.Things))
+	for i, thing := range batchArgs.Things {
+		typedAliases[i], err = checkThingAvailable(stub, thing, pending)
+		if err != nil {
+			return nil, prefixError(err, "entry %d", i)
+		}
+	}
+	for i, thing := range batchArgs.Things {
+		err = putRegisteredThing(stub, thing, typedAliases[i])
+		if err != nil {
+			return nil, prefixError(err, "entry %d", i)
+		}
+	}
+	return nil, nil
+}
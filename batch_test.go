@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	registers a batch of things by calling to Invoke(). tamper, if not nil, is applied after signing.
+*/
+func registerBatch(stub *testStub, registrantPubkey string, things []*IOTRegistryTX.RegisterThingTX,
+	privateKeyString string, tamper func(*IOTRegistryTX.RegisterThingsBatchTX)) error {
+
+	batch := IOTRegistryTX.RegisterThingsBatchTX{RegistrantPubkey: registrantPubkey, Things: things}
+	for _, thing := range things {
+		thing.RegistrantPubkey = registrantPubkey
+	}
+	signer, err := client.NewPrivateKeySigner(privateKeyString)
+	if err != nil {
+		return err
+	}
+	batch.Signature, err = signer.Sign(client.SignedMessage(&batch, client.RegisterThingsBatchMessage(things)))
+	if err != nil {
+		return err
+	}
+	if tamper != nil {
+		tamper(&batch)
+	}
+	batchBytes, err := proto.Marshal(&batch)
+	if err != nil {
+		return err
+	}
+	_, err = stub.MockInvoke("3", "registerThingsBatch", []string{hex.EncodeToString(batchBytes)})
+	return err
+}
+
+func TestRegisterThingsBatch(t *testing.T) {
+	stub := newTestStub()
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	bobPriv := "166cc93d9eadb573b329b5993b9671f1521679cea90fe52e398e66c1d6373abf"
+
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := registerThing(t, stub, []byte{0xff}, []string{"taken"}, alicePub, "", "", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	newBatch := func() []*IOTRegistryTX.RegisterThingTX {
+		return []*IOTRegistryTX.RegisterThingTX{
+			{Nonce: []byte{1}, Aliases: []string{"b1"}, Spec: "sensor", Data: "one"},
+			{Nonce: []byte{2}, Aliases: []string{"b2"}, Spec: "sensor", Data: "two"},
+			{Nonce: []byte{3}, Aliases: []string{"b3"}, TypedAliases: []*IOTRegistryTX.TypedAlias{{Type: "serial", Value: "S3"}}, Spec: "sensor"},
+		}
+	}
+
+	//a forged signature, a tampered entry and another registrant's key are rejected
+	if err := registerBatch(stub, alicePub, newBatch(), bobPriv, nil); err == nil {
+		HandleError(t, fmt.Errorf("registered a batch signed by the wrong key"))
+	}
+	tamper := func(batch *IOTRegistryTX.RegisterThingsBatchTX) { batch.Things[1].Data = "forged" }
+	if err := registerBatch(stub, alicePub, newBatch(), alicePriv, tamper); err == nil {
+		HandleError(t, fmt.Errorf("registered a batch with an entry changed after signing"))
+	}
+
+	//conflicts within the batch or with the ledger reject the whole batch
+	conflicts := [][]*IOTRegistryTX.RegisterThingTX{
+		append(newBatch(), &IOTRegistryTX.RegisterThingTX{Nonce: []byte{1}, Aliases: []string{"b4"}}),
+		append(newBatch(), &IOTRegistryTX.RegisterThingTX{Nonce: []byte{4}, Aliases: []string{"b2"}}),
+		append(newBatch(), &IOTRegistryTX.RegisterThingTX{Nonce: []byte{4}, TypedAliases: []*IOTRegistryTX.TypedAlias{{Type: "serial", Value: "S3"}}}),
+		append(newBatch(), &IOTRegistryTX.RegisterThingTX{Nonce: []byte{4}, Aliases: []string{"taken"}}),
+		append(newBatch(), &IOTRegistryTX.RegisterThingTX{Nonce: []byte{0xff}}),
+	}
+	for i, things := range conflicts {
+		if err := registerBatch(stub, alicePub, things, alicePriv, nil); err == nil {
+			HandleError(t, fmt.Errorf("registered conflicting batch %d", i))
+		}
+	}
+	if len(stub.State[thingKey("01")]) != 0 || len(stub.State[aliasKey("b1")]) != 0 {
+		HandleError(t, fmt.Errorf("a rejected batch left state behind"))
+	}
+
+	if err := registerBatch(stub, alicePub, newBatch(), alicePriv, nil); err != nil {
+		HandleError(t, err)
+		return
+	}
+	for _, args := range [][]string{{"b1"}, {"b2"}, {"b3"}, {"serial:S3"}} {
+		specName, err := queryThingSpec(stub, args...)
+		if err != nil || specName != "sensor" {
+			HandleError(t, fmt.Errorf("query %v returned spec (%s): %v", args, specName, err))
+		}
+	}
+}
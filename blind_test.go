@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+)
+
+func TestBlindedAliases(t *testing.T) {
+	stub := newTestStub()
+	registrySalt := []byte("registry salt 0123456789abcdef")
+	checkInit(t, stub, []string{fmt.Sprintf(`{"BlindAliases":true,"AliasSalt":"%s"}`, hex.EncodeToString(registrySalt))})
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	bobPriv := "166cc93d9eadb573b329b5993b9671f1521679cea90fe52e398e66c1d6373abf"
+	bobPub := "02242a1c19bc831cd95a9e5492015043250cbc17d0eceb82612ce08736b8d753a6"
+
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	bobSalt := []byte("bob's own alias salt")
+	bob, err := client.NewPrivateKeySigner(bobPriv)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	registrant, err := client.CreateRegistrant(bob, "Bob", "", client.WithAliasSalt(bobSalt))
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	args, err := client.EncodeArgs(registrant)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	if _, err := stub.MockInvoke("2", "createRegistrant", []string{args}); err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	aliceAliases := []*IOTRegistryTX.TypedAlias{
+		{Type: "mac", Value: "00-11-22-33-44-55"},
+		{Type: "serial", Value: "SN1", Scoped: true},
+	}
+	err = registerTypedThing(t, stub, []byte{1}, []string{"legacy"}, aliceAliases, alicePub, "alice spec", "", alicePriv)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	//the ledger holds no raw alias, only digests
+	for key := range stub.State {
+		if strings.Contains(key, "legacy") || strings.Contains(key, "00:11:22:33:44:55") || strings.Contains(key, "SN1") {
+			HandleError(t, fmt.Errorf("key (%s) contains a raw alias", displayKey(key)))
+		}
+	}
+	if len(stub.State[aliasKey(client.BlindAlias(registrySalt, "legacy"))]) == 0 {
+		HandleError(t, fmt.Errorf("blinded legacy alias not stored"))
+	}
+
+	//the thing resolves by raw alias and by precomputed digest
+	for _, args := range [][]string{
+		{"legacy"},
+		{client.BlindAlias(registrySalt, "legacy")},
+		{"mac:00:11:22:33:44:55"},
+		{"mac:00-11-22-33-44-55"},
+		{"mac:" + client.BlindAlias(registrySalt, "00:11:22:33:44:55")},
+		{"serial:SN1", alicePub},
+		{"serial:" + client.BlindAlias(registrySalt, "SN1"), alicePub},
+	} {
+		specName, err := queryThingSpec(stub, args...)
+		if err != nil {
+			HandleError(t, fmt.Errorf("query %v failed: %v", args, err))
+		} else if specName != "alice spec" {
+			HandleError(t, fmt.Errorf("query %v returned spec (%s)", args, specName))
+		}
+	}
+
+	//uniqueness holds over raw and blinded forms
+	err = registerTypedThing(t, stub, []byte{2}, []string{"legacy"}, nil, bobPub, "bob spec", "", bobPriv)
+	HandleError(t, checkErrorCode(err, client.CodeAlreadyExists, displayKey(aliasKey(client.BlindAlias(registrySalt, "legacy"))), ""))
+	err = registerTypedThing(t, stub, []byte{2}, []string{client.BlindAlias(registrySalt, "legacy")}, nil, bobPub, "bob spec", "", bobPriv)
+	HandleError(t, checkErrorCode(err, client.CodeAlreadyExists, displayKey(aliasKey(client.BlindAlias(registrySalt, "legacy"))), ""))
+	blindedMac := []*IOTRegistryTX.TypedAlias{{Type: "mac", Value: client.BlindAlias(registrySalt, "00:11:22:33:44:55")}}
+	err = registerTypedThing(t, stub, []byte{2}, nil, blindedMac, bobPub, "bob spec", "", bobPriv)
+	if err == nil {
+		HandleError(t, fmt.Errorf("registered a blinded mac alias that is already taken"))
+	}
+
+	//Bob's scoped aliases are blinded with his own salt
+	err = registerTypedThing(t, stub, []byte{3}, nil, []*IOTRegistryTX.TypedAlias{{Type: "serial", Value: "SN1", Scoped: true}}, bobPub, "bob spec", "", bobPriv)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	for _, value := range []string{"SN1", client.BlindAlias(bobSalt, "SN1")} {
+		specName, err := queryThingSpec(stub, "serial:"+value, bobPub)
+		if err != nil || specName != "bob spec" {
+			HandleError(t, fmt.Errorf("scoped alias (%s) for Bob returned (%s): %v", value, specName, err))
+		}
+	}
+	if _, err := queryThingSpec(stub, "serial:"+client.BlindAlias(registrySalt, "SN1"), bobPub); err == nil {
+		HandleError(t, fmt.Errorf("Bob's scoped alias resolved with the registry salt"))
+	}
+
+	//blinding cannot be changed once aliases are stored
+	checkInit(t, stub, []string{fmt.Sprintf(`{"BlindAliases":true,"AliasSalt":"%s"}`, hex.EncodeToString(registrySalt))})
+	for _, config := range []string{`{}`, fmt.Sprintf(`{"BlindAliases":true,"AliasSalt":"%s"}`, hex.EncodeToString(bobSalt))} {
+		_, err := stub.MockInit("1", "", []string{config})
+		HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(configKey()), ""))
+	}
+}
+
+func TestBlindedAliasConfig(t *testing.T) {
+	for _, config := range []string{
+		`{"BlindAliases":true}`,
+		`{"AliasSalt":"00112233445566778899aabbccddeeff"}`,
+		`{"BlindAliases":true,"AliasSalt":"0011"}`,
+		`{"BlindAliases":true,"AliasSalt":"not hex"}`,
+	} {
+		_, err := newTestStub().MockInit("1", "", []string{config})
+		HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "args"))
+	}
+
+	//the salt of a registrant is only accepted within its size limits
+	stub := newTestStub()
+	checkInit(t, stub, nil)
+	signer, err := client.GeneratePrivateKeySigner()
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	registrant, err := client.CreateRegistrant(signer, "Carol", "", client.WithAliasSalt([]byte("short")))
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	args, err := client.EncodeArgs(registrant)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	_, err = stub.MockInvoke("2", "createRegistrant", []string{args})
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "AliasSalt"))
+}
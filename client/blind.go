@@ -0,0 +1,60 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"strings"
+
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	A registry deployed with BlindAliases stores aliases as "blinded:<hex sha256(salt || alias)>" instead
+	of the raw identifier, in its keys and in Thing records. Typed aliases are normalized (see the alias
+	types of the chaincode) before they are blinded. Transactions and the thing query take either the raw
+	alias, which the chaincode blinds, or the blinded form computed with BlindAlias, which keeps the raw
+	identifier out of the transaction as well.
+	The salts are stored on the ledger, so blinding hides an inventory from range scans but cannot stop a
+	brute force search of identifiers with little entropy, such as IMEIs of a known model.
+*/
+const BlindedAliasPrefix = "blinded:"
+
+/*
+	returns the blinded form of an alias.
+*/
+func BlindAlias(salt []byte, alias string) string {
+	digest := sha256.Sum256(append(append([]byte{}, salt...), alias...))
+	return BlindedAliasPrefix + hex.EncodeToString(digest[:])
+}
+
+/*
+	reports whether alias is in the blinded form: the prefix and 64 lower case hex digits.
+*/
+func IsBlindedAlias(alias string) bool {
+	digest := strings.TrimPrefix(alias, BlindedAliasPrefix)
+	if len(digest) != len(alias)-len(BlindedAliasPrefix) || len(digest) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil && digest == strings.ToLower(digest)
+}
+
+/*
+	sets the AliasSalt of a createRegistrant transaction, which the registrant's scoped typed aliases are
+	blinded with instead of the registry salt.
+*/
+func WithAliasSalt(salt []byte) Option {
+	return func(tx proto.Message) {
+		reflect.ValueOf(tx).Elem().FieldByName("AliasSalt").SetBytes(salt)
+	}
+}
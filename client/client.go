@@ -0,0 +1,423 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/btcsuite/btcd/btcec"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	Signer signs registry messages. Implementations can keep the private key elsewhere, e.g. in an HSM.
+	|		PublicKey returns the SEC1 compressed secp256k1 public key
+	|		Sign returns a DER encoded ECDSA signature over sha256(message)
+*/
+type Signer interface {
+	PublicKey() []byte
+	Sign(message string) ([]byte, error)
+}
+
+/*
+	PrivateKeySigner is a Signer holding a secp256k1 private key in memory.
+*/
+type PrivateKeySigner struct {
+	key *btcec.PrivateKey
+}
+
+/*
+	creates a PrivateKeySigner from a hex encoded 32 byte private key.
+*/
+func NewPrivateKeySigner(privateKeyHex string) (*PrivateKeySigner, error) {
+	privKeyBytes, err := hex.DecodeString(privateKeyHex)
+	if err != nil || len(privKeyBytes) != 32 {
+		return nil, fmt.Errorf("private key (%s) is not 32 hex encoded bytes", privateKeyHex)
+	}
+	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), privKeyBytes)
+	return &PrivateKeySigner{privKey}, nil
+}
+
+/*
+	generates a new random secp256k1 key.
+*/
+func GeneratePrivateKeySigner() (*PrivateKeySigner, error) {
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKeySigner{privKey}, nil
+}
+
+func (s *PrivateKeySigner) PublicKey() []byte {
+	return s.key.PubKey().SerializeCompressed()
+}
+
+/*
+	returns the hex encoded 32 byte private key.
+*/
+func (s *PrivateKeySigner) PrivateKeyHex() string {
+	return hex.EncodeToString(s.key.Serialize())
+}
+
+func (s *PrivateKeySigner) Sign(message string) ([]byte, error) {
+	messageBytes := sha256.Sum256([]byte(message))
+	sig, err := s.key.Sign(messageBytes[:])
+	if err != nil {
+		return nil, fmt.Errorf("error signing message (%s): %v", message, err)
+	}
+	return sig.Serialize(), nil
+}
+
+/*
+	verifies a DER encoded signature over sha256(message) against a SEC1 encoded secp256k1 public key.
+	The signature must be canonical (see CheckCanonicalSignature), so that a signed message has exactly one
+	valid signature encoding. This is the check the chaincode applies to every signed transaction.
+*/
+func Verify(pubKeyBytes []byte, sigBytes []byte, message string) error {
+	err := CheckCanonicalSignature(sigBytes)
+	if err != nil {
+		return err
+	}
+	return VerifyLegacy(pubKeyBytes, sigBytes, message)
+}
+
+/*
+	verifies a signature like Verify, but also accepts signatures that are not canonical, e.g. with a high S
+	value or trailing bytes. The chaincode uses it when deployed with LegacySignatures.
+*/
+func VerifyLegacy(pubKeyBytes []byte, sigBytes []byte, message string) error {
+	//deserialize public key bytes into a public key object
+	creatorKey, err := btcec.ParsePubKey(pubKeyBytes, btcec.S256())
+	if err != nil {
+		return fmt.Errorf("Invalid pubkey key (%s)\n", hex.EncodeToString(pubKeyBytes))
+	}
+
+	//DER is a standard for serialization
+	//parsing DER signature from bitcoin curve into a signature object
+	signature, err := btcec.ParseDERSignature(sigBytes, btcec.S256())
+	if err != nil {
+		return fmt.Errorf("Bad Creator signature encoding\n")
+	}
+
+	messageBytes := sha256.Sum256([]byte(message))
+
+	//try to verify the signature
+	success := signature.Verify(messageBytes[:], creatorKey)
+	if !success {
+		return fmt.Errorf("Invalid Creator Signature\n")
+	}
+	return nil
+}
+
+var halfOrder = new(big.Int).Rsh(btcec.S256().N, 1)
+
+/*
+	checks that a signature is canonical, as in BIP-62:
+	|		strict DER		0x30 <len> 0x02 <len R> <R> 0x02 <len S> <S>, minimally encoded, with nothing after S
+	|		low S			S <= N/2, since (R, N-S) is also a valid signature of the same message
+*/
+func CheckCanonicalSignature(sigBytes []byte) error {
+	signature, err := btcec.ParseDERSignature(sigBytes, btcec.S256())
+	if err != nil {
+		return fmt.Errorf("Bad Creator signature encoding: %v\n", err)
+	}
+	if signature.S.Cmp(halfOrder) > 0 {
+		return fmt.Errorf("Signature is not canonical: S is greater than N/2\n")
+	}
+	if !bytes.Equal(signature.Serialize(), sigBytes) {
+		return fmt.Errorf("Signature is not canonical: not strict DER\n")
+	}
+	return nil
+}
+
+/*
+	returns the canonical encoding of a DER or BER encoded signature, for signers that produce high S
+	values or non-minimal encodings.
+*/
+func CanonicalSignature(sigBytes []byte) ([]byte, error) {
+	signature, err := btcec.ParseSignature(sigBytes, btcec.S256())
+	if err != nil {
+		return nil, fmt.Errorf("Bad signature encoding: %v", err)
+	}
+	return signature.Serialize(), nil
+}
+
+/*
+	returns the hex encoded public key of a signer, as used in RegistrantPubkey fields.
+*/
+func PubkeyHex(signer Signer) string {
+	return hex.EncodeToString(signer.PublicKey())
+}
+
+/*
+	parses a secp256k1 public key in any SEC1 encoding (compressed, uncompressed or hybrid) and returns its
+	compressed encoding, which is the form the registry stores and signs.
+*/
+func NormalizePubkey(pubKeyBytes []byte) ([]byte, error) {
+	key, err := btcec.ParsePubKey(pubKeyBytes, btcec.S256())
+	if err != nil {
+		return nil, fmt.Errorf("public key (%s) is invalid: %v", hex.EncodeToString(pubKeyBytes), err)
+	}
+	return key.SerializeCompressed(), nil
+}
+
+/*
+	normalizes a hex encoded public key of either hex case to the lower case hex of its compressed encoding,
+	as used in RegistrantPubkey fields, ledger keys and signed messages.
+*/
+func NormalizePubkeyHex(pubkeyHex string) (string, error) {
+	pubKeyBytes, err := hex.DecodeString(pubkeyHex)
+	if err != nil {
+		return "", fmt.Errorf("public key (%s) is not hex", pubkeyHex)
+	}
+	normalized, err := NormalizePubkey(pubKeyBytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(normalized), nil
+}
+
+/*
+	marshalls a transaction and hex encodes it, giving the args[0] string expected by Invoke.
+*/
+func EncodeArgs(tx proto.Message) (string, error) {
+	txBytes, err := proto.Marshal(tx)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling transaction: %v", err)
+	}
+	return hex.EncodeToString(txBytes), nil
+}
+
+/*
+	builds a signed createRegistrant transaction for the signer's key.
+*/
+func CreateRegistrant(signer Signer, registrantName string, data string, options ...Option) (*IOTRegistryTX.CreateRegistrantTX, error) {
+	tx := &IOTRegistryTX.CreateRegistrantTX{
+		RegistrantName:   registrantName,
+		RegistrantPubkey: signer.PublicKey(),
+		Data:             data,
+	}
+	applyOptions(tx, options)
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, CreateRegistrantMessage(registrantName, hex.EncodeToString(tx.RegistrantPubkey), data, tx.AliasSalt)))
+	return tx, err
+}
+
+/*
+	builds a signed registerThing transaction for a thing owned by the signer.
+*/
+func RegisterThing(signer Signer, nonce []byte, aliases []string, typedAliases []*IOTRegistryTX.TypedAlias,
+	spec string, data string, options ...Option) (*IOTRegistryTX.RegisterThingTX, error) {
+
+	tx := &IOTRegistryTX.RegisterThingTX{
+		Nonce:            nonce,
+		Aliases:          aliases,
+		TypedAliases:     typedAliases,
+		RegistrantPubkey: PubkeyHex(signer),
+		Spec:             spec,
+		Data:             data,
+	}
+	applyOptions(tx, options)
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, RegisterThingMessage(tx)))
+	return tx, err
+}
+
+/*
+	builds a signed registerSpec transaction for a spec owned by the signer.
+*/
+func RegisterSpec(signer Signer, specName string, data string, options ...Option) (*IOTRegistryTX.RegisterSpecTX, error) {
+	tx := &IOTRegistryTX.RegisterSpecTX{
+		SpecName:         specName,
+		RegistrantPubkey: PubkeyHex(signer),
+		Data:             data,
+	}
+	applyOptions(tx, options)
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, RegisterSpecMessage(specName, tx.RegistrantPubkey, data, tx.Content)))
+	return tx, err
+}
+
+/*
+	builds a signed registerThingsBatch transaction. The entries need no signatures; their
+	RegistrantPubkey is set to the signer's key.
+*/
+func RegisterThingsBatch(signer Signer, things []*IOTRegistryTX.RegisterThingTX, options ...Option) (*IOTRegistryTX.RegisterThingsBatchTX, error) {
+	tx := &IOTRegistryTX.RegisterThingsBatchTX{RegistrantPubkey: PubkeyHex(signer), Things: things}
+	applyOptions(tx, options)
+	for _, thing := range things {
+		thing.RegistrantPubkey = tx.RegistrantPubkey
+		thing.Signature = nil
+	}
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, RegisterThingsBatchMessage(things)))
+	return tx, err
+}
+
+/*
+	builds an attachThing transaction signed by the owners of the parent and the child. linkSequence is
+	the current LinkSequence of the child (see the thing query).
+*/
+func AttachThing(parentSigner Signer, childSigner Signer, parentNonce []byte, childNonce []byte, linkSequence int64, options ...Option) (*IOTRegistryTX.AttachThingTX, error) {
+	tx := &IOTRegistryTX.AttachThingTX{ParentNonce: parentNonce, ChildNonce: childNonce, LinkSequence: linkSequence}
+	applyOptions(tx, options)
+	message := SignedMessage(tx, ThingLinkMessage("attachThing", parentNonce, childNonce, linkSequence))
+	var err error
+	tx.ParentSignature, err = parentSigner.Sign(message)
+	if err != nil {
+		return nil, err
+	}
+	tx.ChildSignature, err = childSigner.Sign(message)
+	return tx, err
+}
+
+/*
+	builds a detachThing transaction signed by the owners of the parent and the child. linkSequence is
+	the current LinkSequence of the child (see the thing query).
+*/
+func DetachThing(parentSigner Signer, childSigner Signer, parentNonce []byte, childNonce []byte, linkSequence int64, options ...Option) (*IOTRegistryTX.DetachThingTX, error) {
+	tx := &IOTRegistryTX.DetachThingTX{ChildNonce: childNonce, LinkSequence: linkSequence}
+	applyOptions(tx, options)
+	message := SignedMessage(tx, ThingLinkMessage("detachThing", parentNonce, childNonce, linkSequence))
+	var err error
+	tx.ParentSignature, err = parentSigner.Sign(message)
+	if err != nil {
+		return nil, err
+	}
+	tx.ChildSignature, err = childSigner.Sign(message)
+	return tx, err
+}
+
+/*
+	builds a signed createGroup transaction for a group owned by the signer.
+*/
+func CreateGroup(signer Signer, groupName string, data string, options ...Option) (*IOTRegistryTX.CreateGroupTX, error) {
+	tx := &IOTRegistryTX.CreateGroupTX{GroupName: groupName, RegistrantPubkey: PubkeyHex(signer), Data: data}
+	applyOptions(tx, options)
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, CreateGroupMessage(groupName, tx.RegistrantPubkey, data)))
+	return tx, err
+}
+
+/*
+	builds a signed addGroupMembers transaction. version is the current Version of the group (see the
+	groupMembers query).
+*/
+func AddGroupMembers(signer Signer, groupName string, version int64, nonces [][]byte, options ...Option) (*IOTRegistryTX.GroupMembersTX, error) {
+	return groupMembers(signer, "addGroupMembers", groupName, version, nonces, options...)
+}
+
+/*
+	builds a signed removeGroupMembers transaction. version is the current Version of the group.
+*/
+func RemoveGroupMembers(signer Signer, groupName string, version int64, nonces [][]byte, options ...Option) (*IOTRegistryTX.GroupMembersTX, error) {
+	return groupMembers(signer, "removeGroupMembers", groupName, version, nonces, options...)
+}
+
+func groupMembers(signer Signer, function string, groupName string, version int64, nonces [][]byte, options ...Option) (*IOTRegistryTX.GroupMembersTX, error) {
+	tx := &IOTRegistryTX.GroupMembersTX{GroupName: groupName, Nonces: nonces, Version: version}
+	applyOptions(tx, options)
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, GroupMembersMessage(function, groupName, version, nonces)))
+	return tx, err
+}
+
+/*
+	builds a signed deleteGroup transaction. version is the current Version of the group.
+*/
+func DeleteGroup(signer Signer, groupName string, version int64, options ...Option) (*IOTRegistryTX.DeleteGroupTX, error) {
+	tx := &IOTRegistryTX.DeleteGroupTX{GroupName: groupName, Version: version}
+	applyOptions(tx, options)
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, DeleteGroupMessage(groupName, version)))
+	return tx, err
+}
+
+/*
+	builds a signed setThingStatus transaction. With asDelegate the signer's key is named as SignerPubkey,
+	otherwise the signer must be the owner of the thing. statusSequence is the current StatusSequence of
+	the thing (see the thing query).
+*/
+func SetThingStatus(signer Signer, nonce []byte, statusSequence int64, status string, reason string, asDelegate bool, options ...Option) (*IOTRegistryTX.SetThingStatusTX, error) {
+	tx := &IOTRegistryTX.SetThingStatusTX{Nonce: nonce, StatusSequence: statusSequence, Status: status, Reason: reason}
+	applyOptions(tx, options)
+	if asDelegate {
+		tx.SignerPubkey = PubkeyHex(signer)
+	}
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, SetThingStatusMessage(nonce, statusSequence, status, reason)))
+	return tx, err
+}
+
+/*
+	builds a signed setStatusDelegate transaction allowing (or, with revoke, no longer allowing)
+	delegatePubkey to set the status of the signer's things. sequence is the current Sequence of the
+	delegate (see the statusDelegate query), 0 for a key that has never been a delegate.
+*/
+func SetStatusDelegate(signer Signer, delegatePubkey string, sequence int64, revoke bool, options ...Option) (*IOTRegistryTX.StatusDelegateTX, error) {
+	normalized, err := NormalizePubkeyHex(delegatePubkey)
+	if err != nil {
+		return nil, err
+	}
+	tx := &IOTRegistryTX.StatusDelegateTX{RegistrantPubkey: PubkeyHex(signer), DelegatePubkey: normalized, Revoke: revoke, Sequence: sequence}
+	applyOptions(tx, options)
+	tx.Signature, err = signer.Sign(SignedMessage(tx, StatusDelegateMessage(tx.RegistrantPubkey, normalized, revoke, sequence)))
+	return tx, err
+}
+
+/*
+	builds a signed setPrivateData transaction, see EncryptPrivateData. Without privateData it removes
+	the private data of the thing. privateDataVersion is the current PrivateDataVersion of the thing.
+*/
+func SetPrivateData(signer Signer, nonce []byte, privateDataVersion int64, privateData *IOTRegistryTX.EncryptedData, options ...Option) (*IOTRegistryTX.SetPrivateDataTX, error) {
+	tx := &IOTRegistryTX.SetPrivateDataTX{Nonce: nonce, PrivateData: privateData, PrivateDataVersion: privateDataVersion}
+	applyOptions(tx, options)
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, SetPrivateDataMessage(nonce, privateDataVersion, privateData)))
+	return tx, err
+}
+
+/*
+	builds a signed grantReader transaction giving readerPubkey access to the private data of a thing,
+	by wrapping the data key (see UnwrapDataKey) for the reader. privateDataVersion is the current
+	PrivateDataVersion of the thing.
+*/
+func GrantReader(signer Signer, nonce []byte, privateDataVersion int64, dataKey []byte, readerPubkey string, options ...Option) (*IOTRegistryTX.PrivateDataReaderTX, error) {
+	reader, err := WrapDataKey(dataKey, readerPubkey)
+	if err != nil {
+		return nil, err
+	}
+	tx := &IOTRegistryTX.PrivateDataReaderTX{Nonce: nonce, Reader: reader, PrivateDataVersion: privateDataVersion}
+	applyOptions(tx, options)
+	tx.Signature, err = signer.Sign(SignedMessage(tx, PrivateDataReaderMessage("grantReader", nonce, privateDataVersion, reader)))
+	return tx, err
+}
+
+/*
+	builds a signed revokeReader transaction removing the wrapped data key of readerPubkey.
+	privateDataVersion is the current PrivateDataVersion of the thing.
+*/
+func RevokeReader(signer Signer, nonce []byte, privateDataVersion int64, readerPubkey string, options ...Option) (*IOTRegistryTX.PrivateDataReaderTX, error) {
+	normalized, err := NormalizePubkeyHex(readerPubkey)
+	if err != nil {
+		return nil, err
+	}
+	tx := &IOTRegistryTX.PrivateDataReaderTX{Nonce: nonce, Reader: &IOTRegistryTX.WrappedKey{ReaderPubkey: normalized}, PrivateDataVersion: privateDataVersion}
+	applyOptions(tx, options)
+	tx.Signature, err = signer.Sign(SignedMessage(tx, PrivateDataReaderMessage("revokeReader", nonce, privateDataVersion, tx.Reader)))
+	return tx, err
+}
@@ -0,0 +1,525 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/btcsuite/btcd/btcec"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	checks a signature the same way the chaincode's verify() does
+*/
+func checkSig(pubKeyBytes []byte, sigBytes []byte, message string) error {
+	pubKey, err := btcec.ParsePubKey(pubKeyBytes, btcec.S256())
+	if err != nil {
+		return err
+	}
+	sig, err := btcec.ParseDERSignature(sigBytes, btcec.S256())
+	if err != nil {
+		return err
+	}
+	messageBytes := sha256.Sum256([]byte(message))
+	if !sig.Verify(messageBytes[:], pubKey) {
+		return fmt.Errorf("signature does not verify for message (%s)", message)
+	}
+	return nil
+}
+
+func TestPrivateKeySigner(t *testing.T) {
+	signer, err := NewPrivateKeySigner("94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if PubkeyHex(signer) != "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc" {
+		t.Errorf("unexpected public key (%s)", PubkeyHex(signer))
+	}
+	if _, err := NewPrivateKeySigner("abcd"); err == nil {
+		t.Errorf("accepted a short private key")
+	}
+	generated, err := GeneratePrivateKeySigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := NewPrivateKeySigner(generated.PrivateKeyHex())
+	if err != nil || PubkeyHex(restored) != PubkeyHex(generated) {
+		t.Errorf("generated key does not round trip: %v", err)
+	}
+}
+
+func TestTransactionSignatures(t *testing.T) {
+	signer, _ := NewPrivateKeySigner("94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20")
+
+	registrant, err := CreateRegistrant(signer, "Alice", "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSig(signer.PublicKey(), registrant.Signature, "Alice:"+PubkeyHex(signer)+":data"); err != nil {
+		t.Error(err)
+	}
+
+	typedAliases := []*IOTRegistryTX.TypedAlias{{Type: "mac", Value: "00:11:22:33:44:55", Scoped: true}}
+	thing, err := RegisterThing(signer, []byte{1}, []string{"a", "b"}, typedAliases, "spec", "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := PubkeyHex(signer) + ":a:b:data:spec:mac:true:00:11:22:33:44:55"
+	if err := checkSig(signer.PublicKey(), thing.Signature, expected); err != nil {
+		t.Error(err)
+	}
+
+	deviceKey := "02242a1c19bc831cd95a9e5492015043250cbc17d0eceb82612ce08736b8d753a6"
+	device, err := RegisterThing(signer, []byte{2}, nil, nil, "spec", "", WithDevicePubkey(deviceKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSig(signer.PublicKey(), device.Signature, PubkeyHex(signer)+"::spec:devicePubkey:"+deviceKey); err != nil {
+		t.Error(err)
+	}
+
+	spec, err := RegisterSpec(signer, "spec", "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSig(signer.PublicKey(), spec.Signature, "spec:"+PubkeyHex(signer)+":data"); err != nil {
+		t.Error(err)
+	}
+
+	args, err := EncodeArgs(thing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	argsBytes, err := hex.DecodeString(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := IOTRegistryTX.RegisterThingTX{}
+	if err := proto.Unmarshal(argsBytes, &decoded); err != nil || decoded.Spec != "spec" || len(decoded.TypedAliases) != 1 {
+		t.Errorf("encoded args do not decode to the transaction: %v", err)
+	}
+}
+
+func TestBatchMerkleRoot(t *testing.T) {
+	things := []*IOTRegistryTX.RegisterThingTX{{Nonce: []byte{1}}, {Nonce: []byte{2}}, {Nonce: []byte{3}}}
+	root := BatchMerkleRoot(things)
+	if hex.EncodeToString(root) == hex.EncodeToString(BatchMerkleRoot(things[:2])) {
+		t.Errorf("odd leaf did not change the root")
+	}
+	if hex.EncodeToString(BatchMerkleRoot(things[:1])) != hex.EncodeToString(BatchLeaf(things[0])) {
+		t.Errorf("root of a single entry is not its leaf")
+	}
+	swapped := []*IOTRegistryTX.RegisterThingTX{things[1], things[0], things[2]}
+	if hex.EncodeToString(root) == hex.EncodeToString(BatchMerkleRoot(swapped)) {
+		t.Errorf("reordering entries did not change the root")
+	}
+	if BatchMerkleRoot(nil) != nil {
+		t.Errorf("empty batch has a root")
+	}
+}
+
+func TestJSONArgs(t *testing.T) {
+	signer, err := NewPrivateKeySigner("94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	typedAliases := []*IOTRegistryTX.TypedAlias{{Type: "serial", Value: "SN1", Scoped: true}}
+	tx, err := RegisterThing(signer, []byte{0xff, 1}, []string{"a", "b"}, typedAliases, "spec", "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, byteEncoding := range []string{ByteEncodingHex, ByteEncodingBase64} {
+		jsonArgs, err := EncodeJSONArgs(tx, byteEncoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeJSONArgs("registerThing", []byte(jsonArgs), byteEncoding)
+		if err != nil {
+			t.Fatalf("%s: %v", jsonArgs, err)
+		}
+		if !proto.Equal(tx, decoded) {
+			t.Errorf("%s JSON did not round trip: %s", byteEncoding, jsonArgs)
+		}
+	}
+	jsonArgs, _ := EncodeJSONArgs(&IOTRegistryTX.RegisterSpecTX{SpecName: "s", Signature: []byte{1}}, ByteEncodingHex)
+	if jsonArgs != `{"Signature":"01","SpecName":"s"}` {
+		t.Errorf("unexpected canonical JSON %s", jsonArgs)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	registryErr := &Error{Code: CodeNotFound, Message: "Thing (0a) does not exist", Key: "Thing:0a"}
+	var tests = []struct {
+		err      error
+		expected *Error
+	}{
+		{registryErr, registryErr},
+		{fmt.Errorf("%v", registryErr), registryErr},
+		{fmt.Errorf("Error invoking chaincode: Transaction or query returned with failure: %v\n", registryErr), registryErr},
+		{fmt.Errorf(`bad {"code": json %v`, registryErr), registryErr},
+		{fmt.Errorf("Nonce (0a) is unavailable\n"), &Error{Code: CodeUnknown, Message: "Nonce (0a) is unavailable\n"}},
+	}
+	for _, test := range tests {
+		parsed := ParseError(test.err)
+		if *parsed != *test.expected {
+			t.Errorf("ParseError(%v) returned %v", test.err, parsed)
+		}
+	}
+	if ParseError(nil) != nil || ErrorCode(nil) != "" {
+		t.Errorf("ParseError(nil) is not nil")
+	}
+	if ErrorCode(fmt.Errorf("wrapped: %v", registryErr)) != CodeNotFound {
+		t.Errorf("ErrorCode did not find the code")
+	}
+}
+
+func TestNormalizePubkeyHex(t *testing.T) {
+	signer, err := NewPrivateKeySigner("94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := btcec.ParsePubKey(signer.PublicKey(), btcec.S256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := PubkeyHex(signer)
+	for _, encoding := range []string{
+		compressed,
+		strings.ToUpper(compressed),
+		hex.EncodeToString(key.SerializeUncompressed()),
+		strings.ToUpper(hex.EncodeToString(key.SerializeUncompressed())),
+		hex.EncodeToString(key.SerializeHybrid()),
+	} {
+		normalized, err := NormalizePubkeyHex(encoding)
+		if err != nil || normalized != compressed {
+			t.Errorf("NormalizePubkeyHex(%s) returned (%s) %v", encoding, normalized, err)
+		}
+	}
+	for _, invalid := range []string{"", "zz", "04" + compressed[2:], compressed[:64]} {
+		if _, err := NormalizePubkeyHex(invalid); err == nil {
+			t.Errorf("NormalizePubkeyHex(%s) accepted an invalid key", invalid)
+		}
+	}
+}
+
+func TestSetStatusDelegateNormalizesPubkey(t *testing.T) {
+	signer, err := GeneratePrivateKeySigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegate, err := GeneratePrivateKeySigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := btcec.ParsePubKey(delegate.PublicKey(), btcec.S256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := SetStatusDelegate(signer, hex.EncodeToString(key.SerializeUncompressed()), 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.DelegatePubkey != PubkeyHex(delegate) {
+		t.Errorf("SetStatusDelegate kept the DelegatePubkey (%s)", tx.DelegatePubkey)
+	}
+	if err := Verify(signer.PublicKey(), tx.Signature, StatusDelegateMessage(tx.RegistrantPubkey, PubkeyHex(delegate), false, 0)); err != nil {
+		t.Errorf("SetStatusDelegate did not sign the normalized DelegatePubkey: %v", err)
+	}
+	if _, err := SetStatusDelegate(signer, "zz", 0, false); err == nil {
+		t.Errorf("SetStatusDelegate accepted an invalid DelegatePubkey")
+	}
+}
+
+/*
+	DER encodes integers given as big endian bytes, without canonicalizing them
+*/
+func derSignature(r []byte, s []byte) []byte {
+	sig := []byte{0x30, byte(4 + len(r) + len(s)), 0x02, byte(len(r))}
+	sig = append(sig, r...)
+	sig = append(sig, 0x02, byte(len(s)))
+	return append(sig, s...)
+}
+
+func TestCanonicalSignatures(t *testing.T) {
+	signer, err := NewPrivateKeySigner("94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := "registerSpec:data"
+	sigBytes, err := signer.Sign(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := btcec.ParseDERSignature(sigBytes, btcec.S256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(signer.PublicKey(), sigBytes, message); err != nil {
+		t.Errorf("canonical signature was rejected: %v", err)
+	}
+
+	r := sig.R.Bytes()
+	if r[0]&0x80 != 0 {
+		r = append([]byte{0}, r...)
+	}
+	highS := new(big.Int).Sub(btcec.S256().N, sig.S).Bytes()
+	if highS[0]&0x80 != 0 {
+		highS = append([]byte{0}, highS...)
+	}
+	var tests = []struct {
+		name   string
+		sig    []byte
+		legacy bool
+	}{
+		{"high S", derSignature(r, highS), true},
+		{"trailing byte", append(append([]byte{}, sigBytes...), 0x00), true},
+		{"padded R", derSignature(append([]byte{0, 0}, r...), sig.S.Bytes()), false},
+		{"negative S", derSignature(r, append([]byte{0x80}, sig.S.Bytes()...)), false},
+		{"long form length", append([]byte{0x30, 0x81, sigBytes[1]}, sigBytes[2:]...), false},
+		{"truncated", sigBytes[:len(sigBytes)-1], false},
+	}
+	for _, test := range tests {
+		if err := Verify(signer.PublicKey(), test.sig, message); err == nil {
+			t.Errorf("%s signature (%x) was accepted", test.name, test.sig)
+		}
+		if err := VerifyLegacy(signer.PublicKey(), test.sig, message); (err == nil) != test.legacy {
+			t.Errorf("%s signature (%x): legacy verification returned %v", test.name, test.sig, err)
+		}
+	}
+
+	canonical, err := CanonicalSignature(derSignature(r, highS))
+	if err != nil || !bytes.Equal(canonical, sigBytes) {
+		t.Errorf("CanonicalSignature returned (%x) %v, expected (%x)", canonical, err, sigBytes)
+	}
+}
+
+func TestSignedMessage(t *testing.T) {
+	spec := &IOTRegistryTX.RegisterSpecTX{SpecName: "spec"}
+	if got := SignedMessage(spec, "message"); got != "message" {
+		t.Errorf("message without a validity window got (%s)", got)
+	}
+	ValidBetween(time.Time{}, time.Unix(1500000000, 0))(spec)
+	if got := SignedMessage(spec, "message"); got != "validity:0:1500000000:message" {
+		t.Errorf("message with a validity window got (%s)", got)
+	}
+	if notBefore, notAfter := ValidityWindow(&IOTRegistryTX.MigrateKeysTX{}); notBefore != 0 || notAfter != 0 {
+		t.Errorf("transaction without validity fields has a window (%d, %d)", notBefore, notAfter)
+	}
+
+	signer, _ := NewPrivateKeySigner("94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20")
+	spec, err := RegisterSpec(signer, "spec", "data", ValidFor(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.NotAfter-spec.NotBefore != 3600 {
+		t.Errorf("ValidFor(1h) set the window (%d, %d)", spec.NotBefore, spec.NotAfter)
+	}
+	if err := checkSig(signer.PublicKey(), spec.Signature, SignedMessage(spec, "spec:"+PubkeyHex(signer)+":data")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestContentHashes(t *testing.T) {
+	content := []byte("firmware manual")
+	sum := sha256.Sum256(content)
+	multihash := append([]byte{0x12, 0x20}, sum[:]...)
+	base58 := ""
+	for value := new(big.Int).SetBytes(multihash); value.Sign() > 0; {
+		digit := new(big.Int)
+		value.DivMod(value, big.NewInt(58), digit)
+		base58 = string(base58Alphabet[digit.Int64()]) + base58
+	}
+	for _, hash := range []string{
+		ContentHash(content),
+		"f" + hex.EncodeToString(multihash),
+		"z" + base58,
+	} {
+		if err := VerifyContent(hash, int64(len(content)), content); err != nil {
+			t.Errorf("content does not verify against (%s): %v", hash, err)
+		}
+		if err := VerifyContent(hash, 0, []byte("tampered")); err == nil {
+			t.Errorf("tampered content verifies against (%s)", hash)
+		}
+	}
+	//CIDv1 of the empty raw block
+	if err := VerifyContent("bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", 0, nil); err != nil {
+		t.Error(err)
+	}
+	if err := VerifyContent(ContentHash(content), 1, content); err == nil {
+		t.Errorf("content of the wrong size verifies")
+	}
+	for _, hash := range []string{
+		"sha256:" + strings.ToUpper(hex.EncodeToString(sum[:])),
+		"sha256:00",
+		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n",
+		"bafybeihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku",
+		"f1220" + hex.EncodeToString(sum[:16]),
+		"md5:" + hex.EncodeToString(sum[:16]),
+	} {
+		if err := CheckContentRef(&IOTRegistryTX.ContentRef{URI: "https://example.com/manual.pdf", Hash: hash}); err == nil {
+			t.Errorf("accepted Hash (%s)", hash)
+		}
+	}
+	for _, ref := range []*IOTRegistryTX.ContentRef{
+		{URI: "manual.pdf", Hash: ContentHash(content)},
+		{URI: "ipfs://bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", Hash: ContentHash(content), Size: -1},
+		{URI: "https://example.com/manual.pdf", Hash: ContentHash(content), MediaType: "not a media type"},
+	} {
+		if err := CheckContentRef(ref); err == nil {
+			t.Errorf("accepted ContentRef (%v)", ref)
+		}
+	}
+	if err := CheckContentRef(NewContentRef("https://example.com/manual.pdf", "application/pdf", content)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPrivateDataEncryption(t *testing.T) {
+	readerPriv := "166cc93d9eadb573b329b5993b9671f1521679cea90fe52e398e66c1d6373abf"
+	reader, _ := NewPrivateKeySigner(readerPriv)
+	privateData, dataKey, err := EncryptPrivateData([]byte("customer 42"), []string{PubkeyHex(reader)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPrivateData(privateData); err != nil {
+		t.Error(err)
+	}
+	if plaintext, err := DecryptPrivateData(privateData, readerPriv); err != nil || string(plaintext) != "customer 42" {
+		t.Errorf("decrypted (%s): %v", plaintext, err)
+	}
+	if unwrapped, err := UnwrapDataKey(privateData, readerPriv); err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("unwrapped a different data key: %v", err)
+	}
+	privateData.Ciphertext[len(privateData.Ciphertext)-1] ^= 1
+	if _, err := DecryptPrivateData(privateData, readerPriv); err == nil {
+		t.Errorf("decrypted tampered ciphertext")
+	}
+
+	wrapped := privateData.Readers[0].Key
+	offCurve := append([]byte{}, wrapped...)
+	offCurve[20] ^= 0xff // the first byte of the ephemeral X coordinate
+	for _, key := range [][]byte{wrapped[:100], make([]byte, len(wrapped)), offCurve} {
+		if err := CheckWrappedKey(key); err == nil {
+			t.Errorf("accepted a malformed wrapped key")
+		}
+	}
+	if err := CheckWrappedKey(wrapped); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBlindAlias(t *testing.T) {
+	salt := []byte("salt")
+	blinded := BlindAlias(salt, "alias")
+	digest := sha256.Sum256([]byte("saltalias"))
+	if blinded != "blinded:"+hex.EncodeToString(digest[:]) {
+		t.Errorf("BlindAlias got (%s)", blinded)
+	}
+	if BlindAlias(salt, "alias") != blinded || BlindAlias([]byte("other"), "alias") == blinded {
+		t.Errorf("BlindAlias is not a function of salt and alias")
+	}
+	for alias, expected := range map[string]bool{
+		blinded: true,
+		"blinded:" + strings.ToUpper(blinded[8:]): false,
+		blinded[:len(blinded)-2]:                  false,
+		blinded[8:]:                               false,
+		"alias":                                   false,
+	} {
+		if IsBlindedAlias(alias) != expected {
+			t.Errorf("IsBlindedAlias(%s) is not %t", alias, expected)
+		}
+	}
+}
+
+func TestDIDs(t *testing.T) {
+	for _, alias := range []string{"sensor 1", "mac:00:11:22:33:44:55", "uri:https://example.com/a?b=c#d", "trailing:", "100%"} {
+		did := AliasDID(alias)
+		kind, id, err := ParseDID(did)
+		if err != nil || kind != DIDAlias || id != alias {
+			t.Errorf("alias (%s) as (%s) parsed to (%s, %s): %v", alias, did, kind, id, err)
+		}
+	}
+	if did := ThingDID([]byte{0xab}); did != "did:iotreg:thing:ab" {
+		t.Errorf("ThingDID got (%s)", did)
+	}
+	for _, did := range []string{"did:iotreg:", "did:iotreg:thing", "did:iotreg:thing:", "did:iotreg:alias:a:", "did:iotreg:alias:a%4", "did:iotreg:alias:a%zz", "did:iotreg:alias:a/b", "did:iotreg:registrant:xyz", "did:other:thing:ab"} {
+		if _, _, err := ParseDID(did); err == nil {
+			t.Errorf("parsed invalid DID (%s)", did)
+		}
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	signer, _ := NewPrivateKeySigner("94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20")
+	issuedAt := time.Unix(1500000000, 0)
+	tx, err := IssueCredential(signer, []byte{0xab}, "spec", "cred-1", issuedAt, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := ParseCredential(tx.Credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential.IssuerPubkey != PubkeyHex(signer) || credential.CredentialID != "cred-1" || !bytes.Equal(credential.SubjectNonce, []byte{0xab}) ||
+		credential.SpecName != "spec" || credential.Claims.NotBefore != 1500000000 || credential.Claims.Expires != 0 {
+		t.Errorf("parsed credential (%+v)", credential)
+	}
+	if err := credential.Verify(signer.PublicKey()); err != nil {
+		t.Error(err)
+	}
+	other, _ := GeneratePrivateKeySigner()
+	if err := credential.Verify(other.PublicKey()); err == nil {
+		t.Errorf("credential verified against another key")
+	}
+
+	//the high S form of the signature is rejected
+	highS := append([]byte{}, credential.signature...)
+	new(big.Int).Sub(btcec.S256().N, new(big.Int).SetBytes(highS[32:])).FillBytes(highS[32:])
+	credential.signature = highS
+	if err := credential.Verify(signer.PublicKey()); err == nil {
+		t.Errorf("credential with a high S verified")
+	}
+
+	if _, err := IssueCredential(signer, []byte{0xab}, "spec", "cred/1", issuedAt, time.Time{}); err == nil {
+		t.Errorf("issued a credential with an invalid CredentialID")
+	}
+	parts := strings.Split(tx.Credential, ".")
+	for _, jwt := range []string{"", parts[0] + "." + parts[1], parts[1] + "." + parts[1] + "." + parts[2], parts[0] + "." + parts[0] + "." + parts[2]} {
+		if _, err := ParseCredential(jwt); err == nil {
+			t.Errorf("parsed an invalid credential (%s)", jwt)
+		}
+	}
+}
+
+func TestSnapshotChecksum(t *testing.T) {
+	records := []SnapshotRecord{{Namespace: "Thing", Components: []string{"01"}, Value: []byte{1}}}
+	page := &SnapshotPage{Version: SnapshotVersion, Records: records, Checksum: SnapshotChecksum("", records)}
+	if err := CheckSnapshotPage(page); err != nil {
+		t.Errorf("CheckSnapshotPage failed: %v", err)
+	}
+	//the fields of a record are length prefixed, so moving bytes between them changes the checksum
+	for _, changed := range [][]SnapshotRecord{
+		{{Namespace: "Thing0", Components: []string{"1"}, Value: []byte{1}}},
+		{{Namespace: "Thing", Components: []string{"01", ""}, Value: []byte{1}}},
+		{{Namespace: "Thing", Components: []string{"01"}, Value: []byte{1}}, {}},
+		{},
+	} {
+		if SnapshotChecksum("", changed) == page.Checksum {
+			t.Errorf("records %v have the checksum of %v", changed, records)
+		}
+	}
+	if SnapshotChecksum(page.Checksum, records) == page.Checksum {
+		t.Errorf("checksum is not chained to the previous page")
+	}
+	page.Version = SnapshotVersion + 1
+	if CheckSnapshotPage(page) == nil {
+		t.Errorf("CheckSnapshotPage accepted version (%d)", page.Version)
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"mime"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+The data of a thing or spec can live off-chain, referenced by a ContentRef in place of Data: the URI
+the content is served from, a hash of its bytes, and optionally its Size and MediaType. Hash is one of
+|		sha256:<hex>			sha256 of the content in lower case hex (ContentHash)
+|		<multibase multihash>	a sha2-256 or sha2-512 multihash, multibase encoded (f base16, b base32, z base58btc)
+|		<multibase CIDv1>		a CIDv1 with the raw codec, e.g. "bafkrei..."
+A CID with another codec, including a CIDv0 ("Qm..."), hashes a dag-pb encoding of the content rather
+than the content itself, so it cannot be checked against the bytes and is rejected.
+*/
+const sha256HashPrefix = "sha256:"
+
+const (
+	multihashSHA256 = 0x12
+	multihashSHA512 = 0x13
+	cidVersion1     = 0x01
+	cidCodecRaw     = 0x55
+)
+
+var multihashFuncs = map[uint64]struct {
+	size int
+	sum  func(data []byte) []byte
+}{
+	multihashSHA256: {sha256.Size, func(data []byte) []byte { sum := sha256.Sum256(data); return sum[:] }},
+	multihashSHA512: {sha512.Size, func(data []byte) []byte { sum := sha512.Sum512(data); return sum[:] }},
+}
+
+/*
+returns the sha256 Hash of content in the "sha256:<hex>" form.
+*/
+func ContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return sha256HashPrefix + hex.EncodeToString(sum[:])
+}
+
+/*
+builds a ContentRef for content served from uri.
+*/
+func NewContentRef(uri string, mediaType string, content []byte) *IOTRegistryTX.ContentRef {
+	return &IOTRegistryTX.ContentRef{URI: uri, Hash: ContentHash(content), Size: int64(len(content)), MediaType: mediaType}
+}
+
+/*
+sets the Content of a registerThing or registerSpec transaction, see NewContentRef.
+*/
+func WithContent(content *IOTRegistryTX.ContentRef) Option {
+	return func(tx proto.Message) {
+		reflect.ValueOf(tx).Elem().FieldByName("Content").Set(reflect.ValueOf(content))
+	}
+}
+
+/*
+part of a registerThing or registerSpec message covering its ContentRef:
+":content:<Hash>:<Size>:<MediaType>:<URI>", or nothing without one
+*/
+func ContentMessage(content *IOTRegistryTX.ContentRef) string {
+	if content == nil {
+		return ""
+	}
+	return ":content:" + content.Hash + ":" + strconv.FormatInt(content.Size, 10) + ":" + content.MediaType + ":" + content.URI
+}
+
+/*
+checks the fields of a ContentRef: an absolute URI, a Hash in one of the supported forms, a Size that is
+not negative, and a MediaType that parses if it is set.
+*/
+func CheckContentRef(content *IOTRegistryTX.ContentRef) error {
+	uri, err := url.Parse(content.URI)
+	if err != nil || !uri.IsAbs() {
+		return fmt.Errorf("URI (%s) is not an absolute URI\n", content.URI)
+	}
+	if _, _, err := parseContentHash(content.Hash); err != nil {
+		return err
+	}
+	if content.Size < 0 {
+		return fmt.Errorf("Size (%d) is negative\n", content.Size)
+	}
+	if len(content.MediaType) != 0 {
+		if _, _, err := mime.ParseMediaType(content.MediaType); err != nil {
+			return fmt.Errorf("MediaType (%s) is not a media type: %v\n", content.MediaType, err)
+		}
+	}
+	return nil
+}
+
+/*
+checks that hash is a Hash in one of the supported forms, e.g. the ImageHash of a firmware release.
+*/
+func CheckContentHash(hash string) error {
+	_, _, err := parseContentHash(hash)
+	return err
+}
+
+/*
+checks content against a stored Hash and Size. A Size of zero is not checked.
+*/
+func VerifyContent(hash string, size int64, content []byte) error {
+	sum, digest, err := parseContentHash(hash)
+	if err != nil {
+		return err
+	}
+	if size != 0 && size != int64(len(content)) {
+		return fmt.Errorf("content is %d bytes, expected %d\n", len(content), size)
+	}
+	if !bytes.Equal(sum(content), digest) {
+		return fmt.Errorf("content does not match Hash (%s)\n", hash)
+	}
+	return nil
+}
+
+/*
+returns the hash function and the expected digest of a Hash.
+*/
+func parseContentHash(hash string) (func(data []byte) []byte, []byte, error) {
+	if strings.HasPrefix(hash, sha256HashPrefix) {
+		digest, err := hex.DecodeString(strings.TrimPrefix(hash, sha256HashPrefix))
+		if err != nil || len(digest) != sha256.Size || hash != strings.ToLower(hash) {
+			return nil, nil, fmt.Errorf("Hash (%s) is not sha256: and 64 lower case hex digits\n", hash)
+		}
+		return multihashFuncs[multihashSHA256].sum, digest, nil
+	}
+	if strings.HasPrefix(hash, "Qm") {
+		return nil, nil, fmt.Errorf("Hash (%s) is a CIDv0, which names a dag-pb block; use a CIDv1 with the raw codec\n", hash)
+	}
+	decoded, err := decodeMultibase(hash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Hash (%s) is not sha256:<hex>, a multihash or a CID: %v\n", hash, err)
+	}
+	if len(decoded) > 0 && decoded[0] == cidVersion1 {
+		codec, n := readUvarint(decoded[1:])
+		if n <= 0 || codec != cidCodecRaw {
+			return nil, nil, fmt.Errorf("Hash (%s) is a CID without the raw codec, which cannot be checked against content\n", hash)
+		}
+		decoded = decoded[1+n:]
+	}
+	code, n := readUvarint(decoded)
+	function, ok := multihashFuncs[code]
+	if n <= 0 || !ok {
+		return nil, nil, fmt.Errorf("Hash (%s) is not a sha2-256 or sha2-512 multihash\n", hash)
+	}
+	length, m := readUvarint(decoded[n:])
+	digest := decoded[n+m:]
+	if m <= 0 || length != uint64(function.size) || len(digest) != function.size {
+		return nil, nil, fmt.Errorf("Hash (%s) has a digest of the wrong length\n", hash)
+	}
+	return function.sum, digest, nil
+}
+
+func readUvarint(data []byte) (uint64, int) {
+	var value uint64
+	for i, b := range data {
+		if i == 9 {
+			return 0, -1
+		}
+		value |= uint64(b&0x7f) << (7 * uint(i))
+		if b&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+/*
+decodes the multibase encodings that CIDs and multihashes are usually written in.
+*/
+func decodeMultibase(encoded string) ([]byte, error) {
+	if len(encoded) < 2 {
+		return nil, fmt.Errorf("too short\n")
+	}
+	data := encoded[1:]
+	switch encoded[0] {
+	case 'f':
+		return hex.DecodeString(data)
+	case 'b':
+		return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(data))
+	case 'z':
+		value := new(big.Int)
+		for _, c := range data {
+			digit := strings.IndexRune(base58Alphabet, c)
+			if digit < 0 {
+				return nil, fmt.Errorf("(%c) is not a base58 digit\n", c)
+			}
+			value.Mul(value, big.NewInt(58))
+			value.Add(value, big.NewInt(int64(digit)))
+		}
+		leadingZeros := len(data) - len(strings.TrimLeft(data, "1"))
+		return append(make([]byte, leadingZeros), value.Bytes()...), nil
+	}
+	return nil, fmt.Errorf("unknown multibase prefix (%c)\n", encoded[0])
+}
@@ -0,0 +1,270 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+/*
+	A registration credential is a W3C Verifiable Credential in the JWT encoding, signed with ES256K by
+	a registrant, stating that a thing was registered by the registrant and conforms to a spec:
+	|		header		{"alg":"ES256K","typ":"JWT","kid":"<registrant DID>#key-1"}
+	|		payload		{"iss":<registrant DID>,"sub":<thing DID>,"jti":<credential URI>,"nbf":..,"iat":..,"exp":..,
+	|					 "vc":{"@context":[...],"type":["VerifiableCredential","IOTRegistrationCredential"],
+	|					 "credentialSubject":{"id":<thing DID>,"conformsTo":<SpecName>},
+	|					 "credentialStatus":{"id":<credential URI>#status,"type":"IOTRegistryCredentialStatus"}}}
+	The credential URI is "<registrant DID>/credentials/<CredentialID>". The issueCredential transaction
+	anchors a credential in the registry, which keeps its status under the issuer and CredentialID, and
+	revokeCredential revokes it. The signature is the 64 byte R || S of the JWS, with a low S as for
+	transaction signatures (see CheckCanonicalSignature).
+*/
+const (
+	CredentialAlgorithm  = "ES256K"
+	CredentialType       = "IOTRegistrationCredential"
+	CredentialStatusType = "IOTRegistryCredentialStatus"
+	credentialsContext   = "https://www.w3.org/2018/credentials/v1"
+)
+
+var credentialIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type CredentialHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+type CredentialSubject struct {
+	ID         string `json:"id"`
+	ConformsTo string `json:"conformsTo"`
+}
+
+type CredentialStatus struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type VerifiableCredential struct {
+	Context           []string          `json:"@context"`
+	Type              []string          `json:"type"`
+	CredentialSubject CredentialSubject `json:"credentialSubject"`
+	CredentialStatus  CredentialStatus  `json:"credentialStatus"`
+}
+
+type CredentialClaims struct {
+	Issuer    string               `json:"iss"`
+	Subject   string               `json:"sub"`
+	ID        string               `json:"jti"`
+	NotBefore int64                `json:"nbf"`
+	IssuedAt  int64                `json:"iat"`
+	Expires   int64                `json:"exp,omitempty"`
+	VC        VerifiableCredential `json:"vc"`
+}
+
+/*
+	Credential is a parsed registration credential. IssuerPubkey, CredentialID, SubjectNonce and SpecName
+	are taken from its claims.
+*/
+type Credential struct {
+	Header       CredentialHeader
+	Claims       CredentialClaims
+	IssuerPubkey string
+	CredentialID string
+	SubjectNonce []byte
+	SpecName     string
+	signingInput string
+	signature    []byte
+}
+
+/*
+	returns the URI of a credential, its "jti".
+*/
+func CredentialURI(issuerPubkey string, credentialID string) string {
+	return RegistrantDID(issuerPubkey) + "/credentials/" + credentialID
+}
+
+/*
+	checks a CredentialID: 1 to 64 letters, digits, ".", "-" or "_".
+*/
+func CheckCredentialID(credentialID string) error {
+	if !credentialIDPattern.MatchString(credentialID) {
+		return fmt.Errorf("CredentialID (%s) must be 1 to 64 letters, digits, \".\", \"-\" or \"_\"", credentialID)
+	}
+	return nil
+}
+
+/*
+	builds an issueCredential transaction holding a registration credential for the thing with nonce,
+	signed by the registrant. The credential is valid from issuedAt, and until expires unless it is zero.
+*/
+func IssueCredential(signer Signer, nonce []byte, specName string, credentialID string, issuedAt time.Time, expires time.Time) (*IOTRegistryTX.IssueCredentialTX, error) {
+	err := CheckCredentialID(credentialID)
+	if err != nil {
+		return nil, err
+	}
+	issuer := RegistrantDID(PubkeyHex(signer))
+	uri := CredentialURI(PubkeyHex(signer), credentialID)
+	header := CredentialHeader{Algorithm: CredentialAlgorithm, Type: "JWT", KeyID: issuer + "#key-1"}
+	claims := CredentialClaims{
+		Issuer:    issuer,
+		Subject:   ThingDID(nonce),
+		ID:        uri,
+		NotBefore: issuedAt.Unix(),
+		IssuedAt:  issuedAt.Unix(),
+		VC: VerifiableCredential{
+			Context:           []string{credentialsContext},
+			Type:              []string{"VerifiableCredential", CredentialType},
+			CredentialSubject: CredentialSubject{ID: ThingDID(nonce), ConformsTo: specName},
+			CredentialStatus:  CredentialStatus{ID: uri + "#status", Type: CredentialStatusType},
+		},
+	}
+	if !expires.IsZero() {
+		claims.Expires = expires.Unix()
+	}
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	claimsBytes, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerBytes) + "." + base64.RawURLEncoding.EncodeToString(claimsBytes)
+	sigBytes, err := signer.Sign(signingInput)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := btcec.ParseDERSignature(sigBytes, btcec.S256())
+	if err != nil {
+		return nil, fmt.Errorf("signer returned an invalid signature: %v", err)
+	}
+	jws := make([]byte, 64)
+	sig.R.FillBytes(jws[:32])
+	sig.S.FillBytes(jws[32:])
+	return &IOTRegistryTX.IssueCredentialTX{Credential: signingInput + "." + base64.RawURLEncoding.EncodeToString(jws)}, nil
+}
+
+/*
+	parses a registration credential and checks that its header and claims are consistent. It does not
+	check the signature (see Verify) or the validity period.
+*/
+func ParseCredential(jwt string) (*Credential, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("credential is not a compact JWS")
+	}
+	credential := &Credential{signingInput: parts[0] + "." + parts[1]}
+	var err error
+	credential.signature, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(credential.signature) != 64 {
+		return nil, fmt.Errorf("credential signature is not 64 base64url encoded bytes")
+	}
+	for i, part := range []interface{}{&credential.Header, &credential.Claims} {
+		partBytes, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("credential part %d is not base64url: %v", i, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(partBytes))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(part)
+		if err != nil {
+			return nil, fmt.Errorf("credential part %d is not valid JSON: %v", i, err)
+		}
+	}
+
+	header, claims := credential.Header, credential.Claims
+	if header.Algorithm != CredentialAlgorithm {
+		return nil, fmt.Errorf("credential alg (%s) is not %s", header.Algorithm, CredentialAlgorithm)
+	}
+	kind, issuer, err := ParseDID(claims.Issuer)
+	if err != nil || kind != DIDRegistrant {
+		return nil, fmt.Errorf("credential iss (%s) is not a registrant DID", claims.Issuer)
+	}
+	credential.IssuerPubkey, err = NormalizePubkeyHex(issuer)
+	if err != nil {
+		return nil, fmt.Errorf("credential iss (%s): %v", claims.Issuer, err)
+	}
+	if claims.Issuer != RegistrantDID(credential.IssuerPubkey) || header.KeyID != claims.Issuer+"#key-1" {
+		return nil, fmt.Errorf("credential kid (%s) is not the key of iss (%s)", header.KeyID, claims.Issuer)
+	}
+	kind, nonce, err := ParseDID(claims.Subject)
+	if err != nil || kind != DIDThing {
+		return nil, fmt.Errorf("credential sub (%s) is not a thing DID", claims.Subject)
+	}
+	credential.SubjectNonce, _ = hex.DecodeString(nonce)
+	if claims.Subject != ThingDID(credential.SubjectNonce) || claims.VC.CredentialSubject.ID != claims.Subject {
+		return nil, fmt.Errorf("credential subject (%s) does not match sub (%s)", claims.VC.CredentialSubject.ID, claims.Subject)
+	}
+	prefix := CredentialURI(credential.IssuerPubkey, "")
+	if !strings.HasPrefix(claims.ID, prefix) {
+		return nil, fmt.Errorf("credential jti (%s) is not a credential of iss", claims.ID)
+	}
+	credential.CredentialID = claims.ID[len(prefix):]
+	err = CheckCredentialID(credential.CredentialID)
+	if err != nil {
+		return nil, err
+	}
+	if claims.VC.CredentialStatus.ID != claims.ID+"#status" || claims.VC.CredentialStatus.Type != CredentialStatusType {
+		return nil, fmt.Errorf("credential status (%s) is not an %s of jti", claims.VC.CredentialStatus.ID, CredentialStatusType)
+	}
+	if len(claims.VC.Type) != 2 || claims.VC.Type[0] != "VerifiableCredential" || claims.VC.Type[1] != CredentialType {
+		return nil, fmt.Errorf("credential type (%v) is not an %s", claims.VC.Type, CredentialType)
+	}
+	if len(claims.VC.Context) == 0 || claims.VC.Context[0] != credentialsContext {
+		return nil, fmt.Errorf("credential @context does not start with %s", credentialsContext)
+	}
+	credential.SpecName = claims.VC.CredentialSubject.ConformsTo
+	if claims.Expires != 0 && claims.Expires < claims.NotBefore {
+		return nil, fmt.Errorf("credential exp (%d) is before nbf (%d)", claims.Expires, claims.NotBefore)
+	}
+	return credential, nil
+}
+
+/*
+	verifies the signature of a credential against the SEC1 encoded public key of its issuer.
+*/
+func (c *Credential) Verify(pubKeyBytes []byte) error {
+	pubKey, err := btcec.ParsePubKey(pubKeyBytes, btcec.S256())
+	if err != nil {
+		return fmt.Errorf("Invalid pubkey key (%s)", hex.EncodeToString(pubKeyBytes))
+	}
+	sig := &btcec.Signature{R: new(big.Int).SetBytes(c.signature[:32]), S: new(big.Int).SetBytes(c.signature[32:])}
+	if sig.S.Cmp(halfOrder) > 0 {
+		return fmt.Errorf("credential signature has a high S value")
+	}
+	digest := sha256.Sum256([]byte(c.signingInput))
+	if !sig.Verify(digest[:], pubKey) {
+		return fmt.Errorf("credential signature does not verify")
+	}
+	return nil
+}
+
+/*
+	builds a signed revokeCredential transaction revoking a credential the signer issued.
+*/
+func RevokeCredential(signer Signer, credentialID string, reason string, options ...Option) (*IOTRegistryTX.RevokeCredentialTX, error) {
+	tx := &IOTRegistryTX.RevokeCredentialTX{IssuerPubkey: PubkeyHex(signer), CredentialID: credentialID, Reason: reason}
+	applyOptions(tx, options)
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, RevokeCredentialMessage(tx.IssuerPubkey, credentialID, reason)))
+	return tx, err
+}
@@ -0,0 +1,118 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+/*
+	Registrants and things are identified by DIDs of the did:iotreg method:
+	|		did:iotreg:registrant:<RegistrantPubkey>	a registrant, by its compressed public key in hex
+	|		did:iotreg:thing:<Nonce>					a thing, by its nonce in hex
+	|		did:iotreg:alias:<alias>					a thing, by a legacy alias or a global "type:value" typed alias
+	The alias is percent encoded where it holds characters that a DID cannot (see AliasDID). The resolveDID
+	query renders the DID Document of a DID; alias DIDs resolve to the document of the thing they name and
+	are listed as its alsoKnownAs.
+*/
+const DIDPrefix = "did:iotreg:"
+
+const (
+	DIDRegistrant = "registrant"
+	DIDThing      = "thing"
+	DIDAlias      = "alias"
+)
+
+/*
+	returns the DID of a registrant.
+*/
+func RegistrantDID(registrantPubkey string) string {
+	return DIDPrefix + DIDRegistrant + ":" + strings.ToLower(registrantPubkey)
+}
+
+/*
+	returns the DID of a thing.
+*/
+func ThingDID(nonce []byte) string {
+	return DIDPrefix + DIDThing + ":" + hex.EncodeToString(nonce)
+}
+
+/*
+	returns the DID naming a thing by an alias. Every byte outside the DID idchar set (letters, digits, ".",
+	"-" and "_") is percent encoded, except ":" inside the alias, which separates DID segments.
+*/
+func AliasDID(alias string) string {
+	var encoded strings.Builder
+	for i := 0; i < len(alias); i++ {
+		c := alias[i]
+		if isDIDChar(c) || (c == ':' && i != len(alias)-1) {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return DIDPrefix + DIDAlias + ":" + encoded.String()
+}
+
+func isDIDChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '.' || c == '-' || c == '_'
+}
+
+/*
+	splits a did:iotreg DID into its kind (DIDRegistrant, DIDThing or DIDAlias) and identifier, decoding
+	the percent encoding of an alias. DID URLs, with a path, query or fragment, are rejected.
+*/
+func ParseDID(did string) (kind string, id string, err error) {
+	if !strings.HasPrefix(did, DIDPrefix) {
+		return "", "", fmt.Errorf("(%s) is not a %s DID", did, strings.TrimSuffix(DIDPrefix, ":"))
+	}
+	rest := did[len(DIDPrefix):]
+	i := strings.Index(rest, ":")
+	if i < 0 {
+		return "", "", fmt.Errorf("(%s) has no identifier", did)
+	}
+	kind, id = rest[:i], rest[i+1:]
+	if len(id) == 0 || strings.HasSuffix(id, ":") {
+		return "", "", fmt.Errorf("(%s) has an empty identifier segment", did)
+	}
+	var decoded strings.Builder
+	for j := 0; j < len(id); j++ {
+		c := id[j]
+		switch {
+		case c == '%':
+			if j+2 >= len(id) {
+				return "", "", fmt.Errorf("(%s) has a truncated percent encoding", did)
+			}
+			b, err := hex.DecodeString(id[j+1 : j+3])
+			if err != nil {
+				return "", "", fmt.Errorf("(%s) has an invalid percent encoding", did)
+			}
+			decoded.WriteByte(b[0])
+			j += 2
+		case isDIDChar(c) || c == ':':
+			decoded.WriteByte(c)
+		default:
+			return "", "", fmt.Errorf("(%s) contains (%c), which is not allowed in a DID", did, c)
+		}
+	}
+	id = decoded.String()
+	switch kind {
+	case DIDRegistrant, DIDThing:
+		if _, err := hex.DecodeString(id); err != nil {
+			return "", "", fmt.Errorf("the %s identifier of (%s) is not hex", kind, did)
+		}
+	case DIDAlias:
+	default:
+		return "", "", fmt.Errorf("(%s) is not a registrant, thing or alias DID", did)
+	}
+	return kind, id, nil
+}
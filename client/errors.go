@@ -0,0 +1,85 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+/*
+	Codes of the errors returned by Invoke and Query. They are stable; messages are not.
+*/
+const (
+	CodeInvalidArgument    = "INVALID_ARGUMENT"
+	CodeNotFound           = "NOT_FOUND"
+	CodeAlreadyExists      = "ALREADY_EXISTS"
+	CodeBadSignature       = "BAD_SIGNATURE"
+	CodeUnauthorized       = "UNAUTHORIZED"
+	CodeFailedPrecondition = "FAILED_PRECONDITION"
+	CodeInternal           = "INTERNAL"
+	CodeUnknown            = "UNKNOWN"
+)
+
+/*
+	Error is the error model of the chaincode. Its Error() string is the JSON encoding, e.g.
+	|		{"code":"ALREADY_EXISTS","message":"Nonce (0a0b) is unavailable","key":"Thing:0a0b"}
+	|		Key		the ledger key the failure is about, if any
+	|		Field	the transaction field or query argument that is invalid, if any
+*/
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Key     string `json:"key,omitempty"`
+	Field   string `json:"field,omitempty"`
+}
+
+func (e *Error) Error() string {
+	errBytes, _ := json.Marshal(e)
+	return string(errBytes)
+}
+
+/*
+	ParseError recovers the Error returned by the chaincode from an error seen by a client, which the
+	peer or the SDK may have wrapped in other text. Errors that carry no Error are returned with
+	CodeUnknown and their full text as Message. ParseError(nil) is nil.
+*/
+func ParseError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	if registryErr, ok := err.(*Error); ok {
+		return registryErr
+	}
+	text := err.Error()
+	for i := strings.Index(text, `{"code":`); i >= 0; {
+		registryErr := Error{}
+		if json.NewDecoder(strings.NewReader(text[i:])).Decode(&registryErr) == nil && len(registryErr.Code) != 0 {
+			return &registryErr
+		}
+		next := strings.Index(text[i+1:], `{"code":`)
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return &Error{Code: CodeUnknown, Message: text}
+}
+
+/*
+	ErrorCode returns the code of an error returned by the chaincode, see ParseError.
+*/
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	return ParseError(err).Code
+}
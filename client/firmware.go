@@ -0,0 +1,81 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package client
+
+import (
+	"reflect"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	The owner of a spec publishes the firmware releases of its devices: a Version, the hash of the image
+	(a Hash as for ContentRef, see content.go), the key the image is signed with, and optionally a
+	ContentRef to the release notes. A release that turns out to be vulnerable is flagged with an
+	advisory. Things report the version they run, signed by their owner or by the device key set with
+	WithDevicePubkey when the thing was registered.
+*/
+
+/*
+	sets the DevicePubkey of a registerThing transaction: the key of the device itself, which may sign
+	reportFirmware for the thing.
+*/
+func WithDevicePubkey(devicePubkey string) Option {
+	return func(tx proto.Message) {
+		reflect.ValueOf(tx).Elem().FieldByName("DevicePubkey").SetString(devicePubkey)
+	}
+}
+
+/*
+	builds a signed publishFirmware transaction for a spec owned by the signer.
+*/
+func PublishFirmware(signer Signer, specName string, version string, imageHash string, signingKey string,
+	releaseNotes *IOTRegistryTX.ContentRef, options ...Option) (*IOTRegistryTX.PublishFirmwareTX, error) {
+
+	tx := &IOTRegistryTX.PublishFirmwareTX{
+		SpecName:     specName,
+		Version:      version,
+		ImageHash:    imageHash,
+		SigningKey:   signingKey,
+		ReleaseNotes: releaseNotes,
+	}
+	applyOptions(tx, options)
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, PublishFirmwareMessage(specName, version, imageHash, signingKey, releaseNotes)))
+	return tx, err
+}
+
+/*
+	builds a signed flagFirmware transaction marking a release of a spec owned by the signer as vulnerable.
+*/
+func FlagFirmware(signer Signer, specName string, version string, advisory string, options ...Option) (*IOTRegistryTX.FlagFirmwareTX, error) {
+	tx := &IOTRegistryTX.FlagFirmwareTX{SpecName: specName, Version: version, Advisory: advisory}
+	applyOptions(tx, options)
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, FlagFirmwareMessage(specName, version, advisory)))
+	return tx, err
+}
+
+/*
+	builds a signed reportFirmware transaction. With asDevice the signer is the device key of the thing
+	and is named in SignerPubkey, otherwise it is the owner of the thing. counter must be greater than the
+	counter of the last report of the thing.
+*/
+func ReportFirmware(signer Signer, nonce []byte, version string, counter int64, asDevice bool, options ...Option) (*IOTRegistryTX.ReportFirmwareTX, error) {
+	tx := &IOTRegistryTX.ReportFirmwareTX{Nonce: nonce, Version: version, Counter: counter}
+	applyOptions(tx, options)
+	if asDevice {
+		tx.SignerPubkey = PubkeyHex(signer)
+	}
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, ReportFirmwareMessage(nonce, version, counter)))
+	return tx, err
+}
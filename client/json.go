@@ -0,0 +1,223 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	Encodings of byte fields (nonces, signatures, CreateRegistrantTX.RegistrantPubkey) in JSON arguments.
+*/
+const (
+	ByteEncodingHex    = "hex"
+	ByteEncodingBase64 = "base64"
+)
+
+/*
+	transactions that may be sent to Invoke as JSON instead of a hex encoded protocol buffer
+*/
+var jsonTXTypes = map[string]func() proto.Message{
+	"createRegistrant": func() proto.Message { return &IOTRegistryTX.CreateRegistrantTX{} },
+	"registerThing":    func() proto.Message { return &IOTRegistryTX.RegisterThingTX{} },
+	"registerSpec":     func() proto.Message { return &IOTRegistryTX.RegisterSpecTX{} },
+}
+
+/*
+	EncodeJSONArgs returns the canonical JSON form of a CreateRegistrantTX, RegisterThingTX or RegisterSpecTX:
+	an object keyed by the protocol buffer field names in sorted order, empty fields left out and byte
+	fields encoded with byteEncoding.
+*/
+func EncodeJSONArgs(tx proto.Message, byteEncoding string) (string, error) {
+	if err := checkByteEncoding(byteEncoding); err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(jsonValue(reflect.ValueOf(tx), byteEncoding))
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+/*
+	DecodeJSONArgs parses the JSON arguments of function into its transaction type. Field names must match
+	the protocol buffer field names exactly; unknown fields, values of the wrong type and byte fields that
+	are not valid byteEncoding are reported by field name.
+*/
+func DecodeJSONArgs(function string, jsonArgs []byte, byteEncoding string) (proto.Message, error) {
+	if err := checkByteEncoding(byteEncoding); err != nil {
+		return nil, err
+	}
+	newTX, ok := jsonTXTypes[function]
+	if !ok {
+		return nil, fmt.Errorf("function (%s) does not accept JSON arguments\n", function)
+	}
+	tx := newTX()
+	err := decodeJSONObject(jsonArgs, reflect.ValueOf(tx).Elem(), byteEncoding)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func checkByteEncoding(byteEncoding string) error {
+	if byteEncoding != ByteEncodingHex && byteEncoding != ByteEncodingBase64 {
+		return fmt.Errorf("unknown byte encoding (%s), expected hex or base64\n", byteEncoding)
+	}
+	return nil
+}
+
+/*
+	converts a transaction into plain values for json.Marshal, which writes map keys in sorted order.
+*/
+func jsonValue(v reflect.Value, byteEncoding string) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr:
+		return jsonValue(v.Elem(), byteEncoding)
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" || isZero(v.Field(i)) {
+				continue
+			}
+			fields[field.Name] = jsonValue(v.Field(i), byteEncoding)
+		}
+		return fields
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if byteEncoding == ByteEncodingBase64 {
+				return base64.StdEncoding.EncodeToString(v.Bytes())
+			}
+			return hex.EncodeToString(v.Bytes())
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = jsonValue(v.Index(i), byteEncoding)
+		}
+		return items
+	}
+	return v.Interface()
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr:
+		return v.IsNil()
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int64:
+		return v.Int() == 0
+	}
+	return false
+}
+
+/*
+	decodes a JSON object into the exported fields of the struct v.
+*/
+func decodeJSONObject(data []byte, v reflect.Value, byteEncoding string) error {
+	typeName := v.Type().Name()
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return fmt.Errorf("%s JSON must be an object\n", typeName)
+	}
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return fmt.Errorf("invalid %s JSON: %v\n", typeName, err)
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field, ok := v.Type().FieldByName(name)
+		if !ok || field.PkgPath != "" {
+			return fmt.Errorf("unknown field (%s) in %s JSON\n", name, typeName)
+		}
+		err = decodeJSONField(fields[name], v.FieldByIndex(field.Index), byteEncoding)
+		if err != nil {
+			return fmt.Errorf("field (%s) of %s: %v", name, typeName, err)
+		}
+	}
+	return nil
+}
+
+func decodeJSONField(data json.RawMessage, v reflect.Value, byteEncoding string) error {
+	switch {
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		var encoded string
+		if err := json.Unmarshal(data, &encoded); err != nil {
+			return fmt.Errorf("expected a %s encoded string\n", byteEncoding)
+		}
+		var decoded []byte
+		var err error
+		if byteEncoding == ByteEncodingBase64 {
+			decoded, err = base64.StdEncoding.DecodeString(encoded)
+		} else {
+			decoded, err = hex.DecodeString(encoded)
+		}
+		if err != nil {
+			return fmt.Errorf("(%s) is not %s\n", encoded, byteEncoding)
+		}
+		v.SetBytes(decoded)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Ptr:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return fmt.Errorf("expected an array of objects\n")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			elem := reflect.New(v.Type().Elem().Elem())
+			if err := decodeJSONObject(item, elem.Elem(), byteEncoding); err != nil {
+				return fmt.Errorf("item %d: %v", i, err)
+			}
+			slice.Index(i).Set(elem)
+		}
+		v.Set(slice)
+	case v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Struct:
+		elem := reflect.New(v.Type().Elem())
+		if err := decodeJSONObject(data, elem.Elem(), byteEncoding); err != nil {
+			return err
+		}
+		v.Set(elem)
+	default:
+		if err := json.Unmarshal(data, v.Addr().Interface()); err != nil {
+			return fmt.Errorf("expected a JSON %s\n", jsonTypeName(v.Type()))
+		}
+	}
+	return nil
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int64:
+		return "number"
+	case reflect.Slice:
+		return "array of " + jsonTypeName(t.Elem()) + "s"
+	}
+	return t.Kind().String()
+}
@@ -0,0 +1,67 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package client
+
+import (
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	An update manifest, after the IETF SUIT manifests, tells devices of a spec which image to install:
+	|		SpecName			the spec whose owner signs the manifest
+	|		SequenceNumber		increases with every manifest of the spec; devices install only newer ones
+	|		Things				nonces of the things the manifest is for, or every thing of the spec if empty
+	|		ImageDigest			Hash of the image, in a form of ContentRef Hash (see content.go)
+	|		ImageSize			size of the image in bytes, 0 if not given
+	|		PayloadURI			where the image is served from
+	|		FirmwareVersion		the published firmware release the image is, if any
+	|		Dependencies		manifests of other specs the update depends on, e.g. for a module
+	|		Conditions			checks on the device record before installing:
+	|							"firmwareVersion" (the thing reports Value) or "status" (the thing has status Value)
+	The serialized UpdateManifest is signed by the spec owner over ManifestMessage, prefixed by the
+	validity window of the issueManifest transaction if it has one, and anchored by that transaction; the
+	manifest query returns it with its signature and window to devices, which can check the signature
+	themselves with VerifyManifest or ask validateManifest.
+*/
+var ManifestConditionTypes = []string{"firmwareVersion", "status"}
+
+/*
+	builds an issueManifest transaction for a manifest of a spec owned by the signer.
+*/
+func IssueManifest(signer Signer, manifest *IOTRegistryTX.UpdateManifest, options ...Option) (*IOTRegistryTX.IssueManifestTX, error) {
+	manifestBytes, err := proto.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	tx := &IOTRegistryTX.IssueManifestTX{Manifest: manifestBytes}
+	applyOptions(tx, options)
+	tx.Signature, err = signer.Sign(SignedMessage(tx, ManifestMessage(manifestBytes)))
+	return tx, err
+}
+
+/*
+	verifies the signature of a serialized manifest against the public key of the spec owner and decodes it.
+	notBefore and notAfter are the validity window the manifest was issued with, as returned by the
+	manifest query, or 0.
+*/
+func VerifyManifest(pubKeyBytes []byte, manifestBytes []byte, sig []byte, notBefore int64, notAfter int64) (*IOTRegistryTX.UpdateManifest, error) {
+	window := &IOTRegistryTX.IssueManifestTX{NotBefore: notBefore, NotAfter: notAfter}
+	err := Verify(pubKeyBytes, sig, SignedMessage(window, ManifestMessage(manifestBytes)))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &IOTRegistryTX.UpdateManifest{}
+	err = proto.Unmarshal(manifestBytes, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
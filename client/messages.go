@@ -0,0 +1,275 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+/*
+	Package client builds and signs IOTRegistry transactions.
+
+	The message functions below are the one definition of the payloads the chaincode verifies:
+	IOTRegistry.go imports them to rebuild the message of every transaction it checks, so a transaction
+	built with this package and a signature checked by the chaincode always cover the same bytes.
+	Every signature is a DER encoded secp256k1 ECDSA signature over sha256(message).
+*/
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+)
+
+/*
+	message signed by a registrant to create itself: "<RegistrantName>:<RegistrantPubkey>:<Data>", followed by
+	":aliasSalt:<AliasSalt>" if the registrant has its own alias salt
+*/
+func CreateRegistrantMessage(registrantName string, registrantPubkey string, data string, aliasSalt []byte) string {
+	message := registrantName + ":" + registrantPubkey + ":" + data
+	if len(aliasSalt) != 0 {
+		message += ":aliasSalt:" + hex.EncodeToString(aliasSalt)
+	}
+	return message
+}
+
+/*
+	part of a registerThing message covering a typed alias: "<Type>:<Scoped>:<Value>"
+*/
+func TypedAliasMessage(alias *IOTRegistryTX.TypedAlias) string {
+	return alias.Type + ":" + strconv.FormatBool(alias.Scoped) + ":" + alias.Value
+}
+
+/*
+	message signed by a registrant to register a thing:
+	"<RegistrantPubkey>:<Alias>...:<Data>:<Spec>:<TypedAlias>...<ContentMessage><PrivateDataMessage>", followed by
+	":devicePubkey:<DevicePubkey>" if the thing has a device key
+*/
+func RegisterThingMessage(registerThingArgs *IOTRegistryTX.RegisterThingTX) string {
+	message := registerThingArgs.RegistrantPubkey
+	for _, identity := range registerThingArgs.Aliases {
+		message += ":" + identity
+	}
+	message += ":" + registerThingArgs.Data
+	message += ":" + registerThingArgs.Spec
+	for _, typedAlias := range registerThingArgs.TypedAliases {
+		message += ":" + TypedAliasMessage(typedAlias)
+	}
+	message += ContentMessage(registerThingArgs.Content) + PrivateDataMessage(registerThingArgs.PrivateData)
+	if len(registerThingArgs.DevicePubkey) != 0 {
+		message += ":devicePubkey:" + registerThingArgs.DevicePubkey
+	}
+	return message
+}
+
+/*
+	message signed by a registrant to register a spec: "<SpecName>:<RegistrantPubkey>:<Data><ContentMessage>"
+*/
+func RegisterSpecMessage(specName string, registrantPubkey string, data string, content *IOTRegistryTX.ContentRef) string {
+	return specName + ":" + registrantPubkey + ":" + data + ContentMessage(content)
+}
+
+/*
+	Merkle leaf of a registerThingsBatch entry: sha256(0x00 || <Nonce> ":" <RegisterThingMessage>)
+*/
+func BatchLeaf(registerThingArgs *IOTRegistryTX.RegisterThingTX) []byte {
+	leaf := sha256.Sum256(append([]byte{0x00}, hex.EncodeToString(registerThingArgs.Nonce)+":"+RegisterThingMessage(registerThingArgs)...))
+	return leaf[:]
+}
+
+/*
+	Merkle root of registerThingsBatch entries. Inner nodes are sha256(0x01 || left || right),
+	and an odd node is carried up to the next level unchanged.
+*/
+func BatchMerkleRoot(things []*IOTRegistryTX.RegisterThingTX) []byte {
+	if len(things) == 0 {
+		return nil
+	}
+	level := make([][]byte, len(things))
+	for i, thing := range things {
+		level[i] = BatchLeaf(thing)
+	}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			node := sha256.Sum256(append(append([]byte{0x01}, level[i]...), level[i+1]...))
+			next = append(next, node[:])
+		}
+		level = next
+	}
+	return level[0]
+}
+
+/*
+	message signed by a registrant to register a batch of things: "registerThingsBatch:<Merkle root>".
+	The entries must already carry the RegistrantPubkey of the batch.
+*/
+func RegisterThingsBatchMessage(things []*IOTRegistryTX.RegisterThingTX) string {
+	return "registerThingsBatch:" + hex.EncodeToString(BatchMerkleRoot(things))
+}
+
+/*
+	message signed by the owners of both things to attach or detach a child thing:
+	"<function>:<ParentNonce>:<ChildNonce>:<LinkSequence>", where function is "attachThing" or "detachThing"
+	and LinkSequence is the current LinkSequence of the child
+*/
+func ThingLinkMessage(function string, parentNonce []byte, childNonce []byte, linkSequence int64) string {
+	return function + ":" + hex.EncodeToString(parentNonce) + ":" + hex.EncodeToString(childNonce) + ":" + strconv.FormatInt(linkSequence, 10)
+}
+
+/*
+	message signed by a registrant to create a group: "createGroup:<GroupName>:<RegistrantPubkey>:<Data>"
+*/
+func CreateGroupMessage(groupName string, registrantPubkey string, data string) string {
+	return "createGroup:" + groupName + ":" + registrantPubkey + ":" + data
+}
+
+/*
+	message signed by the group owner to add or remove members: "<function>:<GroupName>:<Version>:<Nonce>...",
+	where function is "addGroupMembers" or "removeGroupMembers" and Version is the current Version of the group
+*/
+func GroupMembersMessage(function string, groupName string, version int64, nonces [][]byte) string {
+	message := function + ":" + groupName + ":" + strconv.FormatInt(version, 10)
+	for _, nonce := range nonces {
+		message += ":" + hex.EncodeToString(nonce)
+	}
+	return message
+}
+
+/*
+	message signed by the group owner to delete a group: "deleteGroup:<GroupName>:<Version>"
+*/
+func DeleteGroupMessage(groupName string, version int64) string {
+	return "deleteGroup:" + groupName + ":" + strconv.FormatInt(version, 10)
+}
+
+/*
+	message signed by the owner or a delegate to set the status of a thing:
+	"setThingStatus:<Nonce>:<StatusSequence>:<Status>:<Reason>", where StatusSequence is the current
+	StatusSequence of the thing
+*/
+func SetThingStatusMessage(nonce []byte, statusSequence int64, status string, reason string) string {
+	return "setThingStatus:" + hex.EncodeToString(nonce) + ":" + strconv.FormatInt(statusSequence, 10) + ":" + status + ":" + reason
+}
+
+/*
+	message signed by a registrant to add or revoke a status delegate:
+	"setStatusDelegate:<RegistrantPubkey>:<DelegatePubkey>:<Revoke>:<Sequence>", where Sequence is the
+	current Sequence of the delegate
+*/
+func StatusDelegateMessage(registrantPubkey string, delegatePubkey string, revoke bool, sequence int64) string {
+	return "setStatusDelegate:" + registrantPubkey + ":" + delegatePubkey + ":" + strconv.FormatBool(revoke) + ":" + strconv.FormatInt(sequence, 10)
+}
+
+/*
+	part of a message covering a reader of private data: "<ReaderPubkey>:<Key>"
+*/
+func WrappedKeyMessage(reader *IOTRegistryTX.WrappedKey) string {
+	return reader.ReaderPubkey + ":" + hex.EncodeToString(reader.Key)
+}
+
+/*
+	part of a registerThing or setPrivateData message covering private data:
+	":private:<Algorithm>:<sha256(Ciphertext)>:<WrappedKeyMessage>...", or nothing without private data
+*/
+func PrivateDataMessage(privateData *IOTRegistryTX.EncryptedData) string {
+	if privateData == nil {
+		return ""
+	}
+	ciphertextHash := sha256.Sum256(privateData.Ciphertext)
+	message := ":private:" + privateData.Algorithm + ":" + hex.EncodeToString(ciphertextHash[:])
+	for _, reader := range privateData.Readers {
+		message += ":" + WrappedKeyMessage(reader)
+	}
+	return message
+}
+
+/*
+	message signed by the owner to replace (or, without private data, remove) the private data of a thing:
+	"setPrivateData:<Nonce>:<PrivateDataVersion><PrivateDataMessage>"
+*/
+func SetPrivateDataMessage(nonce []byte, privateDataVersion int64, privateData *IOTRegistryTX.EncryptedData) string {
+	return "setPrivateData:" + hex.EncodeToString(nonce) + ":" + strconv.FormatInt(privateDataVersion, 10) + PrivateDataMessage(privateData)
+}
+
+/*
+	message signed by the owner to grant or revoke a reader of private data:
+	"<function>:<Nonce>:<PrivateDataVersion>:<WrappedKeyMessage>", where function is "grantReader" or
+	"revokeReader" and a revoked reader has no Key
+*/
+func PrivateDataReaderMessage(function string, nonce []byte, privateDataVersion int64, reader *IOTRegistryTX.WrappedKey) string {
+	return function + ":" + hex.EncodeToString(nonce) + ":" + strconv.FormatInt(privateDataVersion, 10) + ":" + WrappedKeyMessage(reader)
+}
+
+/*
+	message signed by the issuer to revoke a credential: "revokeCredential:<IssuerPubkey>:<CredentialID>:<Reason>"
+*/
+func RevokeCredentialMessage(issuerPubkey string, credentialID string, reason string) string {
+	return "revokeCredential:" + issuerPubkey + ":" + credentialID + ":" + reason
+}
+
+/*
+	message signed by the admin to import a snapshot page: "importSnapshot:<hex sha256(Page)>"
+*/
+func ImportSnapshotMessage(page []byte) string {
+	digest := sha256.Sum256(page)
+	return "importSnapshot:" + hex.EncodeToString(digest[:])
+}
+
+/*
+	message signed by the admin to migrate the ledger keys to the composite layout: "migrateKeys"
+*/
+func MigrateKeysMessage() string {
+	return "migrateKeys"
+}
+
+/*
+	message signed by the admin to repair the issues that the checkConsistency query reported with a
+	RepairSequence and a Checksum: "repair:<Sequence>:<Checksum>"
+*/
+func RepairMessage(sequence int64, checksum string) string {
+	return "repair:" + strconv.FormatInt(sequence, 10) + ":" + checksum
+}
+
+/*
+	message signed by the owner of a spec to publish a firmware release:
+	"publishFirmware:<SpecName>:<Version>:<ImageHash>:<SigningKey><ContentMessage of the ReleaseNotes>"
+*/
+func PublishFirmwareMessage(specName string, version string, imageHash string, signingKey string, releaseNotes *IOTRegistryTX.ContentRef) string {
+	return "publishFirmware:" + specName + ":" + version + ":" + imageHash + ":" + signingKey + ContentMessage(releaseNotes)
+}
+
+/*
+	message signed by the owner of a spec to flag a firmware release as vulnerable:
+	"flagFirmware:<SpecName>:<Version>:<Advisory>"
+*/
+func FlagFirmwareMessage(specName string, version string, advisory string) string {
+	return "flagFirmware:" + specName + ":" + version + ":" + advisory
+}
+
+/*
+	message signed by the owner or the device key of a thing to report the firmware it runs:
+	"reportFirmware:<Nonce hex>:<Version>:<Counter>". Counter must be greater than the Counter of the last
+	report of the thing.
+*/
+func ReportFirmwareMessage(nonce []byte, version string, counter int64) string {
+	return "reportFirmware:" + hex.EncodeToString(nonce) + ":" + version + ":" + strconv.FormatInt(counter, 10)
+}
+
+/*
+	message signed by the owner of a spec to issue an update manifest: "manifest:<hex sha256(Manifest)>",
+	where Manifest is the serialized UpdateManifest. Devices verify the same message.
+*/
+func ManifestMessage(manifest []byte) string {
+	digest := sha256.Sum256(manifest)
+	return "manifest:" + hex.EncodeToString(digest[:])
+}
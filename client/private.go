@@ -0,0 +1,183 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package client
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/btcsuite/btcd/btcec"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	Private data is envelope encrypted: the plaintext is sealed with AES-256-GCM under a random data key,
+	stored as Ciphertext = <12 byte nonce><sealed data>, and the data key is wrapped for every reader with
+	the ECIES of btcec.Encrypt (AES-256-CBC and HMAC-SHA256 under an ephemeral secp256k1 key):
+	|		<16 byte IV><curve 0x02ca><32><X><32><Y><48 byte encrypted key><32 byte HMAC>
+	The chaincode only checks this structure; it never holds a data key or sees plaintext.
+*/
+const PrivateDataAlgorithm = "AES-256-GCM+ECIES-secp256k1"
+
+const (
+	dataKeySize    = 32
+	gcmNonceSize   = 12
+	gcmTagSize     = 16
+	wrappedKeySize = aes.BlockSize + 70 + 48 + 32
+)
+
+/*
+	encrypts plaintext for readers (hex public keys in any SEC1 encoding) and returns the private data
+	with the data key, which the owner keeps to grant further readers.
+*/
+func EncryptPrivateData(plaintext []byte, readerPubkeys []string) (*IOTRegistryTX.EncryptedData, []byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, err
+	}
+	aead, err := dataCipher(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, gcmNonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	privateData := &IOTRegistryTX.EncryptedData{Algorithm: PrivateDataAlgorithm, Ciphertext: aead.Seal(nonce, nonce, plaintext, nil)}
+	for _, readerPubkey := range readerPubkeys {
+		reader, err := WrapDataKey(dataKey, readerPubkey)
+		if err != nil {
+			return nil, nil, err
+		}
+		privateData.Readers = append(privateData.Readers, reader)
+	}
+	return privateData, dataKey, nil
+}
+
+/*
+	sets the PrivateData of a registerThing transaction, see EncryptPrivateData.
+*/
+func WithPrivateData(privateData *IOTRegistryTX.EncryptedData) Option {
+	return func(tx proto.Message) {
+		reflect.ValueOf(tx).Elem().FieldByName("PrivateData").Set(reflect.ValueOf(privateData))
+	}
+}
+
+/*
+	wraps a data key for a reader. The ReaderPubkey of the result is normalized (see NormalizePubkeyHex).
+*/
+func WrapDataKey(dataKey []byte, readerPubkey string) (*IOTRegistryTX.WrappedKey, error) {
+	if len(dataKey) != dataKeySize {
+		return nil, fmt.Errorf("data key is %d bytes, expected %d\n", len(dataKey), dataKeySize)
+	}
+	normalized, err := NormalizePubkeyHex(readerPubkey)
+	if err != nil {
+		return nil, err
+	}
+	pubkeyBytes, _ := hex.DecodeString(normalized)
+	pubkey, err := btcec.ParsePubKey(pubkeyBytes, btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := btcec.Encrypt(pubkey, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &IOTRegistryTX.WrappedKey{ReaderPubkey: normalized, Key: wrapped}, nil
+}
+
+/*
+	unwraps the data key of the reader holding privateKeyHex.
+*/
+func UnwrapDataKey(privateData *IOTRegistryTX.EncryptedData, privateKeyHex string) ([]byte, error) {
+	privateKeyBytes, err := hex.DecodeString(privateKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("private key is not hex: %v\n", err)
+	}
+	privateKey, pubkey := btcec.PrivKeyFromBytes(btcec.S256(), privateKeyBytes)
+	readerPubkey := hex.EncodeToString(pubkey.SerializeCompressed())
+	for _, reader := range privateData.Readers {
+		if reader.ReaderPubkey == readerPubkey {
+			return btcec.Decrypt(privateKey, reader.Key)
+		}
+	}
+	return nil, fmt.Errorf("(%s) is not a reader of the private data\n", readerPubkey)
+}
+
+/*
+	decrypts private data as the reader holding privateKeyHex.
+*/
+func DecryptPrivateData(privateData *IOTRegistryTX.EncryptedData, privateKeyHex string) ([]byte, error) {
+	dataKey, err := UnwrapDataKey(privateData, privateKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := dataCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(privateData.Ciphertext) < gcmNonceSize+gcmTagSize {
+		return nil, fmt.Errorf("Ciphertext is too short\n")
+	}
+	return aead.Open(nil, privateData.Ciphertext[:gcmNonceSize], privateData.Ciphertext[gcmNonceSize:], nil)
+}
+
+func dataCipher(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+/*
+	checks the structure of private data: the Algorithm, a Ciphertext long enough for the GCM nonce and
+	tag, and a wrapped key for every reader (see CheckWrappedKey). Reader pubkeys are checked by the caller.
+*/
+func CheckPrivateData(privateData *IOTRegistryTX.EncryptedData) error {
+	if privateData.Algorithm != PrivateDataAlgorithm {
+		return fmt.Errorf("Algorithm (%s) is not %s\n", privateData.Algorithm, PrivateDataAlgorithm)
+	}
+	if len(privateData.Ciphertext) < gcmNonceSize+gcmTagSize {
+		return fmt.Errorf("Ciphertext is %d bytes, shorter than the GCM nonce and tag\n", len(privateData.Ciphertext))
+	}
+	for i, reader := range privateData.Readers {
+		if err := CheckWrappedKey(reader.Key); err != nil {
+			return fmt.Errorf("reader %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+/*
+	checks that a wrapped key has the length of a wrapped data key and that its ephemeral public key is
+	a secp256k1 point. Whether it decrypts can only be checked by the reader.
+*/
+func CheckWrappedKey(wrapped []byte) error {
+	if len(wrapped) != wrappedKeySize {
+		return fmt.Errorf("wrapped Key is %d bytes, expected %d\n", len(wrapped), wrappedKeySize)
+	}
+	header := wrapped[aes.BlockSize : aes.BlockSize+4]
+	if header[0] != 0x02 || header[1] != 0xca || header[2] != 0 || header[3] != 32 || wrapped[aes.BlockSize+36] != 0 || wrapped[aes.BlockSize+37] != 32 {
+		return fmt.Errorf("wrapped Key does not hold a secp256k1 ephemeral key\n")
+	}
+	ephemeral := append([]byte{0x04}, wrapped[aes.BlockSize+4:aes.BlockSize+36]...)
+	ephemeral = append(ephemeral, wrapped[aes.BlockSize+38:aes.BlockSize+70]...)
+	if _, err := btcec.ParsePubKey(ephemeral, btcec.S256()); err != nil {
+		return fmt.Errorf("ephemeral key of the wrapped Key is not on secp256k1: %v\n", err)
+	}
+	return nil
+}
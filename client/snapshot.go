@@ -0,0 +1,126 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+)
+
+/*
+	A snapshot copies the records of a registry to another deployment. The exportSnapshot query returns
+	it in pages of JSON; each page chains the checksum of the page before it, so the pages of one export
+	form a chain:
+	|		Checksum = hex sha256(PrevChecksum || len-prefixed Namespace, Components and Value of each record)
+	PrevChecksum is empty for the first page, and NextPageToken, passed back to exportSnapshot, is empty
+	after the last one. CheckSnapshotPage checks a page against its own records only; importSnapshot also
+	keeps the Checksum of the last page it imported and requires the PrevChecksum of the next page to
+	match it, so pages are imported in order and a page of another export cannot be spliced in. Every page carries the state root of the exporting registry and its alias blinding,
+	which the importing registry must share, since blinded aliases are keyed by the salt.
+	An administrator signs each page for the importSnapshot transaction with ImportSnapshot.
+*/
+const SnapshotVersion = 1
+
+type SnapshotRecord struct {
+	Namespace  string
+	Components []string
+	Value      []byte
+}
+
+type SnapshotPage struct {
+	Version       int
+	BlindAliases  bool   `json:",omitempty"`
+	AliasSalt     string `json:",omitempty"`
+	StateRoot     []byte
+	PrevChecksum  string
+	Checksum      string
+	Records       []SnapshotRecord
+	NextPageToken string
+}
+
+/*
+	returns the checksum of a page's records, chained to the checksum of the page before it.
+*/
+func SnapshotChecksum(prevChecksum string, records []SnapshotRecord) string {
+	digest := sha256.New()
+	writeField := func(field []byte) {
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+		digest.Write(length[:])
+		digest.Write(field)
+	}
+	writeField([]byte(prevChecksum))
+	for _, record := range records {
+		writeField([]byte(record.Namespace))
+		var count [8]byte
+		binary.BigEndian.PutUint64(count[:], uint64(len(record.Components)))
+		digest.Write(count[:])
+		for _, component := range record.Components {
+			writeField([]byte(component))
+		}
+		writeField(record.Value)
+	}
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+/*
+	checks the version and checksum of a page.
+*/
+func CheckSnapshotPage(page *SnapshotPage) error {
+	if page.Version != SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version (%d), expected (%d)", page.Version, SnapshotVersion)
+	}
+	checksum := SnapshotChecksum(page.PrevChecksum, page.Records)
+	if page.Checksum != checksum {
+		return fmt.Errorf("snapshot checksum (%s) does not match its records (%s)", page.Checksum, checksum)
+	}
+	return nil
+}
+
+/*
+	builds an importSnapshot transaction for a page returned by exportSnapshot, signed by the admin key
+	of the importing registry.
+*/
+func ImportSnapshot(signer Signer, page []byte, options ...Option) (*IOTRegistryTX.ImportSnapshotTX, error) {
+	tx := &IOTRegistryTX.ImportSnapshotTX{Page: page}
+	applyOptions(tx, options)
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, ImportSnapshotMessage(page)))
+	return tx, err
+}
+
+/*
+	builds a repair transaction, signed by the admin key of the registry, which fixes the records that the
+	checkConsistency query reports as Repairable. sequence and checksum are the RepairSequence and
+	Checksum of that report; the repair fails if the issues have changed, or another repair ran, since.
+*/
+func Repair(signer Signer, sequence int64, checksum string, options ...Option) (*IOTRegistryTX.RepairTX, error) {
+	tx := &IOTRegistryTX.RepairTX{Checksum: checksum, Sequence: sequence}
+	applyOptions(tx, options)
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, RepairMessage(sequence, checksum)))
+	return tx, err
+}
+
+/*
+	builds a migrateKeys transaction, signed by the admin key of the registry, which rewrites the states
+	of a ledger written before the composite key layout.
+*/
+func MigrateKeys(signer Signer, options ...Option) (*IOTRegistryTX.MigrateKeysTX, error) {
+	tx := &IOTRegistryTX.MigrateKeysTX{}
+	applyOptions(tx, options)
+	var err error
+	tx.Signature, err = signer.Sign(SignedMessage(tx, MigrateKeysMessage()))
+	return tx, err
+}
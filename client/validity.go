@@ -0,0 +1,93 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package client
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	Every signed transaction has an optional validity window: NotBefore and NotAfter, in seconds since the
+	epoch, bound the transaction timestamps at which the chaincode accepts it. Zero leaves that side of the
+	window open. A transaction with a window signs its message prefixed by the window:
+	|		"validity:<NotBefore>:<NotAfter>:<message>"
+	The prefix cannot be mistaken for the start of a message without a window, since those start with a
+	function name, a RegistrantPubkey, or (createRegistrant and registerSpec) a name followed by a pubkey.
+*/
+const validityPrefix = "validity:"
+
+/*
+	returns the validity window of a transaction, which is zero for transactions without one.
+*/
+func ValidityWindow(tx proto.Message) (notBefore int64, notAfter int64) {
+	v := reflect.ValueOf(tx)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return 0, 0
+	}
+	v = v.Elem()
+	if field := v.FieldByName("NotBefore"); field.IsValid() && field.Kind() == reflect.Int64 {
+		notBefore = field.Int()
+	}
+	if field := v.FieldByName("NotAfter"); field.IsValid() && field.Kind() == reflect.Int64 {
+		notAfter = field.Int()
+	}
+	return notBefore, notAfter
+}
+
+/*
+	returns the message to sign for a transaction: message itself, or message prefixed by the validity
+	window of tx if it has one.
+*/
+func SignedMessage(tx proto.Message, message string) string {
+	notBefore, notAfter := ValidityWindow(tx)
+	if notBefore == 0 && notAfter == 0 {
+		return message
+	}
+	return validityPrefix + strconv.FormatInt(notBefore, 10) + ":" + strconv.FormatInt(notAfter, 10) + ":" + message
+}
+
+/*
+	An Option changes a transaction before the transaction builders of this package sign it.
+*/
+type Option func(tx proto.Message)
+
+/*
+	sets the validity window of a transaction. A zero time leaves that side of the window open.
+*/
+func ValidBetween(notBefore time.Time, notAfter time.Time) Option {
+	return func(tx proto.Message) {
+		v := reflect.ValueOf(tx).Elem()
+		if !notBefore.IsZero() {
+			v.FieldByName("NotBefore").SetInt(notBefore.Unix())
+		}
+		if !notAfter.IsZero() {
+			v.FieldByName("NotAfter").SetInt(notAfter.Unix())
+		}
+	}
+}
+
+/*
+	sets a validity window from now until now+d, e.g. for payloads that are pre-signed by a provisioning
+	pipeline and should stop being usable after a few hours.
+*/
+func ValidFor(d time.Duration) Option {
+	now := time.Now()
+	return ValidBetween(now, now.Add(d))
+}
+
+func applyOptions(tx proto.Message, options []Option) {
+	for _, option := range options {
+		option(tx)
+	}
+}
@@ -0,0 +1,323 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+/*
+	iotreg builds, signs, decodes and verifies IOTRegistry transactions offline.
+
+	Usage:
+	|		iotreg keygen
+	|		iotreg pubkey -key <private key hex> | -pubkey <public key hex>
+	|		iotreg build <createRegistrant|registerThing|registerSpec> -key <private key hex> [flags | -json <file>]
+	|		iotreg decode <function> <args hex>
+	|		iotreg verify <createRegistrant|registerThing|registerSpec> <args hex>
+
+	build prints the hex encoded args[0] for Invoke, or its JSON form with -format json|json-base64.
+	Messages are built by the client package, which the chaincode uses to verify signatures as well.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	transaction types accepted by Invoke, by function name
+*/
+var txTypes = map[string]func() proto.Message{
+	"createRegistrant":    func() proto.Message { return &IOTRegistryTX.CreateRegistrantTX{} },
+	"registerThing":       func() proto.Message { return &IOTRegistryTX.RegisterThingTX{} },
+	"registerThingsBatch": func() proto.Message { return &IOTRegistryTX.RegisterThingsBatchTX{} },
+	"registerSpec":        func() proto.Message { return &IOTRegistryTX.RegisterSpecTX{} },
+	"attachThing":         func() proto.Message { return &IOTRegistryTX.AttachThingTX{} },
+	"detachThing":         func() proto.Message { return &IOTRegistryTX.DetachThingTX{} },
+	"createGroup":         func() proto.Message { return &IOTRegistryTX.CreateGroupTX{} },
+	"addGroupMembers":     func() proto.Message { return &IOTRegistryTX.GroupMembersTX{} },
+	"removeGroupMembers":  func() proto.Message { return &IOTRegistryTX.GroupMembersTX{} },
+	"deleteGroup":         func() proto.Message { return &IOTRegistryTX.DeleteGroupTX{} },
+	"setThingStatus":      func() proto.Message { return &IOTRegistryTX.SetThingStatusTX{} },
+	"setStatusDelegate":   func() proto.Message { return &IOTRegistryTX.StatusDelegateTX{} },
+}
+
+/*
+	JSON input for build. Byte fields (Nonce) are hex encoded.
+*/
+type buildInput struct {
+	Name         string
+	Nonce        string
+	Aliases      []string
+	TypedAliases []*IOTRegistryTX.TypedAlias
+	Spec         string
+	Data         string
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "iotreg: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("expected a command: keygen, pubkey, build, decode or verify")
+	}
+	switch args[0] {
+	case "keygen":
+		return keygen(out)
+	case "pubkey":
+		return pubkey(args[1:], out)
+	case "build":
+		return build(args[1:], out)
+	case "decode":
+		return decode(args[1:], out)
+	case "verify":
+		return verifyArgs(args[1:], out)
+	}
+	return fmt.Errorf("unknown command (%s)", args[0])
+}
+
+func keygen(out io.Writer) error {
+	signer, err := client.GeneratePrivateKeySigner()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Private Key: %s\n", signer.PrivateKeyHex())
+	fmt.Fprintf(out, " Public Key: %s\n", client.PubkeyHex(signer))
+	return nil
+}
+
+/*
+	prints the compressed public key of a private key, or the compressed form of any SEC1 public key.
+*/
+func pubkey(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("pubkey", flag.ContinueOnError)
+	privateKey := flags.String("key", "", "hex encoded private key")
+	publicKey := flags.String("pubkey", "", "hex encoded public key in any SEC1 encoding")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	switch {
+	case len(*privateKey) != 0:
+		signer, err := client.NewPrivateKeySigner(*privateKey)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, client.PubkeyHex(signer))
+	case len(*publicKey) != 0:
+		normalized, err := client.NormalizePubkeyHex(*publicKey)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, normalized)
+	default:
+		return errors.New("pubkey needs -key or -pubkey")
+	}
+	return nil
+}
+
+func build(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("build needs a function: createRegistrant, registerThing or registerSpec")
+	}
+	function := args[0]
+	flags := flag.NewFlagSet("build "+function, flag.ContinueOnError)
+	privateKey := flags.String("key", "", "hex encoded private key of the registrant")
+	jsonFile := flags.String("json", "", "JSON file with the transaction fields")
+	name := flags.String("name", "", "registrant or spec name")
+	nonce := flags.String("nonce", "", "hex encoded thing nonce")
+	aliases := flags.String("aliases", "", "comma separated aliases")
+	spec := flags.String("spec", "", "spec name of a thing")
+	data := flags.String("data", "", "data")
+	format := flags.String("format", "hex", "output format: hex, json or json-base64")
+	validFor := flags.Duration("valid-for", 0, "validity window of the transaction from now, e.g. 24h (default unbounded)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	var options []client.Option
+	if *validFor > 0 {
+		options = append(options, client.ValidFor(*validFor))
+	}
+	signer, err := client.NewPrivateKeySigner(*privateKey)
+	if err != nil {
+		return err
+	}
+
+	input := buildInput{Name: *name, Nonce: *nonce, Spec: *spec, Data: *data}
+	if len(*aliases) != 0 {
+		input.Aliases = strings.Split(*aliases, ",")
+	}
+	if len(*jsonFile) != 0 {
+		jsonBytes, err := ioutil.ReadFile(*jsonFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(jsonBytes, &input); err != nil {
+			return fmt.Errorf("error parsing %s: %v", *jsonFile, err)
+		}
+	}
+
+	var tx proto.Message
+	switch function {
+	case "createRegistrant":
+		tx, err = client.CreateRegistrant(signer, input.Name, input.Data, options...)
+	case "registerThing":
+		nonceBytes, decodeErr := hex.DecodeString(input.Nonce)
+		if decodeErr != nil || len(nonceBytes) == 0 {
+			return fmt.Errorf("nonce (%s) must be non-empty hex", input.Nonce)
+		}
+		tx, err = client.RegisterThing(signer, nonceBytes, input.Aliases, input.TypedAliases, input.Spec, input.Data, options...)
+	case "registerSpec":
+		tx, err = client.RegisterSpec(signer, input.Name, input.Data, options...)
+	default:
+		return fmt.Errorf("cannot build function (%s)", function)
+	}
+	if err != nil {
+		return err
+	}
+	var encoded string
+	switch *format {
+	case "hex":
+		encoded, err = client.EncodeArgs(tx)
+	case "json":
+		encoded, err = client.EncodeJSONArgs(tx, client.ByteEncodingHex)
+	case "json-base64":
+		encoded, err = client.EncodeJSONArgs(tx, client.ByteEncodingBase64)
+	default:
+		return fmt.Errorf("unknown format (%s)", *format)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, encoded)
+	return nil
+}
+
+func decodeTX(function string, argsHex string) (proto.Message, error) {
+	newTX, ok := txTypes[function]
+	if !ok {
+		return nil, fmt.Errorf("unknown function (%s)", function)
+	}
+	argsBytes, err := hex.DecodeString(argsHex)
+	if err != nil {
+		return nil, fmt.Errorf("args (%s) are not hex", argsHex)
+	}
+	tx := newTX()
+	if err := proto.Unmarshal(argsBytes, tx); err != nil {
+		return nil, fmt.Errorf("args are not a %s protocol buffer: %v", reflect.TypeOf(tx).Elem().Name(), err)
+	}
+	return tx, nil
+}
+
+func decode(args []string, out io.Writer) error {
+	if len(args) != 2 {
+		return errors.New("decode needs a function and hex args")
+	}
+	tx, err := decodeTX(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	jsonBytes, err := json.MarshalIndent(hexBytes(reflect.ValueOf(tx)), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, string(jsonBytes))
+	return nil
+}
+
+/*
+	converts a transaction into plain values for JSON output, hex encoding byte slices.
+*/
+func hexBytes(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return hexBytes(v.Elem())
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			fields[v.Type().Field(i).Name] = hexBytes(v.Field(i))
+		}
+		return fields
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return hex.EncodeToString(v.Bytes())
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = hexBytes(v.Index(i))
+		}
+		return items
+	}
+	return v.Interface()
+}
+
+/*
+	verifies the signature of a createRegistrant, registerThing or registerSpec transaction against the
+	public key it names, the same way Invoke does.
+*/
+func verifyArgs(args []string, out io.Writer) error {
+	if len(args) != 2 {
+		return errors.New("verify needs a function and hex args")
+	}
+	tx, err := decodeTX(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	var pubKeyHex, message string
+	var sig []byte
+	switch tx := tx.(type) {
+	case *IOTRegistryTX.CreateRegistrantTX:
+		pubKeyHex = hex.EncodeToString(tx.RegistrantPubkey)
+		message = client.CreateRegistrantMessage(tx.RegistrantName, pubKeyHex, tx.Data, tx.AliasSalt)
+		sig = tx.Signature
+	case *IOTRegistryTX.RegisterThingTX:
+		pubKeyHex = tx.RegistrantPubkey
+		message = client.RegisterThingMessage(tx)
+		sig = tx.Signature
+	case *IOTRegistryTX.RegisterSpecTX:
+		pubKeyHex = tx.RegistrantPubkey
+		message = client.RegisterSpecMessage(tx.SpecName, tx.RegistrantPubkey, tx.Data, tx.Content)
+		sig = tx.Signature
+	default:
+		return fmt.Errorf("cannot verify function (%s) offline", args[0])
+	}
+	pubKeyBytes, err := hex.DecodeString(pubKeyHex)
+	if err != nil {
+		return fmt.Errorf("public key (%s) is not hex", pubKeyHex)
+	}
+	err = client.Verify(pubKeyBytes, sig, client.SignedMessage(tx, message))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "valid signature by %s\n", pubKeyHex)
+	if notBefore, notAfter := client.ValidityWindow(tx); notBefore != 0 || notAfter != 0 {
+		fmt.Fprintf(out, "valid from %d to %d\n", notBefore, notAfter)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testPrivateKey = "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+const testPublicKey = "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+
+func runOutput(t *testing.T, args ...string) string {
+	out := bytes.Buffer{}
+	if err := run(args, &out); err != nil {
+		t.Fatalf("iotreg %s: %v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(out.String())
+}
+
+func TestPubkey(t *testing.T) {
+	if got := runOutput(t, "pubkey", "-key", testPrivateKey); got != testPublicKey {
+		t.Errorf("pubkey -key got (%s)", got)
+	}
+	uncompressed := "04ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc" +
+		"0b30b3e9a7c7cd2a37bf9b7ba9e8cd30b2d0a0e1bb3dd44b61c6e7f9e0ba72c4"
+	out := bytes.Buffer{}
+	if err := run([]string{"pubkey", "-pubkey", uncompressed}, &out); err == nil {
+		t.Errorf("accepted a point that is not on the curve")
+	}
+	if !strings.Contains(runOutput(t, "keygen"), "Public Key: 0") {
+		t.Errorf("keygen did not print a compressed public key")
+	}
+}
+
+func TestBuildDecodeVerify(t *testing.T) {
+	args := runOutput(t, "build", "registerThing", "-key", testPrivateKey, "-nonce", "0a0b", "-aliases", "foo,bar", "-spec", "s", "-data", "d")
+	if got := runOutput(t, "verify", "registerThing", args); got != "valid signature by "+testPublicKey {
+		t.Errorf("verify got (%s)", got)
+	}
+
+	decoded := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(runOutput(t, "decode", "registerThing", args)), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["Nonce"] != "0a0b" || decoded["RegistrantPubkey"] != testPublicKey || decoded["Spec"] != "s" {
+		t.Errorf("decode got (%v)", decoded)
+	}
+
+	windowArgs := runOutput(t, "build", "registerSpec", "-key", testPrivateKey, "-name", "s", "-valid-for", "1h")
+	if got := runOutput(t, "verify", "registerSpec", windowArgs); !strings.HasPrefix(got, "valid signature by "+testPublicKey+"\nvalid from ") {
+		t.Errorf("verify of a transaction with a validity window got (%s)", got)
+	}
+
+	//a signature over other fields does not verify
+	otherArgs := runOutput(t, "build", "registerThing", "-key", testPrivateKey, "-nonce", "0a0b", "-aliases", "foo", "-spec", "s", "-data", "d")
+	forged := args[:len(args)-140] + otherArgs[len(otherArgs)-140:]
+	out := bytes.Buffer{}
+	if err := run([]string{"verify", "registerThing", forged}, &out); err == nil {
+		t.Errorf("verified a transaction with a signature over other fields")
+	}
+}
+
+func TestBuildFromJSON(t *testing.T) {
+	file, err := ioutil.TempFile("", "iotreg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{"Name": "Alice", "Data": "from json"}`)
+	file.Close()
+
+	args := runOutput(t, "build", "createRegistrant", "-key", testPrivateKey, "-json", file.Name())
+	runOutput(t, "verify", "createRegistrant", args)
+	decoded := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(runOutput(t, "decode", "createRegistrant", args)), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["RegistrantName"] != "Alice" || decoded["Data"] != "from json" || decoded["RegistrantPubkey"] != testPublicKey {
+		t.Errorf("decode got (%v)", decoded)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+/*
+	registryConfig holds the deployment settings of the registry. It is passed to Init as a JSON object
+	in args[0] and stored in the "Config" state; fields that are left out keep their defaults, and Init
+	without arguments deploys the defaults.
+	|		LegacySignatures	accept signatures that are not canonical (high S, trailing bytes), see verify
+	|		MaxClockSkew		seconds a validity window may be missed by, see checkValidity (default 300)
+	|		RequireValidity		reject signed transactions without a validity window and credentials without exp
+	|		BlindAliases		store aliases blinded with AliasSalt, see alias.go
+	|		AliasSalt			hex encoded salt of blinded aliases, 16 to 64 bytes
+	|		AdminPubkey			public key that signs administrative transactions, importSnapshot, repair and migrateKeys
+*/
+type registryConfig struct {
+	LegacySignatures bool   `json:",omitempty"`
+	MaxClockSkew     *int64 `json:",omitempty"`
+	RequireValidity  bool   `json:",omitempty"`
+	BlindAliases     bool   `json:",omitempty"`
+	AliasSalt        string `json:",omitempty"`
+	AdminPubkey      string `json:",omitempty"`
+}
+
+const defaultMaxClockSkew = 300
+
+func (config *registryConfig) maxClockSkew() int64 {
+	if config.MaxClockSkew == nil {
+		return defaultMaxClockSkew
+	}
+	return *config.MaxClockSkew
+}
+
+func configKey() string {
+	return compositeKey(configNamespace)
+}
+
+/*
+	returns the stored config, or the defaults if Init has not stored one.
+*/
+func getConfig(stub Stub) (*registryConfig, error) {
+	config := &registryConfig{}
+	configBytes, err := stub.GetState(configKey())
+	if err != nil {
+		return nil, internalError(configKey(), "Could not get Config State")
+	}
+	if len(configBytes) == 0 {
+		return config, nil
+	}
+	err = json.Unmarshal(configBytes, config)
+	if err != nil {
+		return nil, internalError(configKey(), "Error unmarshalling Config: (%v)", err.Error())
+	}
+	return config, nil
+}
+
+/*
+	verifies a signature made by the AdminPubkey of the config, for administrative transactions.
+	A registry without an AdminPubkey takes none.
+*/
+func verifyAdmin(stub Stub, sig []byte, message string, field string) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	if len(config.AdminPubkey) == 0 {
+		return failedPrecondition(configKey(), "the registry has no AdminPubkey to authorize administrative transactions")
+	}
+	adminPubKeyBytes, err := hex.DecodeString(config.AdminPubkey)
+	if err != nil {
+		return internalError(configKey(), "Error decoding AdminPubkey: %s", err.Error())
+	}
+	return verify(stub, adminPubKeyBytes, sig, message, field)
+}
+
+/*
+	decodes the config passed to Init. Unknown fields are rejected, so that a misspelled setting
+	does not silently deploy a default.
+*/
+func decodeConfig(args []string) (*registryConfig, error) {
+	config := &registryConfig{}
+	if len(args) == 0 || len(args[0]) == 0 {
+		return config, nil
+	}
+	if len(args) > 1 {
+		return nil, invalidArgument("args", "Init takes one JSON config argument, got %d", len(args))
+	}
+	decoder := json.NewDecoder(strings.NewReader(args[0]))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(config)
+	if err != nil {
+		return nil, invalidArgument("args", "Invalid config: %s", err.Error())
+	}
+	if config.MaxClockSkew != nil && *config.MaxClockSkew < 0 {
+		return nil, invalidArgument("args", "Invalid config: MaxClockSkew (%d) is negative", *config.MaxClockSkew)
+	}
+	if config.BlindAliases != (len(config.AliasSalt) != 0) {
+		return nil, invalidArgument("args", "Invalid config: BlindAliases and AliasSalt must be set together")
+	}
+	if config.BlindAliases {
+		salt, err := hex.DecodeString(config.AliasSalt)
+		if err != nil || !validAliasSalt(salt) {
+			return nil, invalidArgument("args", "Invalid config: AliasSalt must be %d to %d hex encoded bytes", minAliasSaltSize, maxAliasSaltSize)
+		}
+	}
+	if len(config.AdminPubkey) != 0 {
+		config.AdminPubkey, err = normalizePubkey("args", config.AdminPubkey)
+		if err != nil {
+			return nil, prefixError(err, "Invalid config: AdminPubkey")
+		}
+	}
+	return config, nil
+}
+
+/*
+	stores the config passed to Init, replacing the config of an earlier deployment.
+*/
+func runInit(stub Stub, args []string) ([]byte, error) {
+	err := initConfig(stub, args)
+	if err == nil {
+		err = initKeyLayout(stub)
+	}
+	if err == nil {
+		err = initStateTree(stub)
+	}
+	if err != nil {
+		err = asRegistryError(err)
+		fmt.Printf("Init failed: %s\n", err.Error())
+		return nil, err
+	}
+	return nil, nil
+}
+
+func initConfig(stub Stub, args []string) error {
+	config, err := decodeConfig(args)
+	if err != nil {
+		return err
+	}
+	err = checkAliasBlindingChange(stub, config)
+	if err != nil {
+		return err
+	}
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return internalError(configKey(), "Error marshalling Config: (%v)", err.Error())
+	}
+	err = stub.PutState(configKey(), configBytes)
+	if err != nil {
+		return internalError(configKey(), "Error putting Config state :(%v)", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+/*
+	returns the high S encoding of a canonical DER signature, which verifies against the same message
+*/
+func highSSignature(sigBytes []byte) ([]byte, error) {
+	sig, err := btcec.ParseDERSignature(sigBytes, btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	r := sig.R.Bytes()
+	if r[0]&0x80 != 0 {
+		r = append([]byte{0}, r...)
+	}
+	s := new(big.Int).Sub(btcec.S256().N, sig.S).Bytes()
+	if s[0]&0x80 != 0 {
+		s = append([]byte{0}, s...)
+	}
+	highS := []byte{0x30, byte(4 + len(r) + len(s)), 0x02, byte(len(r))}
+	highS = append(highS, r...)
+	highS = append(highS, 0x02, byte(len(s)))
+	return append(highS, s...), nil
+}
+
+func TestLegacySignatures(t *testing.T) {
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	signer, err := client.NewPrivateKeySigner(alicePriv)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	spec, err := client.RegisterSpec(signer, "spec", "data")
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	spec.Signature, err = highSSignature(spec.Signature)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	args, err := client.EncodeArgs(spec)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	for _, legacy := range []bool{false, true} {
+		stub := newTestStub()
+		checkInit(t, stub, []string{fmt.Sprintf(`{"LegacySignatures":%t}`, legacy)})
+		if err := createRegistrant(t, stub, "Alice", "", alicePriv, client.PubkeyHex(signer)); err != nil {
+			HandleError(t, err)
+			return
+		}
+		_, err = stub.MockInvoke("2", "registerSpec", []string{args})
+		if legacy {
+			HandleError(t, err)
+		} else {
+			HandleError(t, checkErrorCode(err, client.CodeBadSignature, "", "Signature"))
+		}
+	}
+
+	for _, config := range []string{`{"LegacySignature":true}`, `{"LegacySignatures":"yes"}`, `[]`, `{"AdminPubkey":"not a key"}`} {
+		_, err := newTestStub().MockInit("1", "", []string{config})
+		HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "args"))
+	}
+}
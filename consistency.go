@@ -0,0 +1,298 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	The checkConsistency query scans the records of the registry for the inconsistencies below, and the
+	repair transaction fixes the ones that are safe to fix, that is, where the ledger itself shows what the
+	record must be:
+	|		undecodable			a record is not a valid protocol buffer of its namespace
+	|		missingRegistrant	a thing refers to a registrant that does not exist
+	|		missingThing		an alias refers to a thing that does not exist; repair deletes the alias
+	|		unlistedAlias		an alias refers to a thing that does not list it among its aliases
+	|		missingAlias		a thing lists an alias that has no state; repair puts the alias, unless
+	|							another thing lists it as well
+	|		conflictingAlias	a thing lists an alias whose state refers to another thing
+	The other inconsistencies need a decision on which record is right, so they are only reported.
+*/
+const (
+	issueUndecodable       = "undecodable"
+	issueMissingRegistrant = "missingRegistrant"
+	issueMissingThing      = "missingThing"
+	issueUnlistedAlias     = "unlistedAlias"
+	issueMissingAlias      = "missingAlias"
+	issueConflictingAlias  = "conflictingAlias"
+)
+
+/*
+	A consistencyIssue is an inconsistent record. A Repairable issue is fixed by putting repairValue to its
+	key, or deleting the key if repairValue is nil.
+*/
+type consistencyIssue struct {
+	Kind        string
+	Key         string
+	Message     string
+	Repairable  bool
+	key         string
+	repairValue []byte
+}
+
+type consistencyReport struct {
+	Scanned        int
+	Issues         []*consistencyIssue
+	Checksum       string
+	RepairSequence int64
+}
+
+func repairSequenceKey() string {
+	return compositeKey(repairSequenceNamespace)
+}
+
+/*
+	gets the "RepairSequence" state, the number of repairs run so far.
+*/
+func getRepairSequence(stub Stub) (int64, error) {
+	key := repairSequenceKey()
+	sequenceBytes, err := stub.GetState(key)
+	if err != nil {
+		return 0, internalError(key, "Could not get RepairSequence State")
+	}
+	if len(sequenceBytes) == 0 {
+		return 0, nil
+	}
+	sequence, err := strconv.ParseInt(string(sequenceBytes), 10, 64)
+	if err != nil {
+		return 0, internalError(key, "Invalid RepairSequence (%s)", sequenceBytes)
+	}
+	return sequence, nil
+}
+
+/*
+	scans the registrants, things, aliases and typed aliases of the ledger, and decodes the records of the
+	other namespaces of a snapshot.
+*/
+func checkConsistency(stub Stub) (*consistencyReport, error) {
+	report := &consistencyReport{Issues: []*consistencyIssue{}}
+	addIssue := func(kind string, key string, message string) *consistencyIssue {
+		issue := &consistencyIssue{Kind: kind, Key: displayKey(key), Message: message, key: key}
+		report.Issues = append(report.Issues, issue)
+		return issue
+	}
+
+	//collect the decoded records first, since the checks below read records of other namespaces.
+	//present holds undecodable records as well, so that they are not taken for missing ones.
+	present := make(map[string]bool)
+	things := make(map[string]*IOTRegistryStore.Thing)
+	aliases := make(map[string][]byte)
+	var thingKeys, aliasKeys []string
+	for _, scanned := range snapshotNamespaces {
+		if scanned.record == nil {
+			continue
+		}
+		err := rangeScan(stub, keyPrefix(scanned.namespace), func(key string, value []byte) error {
+			report.Scanned++
+			present[key] = true
+			record := scanned.record()
+			err := proto.Unmarshal(value, record)
+			if err != nil {
+				addIssue(issueUndecodable, key, "record is not a "+scanned.namespace+": "+err.Error())
+				return nil
+			}
+			switch scanned.namespace {
+			case thingNamespace:
+				things[key] = record.(*IOTRegistryStore.Thing)
+				thingKeys = append(thingKeys, key)
+			case aliasNamespace, typedAliasNamespace:
+				aliases[key] = record.(*IOTRegistryStore.Alias).Nonce
+				aliasKeys = append(aliasKeys, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//the alias keys each thing lists, and how many things list each key
+	listed := make(map[string]map[string]bool)
+	claims := make(map[string]int)
+	for _, key := range thingKeys {
+		thing := things[key]
+		listed[key] = make(map[string]bool)
+		for _, alias := range thing.Aliases {
+			listed[key][aliasKey(alias)] = true
+		}
+		for _, typedAlias := range thing.TypedAliases {
+			listed[key][typedAliasKey(typedAlias.Type, typedAlias.Scope, typedAlias.Value)] = true
+		}
+		for listedKey := range listed[key] {
+			claims[listedKey]++
+		}
+	}
+
+	for _, key := range thingKeys {
+		thing := things[key]
+		if !present[registrantKey(thing.RegistrantPubkey)] {
+			addIssue(issueMissingRegistrant, key, "registrant ("+thing.RegistrantPubkey+") does not exist")
+		}
+		nonce, _ := hex.DecodeString(lastKeyComponent(key))
+		for _, keys := range [][]string{aliasKeysOf(thing.Aliases), typedAliasKeysOf(thing.TypedAliases)} {
+			for _, listedKey := range keys {
+				aliasNonce, ok := aliases[listedKey]
+				switch {
+				case !present[listedKey] && claims[listedKey] == 1:
+					issue := addIssue(issueMissingAlias, listedKey, "alias of thing ("+lastKeyComponent(key)+") has no state")
+					issue.Repairable = true
+					issue.repairValue, _ = proto.Marshal(&IOTRegistryStore.Alias{Nonce: nonce})
+				case !present[listedKey]:
+					addIssue(issueMissingAlias, listedKey, "alias of thing ("+lastKeyComponent(key)+") has no state and is listed by other things")
+				case ok && !bytes.Equal(aliasNonce, nonce):
+					addIssue(issueConflictingAlias, listedKey, "alias of thing ("+lastKeyComponent(key)+") refers to thing ("+hex.EncodeToString(aliasNonce)+")")
+				}
+			}
+		}
+	}
+
+	for _, key := range aliasKeys {
+		thing := thingKey(hex.EncodeToString(aliases[key]))
+		switch {
+		case !present[thing]:
+			issue := addIssue(issueMissingThing, key, "thing ("+hex.EncodeToString(aliases[key])+") does not exist")
+			issue.Repairable = true
+		case things[thing] != nil && !listed[thing][key]:
+			addIssue(issueUnlistedAlias, key, "thing ("+hex.EncodeToString(aliases[key])+") does not list the alias")
+		}
+	}
+	issuesBytes, err := json.Marshal(report.Issues)
+	if err != nil {
+		return nil, internalError("", "Error marshalling consistency issues: (%v)", err.Error())
+	}
+	checksum := sha256.Sum256(issuesBytes)
+	report.Checksum = hex.EncodeToString(checksum[:])
+	report.RepairSequence, err = getRepairSequence(stub)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func aliasKeysOf(aliases []string) []string {
+	keys := make([]string, len(aliases))
+	for i, alias := range aliases {
+		keys[i] = aliasKey(alias)
+	}
+	return keys
+}
+
+func typedAliasKeysOf(typedAliases []*IOTRegistryStore.TypedAlias) []string {
+	keys := make([]string, len(typedAliases))
+	for i, typedAlias := range typedAliases {
+		keys[i] = typedAliasKey(typedAlias.Type, typedAlias.Scope, typedAlias.Value)
+	}
+	return keys
+}
+
+/*
+	checkConsistency returns a consistencyReport of the registry:
+	|		args {}
+	|		result {"Scanned":<records>,"Issues":[{"Kind","Key","Message","Repairable"}],"Checksum":<hex>,"RepairSequence":<repairs so far>}
+	Checksum is the sha256 of the JSON of the Issues, which a repair signs with the RepairSequence.
+*/
+func queryCheckConsistency(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 0 {
+		return nil, invalidArgument("args", "checkConsistency takes no arguments")
+	}
+	report, err := checkConsistency(stub)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(report)
+}
+
+/*
+	repair fixes the Repairable issues of checkConsistency. It is signed by the AdminPubkey of the config
+	over "repair:<RepairSequence>:<Checksum>" of the report it was built for, and fails with
+	FAILED_PRECONDITION if the issues have changed since, so a signature authorizes the repair of the issues
+	the admin reviewed, and not of later ones. Every repair increments the RepairSequence, so it cannot be
+	replayed, even when the same issues come back later.
+	It returns the issues it repaired and the ones that remain:
+	|		result {"Repaired":[...],"Remaining":[...]}
+	TX struct: 		RepairTX
+	Store structs: 	Alias, "RepairSequence"
+*/
+type repairHandler struct{ txType }
+
+func (repairHandler) validate(tx proto.Message) error {
+	repairArgs := tx.(*IOTRegistryTX.RepairTX)
+	if len(repairArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", repairArgs.Signature)
+	}
+	if len(repairArgs.Checksum) != 2*sha256.Size {
+		return invalidArgument("Checksum", "Checksum (%s) is not a hex sha256", repairArgs.Checksum)
+	}
+	return nil
+}
+
+func (repairHandler) authorize(stub Stub, tx proto.Message) error {
+	repairArgs := tx.(*IOTRegistryTX.RepairTX)
+	return verifyAdmin(stub, repairArgs.Signature, client.SignedMessage(repairArgs, client.RepairMessage(repairArgs.Sequence, repairArgs.Checksum)), "Signature")
+}
+
+func (repairHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	repairArgs := tx.(*IOTRegistryTX.RepairTX)
+	report, err := checkConsistency(stub)
+	if err != nil {
+		return nil, err
+	}
+	if repairArgs.Sequence != report.RepairSequence {
+		return nil, failedPrecondition(repairSequenceKey(), "Sequence (%d) is not the current RepairSequence (%d)", repairArgs.Sequence, report.RepairSequence)
+	}
+	if report.Checksum != repairArgs.Checksum {
+		return nil, registryError(client.CodeFailedPrecondition, "", "Checksum", "the issues of checkConsistency (%s) are not the ones the repair was signed for (%s)", report.Checksum, repairArgs.Checksum)
+	}
+	result := struct {
+		Repaired  []*consistencyIssue
+		Remaining []*consistencyIssue
+	}{[]*consistencyIssue{}, []*consistencyIssue{}}
+	for _, issue := range report.Issues {
+		if !issue.Repairable {
+			result.Remaining = append(result.Remaining, issue)
+			continue
+		}
+		if issue.repairValue == nil {
+			err = stub.DelState(issue.key)
+		} else {
+			err = stub.PutState(issue.key, issue.repairValue)
+		}
+		if err != nil {
+			return nil, internalError(issue.key, "Error repairing state :(%v)", err.Error())
+		}
+		result.Repaired = append(result.Repaired, issue)
+	}
+	key := repairSequenceKey()
+	err = stub.PutState(key, []byte(strconv.FormatInt(report.RepairSequence+1, 10)))
+	if err != nil {
+		return nil, internalError(key, "Error putting RepairSequence state :(%v)", err.Error())
+	}
+	return json.Marshal(result)
+}
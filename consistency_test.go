@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	returns the issues of a checkConsistency query as "<Kind> <Key>", sorted, with a "*" suffix for the
+	repairable ones.
+*/
+func consistencyIssues(stub *testStub) ([]string, error) {
+	bytes, err := stub.MockQuery("checkConsistency", nil)
+	if err != nil {
+		return nil, err
+	}
+	report := consistencyReport{}
+	err = json.Unmarshal(bytes, &report)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling json string %s", bytes)
+	}
+	issues := []string{}
+	for _, issue := range report.Issues {
+		summary := issue.Kind + " " + issue.Key
+		if issue.Repairable {
+			summary += "*"
+		}
+		issues = append(issues, summary)
+	}
+	sort.Strings(issues)
+	return issues, nil
+}
+
+/*
+	returns the RepairSequence and Checksum of a checkConsistency query, which a repair signs
+*/
+func consistencyChecksum(stub *testStub) (int64, string) {
+	bytes, _ := stub.MockQuery("checkConsistency", nil)
+	report := consistencyReport{}
+	json.Unmarshal(bytes, &report)
+	return report.RepairSequence, report.Checksum
+}
+
+func TestConsistency(t *testing.T) {
+	stub := newTestStub()
+	admin, err := client.GeneratePrivateKeySigner()
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	checkInit(t, stub, []string{fmt.Sprintf(`{"AdminPubkey":"%s"}`, client.PubkeyHex(admin))})
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	typed := []*IOTRegistryTX.TypedAlias{{Type: "serial", Value: "SN1", Scoped: true}}
+	if err := registerTypedThing(t, stub, []byte{1}, []string{"a1", "a2"}, typed, alicePub, "spec A", "", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := registerThing(t, stub, []byte{2}, []string{"b1"}, alicePub, "spec A", "", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+	issues, err := consistencyIssues(stub)
+	if err != nil || len(issues) != 0 {
+		HandleError(t, fmt.Errorf("consistent registry has issues %v: %v", issues, err))
+	}
+	_, consistent := consistencyChecksum(stub)
+
+	//break the ledger the ways checkConsistency detects
+	alias := func(nonce byte) []byte {
+		aliasBytes, _ := proto.Marshal(&IOTRegistryStore.Alias{Nonce: []byte{nonce}})
+		return aliasBytes
+	}
+	orphan, _ := proto.Marshal(&IOTRegistryStore.Thing{RegistrantPubkey: "02242a1c19bc831cd95a9e5492015043250cbc17d0eceb82612ce08736b8d753a6", Aliases: []string{"b1", "c1"}})
+	stub.MockTransactionStart("corrupt")
+	stub.DelState(aliasKey("a2"))
+	stub.DelState(typedAliasKey("serial", alicePub, "SN1"))
+	stub.PutState(aliasKey("orphan"), alias(9))
+	stub.PutState(aliasKey("stray"), alias(1))
+	stub.PutState(thingKey("03"), orphan)
+	stub.PutState(specKey("broken"), []byte{0xff})
+	stub.MockTransactionEnd("corrupt")
+
+	expected := []string{
+		"conflictingAlias Alias:b1",
+		"missingAlias Alias:a2*",
+		"missingAlias Alias:c1*",
+		"missingAlias TypedAlias:serial:" + alicePub + ":SN1*",
+		"missingRegistrant Thing:03",
+		"missingThing Alias:orphan*",
+		"undecodable Spec:broken",
+		"unlistedAlias Alias:stray",
+	}
+	issues, err = consistencyIssues(stub)
+	if err != nil || fmt.Sprint(issues) != fmt.Sprint(expected) {
+		HandleError(t, fmt.Errorf("checkConsistency returned %v, expected %v: %v", issues, expected, err))
+	}
+
+	//only the admin repairs, and only the issues the repair was signed for
+	sequence, checksum := consistencyChecksum(stub)
+	alice, _ := client.NewPrivateKeySigner(alicePriv)
+	tx, _ := client.Repair(alice, sequence, checksum)
+	HandleError(t, checkErrorCode(invokeTX(stub, "repair", tx), client.CodeBadSignature, "", "Signature"))
+	tx, _ = client.Repair(admin, sequence, consistent)
+	HandleError(t, checkErrorCode(invokeTX(stub, "repair", tx), client.CodeFailedPrecondition, "", "Checksum"))
+
+	tx, _ = client.Repair(admin, sequence, checksum)
+	if err := invokeTX(stub, "repair", tx); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if specName, err := queryThingSpec(stub, "a2"); err != nil || specName != "spec A" {
+		HandleError(t, fmt.Errorf("repaired alias returned spec (%s): %v", specName, err))
+	}
+	if _, err := queryThingSpec(stub, "orphan"); err == nil {
+		HandleError(t, fmt.Errorf("orphaned alias was not deleted"))
+	}
+	remaining := []string{}
+	for _, issue := range expected {
+		if issue[len(issue)-1] != '*' {
+			remaining = append(remaining, issue)
+		}
+	}
+	issues, err = consistencyIssues(stub)
+	if err != nil || fmt.Sprint(issues) != fmt.Sprint(remaining) {
+		HandleError(t, fmt.Errorf("after repair checkConsistency returned %v, expected %v: %v", issues, remaining, err))
+	}
+
+	//the repair cannot be replayed, and repairing again changes nothing
+	HandleError(t, checkErrorCode(invokeTX(stub, "repair", tx), client.CodeFailedPrecondition, displayKey(repairSequenceKey()), ""))
+	sequence, checksum = consistencyChecksum(stub)
+	tx, _ = client.Repair(admin, sequence, checksum)
+	if err := invokeTX(stub, "repair", tx); err != nil {
+		HandleError(t, err)
+	}
+
+	//nor can a repair whose issues come back after it ran
+	stub.MockTransactionStart("corrupt")
+	stub.PutState(aliasKey("orphan"), alias(9))
+	stub.MockTransactionEnd("corrupt")
+	sequence, checksum = consistencyChecksum(stub)
+	tx, _ = client.Repair(admin, sequence, checksum)
+	if err := invokeTX(stub, "repair", tx); err != nil {
+		HandleError(t, err)
+	}
+	stub.MockTransactionStart("corrupt")
+	stub.PutState(aliasKey("orphan"), alias(9))
+	stub.MockTransactionEnd("corrupt")
+	if _, again := consistencyChecksum(stub); again != checksum {
+		HandleError(t, fmt.Errorf("the same issues have another Checksum (%s), expected (%s)", again, checksum))
+	}
+	HandleError(t, checkErrorCode(invokeTX(stub, "repair", tx), client.CodeFailedPrecondition, displayKey(repairSequenceKey()), ""))
+
+	_, err = stub.MockQuery("checkConsistency", []string{"extra"})
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "args"))
+}
@@ -0,0 +1,105 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+)
+
+/*
+	Things and specs may reference off-chain data with a ContentRef (see client/content.go) in place of
+	their inline Data. The ContentRef is part of the signed message and is stored on the Thing or Spec,
+	so content fetched from its URI can be checked against the ledger with the verifyContent query.
+*/
+func validateContent(content *IOTRegistryTX.ContentRef, data string) error {
+	if content == nil {
+		return nil
+	}
+	if len(data) != 0 {
+		return invalidArgument("Data", "Data must be empty when Content references off-chain data")
+	}
+	err := client.CheckContentRef(content)
+	if err != nil {
+		return invalidArgument("Content", "%s", err.Error())
+	}
+	return nil
+}
+
+/*
+	converts the ContentRef of a transaction to its store type.
+*/
+func storedContent(content *IOTRegistryTX.ContentRef) *IOTRegistryStore.ContentRef {
+	if content == nil {
+		return nil
+	}
+	return &IOTRegistryStore.ContentRef{URI: content.URI, Hash: content.Hash, Size: content.Size, MediaType: content.MediaType}
+}
+
+/*
+	verifyContent checks content against the ContentRef stored on a thing or spec:
+	|		args {"thing", <Nonce hex>, <content hex>} or {"spec", <SpecName>, <content hex>}
+	and returns JSON with the stored ContentRef and the result:
+	|		{"Valid":false,"Reason":"content does not match Hash (...)","Content":{"URI":...,"Hash":...}}
+	A thing or spec without a ContentRef is a FAILED_PRECONDITION.
+*/
+func queryVerifyContent(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, invalidArgument("args", "expected thing or spec, its Nonce or SpecName, and the hex encoded content")
+	}
+	content, err := hex.DecodeString(args[2])
+	if err != nil {
+		return nil, invalidArgument("args", "content is not hex: %s", err.Error())
+	}
+	var key string
+	var ref *IOTRegistryStore.ContentRef
+	switch args[0] {
+	case "thing":
+		nonce, err := hex.DecodeString(args[1])
+		if err != nil || len(nonce) == 0 {
+			return nil, invalidArgument("args", "Nonce (%s) is not hex", args[1])
+		}
+		thing, err := getThing(stub, nonce)
+		if err != nil {
+			return nil, err
+		}
+		key, ref = thingKey(args[1]), thing.Content
+	case "spec":
+		err = validateKeyComponent("args", args[1])
+		if err != nil {
+			return nil, err
+		}
+		spec, err := getSpec(stub, args[1])
+		if err != nil {
+			return nil, err
+		}
+		key, ref = specKey(args[1]), spec.Content
+	default:
+		return nil, invalidArgument("args", "expected thing or spec, got (%s)", args[0])
+	}
+	if ref == nil {
+		return nil, failedPrecondition(key, "(%s) has no off-chain Content", args[1])
+	}
+
+	result := struct {
+		Valid   bool
+		Reason  string `json:",omitempty"`
+		Content *IOTRegistryStore.ContentRef
+	}{Valid: true, Content: ref}
+	err = client.VerifyContent(ref.Hash, ref.Size, content)
+	if err != nil {
+		result.Valid, result.Reason = false, err.Error()
+	}
+	return json.Marshal(result)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	calls verifyContent and returns whether the content matched
+*/
+func verifyContent(stub *testStub, kind string, id string, content []byte) (bool, error) {
+	bytes, err := stub.MockQuery("verifyContent", []string{kind, id, hex.EncodeToString(content)})
+	if err != nil {
+		return false, err
+	}
+	result := struct{ Valid bool }{}
+	err = json.Unmarshal(bytes, &result)
+	return result.Valid, err
+}
+
+func TestOffChainContent(t *testing.T) {
+	stub := newTestStub()
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	signer, err := client.NewPrivateKeySigner(alicePriv)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, client.PubkeyHex(signer)); err != nil {
+		HandleError(t, err)
+		return
+	}
+	invoke := func(function string, tx proto.Message) error {
+		args, err := client.EncodeArgs(tx)
+		if err != nil {
+			return err
+		}
+		_, err = stub.MockInvoke("2", function, []string{args})
+		return err
+	}
+
+	manual := []byte("a spec manual too large to keep in world state")
+	ref := client.NewContentRef("https://example.com/manual.pdf", "application/pdf", manual)
+	spec, err := client.RegisterSpec(signer, "spec", "", client.WithContent(ref))
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	HandleError(t, invoke("registerSpec", spec))
+	image := []byte("device image")
+	thing, err := client.RegisterThing(signer, []byte{1}, []string{"device"}, nil, "spec", "",
+		client.WithContent(client.NewContentRef("ipfs://image", "", image)))
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	HandleError(t, invoke("registerThing", thing))
+
+	for _, test := range []struct {
+		kind    string
+		id      string
+		content []byte
+		valid   bool
+	}{
+		{"spec", "spec", manual, true},
+		{"spec", "spec", append(manual, '!'), false},
+		{"thing", "01", image, true},
+		{"thing", "01", manual, false},
+	} {
+		valid, err := verifyContent(stub, test.kind, test.id, test.content)
+		if err != nil || valid != test.valid {
+			HandleError(t, fmt.Errorf("verifyContent %s (%s) returned %t, expected %t: %v", test.kind, test.id, valid, test.valid, err))
+		}
+	}
+
+	//JSON arguments carry the ContentRef as a nested object
+	jsonSpec, err := client.RegisterSpec(signer, "jsonSpec", "", client.WithContent(ref))
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	jsonArgs, err := client.EncodeJSONArgs(jsonSpec, client.ByteEncodingHex)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	_, err = stub.MockInvoke("2", "registerSpec", []string{jsonArgs, "json"})
+	HandleError(t, err)
+	if valid, err := verifyContent(stub, "spec", "jsonSpec", manual); err != nil || !valid {
+		HandleError(t, fmt.Errorf("content of a spec registered with JSON arguments does not verify: %v", err))
+	}
+
+	//the ContentRef is signed
+	tampered, err := client.RegisterSpec(signer, "tampered", "", client.WithContent(ref))
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	tampered.Content.URI = "https://example.com/other.pdf"
+	err = invoke("registerSpec", tampered)
+	HandleError(t, checkErrorCode(err, client.CodeBadSignature, "", "Signature"))
+
+	both, err := client.RegisterSpec(signer, "both", "inline", client.WithContent(ref))
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	err = invoke("registerSpec", both)
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "Data"))
+	badHash, err := client.RegisterSpec(signer, "badHash", "",
+		client.WithContent(&IOTRegistryTX.ContentRef{URI: "https://example.com/manual.pdf", Hash: "md5:00"}))
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	err = invoke("registerSpec", badHash)
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "Content"))
+
+	if err := registerSpec(t, stub, "inline", client.PubkeyHex(signer), "data", alicePriv); err != nil {
+		HandleError(t, err)
+	}
+	_, err = verifyContent(stub, "spec", "inline", manual)
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(specKey("inline")), ""))
+	_, err = verifyContent(stub, "thing", "02", manual)
+	HandleError(t, checkErrorCode(err, client.CodeNotFound, displayKey(thingKey("02")), ""))
+}
@@ -0,0 +1,321 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	Registrants issue registration credentials for their things (see client/credential.go): JWT
+	Verifiable Credentials stating that the thing was registered by the registrant and conforms to a spec.
+	issueCredential anchors a credential, after checking its signature and its claims against the ledger,
+	in a "Credential:<IssuerPubkey>:<CredentialID>" state holding its hash and status. revokeCredential
+	revokes it, and verifyCredential checks a presented credential against its issuer and that state.
+*/
+func credentialKey(issuerPubkey string, credentialID string) string {
+	return compositeKey(credentialNamespace, issuerPubkey, credentialID)
+}
+
+/*
+	gets the status of a credential. Returns nil if the credential is not anchored.
+*/
+func getCredential(stub Stub, issuerPubkey string, credentialID string) (*IOTRegistryStore.Credential, error) {
+	key := credentialKey(issuerPubkey, credentialID)
+	credentialBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "Could not get Credential (%s) State", credentialID)
+	}
+	if len(credentialBytes) == 0 {
+		return nil, nil
+	}
+	credential := IOTRegistryStore.Credential{}
+	err = proto.Unmarshal(credentialBytes, &credential)
+	if err != nil {
+		return nil, internalError(key, "Error unmarshalling Credential (%s): (%v)", credentialID, err.Error())
+	}
+	return &credential, nil
+}
+
+func putCredential(stub Stub, credential *IOTRegistryStore.Credential, credentialID string) error {
+	key := credentialKey(credential.IssuerPubkey, credentialID)
+	credentialBytes, err := proto.Marshal(credential)
+	if err != nil {
+		return internalError(key, "error marshalling type IOTRegistry store :(%v)", err.Error())
+	}
+	err = stub.PutState(key, credentialBytes)
+	if err != nil {
+		return internalError(key, "Error putting Credential state :(%v)", err.Error())
+	}
+	return nil
+}
+
+/*
+	issueCredential anchors a registration credential. The credential is its own authorization: its
+	signature must verify against its registered issuer, which must own the subject thing, and the thing
+	must not be retired and must have the spec the credential claims.
+	TX struct: 		IssueCredentialTX
+	Store structs: 	Credential
+*/
+type issueCredentialHandler struct{ txType }
+
+/*
+	checkCredentialValidity is the validity window check of issueCredential. The credential is signed on its
+	own, so a NotBefore/NotAfter on the transaction would not be covered by the issuer's signature; the
+	window is the "nbf" and "exp" claims of the credential instead. It only applies with RequireValidity in
+	the config, which also requires an "exp" claim, so that a credential cannot be anchored long after it
+	was issued.
+*/
+func checkCredentialValidity(stub Stub, issueArgs *IOTRegistryTX.IssueCredentialTX) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	if !config.RequireValidity {
+		return nil
+	}
+	credential, err := client.ParseCredential(issueArgs.Credential)
+	if err != nil {
+		return invalidArgument("Credential", "%s", err.Error())
+	}
+	if credential.Claims.Expires == 0 {
+		return invalidArgument("Credential", "the registry requires credentials with an expiry (exp)")
+	}
+	timestamp, err := txTimestamp(stub)
+	if err != nil {
+		return err
+	}
+	skew := config.maxClockSkew()
+	if timestamp+skew < credential.Claims.NotBefore {
+		return registryError(client.CodeFailedPrecondition, "", "Credential", "credential is not valid before (%d), timestamp is (%d)", credential.Claims.NotBefore, timestamp)
+	}
+	if timestamp-skew > credential.Claims.Expires {
+		return registryError(client.CodeFailedPrecondition, "", "Credential", "credential expired at (%d), timestamp is (%d)", credential.Claims.Expires, timestamp)
+	}
+	return nil
+}
+
+func (issueCredentialHandler) validate(tx proto.Message) error {
+	issueArgs := tx.(*IOTRegistryTX.IssueCredentialTX)
+	_, err := client.ParseCredential(issueArgs.Credential)
+	if err != nil {
+		return invalidArgument("Credential", "%s", err.Error())
+	}
+	return nil
+}
+
+func (issueCredentialHandler) authorize(stub Stub, tx proto.Message) error {
+	issueArgs := tx.(*IOTRegistryTX.IssueCredentialTX)
+	credential, _ := client.ParseCredential(issueArgs.Credential)
+	issuerPubKeyBytes, err := getRegistrantPubkey(stub, credential.IssuerPubkey)
+	if err != nil {
+		return err
+	}
+	err = credential.Verify(issuerPubKeyBytes)
+	if err != nil {
+		return badSignature("Credential", "%s", err.Error())
+	}
+	return nil
+}
+
+func (issueCredentialHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	issueArgs := tx.(*IOTRegistryTX.IssueCredentialTX)
+	credential, _ := client.ParseCredential(issueArgs.Credential)
+	nonce := hex.EncodeToString(credential.SubjectNonce)
+	thing, err := getThing(stub, credential.SubjectNonce)
+	if err != nil {
+		return nil, err
+	}
+	if thing.RegistrantPubkey != credential.IssuerPubkey {
+		return nil, unauthorized(thingKey(nonce), "Thing (%s) is not registered by the issuer (%s)", nonce, credential.IssuerPubkey)
+	}
+	if thing.SpecName != credential.SpecName {
+		return nil, failedPrecondition(thingKey(nonce), "Thing (%s) has spec (%s), not (%s)", nonce, thing.SpecName, credential.SpecName)
+	}
+	if thing.Status == "retired" {
+		return nil, failedPrecondition(thingKey(nonce), "Thing (%s) is retired", nonce)
+	}
+	key := credentialKey(credential.IssuerPubkey, credential.CredentialID)
+	existing, err := getCredential(stub, credential.IssuerPubkey, credential.CredentialID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, alreadyExists(key, "Credential (%s) is already anchored", credential.CredentialID)
+	}
+
+	timestamp, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(issueArgs.Credential))
+	store := &IOTRegistryStore.Credential{
+		IssuerPubkey:    credential.IssuerPubkey,
+		SubjectNonce:    credential.SubjectNonce,
+		SpecName:        credential.SpecName,
+		CredentialHash:  hash[:],
+		IssuedTimestamp: timestamp,
+	}
+	return nil, putCredential(stub, store, credential.CredentialID)
+}
+
+/*
+	revokeCredential revokes an anchored credential. It is signed by the issuer, and revocation is final.
+	TX struct: 		RevokeCredentialTX
+	Store structs: 	Credential
+*/
+type revokeCredentialHandler struct{ txType }
+
+func (revokeCredentialHandler) validate(tx proto.Message) error {
+	revokeArgs := tx.(*IOTRegistryTX.RevokeCredentialTX)
+	var err error
+	revokeArgs.IssuerPubkey, err = normalizePubkey("IssuerPubkey", revokeArgs.IssuerPubkey)
+	if err != nil {
+		return err
+	}
+	err = client.CheckCredentialID(revokeArgs.CredentialID)
+	if err != nil {
+		return invalidArgument("CredentialID", "%s", err.Error())
+	}
+	if len(revokeArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", revokeArgs.Signature)
+	}
+	return nil
+}
+
+func (revokeCredentialHandler) authorize(stub Stub, tx proto.Message) error {
+	revokeArgs := tx.(*IOTRegistryTX.RevokeCredentialTX)
+	issuerPubKeyBytes, err := getRegistrantPubkey(stub, revokeArgs.IssuerPubkey)
+	if err != nil {
+		return err
+	}
+	message := client.SignedMessage(revokeArgs, client.RevokeCredentialMessage(revokeArgs.IssuerPubkey, revokeArgs.CredentialID, revokeArgs.Reason))
+	return verify(stub, issuerPubKeyBytes, revokeArgs.Signature, message, "Signature")
+}
+
+func (revokeCredentialHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	revokeArgs := tx.(*IOTRegistryTX.RevokeCredentialTX)
+	key := credentialKey(revokeArgs.IssuerPubkey, revokeArgs.CredentialID)
+	credential, err := getCredential(stub, revokeArgs.IssuerPubkey, revokeArgs.CredentialID)
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil {
+		return nil, notFound(key, "Credential (%s) is not anchored", revokeArgs.CredentialID)
+	}
+	if credential.Revoked {
+		return nil, failedPrecondition(key, "Credential (%s) is already revoked", revokeArgs.CredentialID)
+	}
+	timestamp, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	credential.Revoked = true
+	credential.RevocationReason = revokeArgs.Reason
+	credential.RevokedTimestamp = timestamp
+	return nil, putCredential(stub, credential, revokeArgs.CredentialID)
+}
+
+/*
+	verifyCredential checks a presented registration credential:
+	|		args {<credential JWT>}
+	It must be signed by its registered issuer, anchored with the same hash, not revoked, and within its
+	nbf and exp at the transaction timestamp, allowing the MaxClockSkew of the config. It returns JSON
+	with the result and the anchored status, if any:
+	|		{"Valid":false,"Reason":"credential was revoked: ...","IssuerPubkey":...,"CredentialID":...,
+	|		 "SubjectNonce":...,"SpecName":...,"Status":{"IssuerPubkey":...,"Revoked":true,...}}
+	A credential that cannot be parsed is an INVALID_ARGUMENT.
+*/
+func queryVerifyCredential(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, invalidArgument("args", "expected a credential")
+	}
+	credential, err := client.ParseCredential(args[0])
+	if err != nil {
+		return nil, invalidArgument("args", "%s", err.Error())
+	}
+	result := struct {
+		Valid        bool
+		Reason       string `json:",omitempty"`
+		IssuerPubkey string
+		CredentialID string
+		SubjectNonce string
+		SpecName     string
+		Status       *IOTRegistryStore.Credential `json:",omitempty"`
+	}{
+		IssuerPubkey: credential.IssuerPubkey,
+		CredentialID: credential.CredentialID,
+		SubjectNonce: hex.EncodeToString(credential.SubjectNonce),
+		SpecName:     credential.SpecName,
+	}
+	result.Status, err = getCredential(stub, credential.IssuerPubkey, credential.CredentialID)
+	if err != nil {
+		return nil, err
+	}
+	result.Reason, err = checkCredential(stub, credential, args[0], result.Status)
+	if err != nil {
+		return nil, err
+	}
+	result.Valid = len(result.Reason) == 0
+	return json.Marshal(result)
+}
+
+/*
+	returns why a credential is not valid, or "" if it is valid.
+*/
+func checkCredential(stub Stub, credential *client.Credential, jwt string, status *IOTRegistryStore.Credential) (string, error) {
+	key := registrantKey(credential.IssuerPubkey)
+	registrantBytes, err := stub.GetState(key)
+	if err != nil {
+		return "", internalError(key, "Failed to look up RegistrantPubkey (%s)", credential.IssuerPubkey)
+	}
+	if len(registrantBytes) == 0 {
+		return "issuer is not registered", nil
+	}
+	issuerPubKeyBytes, _ := hex.DecodeString(credential.IssuerPubkey)
+	err = credential.Verify(issuerPubKeyBytes)
+	if err != nil {
+		return err.Error(), nil
+	}
+	if status == nil {
+		return "credential is not anchored in the registry", nil
+	}
+	hash := sha256.Sum256([]byte(jwt))
+	if !bytes.Equal(hash[:], status.CredentialHash) {
+		return "credential does not match the anchored credential", nil
+	}
+	if status.Revoked {
+		return "credential was revoked: " + status.RevocationReason, nil
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return "", err
+	}
+	timestamp, err := txTimestamp(stub)
+	if err != nil {
+		return "", err
+	}
+	skew := config.maxClockSkew()
+	if timestamp+skew < credential.Claims.NotBefore {
+		return "credential is not valid yet", nil
+	}
+	if credential.Claims.Expires != 0 && timestamp-skew > credential.Claims.Expires {
+		return "credential has expired", nil
+	}
+	return "", nil
+}
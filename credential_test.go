@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	invokes a transaction built by the client package
+*/
+func invokeTX(stub *testStub, function string, tx proto.Message) error {
+	args, err := client.EncodeArgs(tx)
+	if err != nil {
+		return err
+	}
+	_, err = stub.MockInvoke("2", function, []string{args})
+	return err
+}
+
+/*
+	checks the result of a verifyCredential query. reason is a part of the expected Reason, or "" if the
+	credential should be valid.
+*/
+func checkVerifyCredential(stub *testStub, jwt string, reason string) error {
+	bytes, err := stub.MockQuery("verifyCredential", []string{jwt})
+	if err != nil {
+		return err
+	}
+	result := struct {
+		Valid  bool
+		Reason string
+		Status *IOTRegistryStore.Credential
+	}{}
+	err = json.Unmarshal(bytes, &result)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling json string %s", bytes)
+	}
+	if result.Valid != (len(reason) == 0) || !strings.Contains(result.Reason, reason) {
+		return fmt.Errorf("verifyCredential returned (%s), expected reason (%s)", bytes, reason)
+	}
+	return nil
+}
+
+func TestCredentials(t *testing.T) {
+	stub := newTestStub()
+	defer setTestClock(1500000000)()
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	bobPriv := "166cc93d9eadb573b329b5993b9671f1521679cea90fe52e398e66c1d6373abf"
+	bobPub := "02242a1c19bc831cd95a9e5492015043250cbc17d0eceb82612ce08736b8d753a6"
+	alice, _ := client.NewPrivateKeySigner(alicePriv)
+	bob, _ := client.NewPrivateKeySigner(bobPriv)
+
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := createRegistrant(t, stub, "Bob", "", bobPriv, bobPub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := registerThing(t, stub, []byte{1}, []string{"a1"}, alicePub, "spec A", "", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	issuedAt := time.Unix(1500000000, 0)
+	issue, err := client.IssueCredential(alice, []byte{1}, "spec A", "cred-1", issuedAt, issuedAt.Add(time.Hour))
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	HandleError(t, checkVerifyCredential(stub, issue.Credential, "not anchored"))
+	if err := invokeTX(stub, "issueCredential", issue); err != nil {
+		HandleError(t, err)
+		return
+	}
+	HandleError(t, checkVerifyCredential(stub, issue.Credential, ""))
+	err = invokeTX(stub, "issueCredential", issue)
+	HandleError(t, checkErrorCode(err, client.CodeAlreadyExists, displayKey(credentialKey(alicePub, "cred-1")), ""))
+
+	//the claims must hold on the ledger
+	wrongSpec, _ := client.IssueCredential(alice, []byte{1}, "spec B", "cred-2", issuedAt, time.Time{})
+	err = invokeTX(stub, "issueCredential", wrongSpec)
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(thingKey("01")), ""))
+	notOwner, _ := client.IssueCredential(bob, []byte{1}, "spec A", "cred-2", issuedAt, time.Time{})
+	err = invokeTX(stub, "issueCredential", notOwner)
+	HandleError(t, checkErrorCode(err, client.CodeUnauthorized, displayKey(thingKey("01")), ""))
+	missing, _ := client.IssueCredential(alice, []byte{2}, "spec A", "cred-2", issuedAt, time.Time{})
+	err = invokeTX(stub, "issueCredential", missing)
+	HandleError(t, checkErrorCode(err, client.CodeNotFound, displayKey(thingKey("02")), ""))
+
+	//a credential whose claims were changed after signing does not verify
+	parts := strings.Split(notOwner.Credential, ".")
+	forged := strings.Split(issue.Credential, ".")[0] + "." + strings.Split(issue.Credential, ".")[1] + "." + parts[2]
+	err = invokeTX(stub, "issueCredential", &IOTRegistryTX.IssueCredentialTX{Credential: forged})
+	HandleError(t, checkErrorCode(err, client.CodeBadSignature, "", "Credential"))
+	HandleError(t, checkVerifyCredential(stub, forged, "does not verify"))
+	err = invokeTX(stub, "issueCredential", &IOTRegistryTX.IssueCredentialTX{Credential: "not.a.credential"})
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "Credential"))
+	_, err = stub.MockQuery("verifyCredential", []string{"not a credential"})
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "args"))
+
+	//the validity period is checked at the transaction timestamp
+	setTestClock(1500000000 + 7200)
+	HandleError(t, checkVerifyCredential(stub, issue.Credential, "expired"))
+	setTestClock(1500000000)
+
+	//only the issuer revokes, once
+	revoke, _ := client.RevokeCredential(bob, "cred-1", "compromised")
+	revoke.IssuerPubkey = alicePub
+	err = invokeTX(stub, "revokeCredential", revoke)
+	HandleError(t, checkErrorCode(err, client.CodeBadSignature, "", "Signature"))
+	revoke, _ = client.RevokeCredential(alice, "cred-1", "compromised")
+	if err := invokeTX(stub, "revokeCredential", revoke); err != nil {
+		HandleError(t, err)
+	}
+	HandleError(t, checkVerifyCredential(stub, issue.Credential, "revoked: compromised"))
+	err = invokeTX(stub, "revokeCredential", revoke)
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(credentialKey(alicePub, "cred-1")), ""))
+	revoke, _ = client.RevokeCredential(alice, "cred-9", "")
+	err = invokeTX(stub, "revokeCredential", revoke)
+	HandleError(t, checkErrorCode(err, client.CodeNotFound, displayKey(credentialKey(alicePub, "cred-9")), ""))
+}
+
+func TestCredentialValidity(t *testing.T) {
+	stub := newTestStub()
+	defer setTestClock(1500000000)()
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	alice, _ := client.NewPrivateKeySigner(alicePriv)
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := registerThing(t, stub, []byte{1}, []string{"a1"}, alicePub, "spec A", "", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	//without RequireValidity the claims only matter to verifyCredential
+	issuedAt := time.Unix(1500000000, 0)
+	late, _ := client.IssueCredential(alice, []byte{1}, "spec A", "cred-1", issuedAt.Add(-2*time.Hour), issuedAt.Add(-time.Hour))
+	HandleError(t, invokeTX(stub, "issueCredential", late))
+
+	//with it, the nbf and exp claims are the validity window of issueCredential
+	checkInit(t, stub, []string{`{"RequireValidity":true}`})
+	late, _ = client.IssueCredential(alice, []byte{1}, "spec A", "cred-2", issuedAt.Add(-2*time.Hour), issuedAt.Add(-time.Hour))
+	HandleError(t, checkErrorCode(invokeTX(stub, "issueCredential", late), client.CodeFailedPrecondition, "", "Credential"))
+	early, _ := client.IssueCredential(alice, []byte{1}, "spec A", "cred-2", issuedAt.Add(time.Hour), issuedAt.Add(2*time.Hour))
+	HandleError(t, checkErrorCode(invokeTX(stub, "issueCredential", early), client.CodeFailedPrecondition, "", "Credential"))
+	unbounded, _ := client.IssueCredential(alice, []byte{1}, "spec A", "cred-2", issuedAt, time.Time{})
+	HandleError(t, checkErrorCode(invokeTX(stub, "issueCredential", unbounded), client.CodeInvalidArgument, "", "Credential"))
+	current, _ := client.IssueCredential(alice, []byte{1}, "spec A", "cred-2", issuedAt, issuedAt.Add(time.Hour))
+	HandleError(t, invokeTX(stub, "issueCredential", current))
+}
@@ -0,0 +1,199 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	"github.com/btcsuite/btcd/btcec"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	resolveDID renders the W3C DID Document of a did:iotreg DID (see client/did.go) with its resolution
+	metadata:
+	|		args {<DID>}
+	|		{"didDocument":{...},"didResolutionMetadata":{"contentType":"application/did+ld+json"},
+	|		 "didDocumentMetadata":{"deactivated":false}}
+	A registrant document holds the registrant public key as an EcdsaSecp256k1VerificationKey2019
+	verification method, used for authentication and assertions. A thing document has the registrant as
+	its controller and its legacy and global typed aliases as alsoKnownAs alias DIDs; scoped typed aliases
+	are only unique within the registrant, so they do not identify the thing and are left out.
+	A retired thing is deactivated, and updated is the time of its last status change. An alias DID
+	resolves to the document of its thing, with the thing DID as canonicalId.
+*/
+const (
+	didContext           = "https://www.w3.org/ns/did/v1"
+	secp256k1Context     = "https://w3id.org/security/suites/secp256k1-2019/v1"
+	didResolutionContext = "https://w3id.org/did-resolution/v1"
+	didContentType       = "application/did+ld+json"
+	secp256k1KeyType     = "EcdsaSecp256k1VerificationKey2019"
+)
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type verificationMethod struct {
+	ID           string     `json:"id"`
+	Type         string     `json:"type"`
+	Controller   string     `json:"controller"`
+	PublicKeyJwk jsonWebKey `json:"publicKeyJwk"`
+}
+
+type didDocument struct {
+	Context            []string             `json:"@context"`
+	ID                 string               `json:"id"`
+	Controller         string               `json:"controller,omitempty"`
+	AlsoKnownAs        []string             `json:"alsoKnownAs,omitempty"`
+	VerificationMethod []verificationMethod `json:"verificationMethod,omitempty"`
+	Authentication     []string             `json:"authentication,omitempty"`
+	AssertionMethod    []string             `json:"assertionMethod,omitempty"`
+}
+
+type didDocumentMetadata struct {
+	Deactivated bool   `json:"deactivated"`
+	Updated     string `json:"updated,omitempty"`
+	CanonicalID string `json:"canonicalId,omitempty"`
+}
+
+type didResolutionResult struct {
+	Context               string              `json:"@context"`
+	DIDDocument           *didDocument        `json:"didDocument"`
+	DIDResolutionMetadata map[string]string   `json:"didResolutionMetadata"`
+	DIDDocumentMetadata   didDocumentMetadata `json:"didDocumentMetadata"`
+}
+
+func queryResolveDID(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, invalidArgument("args", "expected a DID")
+	}
+	kind, id, err := client.ParseDID(args[0])
+	if err != nil {
+		return nil, invalidArgument("args", "%s", err.Error())
+	}
+	result := didResolutionResult{
+		Context:               didResolutionContext,
+		DIDResolutionMetadata: map[string]string{"contentType": didContentType},
+	}
+	switch kind {
+	case client.DIDRegistrant:
+		result.DIDDocument, err = registrantDIDDocument(stub, id)
+	case client.DIDThing:
+		nonce, _ := hex.DecodeString(id)
+		result.DIDDocument, result.DIDDocumentMetadata, err = thingDIDDocument(stub, nonce)
+	case client.DIDAlias:
+		err = validateKeyComponent("args", id)
+		if err != nil {
+			return nil, err
+		}
+		aliasBytes, err := getAliasState(stub, id, "")
+		if err != nil {
+			return nil, err
+		}
+		if len(aliasBytes) == 0 {
+			return nil, notFound("", "Thing (%s) does not exist", id)
+		}
+		alias := IOTRegistryStore.Alias{}
+		err = proto.Unmarshal(aliasBytes, &alias)
+		if err != nil {
+			return nil, internalError("", "Error unmarshalling Alias: (%v)", err.Error())
+		}
+		result.DIDDocument, result.DIDDocumentMetadata, err = thingDIDDocument(stub, alias.Nonce)
+		if err != nil {
+			return nil, err
+		}
+		result.DIDDocumentMetadata.CanonicalID = result.DIDDocument.ID
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
+
+/*
+	renders the DID Document of a registrant, which must be registered.
+*/
+func registrantDIDDocument(stub Stub, registrantPubkey string) (*didDocument, error) {
+	registrantPubkey, err := normalizePubkey("args", registrantPubkey)
+	if err != nil {
+		return nil, err
+	}
+	pubKeyBytes, err := getRegistrantPubkey(stub, registrantPubkey)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := btcec.ParsePubKey(pubKeyBytes, btcec.S256())
+	if err != nil {
+		return nil, internalError(registrantKey(registrantPubkey), "Error parsing RegistrantPubkey: %s", err.Error())
+	}
+	coordinate := func(n []byte) string {
+		padded := make([]byte, 32)
+		copy(padded[32-len(n):], n)
+		return base64.RawURLEncoding.EncodeToString(padded)
+	}
+
+	did := client.RegistrantDID(registrantPubkey)
+	keyID := did + "#key-1"
+	return &didDocument{
+		Context: []string{didContext, secp256k1Context},
+		ID:      did,
+		VerificationMethod: []verificationMethod{{
+			ID:         keyID,
+			Type:       secp256k1KeyType,
+			Controller: did,
+			PublicKeyJwk: jsonWebKey{
+				Kty: "EC",
+				Crv: "secp256k1",
+				X:   coordinate(pubKey.X.Bytes()),
+				Y:   coordinate(pubKey.Y.Bytes()),
+			},
+		}},
+		Authentication:  []string{keyID},
+		AssertionMethod: []string{keyID},
+	}, nil
+}
+
+/*
+	renders the DID Document of a thing and its document metadata.
+*/
+func thingDIDDocument(stub Stub, nonce []byte) (*didDocument, didDocumentMetadata, error) {
+	metadata := didDocumentMetadata{}
+	thing, err := getThing(stub, nonce)
+	if err != nil {
+		return nil, metadata, err
+	}
+	document := &didDocument{
+		Context:    []string{didContext},
+		ID:         client.ThingDID(nonce),
+		Controller: client.RegistrantDID(thing.RegistrantPubkey),
+	}
+	for _, alias := range thing.Aliases {
+		document.AlsoKnownAs = append(document.AlsoKnownAs, client.AliasDID(alias))
+	}
+	for _, typedAlias := range thing.TypedAliases {
+		if len(typedAlias.Scope) == 0 {
+			document.AlsoKnownAs = append(document.AlsoKnownAs, client.AliasDID(typedAlias.Type+":"+typedAlias.Value))
+		}
+	}
+	metadata.Deactivated = thing.Status == "retired"
+	if thing.StatusTimestamp != 0 {
+		metadata.Updated = time.Unix(thing.StatusTimestamp, 0).UTC().Format(time.RFC3339)
+	}
+	return document, metadata, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+/*
+	resolves a DID and unmarshalls the resolution result
+*/
+func resolveTestDID(stub *testStub, did string) (*didResolutionResult, error) {
+	bytes, err := stub.MockQuery("resolveDID", []string{did})
+	if err != nil {
+		return nil, err
+	}
+	result := didResolutionResult{}
+	err = json.Unmarshal(bytes, &result)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling json string %s", bytes)
+	}
+	return &result, nil
+}
+
+func TestResolveDID(t *testing.T) {
+	stub := newTestStub()
+	defer setTestClock(1500000000)()
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	typedAliases := []*IOTRegistryTX.TypedAlias{
+		{Type: "uri", Value: "https://example.com/device/1"},
+		{Type: "serial", Value: "SN1", Scoped: true},
+	}
+	err := registerTypedThing(t, stub, []byte{0xab}, []string{"sensor 1"}, typedAliases, alicePub, "spec", "", alicePriv)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	//a registrant document carries its key as a JWK
+	aliceDID := "did:iotreg:registrant:" + alicePub
+	result, err := resolveTestDID(stub, aliceDID)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	document := result.DIDDocument
+	if document.ID != aliceDID || len(document.VerificationMethod) != 1 || result.DIDResolutionMetadata["contentType"] != "application/did+ld+json" {
+		HandleError(t, fmt.Errorf("registrant DID resolved to (%+v)", result))
+		return
+	}
+	method := document.VerificationMethod[0]
+	if method.Type != "EcdsaSecp256k1VerificationKey2019" || method.Controller != aliceDID ||
+		!reflect.DeepEqual(document.Authentication, []string{method.ID}) || !reflect.DeepEqual(document.AssertionMethod, []string{method.ID}) {
+		HandleError(t, fmt.Errorf("registrant verification method (%+v) in (%+v)", method, document))
+	}
+	x, _ := base64.RawURLEncoding.DecodeString(method.PublicKeyJwk.X)
+	y, _ := base64.RawURLEncoding.DecodeString(method.PublicKeyJwk.Y)
+	uncompressed := append(append([]byte{0x04}, x...), y...)
+	pubKey, err := btcec.ParsePubKey(uncompressed, btcec.S256())
+	if err != nil || hex.EncodeToString(pubKey.SerializeCompressed()) != alicePub || method.PublicKeyJwk.Crv != "secp256k1" {
+		HandleError(t, fmt.Errorf("publicKeyJwk (%+v) is not Alice's key: %v", method.PublicKeyJwk, err))
+	}
+
+	//a thing document is controlled by its registrant and known by its global aliases
+	thingDID := "did:iotreg:thing:ab"
+	result, err = resolveTestDID(stub, thingDID)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	document = result.DIDDocument
+	alsoKnownAs := []string{"did:iotreg:alias:sensor%201", "did:iotreg:alias:uri:https:%2F%2Fexample.com%2Fdevice%2F1"}
+	if document.ID != thingDID || document.Controller != aliceDID || !reflect.DeepEqual(document.AlsoKnownAs, alsoKnownAs) ||
+		len(document.VerificationMethod) != 0 || result.DIDDocumentMetadata.Deactivated {
+		HandleError(t, fmt.Errorf("thing DID resolved to (%+v)", result))
+	}
+
+	//alias DIDs resolve to the thing
+	for _, did := range alsoKnownAs {
+		result, err = resolveTestDID(stub, did)
+		if err != nil {
+			HandleError(t, err)
+		} else if result.DIDDocument.ID != thingDID || result.DIDDocumentMetadata.CanonicalID != thingDID {
+			HandleError(t, fmt.Errorf("alias DID (%s) resolved to (%+v)", did, result))
+		}
+	}
+
+	//a retired thing is deactivated
+	if err := setTestThingStatus(stub, []byte{0xab}, "retired", "recalled", "", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+	result, err = resolveTestDID(stub, "did:iotreg:thing:AB")
+	if err != nil {
+		HandleError(t, err)
+	} else if !result.DIDDocumentMetadata.Deactivated || result.DIDDocumentMetadata.Updated != "2017-07-14T02:40:00Z" {
+		HandleError(t, fmt.Errorf("retired thing has metadata (%+v)", result.DIDDocumentMetadata))
+	}
+
+	_, err = stub.MockQuery("resolveDID", []string{"did:iotreg:thing:cd"})
+	HandleError(t, checkErrorCode(err, client.CodeNotFound, displayKey(thingKey("cd")), ""))
+	_, err = stub.MockQuery("resolveDID", []string{"did:iotreg:alias:unknown"})
+	HandleError(t, checkErrorCode(err, client.CodeNotFound, "", ""))
+	for _, did := range []string{"did:example:123", "did:iotreg:thing:zz", "did:iotreg:device:ab", "did:iotreg:thing:ab#key-1", "did:iotreg:registrant:02ab"} {
+		_, err = stub.MockQuery("resolveDID", []string{did})
+		HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "args"))
+	}
+}
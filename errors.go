@@ -0,0 +1,101 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+)
+
+/*
+	Every failure of Invoke and Query is a *client.Error with a stable code (see client/errors.go), so
+	clients can branch on client.ErrorCode(err) instead of matching messages. Errors are logged once,
+	when Invoke or Query returns.
+*/
+func registryError(code string, key string, field string, format string, a ...interface{}) error {
+	return &client.Error{Code: code, Message: strings.TrimSpace(fmt.Sprintf(format, a...)), Key: displayKey(key), Field: field}
+}
+
+/*
+	a transaction field or query argument is missing or malformed
+*/
+func invalidArgument(field string, format string, a ...interface{}) error {
+	return registryError(client.CodeInvalidArgument, "", field, format, a...)
+}
+
+/*
+	the state at key does not exist
+*/
+func notFound(key string, format string, a ...interface{}) error {
+	return registryError(client.CodeNotFound, key, "", format, a...)
+}
+
+/*
+	the state at key is already taken
+*/
+func alreadyExists(key string, format string, a ...interface{}) error {
+	return registryError(client.CodeAlreadyExists, key, "", format, a...)
+}
+
+/*
+	a signature in field does not verify
+*/
+func badSignature(field string, format string, a ...interface{}) error {
+	return registryError(client.CodeBadSignature, "", field, format, a...)
+}
+
+/*
+	the signer is not allowed to change the state at key
+*/
+func unauthorized(key string, format string, a ...interface{}) error {
+	return registryError(client.CodeUnauthorized, key, "", format, a...)
+}
+
+/*
+	the state at key does not allow the transaction, e.g. an illegal status transition
+*/
+func failedPrecondition(key string, format string, a ...interface{}) error {
+	return registryError(client.CodeFailedPrecondition, key, "", format, a...)
+}
+
+/*
+	reading, writing or encoding the state at key failed
+*/
+func internalError(key string, format string, a ...interface{}) error {
+	return registryError(client.CodeInternal, key, "", format, a...)
+}
+
+/*
+	returns err as a *client.Error, wrapping errors that are not one yet as INTERNAL.
+*/
+func asRegistryError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*client.Error); ok {
+		return err
+	}
+	return internalError("", "%s", err.Error())
+}
+
+/*
+	prefixes the message of err, keeping its code, e.g. with the index of a batch entry.
+*/
+func prefixError(err error, format string, a ...interface{}) error {
+	registryErr, ok := asRegistryError(err).(*client.Error)
+	if !ok {
+		return err
+	}
+	prefixed := *registryErr
+	prefixed.Message = fmt.Sprintf(format, a...) + ": " + registryErr.Message
+	return &prefixed
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+)
+
+/*
+	checks the code and key or field of an error returned through Invoke or Query
+*/
+func checkErrorCode(err error, code string, key string, field string) error {
+	registryErr := client.ParseError(err)
+	if registryErr == nil || registryErr.Code != code || registryErr.Key != key || registryErr.Field != field {
+		return fmt.Errorf("expected %s error with key (%s) field (%s), got (%v)", code, key, field, err)
+	}
+	return nil
+}
+
+func TestErrorCodes(t *testing.T) {
+	stub := newTestStub()
+	defer setTestClock(1500000000)()
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	bobPriv := "166cc93d9eadb573b329b5993b9671f1521679cea90fe52e398e66c1d6373abf"
+	bobPub := "02242a1c19bc831cd95a9e5492015043250cbc17d0eceb82612ce08736b8d753a6"
+
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := registerThing(t, stub, []byte{1}, []string{"taken"}, alicePub, "", "", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub)
+	HandleError(t, checkErrorCode(err, client.CodeAlreadyExists, "RegistrantPubkey:"+alicePub, ""))
+
+	err = registerThing(t, stub, []byte{1}, []string{"other"}, alicePub, "", "", alicePriv)
+	HandleError(t, checkErrorCode(err, client.CodeAlreadyExists, "Thing:01", ""))
+
+	err = registerThing(t, stub, []byte{2}, []string{"taken"}, alicePub, "", "", alicePriv)
+	HandleError(t, checkErrorCode(err, client.CodeAlreadyExists, "Alias:taken", ""))
+
+	err = registerThing(t, stub, []byte{2}, []string{"new"}, bobPub, "", "", bobPriv)
+	HandleError(t, checkErrorCode(err, client.CodeNotFound, "RegistrantPubkey:"+bobPub, ""))
+
+	err = registerThing(t, stub, []byte{2}, []string{"new"}, alicePub, "", "", bobPriv)
+	HandleError(t, checkErrorCode(err, client.CodeBadSignature, "", "Signature"))
+
+	err = registerThing(t, stub, nil, []string{"new"}, alicePub, "", "", alicePriv)
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "Nonce"))
+
+	err = setTestThingStatus(stub, []byte{1}, "active", "", "", alicePriv)
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, "Thing:01", ""))
+
+	err = setTestThingStatus(stub, []byte{1}, "provisioned", "", bobPub, bobPriv)
+	HandleError(t, checkErrorCode(err, client.CodeUnauthorized, displayKey(statusDelegateKey(alicePub, bobPub)), ""))
+
+	_, err = stub.MockQuery("owner", []string{bobPub})
+	HandleError(t, checkErrorCode(err, client.CodeNotFound, "RegistrantPubkey:"+bobPub, ""))
+
+	_, err = stub.MockQuery("spec", nil)
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "args"))
+
+	_, err = stub.MockInvoke("1", "registerThing", []string{"not hex"})
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "args"))
+}
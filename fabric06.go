@@ -0,0 +1,84 @@
+//go:build !fabric1
+// +build !fabric1
+
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+/*
+	Adapter for the Fabric 0.6 shim, which is the default build. Invoke and Query take the function
+	and its args as parameters, and return the result and an error.
+*/
+
+/*
+	fabric06Stub implements Stub over a Fabric 0.6 stub.
+*/
+type fabric06Stub struct {
+	shim.ChaincodeStubInterface
+}
+
+func (s fabric06Stub) RangeQueryState(startKey, endKey string) (StateIterator, error) {
+	return s.ChaincodeStubInterface.RangeQueryState(startKey, endKey)
+}
+
+func (s fabric06Stub) TxTimestamp() (int64, error) {
+	ts, err := s.GetTxTimestamp()
+	if err != nil {
+		return 0, internalError("", "Could not get transaction timestamp: (%v)", err.Error())
+	}
+	if ts == nil {
+		return 0, internalError("", "transaction timestamp is unavailable")
+	}
+	return ts.Seconds, nil
+}
+
+/*
+	Init is a required function in which necessary setup operations are performed.
+	It stores the registry config passed as a JSON object in args[0] (see config.go).
+*/
+func (t *IOTRegistry) Init(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	return runInit(fabric06Stub{stub}, args)
+}
+
+/*
+	Invoke is the central mechanism in hyperledger for creating transactions and putting them to the ledger.
+	This function takes as arguments
+	|		a chaincode interface, called "stub"
+	|		a string which dictates which function to perform,
+	|		a slice of strings "args" that accord with some protobuf specification
+	The function is run by its handler in invokeHandlers (see handlers.go).
+	Failures are returned as *client.Error (see errors.go).
+*/
+func (t *IOTRegistry) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	return runInvoke(fabric06Stub{stub}, function, args)
+}
+
+/*
+	Query is a mechanism for requesting information from the ledger. The query functions are registered in
+	queryHandlers (see handlers.go); the "functions" query lists them.
+	Each query will return data as a json formatted slice of bytes. Failures are returned as *client.Error (see errors.go).
+*/
+func (t *IOTRegistry) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	return runQuery(fabric06Stub{stub}, function, args)
+}
+
+func main() {
+	err := shim.Start(new(IOTRegistry))
+	if err != nil {
+		fmt.Printf("Error starting chaincode: %s\n", err)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !fabric1
+// +build !fabric1
+
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+/*
+	testStub runs the chaincode in the mock stub of the shim generation being built, so that the same
+	tests cover every adapter. The Fabric 0.6 mock already has the MockInit, MockInvoke and MockQuery
+	signatures the tests use, but its range iterator starts after the first key of the ledger, so the
+	ledger is seeded with an empty key that sorts before every state.
+*/
+type testStub struct {
+	*shim.MockStub
+}
+
+func newTestStub() *testStub {
+	stub := shim.NewMockStub("IOTRegistry", new(IOTRegistry))
+	stub.Keys.PushFront("")
+	return markKeysMigrated(&testStub{stub})
+}
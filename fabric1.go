@@ -0,0 +1,123 @@
+//go:build fabric1
+// +build fabric1
+
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+	Adapter for the Fabric 1.x shim, built with "-tags fabric1" against a Fabric 1.x vendor tree.
+	Init and Invoke read the function and its args with GetFunctionAndParameters and return a pb.Response.
+	There is no separate Query: query functions are routed through Invoke, so that
+	|		peer chaincode query -c '{"Args":["thing","myAlias"]}'
+	runs the thing query. Errors are returned as the message of an error response.
+*/
+
+/*
+	fabric1Stub implements Stub over a Fabric 1.x stub.
+*/
+type fabric1Stub struct {
+	shim.ChaincodeStubInterface
+}
+
+/*
+	Composite keys (see keys.go) have the layout of Fabric 1.x composite keys, which GetStateByRange
+	rejects, so scans of composite keys use GetStateByPartialCompositeKey over their prefix instead. A scan
+	that starts within the prefix, e.g. the next page of a snapshot, returns the keys before startKey as
+	well; rangeScanFrom skips them. The paginated queries of Fabric 1.4 are not used, since they are
+	only allowed in read-only transactions.
+*/
+func (s fabric1Stub) RangeQueryState(startKey, endKey string) (StateIterator, error) {
+	namespace, components, ok := partialCompositeRange(startKey, endKey)
+	if ok {
+		iter, err := s.GetStateByPartialCompositeKey(namespace, components)
+		if err != nil {
+			return nil, err
+		}
+		return fabric1Iterator{iter}, nil
+	}
+	iter, err := s.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	return fabric1Iterator{iter}, nil
+}
+
+func (s fabric1Stub) TxTimestamp() (int64, error) {
+	ts, err := s.GetTxTimestamp()
+	if err != nil {
+		return 0, internalError("", "Could not get transaction timestamp: (%v)", err.Error())
+	}
+	if ts == nil {
+		return 0, internalError("", "transaction timestamp is unavailable")
+	}
+	return ts.Seconds, nil
+}
+
+/*
+	fabric1Iterator adapts the key/value results of a Fabric 1.x range query to StateIterator.
+*/
+type fabric1Iterator struct {
+	shim.StateQueryIteratorInterface
+}
+
+func (i fabric1Iterator) Next() (string, []byte, error) {
+	kv, err := i.StateQueryIteratorInterface.Next()
+	if err != nil {
+		return "", nil, err
+	}
+	return kv.Key, kv.Value, nil
+}
+
+/*
+	Init is a required function in which necessary setup operations are performed.
+	It stores the registry config passed as a JSON object in args[0] (see config.go).
+*/
+func (t *IOTRegistry) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	_, args := stub.GetFunctionAndParameters()
+	_, err := runInit(fabric1Stub{stub}, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/*
+	Invoke runs the Invoke or Query function named by the first argument (see handlers.go).
+*/
+func (t *IOTRegistry) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	var result []byte
+	var err error
+	if _, ok := queryHandlers[function]; ok {
+		result, err = runQuery(fabric1Stub{stub}, function, args)
+	} else {
+		result, err = runInvoke(fabric1Stub{stub}, function, args)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(result)
+}
+
+func main() {
+	err := shim.Start(new(IOTRegistry))
+	if err != nil {
+		fmt.Printf("Error starting chaincode: %s\n", err)
+	}
+}
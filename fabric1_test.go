@@ -0,0 +1,78 @@
+//go:build fabric1
+// +build fabric1
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+	testStub runs the chaincode in the Fabric 1.x mock stub, translating the Fabric 0.6 style calls of
+	the tests into args for GetFunctionAndParameters and pb.Responses back into results and errors.
+*/
+type testStub struct {
+	*shim.MockStub
+}
+
+func newTestStub() *testStub {
+	return markKeysMigrated(&testStub{shim.NewMockStub("IOTRegistry", new(IOTRegistry))})
+}
+
+func mockArgs(function string, args []string) [][]byte {
+	mockArgs := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		mockArgs = append(mockArgs, []byte(arg))
+	}
+	return mockArgs
+}
+
+func mockResult(response pb.Response) ([]byte, error) {
+	if response.Status != shim.OK {
+		return nil, errors.New(response.Message)
+	}
+	return response.Payload, nil
+}
+
+func (s *testStub) MockInit(uuid string, function string, args []string) ([]byte, error) {
+	return mockResult(s.MockStub.MockInit(uuid, mockArgs(function, args)))
+}
+
+func (s *testStub) MockInvoke(uuid string, function string, args []string) ([]byte, error) {
+	return mockResult(s.MockStub.MockInvoke(uuid, mockArgs(function, args)))
+}
+
+/*
+	queries are routed through Invoke by the Fabric 1.x adapter
+*/
+func (s *testStub) MockQuery(function string, args []string) ([]byte, error) {
+	return mockResult(s.MockStub.MockInvoke("query", mockArgs(function, args)))
+}
+
+/*
+	scans starting within a composite key prefix go through GetStateByPartialCompositeKey, since Fabric 1.x
+	rejects composite keys in GetStateByRange
+*/
+func TestFabric1RangeScanFrom(t *testing.T) {
+	stub := newTestStub()
+	stub.MockTransactionStart("range")
+	for _, version := range []string{"1.0", "1.1", "2.0"} {
+		stub.PutState(compositeKey(manifestNamespace, "radio", version), []byte(version))
+	}
+	stub.PutState(compositeKey(manifestNamespace, "radio2", "1.0"), []byte("other"))
+	var versions []string
+	err := rangeScanFrom(fabric1Stub{stub.MockStub}, keyPrefix(manifestNamespace, "radio"), compositeKey(manifestNamespace, "radio", "1.1"),
+		func(key string, value []byte) error {
+			versions = append(versions, string(value))
+			return nil
+		})
+	stub.MockTransactionEnd("range")
+	if err != nil || len(versions) != 2 || versions[0] != "1.1" || versions[1] != "2.0" {
+		HandleError(t, fmt.Errorf("scan from version (1.1) returned %v: %v", versions, err))
+	}
+}
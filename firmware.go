@@ -0,0 +1,444 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	The owner of a spec publishes firmware releases for it (see client/firmware.go), and things report the
+	release they run. The records are
+	|		"FirmwareRelease:<SpecName>:<Version>"				FirmwareRelease
+	|		"ThingFirmware:<SpecName>:<Version>:<Nonce>"		index of the things running a release
+	|		"FirmwareHistory:<Nonce>:<Report number>"			FirmwareReport, numbered from 0 in 16 digits
+	and the Thing holds its current FirmwareVersion and the number of its FirmwareReports.
+*/
+func firmwareReleaseKey(specName string, version string) string {
+	return compositeKey(firmwareReleaseNamespace, specName, version)
+}
+
+func thingFirmwareKey(specName string, version string, nonce string) string {
+	return compositeKey(thingFirmwareNamespace, specName, version, nonce)
+}
+
+func firmwareHistoryKey(nonce string, report int64) string {
+	return compositeKey(firmwareHistoryNamespace, nonce, fmt.Sprintf("%016d", report))
+}
+
+/*
+	gets a firmware release. Returns nil if the release has not been published.
+*/
+func getFirmwareRelease(stub Stub, specName string, version string) (*IOTRegistryStore.FirmwareRelease, error) {
+	key := firmwareReleaseKey(specName, version)
+	releaseBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "Could not get FirmwareRelease (%s:%s) State", specName, version)
+	}
+	if len(releaseBytes) == 0 {
+		return nil, nil
+	}
+	release := IOTRegistryStore.FirmwareRelease{}
+	err = proto.Unmarshal(releaseBytes, &release)
+	if err != nil {
+		return nil, internalError(key, "Error unmarshalling FirmwareRelease (%s:%s): (%v)", specName, version, err.Error())
+	}
+	return &release, nil
+}
+
+func putFirmwareRelease(stub Stub, release *IOTRegistryStore.FirmwareRelease) error {
+	key := firmwareReleaseKey(release.SpecName, release.Version)
+	releaseBytes, err := proto.Marshal(release)
+	if err != nil {
+		return internalError(key, "error marshalling type IOTRegistry store :(%v)", err.Error())
+	}
+	err = stub.PutState(key, releaseBytes)
+	if err != nil {
+		return internalError(key, "Error putting FirmwareRelease state :(%v)", err.Error())
+	}
+	return nil
+}
+
+/*
+	normalizes the optional DevicePubkey of a thing being registered.
+*/
+func validateDevicePubkey(registerThingArgs *IOTRegistryTX.RegisterThingTX) error {
+	if len(registerThingArgs.DevicePubkey) == 0 {
+		return nil
+	}
+	var err error
+	registerThingArgs.DevicePubkey, err = normalizePubkey("DevicePubkey", registerThingArgs.DevicePubkey)
+	return err
+}
+
+/*
+	verifies a signature made by the registrant owning a spec.
+*/
+func verifySpecOwner(stub Stub, specName string, sig []byte, message string) error {
+	spec, err := getSpec(stub, specName)
+	if err != nil {
+		return err
+	}
+	ownerPubKeyBytes, err := getRegistrantPubkey(stub, spec.RegistrantPubkey)
+	if err != nil {
+		return err
+	}
+	return verify(stub, ownerPubKeyBytes, sig, message, "Signature")
+}
+
+/*
+	publishFirmware publishes a firmware release of a spec. It is signed by the owner of the spec, and a
+	published release cannot be changed.
+	TX struct: 		PublishFirmwareTX
+	Store structs: 	FirmwareRelease
+*/
+type publishFirmwareHandler struct{ txType }
+
+func (publishFirmwareHandler) validate(tx proto.Message) error {
+	publishArgs := tx.(*IOTRegistryTX.PublishFirmwareTX)
+	err := validateKeyComponent("SpecName", publishArgs.SpecName)
+	if err != nil {
+		return err
+	}
+	err = validateKeyComponent("Version", publishArgs.Version)
+	if err != nil {
+		return err
+	}
+	err = client.CheckContentHash(publishArgs.ImageHash)
+	if err != nil {
+		return invalidArgument("ImageHash", "%s", err.Error())
+	}
+	publishArgs.SigningKey, err = normalizePubkey("SigningKey", publishArgs.SigningKey)
+	if err != nil {
+		return err
+	}
+	if publishArgs.ReleaseNotes != nil {
+		err = client.CheckContentRef(publishArgs.ReleaseNotes)
+		if err != nil {
+			return invalidArgument("ReleaseNotes", "%s", err.Error())
+		}
+	}
+	if len(publishArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", publishArgs.Signature)
+	}
+	return nil
+}
+
+func (publishFirmwareHandler) authorize(stub Stub, tx proto.Message) error {
+	publishArgs := tx.(*IOTRegistryTX.PublishFirmwareTX)
+	message := client.PublishFirmwareMessage(publishArgs.SpecName, publishArgs.Version, publishArgs.ImageHash, publishArgs.SigningKey, publishArgs.ReleaseNotes)
+	return verifySpecOwner(stub, publishArgs.SpecName, publishArgs.Signature, client.SignedMessage(publishArgs, message))
+}
+
+func (publishFirmwareHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	publishArgs := tx.(*IOTRegistryTX.PublishFirmwareTX)
+	existing, err := getFirmwareRelease(stub, publishArgs.SpecName, publishArgs.Version)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, alreadyExists(firmwareReleaseKey(publishArgs.SpecName, publishArgs.Version), "FirmwareRelease (%s:%s) is already published", publishArgs.SpecName, publishArgs.Version)
+	}
+	timestamp, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	release := &IOTRegistryStore.FirmwareRelease{
+		SpecName:           publishArgs.SpecName,
+		Version:            publishArgs.Version,
+		ImageHash:          publishArgs.ImageHash,
+		SigningKey:         publishArgs.SigningKey,
+		ReleaseNotes:       storedContent(publishArgs.ReleaseNotes),
+		PublishedTimestamp: timestamp,
+	}
+	return nil, putFirmwareRelease(stub, release)
+}
+
+/*
+	flagFirmware marks a firmware release as vulnerable, with a reference to its advisory. It is signed by
+	the owner of the spec, and a flag cannot be removed.
+	TX struct: 		FlagFirmwareTX
+	Store structs: 	FirmwareRelease
+*/
+type flagFirmwareHandler struct{ txType }
+
+func (flagFirmwareHandler) validate(tx proto.Message) error {
+	flagArgs := tx.(*IOTRegistryTX.FlagFirmwareTX)
+	err := validateKeyComponent("SpecName", flagArgs.SpecName)
+	if err != nil {
+		return err
+	}
+	err = validateKeyComponent("Version", flagArgs.Version)
+	if err != nil {
+		return err
+	}
+	if len(flagArgs.Advisory) == 0 {
+		return invalidArgument("Advisory", "length of Advisory is zero")
+	}
+	if len(flagArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", flagArgs.Signature)
+	}
+	return nil
+}
+
+func (flagFirmwareHandler) authorize(stub Stub, tx proto.Message) error {
+	flagArgs := tx.(*IOTRegistryTX.FlagFirmwareTX)
+	message := client.FlagFirmwareMessage(flagArgs.SpecName, flagArgs.Version, flagArgs.Advisory)
+	return verifySpecOwner(stub, flagArgs.SpecName, flagArgs.Signature, client.SignedMessage(flagArgs, message))
+}
+
+func (flagFirmwareHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	flagArgs := tx.(*IOTRegistryTX.FlagFirmwareTX)
+	key := firmwareReleaseKey(flagArgs.SpecName, flagArgs.Version)
+	release, err := getFirmwareRelease(stub, flagArgs.SpecName, flagArgs.Version)
+	if err != nil {
+		return nil, err
+	}
+	if release == nil {
+		return nil, notFound(key, "FirmwareRelease (%s:%s) is not published", flagArgs.SpecName, flagArgs.Version)
+	}
+	if release.Vulnerable {
+		return nil, failedPrecondition(key, "FirmwareRelease (%s:%s) is already flagged", flagArgs.SpecName, flagArgs.Version)
+	}
+	timestamp, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	release.Vulnerable = true
+	release.Advisory = flagArgs.Advisory
+	release.FlaggedTimestamp = timestamp
+	return nil, putFirmwareRelease(stub, release)
+}
+
+/*
+	reportFirmware records the firmware version a thing runs, which must be a published release of the
+	spec of the thing. It is signed by the owner of the thing, or by the DevicePubkey of the thing named
+	in SignerPubkey. The signed Counter must be greater than the Counter of the last report of the thing, so
+	a report cannot be replayed. Every report is kept in the firmware history of the thing.
+	TX struct: 		ReportFirmwareTX
+	Store structs: 	Thing, FirmwareReport, "ThingFirmware:<SpecName>:<Version>:<Nonce>" index
+*/
+type reportFirmwareHandler struct{ txType }
+
+func (reportFirmwareHandler) validate(tx proto.Message) error {
+	reportArgs := tx.(*IOTRegistryTX.ReportFirmwareTX)
+	if len(reportArgs.Nonce) == 0 {
+		return invalidArgument("Nonce", "length of Nonce is zero")
+	}
+	err := validateKeyComponent("Version", reportArgs.Version)
+	if err != nil {
+		return err
+	}
+	if len(reportArgs.SignerPubkey) != 0 {
+		reportArgs.SignerPubkey, err = normalizePubkey("SignerPubkey", reportArgs.SignerPubkey)
+		if err != nil {
+			return err
+		}
+	}
+	if len(reportArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", reportArgs.Signature)
+	}
+	return nil
+}
+
+func (reportFirmwareHandler) authorize(stub Stub, tx proto.Message) error {
+	reportArgs := tx.(*IOTRegistryTX.ReportFirmwareTX)
+	thing, err := getThing(stub, reportArgs.Nonce)
+	if err != nil {
+		return err
+	}
+	message := client.SignedMessage(reportArgs, client.ReportFirmwareMessage(reportArgs.Nonce, reportArgs.Version, reportArgs.Counter))
+	if len(reportArgs.SignerPubkey) == 0 || reportArgs.SignerPubkey == thing.RegistrantPubkey {
+		return verifyThingOwner(stub, thing, reportArgs.Signature, message, "Signature")
+	}
+	if reportArgs.SignerPubkey != thing.DevicePubkey {
+		return unauthorized(thingKey(hex.EncodeToString(reportArgs.Nonce)), "SignerPubkey (%s) is not the owner or the device key of the thing", reportArgs.SignerPubkey)
+	}
+	devicePubKeyBytes, err := hex.DecodeString(thing.DevicePubkey)
+	if err != nil {
+		return internalError("", "Error decoding DevicePubkey: %s", err.Error())
+	}
+	return verify(stub, devicePubKeyBytes, reportArgs.Signature, message, "Signature")
+}
+
+func (reportFirmwareHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	reportArgs := tx.(*IOTRegistryTX.ReportFirmwareTX)
+	nonce := hex.EncodeToString(reportArgs.Nonce)
+	thing, err := getThing(stub, reportArgs.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if thing.Status == "retired" {
+		return nil, failedPrecondition(thingKey(nonce), "Thing (%s) is retired", nonce)
+	}
+	if reportArgs.Counter <= thing.FirmwareCounter {
+		return nil, failedPrecondition(thingKey(nonce), "Counter (%d) is not greater than the FirmwareCounter (%d) of Thing (%s)", reportArgs.Counter, thing.FirmwareCounter, nonce)
+	}
+	release, err := getFirmwareRelease(stub, thing.SpecName, reportArgs.Version)
+	if err != nil {
+		return nil, err
+	}
+	if release == nil {
+		return nil, notFound(firmwareReleaseKey(thing.SpecName, reportArgs.Version), "FirmwareRelease (%s:%s) is not published", thing.SpecName, reportArgs.Version)
+	}
+	timestamp, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	signerPubkey := reportArgs.SignerPubkey
+	if len(signerPubkey) == 0 {
+		signerPubkey = thing.RegistrantPubkey
+	}
+
+	report := &IOTRegistryStore.FirmwareReport{Version: reportArgs.Version, ReporterPubkey: signerPubkey, Timestamp: timestamp, Counter: reportArgs.Counter}
+	historyKey := firmwareHistoryKey(nonce, thing.FirmwareReports)
+	reportBytes, err := proto.Marshal(report)
+	if err != nil {
+		return nil, internalError(historyKey, "error marshalling type IOTRegistry store :(%v)", err.Error())
+	}
+	err = stub.PutState(historyKey, reportBytes)
+	if err != nil {
+		return nil, internalError(historyKey, "Error putting FirmwareHistory state :(%v)", err.Error())
+	}
+	if len(thing.FirmwareVersion) != 0 && thing.FirmwareVersion != reportArgs.Version {
+		oldKey := thingFirmwareKey(thing.SpecName, thing.FirmwareVersion, nonce)
+		err = stub.DelState(oldKey)
+		if err != nil {
+			return nil, internalError(oldKey, "Error deleting ThingFirmware state :(%v)", err.Error())
+		}
+	}
+	indexKey := thingFirmwareKey(thing.SpecName, reportArgs.Version, nonce)
+	err = stub.PutState(indexKey, reportArgs.Nonce)
+	if err != nil {
+		return nil, internalError(indexKey, "Error putting ThingFirmware state :(%v)", err.Error())
+	}
+	thing.FirmwareVersion = reportArgs.Version
+	thing.FirmwareTimestamp = timestamp
+	thing.FirmwareCounter = reportArgs.Counter
+	thing.FirmwareReports++
+	return nil, putThing(stub, reportArgs.Nonce, thing)
+}
+
+/*
+	firmwareRelease returns a firmware release:
+	|		args {<SpecName>, <Version>}
+*/
+func queryFirmwareRelease(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, invalidArgument("args", "expected a SpecName and a Version")
+	}
+	for _, arg := range args {
+		err := validateKeyComponent("args", arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	release, err := getFirmwareRelease(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if release == nil {
+		return nil, notFound(firmwareReleaseKey(args[0], args[1]), "FirmwareRelease (%s:%s) is not published", args[0], args[1])
+	}
+	return json.Marshal(release)
+}
+
+/*
+	vulnerableThings lists the things that last reported a release flagged as vulnerable, of one spec or of
+	every spec:
+	|		args {[<SpecName>]}
+	|		result [{"Nonce":<hex>,"SpecName":..,"Version":..,"Advisory":..}]
+*/
+func queryVulnerableThings(stub Stub, args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return nil, invalidArgument("args", "expected at most a SpecName")
+	}
+	prefix := keyPrefix(firmwareReleaseNamespace)
+	if len(args) == 1 {
+		err := validateKeyComponent("args", args[0])
+		if err != nil {
+			return nil, err
+		}
+		prefix = keyPrefix(firmwareReleaseNamespace, args[0])
+	}
+	var vulnerable []*IOTRegistryStore.FirmwareRelease
+	err := rangeScan(stub, prefix, func(key string, value []byte) error {
+		release := IOTRegistryStore.FirmwareRelease{}
+		err := proto.Unmarshal(value, &release)
+		if err != nil {
+			return internalError(key, "Error unmarshalling FirmwareRelease: (%v)", err.Error())
+		}
+		if release.Vulnerable {
+			vulnerable = append(vulnerable, &release)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type vulnerableThing struct {
+		Nonce    string
+		SpecName string
+		Version  string
+		Advisory string
+	}
+	things := []vulnerableThing{}
+	for _, release := range vulnerable {
+		err = rangeScan(stub, keyPrefix(thingFirmwareNamespace, release.SpecName, release.Version), func(key string, value []byte) error {
+			things = append(things, vulnerableThing{lastKeyComponent(key), release.SpecName, release.Version, release.Advisory})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(things)
+}
+
+/*
+	firmwareHistory returns the firmware reports of a thing, oldest first:
+	|		args {<Nonce hex>}
+	|		result [{"Version":..,"ReporterPubkey":..,"Timestamp":..}]
+*/
+func queryFirmwareHistory(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, invalidArgument("args", "No argument specified")
+	}
+	nonceBytes, err := hex.DecodeString(args[0])
+	if err != nil {
+		return nil, invalidArgument("args", "Invalid nonce (%s) expected hex", args[0])
+	}
+	_, err = getThing(stub, nonceBytes)
+	if err != nil {
+		return nil, err
+	}
+	history := []*IOTRegistryStore.FirmwareReport{}
+	err = rangeScan(stub, keyPrefix(firmwareHistoryNamespace, hex.EncodeToString(nonceBytes)), func(key string, value []byte) error {
+		report := IOTRegistryStore.FirmwareReport{}
+		err := proto.Unmarshal(value, &report)
+		if err != nil {
+			return internalError(key, "Error unmarshalling FirmwareReport: (%v)", err.Error())
+		}
+		history = append(history, &report)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(history)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+)
+
+/*
+	returns the nonces listed by a vulnerableThings query.
+*/
+func queryVulnerableNonces(stub *testStub, args ...string) ([]string, error) {
+	bytes, err := stub.MockQuery("vulnerableThings", args)
+	if err != nil {
+		return nil, err
+	}
+	things := []struct{ Nonce, SpecName, Version, Advisory string }{}
+	err = json.Unmarshal(bytes, &things)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling json string %s", bytes)
+	}
+	nonces := []string{}
+	for _, thing := range things {
+		nonces = append(nonces, thing.Nonce)
+	}
+	return nonces, nil
+}
+
+func TestFirmware(t *testing.T) {
+	stub := newTestStub()
+	checkInit(t, stub, nil)
+	defer setTestClock(1500000000)()
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	bobPriv := "166cc93d9eadb573b329b5993b9671f1521679cea90fe52e398e66c1d6373abf"
+	bobPub := "02242a1c19bc831cd95a9e5492015043250cbc17d0eceb82612ce08736b8d753a6"
+	alice, _ := client.NewPrivateKeySigner(alicePriv)
+	bob, _ := client.NewPrivateKeySigner(bobPriv)
+	device, _ := client.GeneratePrivateKeySigner()
+	firmwareKey, _ := client.GeneratePrivateKeySigner()
+
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := createRegistrant(t, stub, "Bob", "", bobPriv, bobPub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := registerSpec(t, stub, "sensor", alicePub, "", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+	//Alice makes the sensors, Bob owns one of them
+	for _, registration := range []struct {
+		signer  client.Signer
+		nonce   byte
+		options []client.Option
+	}{
+		{alice, 1, []client.Option{client.WithDevicePubkey(client.PubkeyHex(device))}},
+		{alice, 2, nil},
+		{bob, 3, nil},
+	} {
+		tx, err := client.RegisterThing(registration.signer, []byte{registration.nonce}, nil, nil, "sensor", "", registration.options...)
+		if err == nil {
+			err = invokeTX(stub, "registerThing", tx)
+		}
+		if err != nil {
+			HandleError(t, err)
+			return
+		}
+	}
+
+	image := []byte("firmware image 1.0")
+	notes := client.NewContentRef("https://example.com/1.0.txt", "text/plain", []byte("notes"))
+	for _, version := range []string{"1.0", "1.1"} {
+		tx, _ := client.PublishFirmware(alice, "sensor", version, client.ContentHash(image), client.PubkeyHex(firmwareKey), notes)
+		if err := invokeTX(stub, "publishFirmware", tx); err != nil {
+			HandleError(t, err)
+			return
+		}
+	}
+	tx, _ := client.PublishFirmware(alice, "sensor", "1.0", client.ContentHash(image), client.PubkeyHex(firmwareKey), nil)
+	HandleError(t, checkErrorCode(invokeTX(stub, "publishFirmware", tx), client.CodeAlreadyExists, displayKey(firmwareReleaseKey("sensor", "1.0")), ""))
+	tx, _ = client.PublishFirmware(bob, "sensor", "2.0", client.ContentHash(image), client.PubkeyHex(firmwareKey), nil)
+	HandleError(t, checkErrorCode(invokeTX(stub, "publishFirmware", tx), client.CodeBadSignature, "", "Signature"))
+	tx, _ = client.PublishFirmware(alice, "sensor", "2.0", "md5:00", client.PubkeyHex(firmwareKey), nil)
+	HandleError(t, checkErrorCode(invokeTX(stub, "publishFirmware", tx), client.CodeInvalidArgument, "", "ImageHash"))
+
+	releaseBytes, err := stub.MockQuery("firmwareRelease", []string{"sensor", "1.0"})
+	release := IOTRegistryStore.FirmwareRelease{}
+	if err == nil {
+		err = json.Unmarshal(releaseBytes, &release)
+	}
+	if err != nil || release.ImageHash != client.ContentHash(image) || release.SigningKey != client.PubkeyHex(firmwareKey) || release.ReleaseNotes.URI != notes.URI {
+		HandleError(t, fmt.Errorf("firmwareRelease returned (%s): %v", releaseBytes, err))
+	}
+
+	//things report firmware signed by their owner or their device key
+	for _, report := range []struct {
+		signer   client.Signer
+		nonce    byte
+		version  string
+		counter  int64
+		asDevice bool
+	}{
+		{alice, 1, "1.0", 1, false},
+		{device, 1, "1.1", 2, true},
+		{device, 1, "1.0", 5, true},
+		{alice, 2, "1.1", 1, false},
+		{bob, 3, "1.0", 1, false},
+	} {
+		tx, _ := client.ReportFirmware(report.signer, []byte{report.nonce}, report.version, report.counter, report.asDevice)
+		if err := invokeTX(stub, "reportFirmware", tx); err != nil {
+			HandleError(t, fmt.Errorf("report %v failed: %v", report, err))
+		}
+	}
+	reportTX, _ := client.ReportFirmware(device, []byte{2}, "1.0", 2, true)
+	HandleError(t, checkErrorCode(invokeTX(stub, "reportFirmware", reportTX), client.CodeUnauthorized, displayKey(thingKey("02")), ""))
+	reportTX, _ = client.ReportFirmware(alice, []byte{3}, "1.0", 2, false)
+	HandleError(t, checkErrorCode(invokeTX(stub, "reportFirmware", reportTX), client.CodeBadSignature, "", "Signature"))
+	reportTX, _ = client.ReportFirmware(alice, []byte{1}, "9.9", 6, false)
+	HandleError(t, checkErrorCode(invokeTX(stub, "reportFirmware", reportTX), client.CodeNotFound, displayKey(firmwareReleaseKey("sensor", "9.9")), ""))
+
+	//a report whose counter does not increase is a replay
+	for _, counter := range []int64{5, 4} {
+		reportTX, _ = client.ReportFirmware(alice, []byte{1}, "1.1", counter, false)
+		HandleError(t, checkErrorCode(invokeTX(stub, "reportFirmware", reportTX), client.CodeFailedPrecondition, displayKey(thingKey("01")), ""))
+	}
+
+	historyBytes, err := stub.MockQuery("firmwareHistory", []string{"01"})
+	history := []IOTRegistryStore.FirmwareReport{}
+	if err == nil {
+		err = json.Unmarshal(historyBytes, &history)
+	}
+	if err != nil || len(history) != 3 || history[0].Version != "1.0" || history[1].Version != "1.1" || history[2].Version != "1.0" ||
+		history[0].ReporterPubkey != alicePub || history[1].ReporterPubkey != client.PubkeyHex(device) || history[2].Timestamp != 1500000000 || history[2].Counter != 5 {
+		HandleError(t, fmt.Errorf("firmwareHistory returned (%s): %v", historyBytes, err))
+	}
+
+	//flagging a release lists the things that still run it
+	nonces, err := queryVulnerableNonces(stub)
+	if err != nil || len(nonces) != 0 {
+		HandleError(t, fmt.Errorf("vulnerableThings before flagging returned %v: %v", nonces, err))
+	}
+	flagTX, _ := client.FlagFirmware(bob, "sensor", "1.0", "https://example.com/advisory")
+	HandleError(t, checkErrorCode(invokeTX(stub, "flagFirmware", flagTX), client.CodeBadSignature, "", "Signature"))
+	flagTX, _ = client.FlagFirmware(alice, "sensor", "1.0", "https://example.com/advisory")
+	if err := invokeTX(stub, "flagFirmware", flagTX); err != nil {
+		HandleError(t, err)
+		return
+	}
+	HandleError(t, checkErrorCode(invokeTX(stub, "flagFirmware", flagTX), client.CodeFailedPrecondition, displayKey(firmwareReleaseKey("sensor", "1.0")), ""))
+	for _, args := range [][]string{nil, {"sensor"}} {
+		nonces, err = queryVulnerableNonces(stub, args...)
+		if err != nil || fmt.Sprint(nonces) != "[01 03]" {
+			HandleError(t, fmt.Errorf("vulnerableThings %v returned %v: %v", args, nonces, err))
+		}
+	}
+	nonces, err = queryVulnerableNonces(stub, "other")
+	if err != nil || len(nonces) != 0 {
+		HandleError(t, fmt.Errorf("vulnerableThings of another spec returned %v: %v", nonces, err))
+	}
+
+	//updating moves a thing off the vulnerable list
+	reportTX, _ = client.ReportFirmware(bob, []byte{3}, "1.1", 2, false)
+	if err := invokeTX(stub, "reportFirmware", reportTX); err != nil {
+		HandleError(t, err)
+	}
+	nonces, err = queryVulnerableNonces(stub)
+	if err != nil || fmt.Sprint(nonces) != "[01]" {
+		HandleError(t, fmt.Errorf("vulnerableThings after update returned %v: %v", nonces, err))
+	}
+}
@@ -0,0 +1,399 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	A group (or fleet) is a named set of things owned by one registrant.
+	The group is put to "Group:<GroupName>" and its membership is indexed both ways:
+	|		"GroupMember:<GroupName>:<Nonce>"	for the members of a group
+	|		"ThingGroup:<Nonce>:<GroupName>"	for the groups of a thing
+	Only things owned by the group's registrant can be members.
+	Every change of the members and the deletion of a group sign and increment Group.Version, so that a
+	signed change cannot be replayed. When a group is deleted, "GroupVersion:<GroupName>" keeps its next
+	Version, which a group created later under the same name starts from.
+*/
+const maxGroupMembersPerTX = 1000
+
+func groupMemberKey(groupName string, nonce string) string {
+	return compositeKey(groupMemberNamespace, groupName, nonce)
+}
+
+func thingGroupKey(nonce string, groupName string) string {
+	return compositeKey(thingGroupNamespace, nonce, groupName)
+}
+
+func groupVersionKey(groupName string) string {
+	return compositeKey(groupVersionNamespace, groupName)
+}
+
+/*
+	gets the "Group:<GroupName>" state and unmarshalls it. Returns an error if the group does not exist.
+*/
+func getGroup(stub Stub, groupName string) (*IOTRegistryStore.Group, error) {
+	key := groupKey(groupName)
+	groupBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "Could not get Group (%s) State", groupName)
+	}
+	if len(groupBytes) == 0 {
+		return nil, notFound(key, "Group (%s) does not exist", groupName)
+	}
+	group := IOTRegistryStore.Group{}
+	err = proto.Unmarshal(groupBytes, &group)
+	if err != nil {
+		return nil, internalError(key, "Error unmarshalling Group (%s): (%v)", groupName, err.Error())
+	}
+	return &group, nil
+}
+
+/*
+	checks that a transaction signed the current Version of a group.
+*/
+func checkGroupVersion(group *IOTRegistryStore.Group, groupName string, version int64) error {
+	if version != group.Version {
+		return failedPrecondition(groupKey(groupName), "Version (%d) is not the current Version (%d) of Group (%s)", version, group.Version, groupName)
+	}
+	return nil
+}
+
+func putGroup(stub Stub, groupName string, group *IOTRegistryStore.Group) error {
+	key := groupKey(groupName)
+	groupBytes, err := proto.Marshal(group)
+	if err != nil {
+		return internalError(key, "Error marshalling variable of type IOTRegistryStore.Group{}: (%v)", err.Error())
+	}
+	err = stub.PutState(key, groupBytes)
+	if err != nil {
+		return internalError(key, "Error putting Group state :(%v)", err.Error())
+	}
+	return nil
+}
+
+/*
+	verifies a signature by the owner of a group and returns the group.
+*/
+func verifyGroupOwner(stub Stub, groupName string, sig []byte, message string) (*IOTRegistryStore.Group, error) {
+	group, err := getGroup(stub, groupName)
+	if err != nil {
+		return nil, err
+	}
+	ownerPubKeyBytes, err := hex.DecodeString(group.RegistrantPubkey)
+	if err != nil {
+		return nil, internalError(groupKey(groupName), "Error decoding registrantPubkey: %s", err.Error())
+	}
+	return group, verify(stub, ownerPubKeyBytes, sig, message, "Signature")
+}
+
+/*
+	checks a GroupName, which is a key component and must not contain ':'.
+*/
+func validateGroupName(groupName string) error {
+	err := validateKeyComponent("GroupName", groupName)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(groupName, ":") {
+		return invalidArgument("GroupName", "GroupName (%s) must not contain ':'", groupName)
+	}
+	return nil
+}
+
+/*
+	createGroup puts a "Group:<GroupName>" state owned by a registrant.
+	The registrant signs "createGroup:<GroupName>:<RegistrantPubkey>:<Data>".
+	TX struct: 		CreateGroupTX
+	Store structs: 	Group
+*/
+type createGroupHandler struct{ txType }
+
+func (createGroupHandler) validate(tx proto.Message) error {
+	groupArgs := tx.(*IOTRegistryTX.CreateGroupTX)
+	err := validateGroupName(groupArgs.GroupName)
+	if err != nil {
+		return err
+	}
+	groupArgs.RegistrantPubkey, err = normalizePubkey("RegistrantPubkey", groupArgs.RegistrantPubkey)
+	if err != nil {
+		return err
+	}
+	if len(groupArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", groupArgs.Signature)
+	}
+	return nil
+}
+
+func (createGroupHandler) authorize(stub Stub, tx proto.Message) error {
+	groupArgs := tx.(*IOTRegistryTX.CreateGroupTX)
+	ownerPubKeyBytes, err := getRegistrantPubkey(stub, groupArgs.RegistrantPubkey)
+	if err != nil {
+		return err
+	}
+	message := client.SignedMessage(groupArgs, client.CreateGroupMessage(groupArgs.GroupName, groupArgs.RegistrantPubkey, groupArgs.Data))
+	return verify(stub, ownerPubKeyBytes, groupArgs.Signature, message, "Signature")
+}
+
+func (createGroupHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	groupArgs := tx.(*IOTRegistryTX.CreateGroupTX)
+	key := groupKey(groupArgs.GroupName)
+	groupCheckBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "Could not get Group (%s) State", groupArgs.GroupName)
+	}
+	if len(groupCheckBytes) != 0 {
+		return nil, alreadyExists(key, "GroupName (%s) is unavailable", groupArgs.GroupName)
+	}
+
+	versionBytes, err := stub.GetState(groupVersionKey(groupArgs.GroupName))
+	if err != nil {
+		return nil, internalError(groupVersionKey(groupArgs.GroupName), "Could not get GroupVersion (%s) State", groupArgs.GroupName)
+	}
+	store := IOTRegistryStore.Group{}
+	store.RegistrantPubkey = groupArgs.RegistrantPubkey
+	store.Data = groupArgs.Data
+	if len(versionBytes) != 0 {
+		store.Version, err = strconv.ParseInt(string(versionBytes), 10, 64)
+		if err != nil {
+			return nil, internalError(groupVersionKey(groupArgs.GroupName), "Invalid GroupVersion (%s)", versionBytes)
+		}
+	}
+	return nil, putGroup(stub, groupArgs.GroupName, &store)
+}
+
+/*
+	addGroupMembers and removeGroupMembers add or remove a list of things owned by the group's registrant.
+	The group owner signs "<function>:<GroupName>:<Version>:<Nonce>:<Nonce>...". Every nonce is checked before any
+	state is written, so either all of the things are added (removed) or none are.
+	TX struct: 		GroupMembersTX
+	Store structs: 	"GroupMember:<GroupName>:<Nonce>" and "ThingGroup:<Nonce>:<GroupName>" indexes
+*/
+type groupMembersHandler struct {
+	txType
+	function string
+}
+
+func (groupMembersHandler) validate(tx proto.Message) error {
+	membersArgs := tx.(*IOTRegistryTX.GroupMembersTX)
+	err := validateGroupName(membersArgs.GroupName)
+	if err != nil {
+		return err
+	}
+	if len(membersArgs.Nonces) == 0 || len(membersArgs.Nonces) > maxGroupMembersPerTX {
+		return invalidArgument("Nonces", "expected 1 to %d Nonces, got %d", maxGroupMembersPerTX, len(membersArgs.Nonces))
+	}
+	if len(membersArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", membersArgs.Signature)
+	}
+	seen := make(map[string]bool)
+	for _, nonceBytes := range membersArgs.Nonces {
+		nonce := hex.EncodeToString(nonceBytes)
+		if seen[nonce] {
+			return invalidArgument("Nonces", "Nonce (%s) is repeated", nonce)
+		}
+		seen[nonce] = true
+	}
+	return nil
+}
+
+func (h groupMembersHandler) authorize(stub Stub, tx proto.Message) error {
+	membersArgs := tx.(*IOTRegistryTX.GroupMembersTX)
+	message := client.SignedMessage(membersArgs, client.GroupMembersMessage(h.function, membersArgs.GroupName, membersArgs.Version, membersArgs.Nonces))
+	_, err := verifyGroupOwner(stub, membersArgs.GroupName, membersArgs.Signature, message)
+	return err
+}
+
+func (h groupMembersHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	membersArgs := tx.(*IOTRegistryTX.GroupMembersTX)
+	group, err := getGroup(stub, membersArgs.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	err = checkGroupVersion(group, membersArgs.GroupName, membersArgs.Version)
+	if err != nil {
+		return nil, err
+	}
+	for _, nonceBytes := range membersArgs.Nonces {
+		nonce := hex.EncodeToString(nonceBytes)
+		memberKey := groupMemberKey(membersArgs.GroupName, nonce)
+		memberBytes, err := stub.GetState(memberKey)
+		if err != nil {
+			return nil, internalError(memberKey, "Could not get GroupMember (%s) State", nonce)
+		}
+		if h.function == "addGroupMembers" {
+			if len(memberBytes) != 0 {
+				return nil, alreadyExists(memberKey, "Thing (%s) is already in Group (%s)", nonce, membersArgs.GroupName)
+			}
+			thing, err := getThing(stub, nonceBytes)
+			if err != nil {
+				return nil, err
+			}
+			if thing.RegistrantPubkey != group.RegistrantPubkey {
+				return nil, unauthorized(thingKey(nonce), "Thing (%s) is not owned by the owner of Group (%s)", nonce, membersArgs.GroupName)
+			}
+		} else if len(memberBytes) == 0 {
+			return nil, notFound(memberKey, "Thing (%s) is not in Group (%s)", nonce, membersArgs.GroupName)
+		}
+	}
+
+	for _, nonceBytes := range membersArgs.Nonces {
+		nonce := hex.EncodeToString(nonceBytes)
+		if h.function == "addGroupMembers" {
+			err = stub.PutState(groupMemberKey(membersArgs.GroupName, nonce), nonceBytes)
+			if err == nil {
+				err = stub.PutState(thingGroupKey(nonce, membersArgs.GroupName), []byte(membersArgs.GroupName))
+			}
+		} else {
+			err = stub.DelState(groupMemberKey(membersArgs.GroupName, nonce))
+			if err == nil {
+				err = stub.DelState(thingGroupKey(nonce, membersArgs.GroupName))
+			}
+		}
+		if err != nil {
+			return nil, internalError(groupMemberKey(membersArgs.GroupName, nonce), "Error updating GroupMember (%s) state :(%v)", nonce, err.Error())
+		}
+	}
+	group.Version++
+	return nil, putGroup(stub, membersArgs.GroupName, group)
+}
+
+/*
+	deleteGroup removes a group and all of its membership indexes. The group owner signs
+	"deleteGroup:<GroupName>:<Version>".
+	TX struct: 		DeleteGroupTX
+*/
+type deleteGroupHandler struct{ txType }
+
+func (deleteGroupHandler) validate(tx proto.Message) error {
+	deleteArgs := tx.(*IOTRegistryTX.DeleteGroupTX)
+	err := validateGroupName(deleteArgs.GroupName)
+	if err != nil {
+		return err
+	}
+	if len(deleteArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", deleteArgs.Signature)
+	}
+	return nil
+}
+
+func (deleteGroupHandler) authorize(stub Stub, tx proto.Message) error {
+	deleteArgs := tx.(*IOTRegistryTX.DeleteGroupTX)
+	_, err := verifyGroupOwner(stub, deleteArgs.GroupName, deleteArgs.Signature, client.SignedMessage(deleteArgs, client.DeleteGroupMessage(deleteArgs.GroupName, deleteArgs.Version)))
+	return err
+}
+
+func (deleteGroupHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	deleteArgs := tx.(*IOTRegistryTX.DeleteGroupTX)
+	group, err := getGroup(stub, deleteArgs.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	err = checkGroupVersion(group, deleteArgs.GroupName, deleteArgs.Version)
+	if err != nil {
+		return nil, err
+	}
+	members, err := groupMembers(stub, deleteArgs.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	for _, nonce := range members {
+		err = stub.DelState(groupMemberKey(deleteArgs.GroupName, nonce))
+		if err == nil {
+			err = stub.DelState(thingGroupKey(nonce, deleteArgs.GroupName))
+		}
+		if err != nil {
+			return nil, internalError(groupMemberKey(deleteArgs.GroupName, nonce), "Error deleting GroupMember (%s) state :(%v)", nonce, err.Error())
+		}
+	}
+	err = stub.DelState(groupKey(deleteArgs.GroupName))
+	if err != nil {
+		return nil, internalError(groupKey(deleteArgs.GroupName), "Error deleting Group state :(%v)", err.Error())
+	}
+	err = stub.PutState(groupVersionKey(deleteArgs.GroupName), []byte(strconv.FormatInt(group.Version+1, 10)))
+	if err != nil {
+		return nil, internalError(groupVersionKey(deleteArgs.GroupName), "Error putting GroupVersion state :(%v)", err.Error())
+	}
+	return nil, nil
+}
+
+/*
+	returns the hex encoded nonces of the members of a group.
+*/
+func groupMembers(stub Stub, groupName string) ([]string, error) {
+	prefix := keyPrefix(groupMemberNamespace, groupName)
+	members := []string{}
+	err := rangeScan(stub, prefix, func(key string, value []byte) error {
+		members = append(members, lastKeyComponent(key))
+		return nil
+	})
+	return members, err
+}
+
+/*
+	groupMembers returns a group, its owner, data, current Version and hex encoded member nonces as JSON.
+*/
+func queryGroupMembers(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, invalidArgument("args", "No argument specified")
+	}
+	err := validateKeyComponent("args", args[0])
+	if err != nil {
+		return nil, err
+	}
+	group, err := getGroup(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	members, err := groupMembers(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	type JSONGroup struct {
+		GroupName        string
+		RegistrantPubkey string
+		Data             string
+		Version          int64
+		Members          []string
+	}
+	return json.Marshal(JSONGroup{args[0], group.RegistrantPubkey, group.Data, group.Version, members})
+}
+
+/*
+	thingGroups returns the names of the groups a thing, indexed by its hex Nonce, belongs to as JSON.
+*/
+func queryThingGroups(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, invalidArgument("args", "No argument specified")
+	}
+	nonceBytes, err := hex.DecodeString(args[0])
+	if err != nil {
+		return nil, invalidArgument("args", "Invalid nonce (%s) expected hex", args[0])
+	}
+	prefix := keyPrefix(thingGroupNamespace, hex.EncodeToString(nonceBytes))
+	groups := []string{}
+	err = rangeScan(stub, prefix, func(key string, value []byte) error {
+		groups = append(groups, lastKeyComponent(key))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(groups)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	creates a group by calling to Invoke()
+*/
+func createTestGroup(stub *testStub, groupName string, registrantPubkey string, data string, privateKeyString string) error {
+	groupTX := IOTRegistryTX.CreateGroupTX{GroupName: groupName, RegistrantPubkey: registrantPubkey, Data: data}
+	signer, err := client.NewPrivateKeySigner(privateKeyString)
+	if err != nil {
+		return err
+	}
+	groupTX.Signature, err = signer.Sign(client.SignedMessage(&groupTX, client.CreateGroupMessage(groupName, registrantPubkey, data)))
+	if err != nil {
+		return err
+	}
+	groupBytes, err := proto.Marshal(&groupTX)
+	if err != nil {
+		return err
+	}
+	_, err = stub.MockInvoke("3", "createGroup", []string{hex.EncodeToString(groupBytes)})
+	return err
+}
+
+/*
+	returns the current Version of a group on the ledger
+*/
+func testGroupVersion(stub *testStub, groupName string) int64 {
+	group := IOTRegistryStore.Group{}
+	proto.Unmarshal(stub.State[groupKey(groupName)], &group)
+	return group.Version
+}
+
+/*
+	adds or removes group members by calling to Invoke(), signing the current Version of the group
+*/
+func updateTestGroup(stub *testStub, function string, groupName string, nonces [][]byte, privateKeyString string) error {
+	return updateTestGroupVersion(stub, function, groupName, testGroupVersion(stub, groupName), nonces, privateKeyString)
+}
+
+func updateTestGroupVersion(stub *testStub, function string, groupName string, version int64, nonces [][]byte, privateKeyString string) error {
+	membersTX := IOTRegistryTX.GroupMembersTX{GroupName: groupName, Nonces: nonces, Version: version}
+	signer, err := client.NewPrivateKeySigner(privateKeyString)
+	if err != nil {
+		return err
+	}
+	membersTX.Signature, err = signer.Sign(client.SignedMessage(&membersTX, client.GroupMembersMessage(function, groupName, version, nonces)))
+	if err != nil {
+		return err
+	}
+	membersBytes, err := proto.Marshal(&membersTX)
+	if err != nil {
+		return err
+	}
+	_, err = stub.MockInvoke("3", function, []string{hex.EncodeToString(membersBytes)})
+	return err
+}
+
+func checkGroupMembers(stub *testStub, groupName string, expected []string) error {
+	bytes, err := stub.MockQuery("groupMembers", []string{groupName})
+	if err != nil {
+		return err
+	}
+	group := struct{ Members []string }{}
+	if err := json.Unmarshal(bytes, &group); err != nil {
+		return err
+	}
+	if !testEq(group.Members, expected) {
+		return fmt.Errorf("Group (%s) members got (%v), expected (%v)", groupName, group.Members, expected)
+	}
+	return nil
+}
+
+/*
+	deletes a group by calling to Invoke()
+*/
+func deleteTestGroup(stub *testStub, groupName string, version int64, privateKeyString string) error {
+	deleteTX := IOTRegistryTX.DeleteGroupTX{GroupName: groupName, Version: version}
+	signer, err := client.NewPrivateKeySigner(privateKeyString)
+	if err != nil {
+		return err
+	}
+	deleteTX.Signature, err = signer.Sign(client.SignedMessage(&deleteTX, client.DeleteGroupMessage(groupName, version)))
+	if err != nil {
+		return err
+	}
+	deleteBytes, err := proto.Marshal(&deleteTX)
+	if err != nil {
+		return err
+	}
+	_, err = stub.MockInvoke("3", "deleteGroup", []string{hex.EncodeToString(deleteBytes)})
+	return err
+}
+
+func checkThingGroups(stub *testStub, nonce string, expected []string) error {
+	bytes, err := stub.MockQuery("thingGroups", []string{nonce})
+	if err != nil {
+		return err
+	}
+	var groups []string
+	if err := json.Unmarshal(bytes, &groups); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		return fmt.Errorf("Thing (%s) groups got (%v), expected (%v)", nonce, groups, expected)
+	}
+	return nil
+}
+
+func TestGroups(t *testing.T) {
+	stub := newTestStub()
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	bobPriv := "166cc93d9eadb573b329b5993b9671f1521679cea90fe52e398e66c1d6373abf"
+	bobPub := "02242a1c19bc831cd95a9e5492015043250cbc17d0eceb82612ce08736b8d753a6"
+
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := createRegistrant(t, stub, "Bob", "", bobPriv, bobPub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	for _, nonce := range [][]byte{{0x01}, {0x02}, {0x03}} {
+		if err := registerThing(t, stub, nonce, []string{"alice" + hex.EncodeToString(nonce)}, alicePub, "", "", alicePriv); err != nil {
+			HandleError(t, err)
+			return
+		}
+	}
+	if err := registerThing(t, stub, []byte{0x04}, []string{"bob04"}, bobPub, "", "", bobPriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	if err := createTestGroup(stub, "Building 7 HVAC", alicePub, "hvac", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := createTestGroup(stub, "Lobby", alicePub, "", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := createTestGroup(stub, "Lobby", bobPub, "", bobPriv); err == nil {
+		HandleError(t, fmt.Errorf("created a group with a name that is taken"))
+	}
+	if err := createTestGroup(stub, "a:b", alicePub, "", alicePriv); err == nil {
+		HandleError(t, fmt.Errorf("created a group with ':' in its name"))
+	}
+
+	if err := updateTestGroup(stub, "addGroupMembers", "Building 7 HVAC", [][]byte{{0x01}, {0x02}, {0x03}}, alicePriv); err != nil {
+		HandleError(t, err)
+	}
+	if err := updateTestGroup(stub, "addGroupMembers", "Lobby", [][]byte{{0x02}}, alicePriv); err != nil {
+		HandleError(t, err)
+	}
+	//things of other registrants, signatures of other registrants and repeated members are rejected as a whole
+	if err := updateTestGroup(stub, "addGroupMembers", "Lobby", [][]byte{{0x03}, {0x04}}, alicePriv); err == nil {
+		HandleError(t, fmt.Errorf("added Bob's thing to Alice's group"))
+	}
+	if err := updateTestGroup(stub, "addGroupMembers", "Lobby", [][]byte{{0x03}}, bobPriv); err == nil {
+		HandleError(t, fmt.Errorf("added a member without the group owner's signature"))
+	}
+	if err := updateTestGroup(stub, "addGroupMembers", "Lobby", [][]byte{{0x01}, {0x01}}, alicePriv); err == nil {
+		HandleError(t, fmt.Errorf("added a repeated member"))
+	}
+	HandleError(t, checkGroupMembers(stub, "Building 7 HVAC", []string{"01", "02", "03"}))
+	HandleError(t, checkGroupMembers(stub, "Lobby", []string{"02"}))
+	HandleError(t, checkThingGroups(stub, "02", []string{"Building 7 HVAC", "Lobby"}))
+	HandleError(t, checkThingGroups(stub, "04", []string{}))
+
+	if err := updateTestGroup(stub, "removeGroupMembers", "Building 7 HVAC", [][]byte{{0x01}, {0x02}}, alicePriv); err != nil {
+		HandleError(t, err)
+	}
+	if err := updateTestGroup(stub, "removeGroupMembers", "Building 7 HVAC", [][]byte{{0x01}}, alicePriv); err == nil {
+		HandleError(t, fmt.Errorf("removed a thing that is not a member"))
+	}
+	HandleError(t, checkGroupMembers(stub, "Building 7 HVAC", []string{"03"}))
+	HandleError(t, checkThingGroups(stub, "02", []string{"Lobby"}))
+
+	//a change signed for an earlier Version cannot be replayed
+	err := updateTestGroupVersion(stub, "addGroupMembers", "Building 7 HVAC", 0, [][]byte{{0x01}, {0x02}, {0x03}}, alicePriv)
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(groupKey("Building 7 HVAC")), ""))
+	if err := updateTestGroup(stub, "removeGroupMembers", "Building 7 HVAC", [][]byte{{0x03}}, alicePriv); err != nil {
+		HandleError(t, err)
+	}
+	bytes, err := stub.MockQuery("groupMembers", []string{"Building 7 HVAC"})
+	if err != nil || !strings.Contains(string(bytes), `"Version":3,"Members":[]`) {
+		HandleError(t, fmt.Errorf("groupMembers of an empty group returned (%s): %v", bytes, err))
+	}
+
+	//group names are validated by every group transaction
+	for _, groupName := range []string{"", "a\x00b", "Lobby:2"} {
+		err = updateTestGroupVersion(stub, "addGroupMembers", groupName, 0, [][]byte{{0x01}}, alicePriv)
+		HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "GroupName"))
+		err = deleteTestGroup(stub, groupName, 0, alicePriv)
+		HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "GroupName"))
+	}
+
+	if err := deleteTestGroup(stub, "Lobby", testGroupVersion(stub, "Lobby"), alicePriv); err != nil {
+		HandleError(t, err)
+	}
+	if _, err := stub.MockQuery("groupMembers", []string{"Lobby"}); err == nil {
+		HandleError(t, fmt.Errorf("deleted group still exists"))
+	}
+	HandleError(t, checkThingGroups(stub, "02", []string{}))
+
+	//a group created again under the name continues its Version, so the delete cannot be replayed
+	if err := createTestGroup(stub, "Lobby", alicePub, "", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+	err = deleteTestGroup(stub, "Lobby", 1, alicePriv)
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(groupKey("Lobby")), ""))
+	if version := testGroupVersion(stub, "Lobby"); version != 2 {
+		HandleError(t, fmt.Errorf("recreated group has Version (%d), expected 2", version))
+	}
+}
@@ -0,0 +1,225 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+A txHandler runs one Invoke function in four phases:
+|		decode		unmarshals args[0] into the TX message of the function
+|		validate	checks and normalizes the fields of the TX, without reading the ledger
+|		authorize	checks that the signers named by the TX exist and that their signatures verify
+|		apply		checks the ledger states the TX depends on, then writes its states
+apply checks everything before its first write, so a failed transaction writes nothing.
+Between validate and authorize, invoke checks the validity window of the TX (see validity.go), and
+after apply it updates the state tree with the records the TX wrote (see statetree.go).
+New transactions are added by implementing txHandler and registering it in invokeHandlers.
+*/
+type txHandler interface {
+	txName() string
+	decode(argsBytes []byte) (proto.Message, error)
+	validate(tx proto.Message) error
+	authorize(stub Stub, tx proto.Message) error
+	apply(stub Stub, tx proto.Message) ([]byte, error)
+}
+
+/*
+txType implements the decode phase for a TX message type. Handlers embed it.
+*/
+type txType struct {
+	prototype proto.Message
+}
+
+func (t txType) txName() string {
+	return reflect.TypeOf(t.prototype).Elem().Name()
+}
+
+func (t txType) decode(argsBytes []byte) (proto.Message, error) {
+	tx := reflect.New(reflect.TypeOf(t.prototype).Elem()).Interface().(proto.Message)
+	err := proto.Unmarshal(argsBytes, tx)
+	if err != nil {
+		return nil, invalidArgument("args", "Invalid argument expected %s protocol buffer %s", t.txName(), err.Error())
+	}
+	return tx, nil
+}
+
+/*
+A queryHandler answers one Query function with JSON.
+*/
+type queryHandler func(stub Stub, args []string) ([]byte, error)
+
+var invokeHandlers map[string]txHandler
+var queryHandlers map[string]queryHandler
+
+/*
+the handlers are registered in init, since the functions query refers back to queryHandlers.
+The doc comment of each handler type describes its transaction.
+*/
+func init() {
+	invokeHandlers = map[string]txHandler{
+		"createRegistrant":    createRegistrantHandler{txType{&IOTRegistryTX.CreateRegistrantTX{}}},
+		"registerThing":       registerThingHandler{txType{&IOTRegistryTX.RegisterThingTX{}}},
+		"registerThingsBatch": registerThingsBatchHandler{txType{&IOTRegistryTX.RegisterThingsBatchTX{}}},
+		"registerSpec":        registerSpecHandler{txType{&IOTRegistryTX.RegisterSpecTX{}}},
+		"attachThing":         attachThingHandler{txType{&IOTRegistryTX.AttachThingTX{}}},
+		"detachThing":         detachThingHandler{txType{&IOTRegistryTX.DetachThingTX{}}},
+		"createGroup":         createGroupHandler{txType{&IOTRegistryTX.CreateGroupTX{}}},
+		"addGroupMembers":     groupMembersHandler{txType{&IOTRegistryTX.GroupMembersTX{}}, "addGroupMembers"},
+		"removeGroupMembers":  groupMembersHandler{txType{&IOTRegistryTX.GroupMembersTX{}}, "removeGroupMembers"},
+		"deleteGroup":         deleteGroupHandler{txType{&IOTRegistryTX.DeleteGroupTX{}}},
+		"setThingStatus":      setThingStatusHandler{txType{&IOTRegistryTX.SetThingStatusTX{}}},
+		"setStatusDelegate":   statusDelegateHandler{txType{&IOTRegistryTX.StatusDelegateTX{}}},
+		"migrateKeys":         migrateKeysHandler{txType{&IOTRegistryTX.MigrateKeysTX{}}},
+		"setPrivateData":      setPrivateDataHandler{txType{&IOTRegistryTX.SetPrivateDataTX{}}},
+		"grantReader":         privateDataReaderHandler{txType{&IOTRegistryTX.PrivateDataReaderTX{}}, "grantReader"},
+		"revokeReader":        privateDataReaderHandler{txType{&IOTRegistryTX.PrivateDataReaderTX{}}, "revokeReader"},
+		"issueCredential":     issueCredentialHandler{txType{&IOTRegistryTX.IssueCredentialTX{}}},
+		"revokeCredential":    revokeCredentialHandler{txType{&IOTRegistryTX.RevokeCredentialTX{}}},
+		"importSnapshot":      importSnapshotHandler{txType{&IOTRegistryTX.ImportSnapshotTX{}}},
+		"repair":              repairHandler{txType{&IOTRegistryTX.RepairTX{}}},
+		"publishFirmware":     publishFirmwareHandler{txType{&IOTRegistryTX.PublishFirmwareTX{}}},
+		"flagFirmware":        flagFirmwareHandler{txType{&IOTRegistryTX.FlagFirmwareTX{}}},
+		"reportFirmware":      reportFirmwareHandler{txType{&IOTRegistryTX.ReportFirmwareTX{}}},
+		"issueManifest":       issueManifestHandler{txType{&IOTRegistryTX.IssueManifestTX{}}},
+	}
+	queryHandlers = map[string]queryHandler{
+		"owner":            queryOwner,
+		"proof":            queryProof,
+		"stateRoot":        queryStateRoot,
+		"thing":            queryThing,
+		"spec":             querySpec,
+		"thingChildren":    queryThingChildren,
+		"groupMembers":     queryGroupMembers,
+		"thingGroups":      queryThingGroups,
+		"thingsByStatus":   queryThingsByStatus,
+		"statusDelegate":   queryStatusDelegate,
+		"resolveDID":       queryResolveDID,
+		"verifyContent":    queryVerifyContent,
+		"verifyCredential": queryVerifyCredential,
+		"checkConsistency": queryCheckConsistency,
+		"firmwareRelease":  queryFirmwareRelease,
+		"firmwareHistory":  queryFirmwareHistory,
+		"vulnerableThings": queryVulnerableThings,
+		"manifest":         queryManifest,
+		"validateManifest": queryValidateManifest,
+		"exportSnapshot":   queryExportSnapshot,
+		"functions":        queryFunctions,
+	}
+}
+
+/*
+runInvoke and runQuery run a function for a shim adapter. Failures are returned as *client.Error
+(see errors.go) and logged once.
+*/
+func runInvoke(stub Stub, function string, args []string) ([]byte, error) {
+	result, err := invoke(stub, function, args)
+	if err != nil {
+		err = asRegistryError(err)
+		fmt.Printf("Invoke %s failed: %s\n", function, err.Error())
+		return nil, err
+	}
+	return result, nil
+}
+
+func runQuery(stub Stub, function string, args []string) ([]byte, error) {
+	result, err := query(stub, function, args)
+	if err != nil {
+		err = asRegistryError(err)
+		fmt.Printf("Query %s failed: %s\n", function, err.Error())
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+runs an Invoke function through the phases of its handler.
+*/
+func invoke(stub Stub, function string, args []string) ([]byte, error) {
+	handler, ok := invokeHandlers[function]
+	if !ok {
+		return nil, invalidArgument("function", "Unknown Invoke function (%s)", function)
+	}
+	if function != "migrateKeys" {
+		err := checkKeysMigrated(stub)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(args) == 0 {
+		return nil, invalidArgument("args", "Insufficient arguments found")
+	}
+	argsBytes, err := decodeInvokeArgs(function, args)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := handler.decode(argsBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = handler.validate(tx)
+	if err != nil {
+		return nil, err
+	}
+	err = checkValidity(stub, tx)
+	if err != nil {
+		return nil, err
+	}
+	err = handler.authorize(stub, tx)
+	if err != nil {
+		return nil, err
+	}
+	recorder := newStateRecorder(stub)
+	result, err := handler.apply(recorder, tx)
+	if err != nil {
+		return nil, err
+	}
+	return result, recorder.commit()
+}
+
+func query(stub Stub, function string, args []string) ([]byte, error) {
+	handler, ok := queryHandlers[function]
+	if !ok {
+		return nil, invalidArgument("function", "Unknown Query function (%s)", function)
+	}
+	return handler(stub, args)
+}
+
+/*
+functions returns the supported Invoke functions with their TX message types, and the supported
+Query functions, as JSON:
+|		{"Invoke":[{"Function":"createRegistrant","TX":"CreateRegistrantTX"},...],"Query":["functions",...]}
+*/
+func queryFunctions(stub Stub, args []string) ([]byte, error) {
+	type invokeFunction struct {
+		Function string
+		TX       string
+	}
+	functions := struct {
+		Invoke []invokeFunction
+		Query  []string
+	}{}
+	for function, handler := range invokeHandlers {
+		functions.Invoke = append(functions.Invoke, invokeFunction{function, handler.txName()})
+	}
+	sort.Slice(functions.Invoke, func(i, j int) bool { return functions.Invoke[i].Function < functions.Invoke[j].Function })
+	for function := range queryHandlers {
+		functions.Query = append(functions.Query, function)
+	}
+	sort.Strings(functions.Query)
+	return json.Marshal(functions)
+}
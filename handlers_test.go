@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+)
+
+func TestUnknownFunctions(t *testing.T) {
+	stub := newTestStub()
+
+	_, err := stub.MockInvoke("1", "registerThings", []string{"00"})
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "function"))
+	_, err = stub.MockQuery("things", []string{"00"})
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "function"))
+}
+
+func TestFunctionsQuery(t *testing.T) {
+	stub := newTestStub()
+
+	bytes, err := stub.MockQuery("functions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var functions struct {
+		Invoke []struct {
+			Function string
+			TX       string
+		}
+		Query []string
+	}
+	if err := json.Unmarshal(bytes, &functions); err != nil {
+		t.Fatal(err)
+	}
+	if len(functions.Invoke) != len(invokeHandlers) || len(functions.Query) != len(queryHandlers) {
+		HandleError(t, fmt.Errorf("functions returned (%s)", bytes))
+	}
+	txTypes := make(map[string]string)
+	for _, function := range functions.Invoke {
+		txTypes[function.Function] = function.TX
+	}
+	for function, txType := range map[string]string{
+		"createRegistrant":   "CreateRegistrantTX",
+		"registerThing":      "RegisterThingTX",
+		"addGroupMembers":    "GroupMembersTX",
+		"removeGroupMembers": "GroupMembersTX",
+		"setThingStatus":     "SetThingStatusTX",
+	} {
+		if txTypes[function] != txType {
+			HandleError(t, fmt.Errorf("function (%s) has TX type (%s), expected (%s)", function, txTypes[function], txType))
+		}
+	}
+	if i := sort.SearchStrings(functions.Query, "functions"); i == len(functions.Query) || functions.Query[i] != "functions" || !sort.StringsAreSorted(functions.Query) {
+		HandleError(t, fmt.Errorf("queries are not sorted: %v", functions.Query))
+	}
+}
@@ -0,0 +1,324 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	Things can be composed into trees, e.g. a gateway with attached sensors.
+	A child thing records the nonce of its parent in Thing.ParentNonce, and the parent is indexed by
+	"ThingChild:<ParentNonce>:<ChildNonce>" states so that its children can be found with a range query.
+	Trees are limited to maxThingDepth levels.
+	Every attach or detach of a child signs and increments its Thing.LinkSequence, so that a link
+	transaction cannot be replayed once the child has been attached or detached again.
+*/
+const maxThingDepth = 16
+
+func thingChildKey(parentNonce string, childNonce string) string {
+	return compositeKey(thingChildNamespace, parentNonce, childNonce)
+}
+
+/*
+	returns the set of hex encoded nonces made up of a thing and all of its ancestors,
+	failing if the parent chain loops or is deeper than maxThingDepth.
+*/
+func thingAncestors(stub Stub, nonce []byte) (map[string]bool, error) {
+	ancestors := map[string]bool{hex.EncodeToString(nonce): true}
+	for {
+		thing, err := getThing(stub, nonce)
+		if err != nil {
+			return nil, err
+		}
+		if len(thing.ParentNonce) == 0 {
+			return ancestors, nil
+		}
+		if ancestors[thing.ParentNonce] {
+			return nil, failedPrecondition(thingKey(thing.ParentNonce), "cycle detected at Thing (%s)", thing.ParentNonce)
+		}
+		ancestors[thing.ParentNonce] = true
+		if len(ancestors) > maxThingDepth+1 {
+			return nil, failedPrecondition(thingKey(hex.EncodeToString(nonce)), "Thing (%s) is nested deeper than %d", hex.EncodeToString(nonce), maxThingDepth)
+		}
+		nonce, err = hex.DecodeString(thing.ParentNonce)
+		if err != nil {
+			return nil, internalError(thingKey(hex.EncodeToString(nonce)), "Invalid ParentNonce (%s)", thing.ParentNonce)
+		}
+	}
+}
+
+/*
+	returns the hex encoded nonces of the direct children of a thing.
+*/
+func thingChildren(stub Stub, nonce string) ([]string, error) {
+	prefix := keyPrefix(thingChildNamespace, nonce)
+	var children []string
+	err := rangeScan(stub, prefix, func(key string, value []byte) error {
+		children = append(children, lastKeyComponent(key))
+		return nil
+	})
+	return children, err
+}
+
+type thingNode struct {
+	Nonce     string
+	Children  []*thingNode `json:",omitempty"`
+	Truncated bool         `json:",omitempty"`
+}
+
+/*
+	walks the subtree below a thing down to depth levels. visited holds the nonces on the current path
+	and is used to detect cycles.
+*/
+func walkThingTree(stub Stub, nonce string, depth int, visited map[string]bool) (*thingNode, int, error) {
+	node := &thingNode{Nonce: nonce}
+	if visited[nonce] {
+		return nil, 0, failedPrecondition(thingKey(nonce), "cycle detected at Thing (%s)", nonce)
+	}
+	children, err := thingChildren(stub, nonce)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(children) == 0 {
+		return node, 0, nil
+	}
+	if depth == 0 {
+		node.Truncated = true
+		return node, 1, nil
+	}
+	visited[nonce] = true
+	height := 0
+	for _, child := range children {
+		childNode, childHeight, err := walkThingTree(stub, child, depth-1, visited)
+		if err != nil {
+			return nil, 0, err
+		}
+		node.Children = append(node.Children, childNode)
+		if childHeight+1 > height {
+			height = childHeight + 1
+		}
+	}
+	delete(visited, nonce)
+	return node, height, nil
+}
+
+/*
+	attachThing makes one thing the child of another. Both owners must sign
+	"attachThing:<ParentNonce>:<ChildNonce>:<LinkSequence>". The child must not already have a parent,
+	and the attachment must neither create a cycle nor exceed maxThingDepth.
+	TX struct: 		AttachThingTX
+	Store structs: 	Thing, "ThingChild:<ParentNonce>:<ChildNonce>" index
+*/
+type attachThingHandler struct{ txType }
+
+func (attachThingHandler) validate(tx proto.Message) error {
+	attachArgs := tx.(*IOTRegistryTX.AttachThingTX)
+	if len(attachArgs.ParentNonce) == 0 || len(attachArgs.ChildNonce) == 0 {
+		return invalidArgument("ParentNonce", "length of ParentNonce or ChildNonce is zero")
+	}
+	if len(attachArgs.ParentSignature) == 0 || len(attachArgs.ChildSignature) == 0 {
+		return invalidArgument("ParentSignature", "length of ParentSignature or ChildSignature is zero")
+	}
+	childNonce := hex.EncodeToString(attachArgs.ChildNonce)
+	if hex.EncodeToString(attachArgs.ParentNonce) == childNonce {
+		return invalidArgument("ChildNonce", "Thing (%s) cannot be attached to itself", childNonce)
+	}
+	return nil
+}
+
+func (attachThingHandler) authorize(stub Stub, tx proto.Message) error {
+	attachArgs := tx.(*IOTRegistryTX.AttachThingTX)
+	parent, err := getThing(stub, attachArgs.ParentNonce)
+	if err != nil {
+		return err
+	}
+	child, err := getThing(stub, attachArgs.ChildNonce)
+	if err != nil {
+		return err
+	}
+	message := client.SignedMessage(attachArgs, client.ThingLinkMessage("attachThing", attachArgs.ParentNonce, attachArgs.ChildNonce, attachArgs.LinkSequence))
+	err = verifyThingOwner(stub, parent, attachArgs.ParentSignature, message, "ParentSignature")
+	if err != nil {
+		return err
+	}
+	return verifyThingOwner(stub, child, attachArgs.ChildSignature, message, "ChildSignature")
+}
+
+func (attachThingHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	attachArgs := tx.(*IOTRegistryTX.AttachThingTX)
+	parentNonce := hex.EncodeToString(attachArgs.ParentNonce)
+	childNonce := hex.EncodeToString(attachArgs.ChildNonce)
+	child, err := getThing(stub, attachArgs.ChildNonce)
+	if err != nil {
+		return nil, err
+	}
+	if len(child.ParentNonce) != 0 {
+		return nil, failedPrecondition(thingKey(childNonce), "Thing (%s) is already attached to (%s)", childNonce, child.ParentNonce)
+	}
+	err = checkLinkSequence(child, childNonce, attachArgs.LinkSequence)
+	if err != nil {
+		return nil, err
+	}
+
+	//the child's subtree must not contain the parent, and the combined tree must fit in maxThingDepth
+	ancestors, err := thingAncestors(stub, attachArgs.ParentNonce)
+	if err != nil {
+		return nil, err
+	}
+	parentDepth := len(ancestors) - 1
+	_, childHeight, err := walkThingTree(stub, childNonce, maxThingDepth, ancestors)
+	if err != nil {
+		return nil, prefixError(err, "Cannot attach Thing (%s) to (%s)", childNonce, parentNonce)
+	}
+	if parentDepth+1+childHeight > maxThingDepth {
+		return nil, failedPrecondition(thingKey(parentNonce), "Attaching Thing (%s) to (%s) exceeds the maximum depth of %d", childNonce, parentNonce, maxThingDepth)
+	}
+
+	child.ParentNonce = parentNonce
+	child.LinkSequence++
+	err = putThing(stub, attachArgs.ChildNonce, child)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(thingChildKey(parentNonce, childNonce), attachArgs.ChildNonce)
+	if err != nil {
+		return nil, internalError(thingChildKey(parentNonce, childNonce), "Error putting ThingChild state :(%v)", err.Error())
+	}
+	return nil, nil
+}
+
+/*
+	checks that a link transaction signed the current LinkSequence of the child.
+*/
+func checkLinkSequence(child *IOTRegistryStore.Thing, childNonce string, linkSequence int64) error {
+	if linkSequence != child.LinkSequence {
+		return failedPrecondition(thingKey(childNonce), "LinkSequence (%d) is not the current LinkSequence (%d) of Thing (%s)", linkSequence, child.LinkSequence, childNonce)
+	}
+	return nil
+}
+
+/*
+	returns a thing and its parent, failing if the thing is not attached.
+*/
+func getAttachedThing(stub Stub, nonce []byte) (child *IOTRegistryStore.Thing, parentNonce []byte, parent *IOTRegistryStore.Thing, err error) {
+	childNonce := hex.EncodeToString(nonce)
+	child, err = getThing(stub, nonce)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(child.ParentNonce) == 0 {
+		return nil, nil, nil, failedPrecondition(thingKey(childNonce), "Thing (%s) is not attached", childNonce)
+	}
+	parentNonce, err = hex.DecodeString(child.ParentNonce)
+	if err != nil {
+		return nil, nil, nil, internalError(thingKey(childNonce), "Invalid ParentNonce (%s)", child.ParentNonce)
+	}
+	parent, err = getThing(stub, parentNonce)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return child, parentNonce, parent, nil
+}
+
+/*
+	detachThing removes a thing from its parent. Both owners must sign
+	"detachThing:<ParentNonce>:<ChildNonce>:<LinkSequence>".
+	TX struct: 		DetachThingTX
+	Store structs: 	Thing, "ThingChild:<ParentNonce>:<ChildNonce>" index
+*/
+type detachThingHandler struct{ txType }
+
+func (detachThingHandler) validate(tx proto.Message) error {
+	detachArgs := tx.(*IOTRegistryTX.DetachThingTX)
+	if len(detachArgs.ChildNonce) == 0 {
+		return invalidArgument("ChildNonce", "length of ChildNonce is zero")
+	}
+	if len(detachArgs.ParentSignature) == 0 || len(detachArgs.ChildSignature) == 0 {
+		return invalidArgument("ParentSignature", "length of ParentSignature or ChildSignature is zero")
+	}
+	return nil
+}
+
+func (detachThingHandler) authorize(stub Stub, tx proto.Message) error {
+	detachArgs := tx.(*IOTRegistryTX.DetachThingTX)
+	child, parentNonceBytes, parent, err := getAttachedThing(stub, detachArgs.ChildNonce)
+	if err != nil {
+		return err
+	}
+	message := client.SignedMessage(detachArgs, client.ThingLinkMessage("detachThing", parentNonceBytes, detachArgs.ChildNonce, detachArgs.LinkSequence))
+	err = verifyThingOwner(stub, parent, detachArgs.ParentSignature, message, "ParentSignature")
+	if err != nil {
+		return err
+	}
+	return verifyThingOwner(stub, child, detachArgs.ChildSignature, message, "ChildSignature")
+}
+
+func (detachThingHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	detachArgs := tx.(*IOTRegistryTX.DetachThingTX)
+	childNonce := hex.EncodeToString(detachArgs.ChildNonce)
+	child, _, _, err := getAttachedThing(stub, detachArgs.ChildNonce)
+	if err != nil {
+		return nil, err
+	}
+	err = checkLinkSequence(child, childNonce, detachArgs.LinkSequence)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.DelState(thingChildKey(child.ParentNonce, childNonce))
+	if err != nil {
+		return nil, internalError(thingChildKey(child.ParentNonce, childNonce), "Error deleting ThingChild state :(%v)", err.Error())
+	}
+	child.ParentNonce = ""
+	child.LinkSequence++
+	err = putThing(stub, detachArgs.ChildNonce, child)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+/*
+	thingChildren returns the tree below a thing as JSON. args are the hex encoded nonce of the thing
+	and an optional depth, which defaults to and may not exceed maxThingDepth.
+	Nodes with children below the depth limit are marked Truncated.
+*/
+func queryThingChildren(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, invalidArgument("args", "No argument specified")
+	}
+	nonceBytes, err := hex.DecodeString(args[0])
+	if err != nil {
+		return nil, invalidArgument("args", "Invalid nonce (%s) expected hex", args[0])
+	}
+	depth := maxThingDepth
+	if len(args) == 2 {
+		depth, err = strconv.Atoi(args[1])
+		if err != nil || depth < 1 || depth > maxThingDepth {
+			return nil, invalidArgument("args", "Invalid depth (%s) expected 1 to %d", args[1], maxThingDepth)
+		}
+	}
+	_, err = getThing(stub, nonceBytes)
+	if err != nil {
+		return nil, err
+	}
+	tree, _, err := walkThingTree(stub, hex.EncodeToString(nonceBytes), depth, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	returns the Thing state of a nonce, or an empty Thing if it does not exist
+*/
+func getTestThing(stub *testStub, nonce []byte) *IOTRegistryStore.Thing {
+	thing := &IOTRegistryStore.Thing{}
+	proto.Unmarshal(stub.State[thingKey(hex.EncodeToString(nonce))], thing)
+	return thing
+}
+
+/*
+	attaches child to parent by calling to Invoke(), signing with the private keys of both owners
+*/
+func attach(stub *testStub, parent []byte, child []byte, parentPriv string, childPriv string) error {
+	return attachSequence(stub, parent, child, getTestThing(stub, child).LinkSequence, parentPriv, childPriv)
+}
+
+func attachSequence(stub *testStub, parent []byte, child []byte, linkSequence int64, parentPriv string, childPriv string) error {
+	attachTX := IOTRegistryTX.AttachThingTX{ParentNonce: parent, ChildNonce: child, LinkSequence: linkSequence}
+	message := client.SignedMessage(&attachTX, client.ThingLinkMessage("attachThing", parent, child, linkSequence))
+	parentSigner, err := client.NewPrivateKeySigner(parentPriv)
+	if err != nil {
+		return err
+	}
+	childSigner, err := client.NewPrivateKeySigner(childPriv)
+	if err != nil {
+		return err
+	}
+	attachTX.ParentSignature, err = parentSigner.Sign(message)
+	if err != nil {
+		return err
+	}
+	attachTX.ChildSignature, err = childSigner.Sign(message)
+	if err != nil {
+		return err
+	}
+	attachBytes, err := proto.Marshal(&attachTX)
+	if err != nil {
+		return err
+	}
+	_, err = stub.MockInvoke("3", "attachThing", []string{hex.EncodeToString(attachBytes)})
+	return err
+}
+
+/*
+	detaches child from parent by calling to Invoke(), signing with the private keys of both owners
+*/
+func detach(stub *testStub, parent []byte, child []byte, parentPriv string, childPriv string) error {
+	linkSequence := getTestThing(stub, child).LinkSequence
+	detachTX := IOTRegistryTX.DetachThingTX{ChildNonce: child, LinkSequence: linkSequence}
+	message := client.SignedMessage(&detachTX, client.ThingLinkMessage("detachThing", parent, child, linkSequence))
+	parentSigner, err := client.NewPrivateKeySigner(parentPriv)
+	if err != nil {
+		return err
+	}
+	childSigner, err := client.NewPrivateKeySigner(childPriv)
+	if err != nil {
+		return err
+	}
+	detachTX.ParentSignature, err = parentSigner.Sign(message)
+	if err != nil {
+		return err
+	}
+	detachTX.ChildSignature, err = childSigner.Sign(message)
+	if err != nil {
+		return err
+	}
+	detachBytes, err := proto.Marshal(&detachTX)
+	if err != nil {
+		return err
+	}
+	_, err = stub.MockInvoke("3", "detachThing", []string{hex.EncodeToString(detachBytes)})
+	return err
+}
+
+func queryChildren(stub *testStub, args ...string) (*thingNode, error) {
+	bytes, err := stub.MockQuery("thingChildren", args)
+	if err != nil {
+		return nil, err
+	}
+	tree := thingNode{}
+	err = json.Unmarshal(bytes, &tree)
+	return &tree, err
+}
+
+func TestThingHierarchy(t *testing.T) {
+	stub := newTestStub()
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	bobPriv := "166cc93d9eadb573b329b5993b9671f1521679cea90fe52e398e66c1d6373abf"
+	bobPub := "02242a1c19bc831cd95a9e5492015043250cbc17d0eceb82612ce08736b8d753a6"
+
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := createRegistrant(t, stub, "Bob", "", bobPriv, bobPub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	gateway, sensor, subSensor, bobSensor := []byte{0x10}, []byte{0x11}, []byte{0x12}, []byte{0x20}
+	for _, nonce := range [][]byte{gateway, sensor, subSensor} {
+		if err := registerThing(t, stub, nonce, []string{"alice" + hex.EncodeToString(nonce)}, alicePub, "", "", alicePriv); err != nil {
+			HandleError(t, err)
+			return
+		}
+	}
+	if err := registerThing(t, stub, bobSensor, []string{"bob20"}, bobPub, "", "", bobPriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	//both owners have to sign
+	if err := attach(stub, gateway, bobSensor, alicePriv, alicePriv); err == nil {
+		HandleError(t, fmt.Errorf("attached Bob's thing without Bob's signature"))
+	}
+	if err := attach(stub, gateway, bobSensor, alicePriv, bobPriv); err != nil {
+		HandleError(t, err)
+	}
+	if err := attach(stub, gateway, sensor, alicePriv, alicePriv); err != nil {
+		HandleError(t, err)
+	}
+	if err := attach(stub, sensor, subSensor, alicePriv, alicePriv); err != nil {
+		HandleError(t, err)
+	}
+	if err := attach(stub, sensor, bobSensor, alicePriv, bobPriv); err == nil {
+		HandleError(t, fmt.Errorf("attached a thing that already has a parent"))
+	}
+	if err := attach(stub, subSensor, gateway, alicePriv, alicePriv); err == nil {
+		HandleError(t, fmt.Errorf("attached a thing below its own descendant"))
+	}
+
+	tree, err := queryChildren(stub, "10")
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	if len(tree.Children) != 2 || tree.Children[0].Nonce != "11" || tree.Children[1].Nonce != "20" {
+		HandleError(t, fmt.Errorf("unexpected children of gateway: %+v", tree.Children))
+	} else if len(tree.Children[0].Children) != 1 || tree.Children[0].Children[0].Nonce != "12" {
+		HandleError(t, fmt.Errorf("unexpected children of sensor: %+v", tree.Children[0].Children))
+	}
+	tree, err = queryChildren(stub, "10", "1")
+	if err != nil {
+		HandleError(t, err)
+	} else if len(tree.Children) != 2 || !tree.Children[0].Truncated || len(tree.Children[0].Children) != 0 {
+		HandleError(t, fmt.Errorf("depth limited walk was not truncated: %+v", tree.Children))
+	}
+	if _, err := queryChildren(stub, "10", "0"); err == nil {
+		HandleError(t, fmt.Errorf("accepted a depth of 0"))
+	}
+
+	//a forged ledger cycle is reported instead of walked forever
+	stub.MockTransactionStart("cycle")
+	stub.PutState(thingChildKey("12", "10"), gateway)
+	stub.MockTransactionEnd("cycle")
+	if _, err := queryChildren(stub, "10"); err == nil {
+		HandleError(t, fmt.Errorf("cycle was not detected"))
+	}
+	stub.MockTransactionStart("cycle")
+	stub.DelState(thingChildKey("12", "10"))
+	stub.MockTransactionEnd("cycle")
+
+	if err := detach(stub, gateway, sensor, alicePriv, alicePriv); err != nil {
+		HandleError(t, err)
+	}
+	thing := getTestThing(stub, sensor)
+	if len(thing.ParentNonce) != 0 || thing.LinkSequence != 2 {
+		HandleError(t, fmt.Errorf("detached thing has parent (%s) and LinkSequence (%d)", thing.ParentNonce, thing.LinkSequence))
+	}
+
+	//the attach signed before the detach cannot be replayed
+	err = attachSequence(stub, gateway, sensor, 0, alicePriv, alicePriv)
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(thingKey("11")), ""))
+	tree, err = queryChildren(stub, "10")
+	if err != nil {
+		HandleError(t, err)
+	} else if len(tree.Children) != 1 || tree.Children[0].Nonce != "20" {
+		HandleError(t, fmt.Errorf("unexpected children of gateway after detach: %+v", tree.Children))
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+	Ledger keys are composite keys: a namespace followed by its components, each terminated by keyDelimiter.
+	|		"\x00Thing\x00<Nonce>\x00"
+	|		"\x00GroupMember\x00<GroupName>\x00<Nonce>\x00"
+	Components are checked by validateKeyComponent, so a component can never contain the delimiter, and the
+	key of a prefix of the components (keyPrefix) only ranges over keys with exactly those leading components.
+	Keys start with the delimiter, so they cannot collide with the "<Namespace>:<component>" keys of the
+	layout before composite keys, which the migrateKeys transaction rewrites.
+	Doc comments and the Key of errors write composite keys as "<Namespace>:<component>:..." (see displayKey).
+*/
+const keyDelimiter = "\x00"
+
+const (
+	registrantNamespace      = "RegistrantPubkey"
+	thingNamespace           = "Thing"
+	aliasNamespace           = "Alias"
+	typedAliasNamespace      = "TypedAlias"
+	specNamespace            = "Spec"
+	groupNamespace           = "Group"
+	groupMemberNamespace     = "GroupMember"
+	thingGroupNamespace      = "ThingGroup"
+	thingChildNamespace      = "ThingChild"
+	thingStatusNamespace     = "ThingStatus"
+	statusDelegateNamespace  = "StatusDelegate"
+	keyLayoutNamespace       = "KeyLayout"
+	configNamespace          = "Config"
+	credentialNamespace      = "Credential"
+	stateTreeNodeNamespace   = "StateTreeNode"
+	stateRootNamespace       = "StateRoot"
+	firmwareReleaseNamespace = "FirmwareRelease"
+	thingFirmwareNamespace   = "ThingFirmware"
+	firmwareHistoryNamespace = "FirmwareHistory"
+	manifestNamespace        = "Manifest"
+	groupVersionNamespace    = "GroupVersion"
+	snapshotImportNamespace  = "SnapshotImport"
+	repairSequenceNamespace  = "RepairSequence"
+)
+
+/*
+	returns the key of a namespace and its components.
+*/
+func compositeKey(namespace string, components ...string) string {
+	key := keyDelimiter + namespace + keyDelimiter
+	for _, component := range components {
+		key += component + keyDelimiter
+	}
+	return key
+}
+
+/*
+	returns the prefix shared by every key of the namespace whose leading components are the given ones,
+	for range scans. It is the same as compositeKey, since every component is terminated by the delimiter.
+*/
+func keyPrefix(namespace string, components ...string) string {
+	return compositeKey(namespace, components...)
+}
+
+/*
+	splits a composite key into its namespace and components. ok is false if key is not a composite key.
+*/
+func splitCompositeKey(key string) (namespace string, components []string, ok bool) {
+	if !strings.HasPrefix(key, keyDelimiter) || !strings.HasSuffix(key, keyDelimiter) || len(key) < 2 {
+		return "", nil, false
+	}
+	parts := strings.Split(key[1:len(key)-1], keyDelimiter)
+	return parts[0], parts[1:], true
+}
+
+/*
+	returns the namespace and leading components of the composite key prefix that a key range scans, if
+	the range is a scan of rangeScanFrom: from startKey, within the prefix, to the prefix followed by 0xff.
+	Stubs that cannot range over composite keys use it to scan the prefix instead.
+*/
+func partialCompositeRange(startKey string, endKey string) (namespace string, components []string, ok bool) {
+	if !strings.HasSuffix(endKey, "\xff") {
+		return "", nil, false
+	}
+	prefix := endKey[:len(endKey)-1]
+	if !strings.HasPrefix(startKey, prefix) {
+		return "", nil, false
+	}
+	return splitCompositeKey(prefix)
+}
+
+/*
+	returns the last component of a composite key, e.g. the nonce of a range scanned index key.
+*/
+func lastKeyComponent(key string) string {
+	_, components, ok := splitCompositeKey(key)
+	if !ok || len(components) == 0 {
+		return ""
+	}
+	return components[len(components)-1]
+}
+
+/*
+	checks a user provided key component, e.g. an alias, a spec name or a group name.
+	Components must be non-empty, valid UTF-8 and must not contain the key delimiter.
+*/
+func validateKeyComponent(field string, value string) error {
+	if len(value) == 0 {
+		return invalidArgument(field, "length of %s is zero", field)
+	}
+	if !utf8.ValidString(value) {
+		return invalidArgument(field, "%s (%q) is not valid UTF-8", field, value)
+	}
+	if strings.Contains(value, keyDelimiter) {
+		return invalidArgument(field, "%s (%q) contains a NUL character", field, value)
+	}
+	return nil
+}
+
+/*
+	renders a composite key as "<Namespace>:<component>:..." for error messages and logs.
+	Other keys are returned unchanged.
+*/
+func displayKey(key string) string {
+	namespace, components, ok := splitCompositeKey(key)
+	if !ok {
+		return key
+	}
+	return strings.Join(append([]string{namespace}, components...), ":")
+}
+
+func registrantKey(registrantPubkey string) string {
+	return compositeKey(registrantNamespace, registrantPubkey)
+}
+
+func thingKey(nonce string) string {
+	return compositeKey(thingNamespace, nonce)
+}
+
+func aliasKey(identity string) string {
+	return compositeKey(aliasNamespace, identity)
+}
+
+func specKey(specName string) string {
+	return compositeKey(specNamespace, specName)
+}
+
+func groupKey(groupName string) string {
+	return compositeKey(groupNamespace, groupName)
+}
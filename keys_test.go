@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+func TestCompositeKeys(t *testing.T) {
+	key := compositeKey(typedAliasNamespace, "uri", globalAliasScope, "https://example.com:8080/a")
+	namespace, components, ok := splitCompositeKey(key)
+	if !ok || namespace != typedAliasNamespace || len(components) != 3 || components[2] != "https://example.com:8080/a" {
+		HandleError(t, fmt.Errorf("split (%q) into (%s) (%q)", key, namespace, components))
+	}
+	if displayKey(key) != "TypedAlias:uri:*:https://example.com:8080/a" {
+		HandleError(t, fmt.Errorf("unexpected display key (%s)", displayKey(key)))
+	}
+
+	//an alias containing the legacy separator no longer shares a prefix with other key shapes
+	if aliasKey("a:b") == compositeKey(aliasNamespace, "a", "b") {
+		HandleError(t, fmt.Errorf("alias (a:b) collides with a two component key"))
+	}
+	prefix := keyPrefix(groupMemberNamespace, "g")
+	if len(compositeKey(groupMemberNamespace, "g2", "01")) >= len(prefix) &&
+		compositeKey(groupMemberNamespace, "g2", "01")[:len(prefix)] == prefix {
+		HandleError(t, fmt.Errorf("members of group (g2) are in the range of group (g)"))
+	}
+
+	for _, invalid := range []string{"", "a\x00b", "\xff"} {
+		if validateKeyComponent("Aliases", invalid) == nil {
+			HandleError(t, fmt.Errorf("accepted key component (%q)", invalid))
+		}
+	}
+
+	//the ranges of rangeScanFrom map to partial composite key scans of their prefix
+	prefix = keyPrefix(manifestNamespace, "radio")
+	for _, start := range []string{prefix, compositeKey(manifestNamespace, "radio", "1.0"), compositeKey(manifestNamespace, "radio", "1.0") + keyDelimiter} {
+		namespace, components, ok := partialCompositeRange(start, prefix+"\xff")
+		if !ok || namespace != manifestNamespace || len(components) != 1 || components[0] != "radio" {
+			HandleError(t, fmt.Errorf("range from (%q) scans (%s) (%q) %v", start, namespace, components, ok))
+		}
+	}
+	if _, _, ok := partialCompositeRange("", "\xff"); ok {
+		HandleError(t, fmt.Errorf("the range of legacy keys is a composite key range"))
+	}
+	if _, _, ok := partialCompositeRange(keyPrefix(specNamespace), prefix+"\xff"); ok {
+		HandleError(t, fmt.Errorf("a range starting outside its prefix is a composite key range"))
+	}
+}
+
+func TestMigrateKeys(t *testing.T) {
+	stub := newTestStub()
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := registerThing(t, stub, []byte{1}, []string{"sensor:1"}, alicePub, "spec", "", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	//rewrite the states into the legacy layout
+	stub.MockTransactionStart("legacy")
+	state := make(map[string][]byte)
+	for key, value := range stub.State {
+		state[key] = value
+	}
+	for key, value := range state {
+		namespace, components, _ := splitCompositeKey(key)
+		if namespace == stateTreeNodeNamespace || namespace == stateRootNamespace || namespace == keyLayoutNamespace {
+			//the legacy layout predates the state tree and the KeyLayout marker
+			stub.DelState(key)
+			continue
+		}
+		legacyKey := namespace
+		for _, component := range components {
+			legacyKey += ":" + component
+		}
+		stub.DelState(key)
+		stub.PutState(legacyKey, value)
+	}
+	//a thing registered before statuses existed has no status and no status index
+	legacyThing := IOTRegistryStore.Thing{}
+	proto.Unmarshal(state[thingKey("01")], &legacyThing)
+	legacyThing.Status = ""
+	legacyThingBytes, _ := proto.Marshal(&legacyThing)
+	stub.PutState(thingNamespace+":03", legacyThingBytes)
+	stub.PutState("Unknown:key", []byte{1})
+	stub.MockTransactionEnd("legacy")
+	if _, err := stub.MockQuery("thing", []string{"sensor:1"}); err == nil {
+		HandleError(t, fmt.Errorf("found a legacy thing before migrating"))
+	}
+
+	//the upgrade runs Init, which leaves a ledger with legacy keys unmarked
+	admin, _ := client.GeneratePrivateKeySigner()
+	checkInit(t, stub, []string{fmt.Sprintf(`{"AdminPubkey":"%s"}`, client.PubkeyHex(admin))})
+	err := registerThing(t, stub, []byte{2}, []string{"sensor:2"}, alicePub, "spec", "", alicePriv)
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, "KeyLayout", ""))
+
+	//only the admin migrates
+	alice, _ := client.NewPrivateKeySigner(alicePriv)
+	tx, _ := client.MigrateKeys(alice)
+	HandleError(t, checkErrorCode(invokeTX(stub, "migrateKeys", tx), client.CodeBadSignature, "", "Signature"))
+
+	tx, _ = client.MigrateKeys(admin)
+	args, _ := client.EncodeArgs(tx)
+	resultBytes, err := stub.MockInvoke("migrate", "migrateKeys", []string{args})
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	result := struct {
+		Migrated     int
+		Unrecognized []string
+	}{}
+	if err := json.Unmarshal(resultBytes, &result); err != nil || result.Migrated != 5 ||
+		len(result.Unrecognized) != 1 || result.Unrecognized[0] != "Unknown:key" {
+		HandleError(t, fmt.Errorf("unexpected migration result (%s): %v", resultBytes, err))
+	}
+	if _, err := stub.MockQuery("thing", []string{"sensor:1"}); err != nil {
+		HandleError(t, err)
+	}
+	if _, err := stub.MockQuery("owner", []string{alicePub}); err != nil {
+		HandleError(t, err)
+	}
+	if nonces, err := stub.MockQuery("thingsByStatus", []string{"manufactured"}); err != nil || string(nonces) != `["01","03"]` {
+		HandleError(t, fmt.Errorf("unexpected status index (%s): %v", nonces, err))
+	}
+
+	//a status change moves the migrated thing out of the manufactured index
+	defer setTestClock(1500000000)()
+	if err := setTestThingStatus(stub, []byte{3}, "provisioned", "", "", alicePriv); err != nil {
+		HandleError(t, err)
+	}
+	HandleError(t, checkThingsByStatus(stub, "manufactured", []string{"01"}))
+	HandleError(t, checkThingsByStatus(stub, "provisioned", []string{"03"}))
+
+	if err := registerThing(t, stub, []byte{2}, []string{"sensor:2"}, alicePub, "spec", "", alicePriv); err != nil {
+		HandleError(t, err)
+	}
+
+	HandleError(t, checkErrorCode(invokeTX(stub, "migrateKeys", tx), client.CodeFailedPrecondition, "KeyLayout", ""))
+}
+
+/*
+	marks the ledger of a test stub as Init marks a new ledger, so that tests which do not run Init can invoke.
+*/
+func markKeysMigrated(stub *testStub) *testStub {
+	stub.MockTransactionStart("init")
+	stub.PutState(compositeKey(keyLayoutNamespace), []byte(compositeKeyLayout))
+	stub.MockTransactionEnd("init")
+	return stub
+}
+
+func TestInitKeyLayout(t *testing.T) {
+	stub := newTestStub()
+	stub.MockTransactionStart("new")
+	stub.DelState(compositeKey(keyLayoutNamespace))
+	stub.MockTransactionEnd("new")
+	checkInit(t, stub, []string{})
+	if layout := string(stub.State[compositeKey(keyLayoutNamespace)]); layout != compositeKeyLayout {
+		HandleError(t, fmt.Errorf("Init did not mark a new ledger as migrated (%s)", layout))
+	}
+}
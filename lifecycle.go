@@ -0,0 +1,295 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	Things move through the lifecycle manufactured -> provisioned -> active <-> suspended -> retired.
+	Any status other than retired can also move straight to retired, and retired is final.
+	Things are registered as manufactured; things registered before statuses existed have an empty
+	status, which is treated as manufactured.
+	The current status of each thing is indexed by "ThingStatus:<Status>:<Nonce>" states. migrateKeys
+	indexes the things with an empty status as manufactured, so thingsByStatus lists them too.
+	Every status change signs and increments Thing.StatusSequence, and every grant or revocation of a status
+	delegate signs and increments StatusDelegate.Sequence, so that neither can be replayed later.
+*/
+const initialThingStatus = "manufactured"
+
+var thingStatusTransitions = map[string][]string{
+	"manufactured": {"provisioned", "retired"},
+	"provisioned":  {"active", "retired"},
+	"active":       {"suspended", "retired"},
+	"suspended":    {"active", "retired"},
+	"retired":      {},
+}
+
+func thingStatusKey(status string, nonce string) string {
+	return compositeKey(thingStatusNamespace, status, nonce)
+}
+
+func statusDelegateKey(registrantPubkey string, delegatePubkey string) string {
+	return compositeKey(statusDelegateNamespace, registrantPubkey, delegatePubkey)
+}
+
+/*
+	gets the "StatusDelegate:<RegistrantPubkey>:<DelegatePubkey>" state. Returns nil if the key has never
+	been a delegate of the registrant.
+*/
+func getStatusDelegate(stub Stub, registrantPubkey string, delegatePubkey string) (*IOTRegistryStore.StatusDelegate, error) {
+	key := statusDelegateKey(registrantPubkey, delegatePubkey)
+	delegateBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "Could not get StatusDelegate (%s) State", delegatePubkey)
+	}
+	if len(delegateBytes) == 0 {
+		return nil, nil
+	}
+	delegate := IOTRegistryStore.StatusDelegate{}
+	err = proto.Unmarshal(delegateBytes, &delegate)
+	if err != nil {
+		return nil, internalError(key, "Error unmarshalling StatusDelegate (%s): (%v)", delegatePubkey, err.Error())
+	}
+	return &delegate, nil
+}
+
+func thingStatusAllowed(from string, to string) bool {
+	if len(from) == 0 {
+		from = initialThingStatus
+	}
+	for _, next := range thingStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	setThingStatus moves a thing to a new lifecycle status, recording the reason and the transaction timestamp.
+	It is signed by the owner of the thing, or by a delegate of the owner named in SignerPubkey, over
+	"setThingStatus:<Nonce>:<StatusSequence>:<Status>:<Reason>" with the current StatusSequence of the thing.
+	TX struct: 		SetThingStatusTX
+	Store structs: 	Thing, "ThingStatus:<Status>:<Nonce>" index
+*/
+type setThingStatusHandler struct{ txType }
+
+func (setThingStatusHandler) validate(tx proto.Message) error {
+	statusArgs := tx.(*IOTRegistryTX.SetThingStatusTX)
+	if len(statusArgs.Nonce) == 0 {
+		return invalidArgument("Nonce", "length of Nonce is zero")
+	}
+	if len(statusArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", statusArgs.Signature)
+	}
+	if _, ok := thingStatusTransitions[statusArgs.Status]; !ok {
+		return invalidArgument("Status", "Status (%s) is not a valid status", statusArgs.Status)
+	}
+	if len(statusArgs.SignerPubkey) != 0 {
+		var err error
+		statusArgs.SignerPubkey, err = normalizePubkey("SignerPubkey", statusArgs.SignerPubkey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (setThingStatusHandler) authorize(stub Stub, tx proto.Message) error {
+	statusArgs := tx.(*IOTRegistryTX.SetThingStatusTX)
+	thing, err := getThing(stub, statusArgs.Nonce)
+	if err != nil {
+		return err
+	}
+	signerPubkey := thing.RegistrantPubkey
+	if len(statusArgs.SignerPubkey) != 0 && statusArgs.SignerPubkey != thing.RegistrantPubkey {
+		delegate, err := getStatusDelegate(stub, thing.RegistrantPubkey, statusArgs.SignerPubkey)
+		if err != nil {
+			return err
+		}
+		if delegate == nil || delegate.Revoked {
+			return unauthorized(statusDelegateKey(thing.RegistrantPubkey, statusArgs.SignerPubkey), "SignerPubkey (%s) is not a status delegate of (%s)", statusArgs.SignerPubkey, thing.RegistrantPubkey)
+		}
+		signerPubkey = statusArgs.SignerPubkey
+	}
+	signerPubKeyBytes, err := hex.DecodeString(signerPubkey)
+	if err != nil {
+		return invalidArgument("SignerPubkey", "Error decoding SignerPubkey: %s", err.Error())
+	}
+	return verify(stub, signerPubKeyBytes, statusArgs.Signature, client.SignedMessage(statusArgs, client.SetThingStatusMessage(statusArgs.Nonce, statusArgs.StatusSequence, statusArgs.Status, statusArgs.Reason)), "Signature")
+}
+
+func (setThingStatusHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	statusArgs := tx.(*IOTRegistryTX.SetThingStatusTX)
+	nonce := hex.EncodeToString(statusArgs.Nonce)
+	thing, err := getThing(stub, statusArgs.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if statusArgs.StatusSequence != thing.StatusSequence {
+		return nil, failedPrecondition(thingKey(nonce), "StatusSequence (%d) is not the current StatusSequence (%d) of Thing (%s)", statusArgs.StatusSequence, thing.StatusSequence, nonce)
+	}
+	if !thingStatusAllowed(thing.Status, statusArgs.Status) {
+		return nil, failedPrecondition(thingKey(nonce), "Thing (%s) cannot move from status (%s) to (%s)", nonce, thing.Status, statusArgs.Status)
+	}
+
+	timestamp, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	//a thing without a status is indexed as manufactured by migrateKeys
+	previousStatus := thing.Status
+	if len(previousStatus) == 0 {
+		previousStatus = initialThingStatus
+	}
+	err = stub.DelState(thingStatusKey(previousStatus, nonce))
+	if err != nil {
+		return nil, internalError(thingStatusKey(previousStatus, nonce), "Error deleting ThingStatus state :(%v)", err.Error())
+	}
+	thing.Status = statusArgs.Status
+	thing.StatusReason = statusArgs.Reason
+	thing.StatusTimestamp = timestamp
+	thing.StatusSequence++
+	err = putThing(stub, statusArgs.Nonce, thing)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(thingStatusKey(thing.Status, nonce), statusArgs.Nonce)
+	if err != nil {
+		return nil, internalError(thingStatusKey(thing.Status, nonce), "Error putting ThingStatus state :(%v)", err.Error())
+	}
+	return nil, nil
+}
+
+/*
+	setStatusDelegate allows (or, with Revoke, stops allowing) another key to set the status of all
+	things of a registrant. The registrant signs
+	"setStatusDelegate:<RegistrantPubkey>:<DelegatePubkey>:<Revoke>:<Sequence>" with the current Sequence
+	of the delegate, which is 0 for a key that has never been a delegate. A revoked delegate keeps its
+	state, so that its Sequence keeps counting.
+	TX struct: 		StatusDelegateTX
+	Store structs: 	StatusDelegate
+*/
+type statusDelegateHandler struct{ txType }
+
+func (statusDelegateHandler) validate(tx proto.Message) error {
+	delegateArgs := tx.(*IOTRegistryTX.StatusDelegateTX)
+	var err error
+	delegateArgs.RegistrantPubkey, err = normalizePubkey("RegistrantPubkey", delegateArgs.RegistrantPubkey)
+	if err != nil {
+		return err
+	}
+	delegateArgs.DelegatePubkey, err = normalizePubkey("DelegatePubkey", delegateArgs.DelegatePubkey)
+	if err != nil {
+		return err
+	}
+	if len(delegateArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", delegateArgs.Signature)
+	}
+	return nil
+}
+
+func (statusDelegateHandler) authorize(stub Stub, tx proto.Message) error {
+	delegateArgs := tx.(*IOTRegistryTX.StatusDelegateTX)
+	ownerPubKeyBytes, err := getRegistrantPubkey(stub, delegateArgs.RegistrantPubkey)
+	if err != nil {
+		return err
+	}
+	message := client.SignedMessage(delegateArgs, client.StatusDelegateMessage(delegateArgs.RegistrantPubkey, delegateArgs.DelegatePubkey, delegateArgs.Revoke, delegateArgs.Sequence))
+	return verify(stub, ownerPubKeyBytes, delegateArgs.Signature, message, "Signature")
+}
+
+func (statusDelegateHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	delegateArgs := tx.(*IOTRegistryTX.StatusDelegateTX)
+	key := statusDelegateKey(delegateArgs.RegistrantPubkey, delegateArgs.DelegatePubkey)
+	delegate, err := getStatusDelegate(stub, delegateArgs.RegistrantPubkey, delegateArgs.DelegatePubkey)
+	if err != nil {
+		return nil, err
+	}
+	if delegate == nil {
+		delegate = &IOTRegistryStore.StatusDelegate{DelegatePubkey: delegateArgs.DelegatePubkey}
+	}
+	if delegateArgs.Sequence != delegate.Sequence {
+		return nil, failedPrecondition(key, "Sequence (%d) is not the current Sequence (%d) of StatusDelegate (%s)", delegateArgs.Sequence, delegate.Sequence, delegateArgs.DelegatePubkey)
+	}
+	delegate.Sequence++
+	delegate.Revoked = delegateArgs.Revoke
+	delegateBytes, err := proto.Marshal(delegate)
+	if err != nil {
+		return nil, internalError(key, "error marshalling type IOTRegistry store :(%v)", err.Error())
+	}
+	err = stub.PutState(key, delegateBytes)
+	if err != nil {
+		return nil, internalError(key, "Error updating StatusDelegate state :(%v)", err.Error())
+	}
+	return nil, nil
+}
+
+/*
+	statusDelegate returns the state of a status delegate, whose Sequence the next setStatusDelegate
+	signs:
+	|		args {<RegistrantPubkey>, <DelegatePubkey>}
+	|		result {"DelegatePubkey":..,"Sequence":..,"Revoked":..}
+*/
+func queryStatusDelegate(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, invalidArgument("args", "expected a RegistrantPubkey and a DelegatePubkey")
+	}
+	registrantPubkey, err := normalizePubkey("args", args[0])
+	if err != nil {
+		return nil, err
+	}
+	delegatePubkey, err := normalizePubkey("args", args[1])
+	if err != nil {
+		return nil, err
+	}
+	delegate, err := getStatusDelegate(stub, registrantPubkey, delegatePubkey)
+	if err != nil {
+		return nil, err
+	}
+	if delegate == nil {
+		return nil, notFound(statusDelegateKey(registrantPubkey, delegatePubkey), "(%s) has never been a status delegate of (%s)", delegatePubkey, registrantPubkey)
+	}
+	return json.Marshal(struct {
+		DelegatePubkey string
+		Sequence       int64
+		Revoked        bool
+	}{delegate.DelegatePubkey, delegate.Sequence, delegate.Revoked})
+}
+
+/*
+	thingsByStatus returns the hex encoded nonces of the things with a status as JSON.
+*/
+func queryThingsByStatus(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, invalidArgument("args", "No argument specified")
+	}
+	if _, ok := thingStatusTransitions[args[0]]; !ok {
+		return nil, invalidArgument("args", "Status (%s) is not a valid status", args[0])
+	}
+	prefix := keyPrefix(thingStatusNamespace, args[0])
+	nonces := []string{}
+	err := rangeScan(stub, prefix, func(key string, value []byte) error {
+		nonces = append(nonces, lastKeyComponent(key))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(nonces)
+}
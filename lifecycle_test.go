@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	sets the mock clock used for transaction timestamps until the returned function is called
+*/
+func setTestClock(seconds int64) func() {
+	saved := txTimestamp
+	txTimestamp = func(stub Stub) (int64, error) {
+		return seconds, nil
+	}
+	return func() { txTimestamp = saved }
+}
+
+/*
+	sets the status of a thing by calling to Invoke(), signing its current StatusSequence. signerPubkey may
+	be empty to sign as the owner.
+*/
+func setTestThingStatus(stub *testStub, nonce []byte, status string, reason string, signerPubkey string, privateKeyString string) error {
+	return setTestThingStatusSequence(stub, nonce, getTestThing(stub, nonce).StatusSequence, status, reason, signerPubkey, privateKeyString)
+}
+
+func setTestThingStatusSequence(stub *testStub, nonce []byte, statusSequence int64, status string, reason string, signerPubkey string, privateKeyString string) error {
+	statusTX := IOTRegistryTX.SetThingStatusTX{Nonce: nonce, StatusSequence: statusSequence, Status: status, Reason: reason, SignerPubkey: signerPubkey}
+	signer, err := client.NewPrivateKeySigner(privateKeyString)
+	if err != nil {
+		return err
+	}
+	statusTX.Signature, err = signer.Sign(client.SignedMessage(&statusTX, client.SetThingStatusMessage(nonce, statusSequence, status, reason)))
+	if err != nil {
+		return err
+	}
+	statusBytes, err := proto.Marshal(&statusTX)
+	if err != nil {
+		return err
+	}
+	_, err = stub.MockInvoke("3", "setThingStatus", []string{hex.EncodeToString(statusBytes)})
+	return err
+}
+
+/*
+	grants or revokes a status delegate by calling to Invoke(), signing its current Sequence
+*/
+func setTestStatusDelegate(stub *testStub, registrantPubkey string, delegatePubkey string, revoke bool, privateKeyString string) error {
+	delegate := IOTRegistryStore.StatusDelegate{}
+	proto.Unmarshal(stub.State[statusDelegateKey(registrantPubkey, delegatePubkey)], &delegate)
+	return setTestStatusDelegateSequence(stub, registrantPubkey, delegatePubkey, delegate.Sequence, revoke, privateKeyString)
+}
+
+func setTestStatusDelegateSequence(stub *testStub, registrantPubkey string, delegatePubkey string, sequence int64, revoke bool, privateKeyString string) error {
+	delegateTX := IOTRegistryTX.StatusDelegateTX{RegistrantPubkey: registrantPubkey, DelegatePubkey: delegatePubkey, Revoke: revoke, Sequence: sequence}
+	signer, err := client.NewPrivateKeySigner(privateKeyString)
+	if err != nil {
+		return err
+	}
+	delegateTX.Signature, err = signer.Sign(client.SignedMessage(&delegateTX, client.StatusDelegateMessage(registrantPubkey, delegatePubkey, revoke, sequence)))
+	if err != nil {
+		return err
+	}
+	delegateBytes, err := proto.Marshal(&delegateTX)
+	if err != nil {
+		return err
+	}
+	_, err = stub.MockInvoke("3", "setStatusDelegate", []string{hex.EncodeToString(delegateBytes)})
+	return err
+}
+
+func checkThingsByStatus(stub *testStub, status string, expected []string) error {
+	bytes, err := stub.MockQuery("thingsByStatus", []string{status})
+	if err != nil {
+		return err
+	}
+	var nonces []string
+	if err := json.Unmarshal(bytes, &nonces); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(nonces, expected) {
+		return fmt.Errorf("things with status (%s) got (%v), expected (%v)", status, nonces, expected)
+	}
+	return nil
+}
+
+func TestThingStatus(t *testing.T) {
+	stub := newTestStub()
+	defer setTestClock(1500000000)()
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	bobPriv := "166cc93d9eadb573b329b5993b9671f1521679cea90fe52e398e66c1d6373abf"
+	bobPub := "02242a1c19bc831cd95a9e5492015043250cbc17d0eceb82612ce08736b8d753a6"
+
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	for _, nonce := range [][]byte{{0x01}, {0x02}} {
+		if err := registerThing(t, stub, nonce, []string{"alice" + hex.EncodeToString(nonce)}, alicePub, "", "", alicePriv); err != nil {
+			HandleError(t, err)
+			return
+		}
+	}
+	HandleError(t, checkThingsByStatus(stub, "manufactured", []string{"01", "02"}))
+
+	//transitions have to follow the lifecycle
+	if err := setTestThingStatus(stub, []byte{0x01}, "active", "", "", alicePriv); err == nil {
+		HandleError(t, fmt.Errorf("skipped the provisioned status"))
+	}
+	if err := setTestThingStatus(stub, []byte{0x01}, "broken", "", "", alicePriv); err == nil {
+		HandleError(t, fmt.Errorf("accepted an unknown status"))
+	}
+	for _, status := range []string{"provisioned", "active", "suspended", "active"} {
+		if err := setTestThingStatus(stub, []byte{0x01}, status, "field install", "", alicePriv); err != nil {
+			HandleError(t, err)
+		}
+	}
+	HandleError(t, checkThingsByStatus(stub, "manufactured", []string{"02"}))
+	HandleError(t, checkThingsByStatus(stub, "active", []string{"01"}))
+	HandleError(t, checkThingsByStatus(stub, "suspended", []string{}))
+
+	//a status change signed for an earlier StatusSequence cannot be replayed to undo a suspension
+	if err := setTestThingStatus(stub, []byte{0x01}, "suspended", "field install", "", alicePriv); err != nil {
+		HandleError(t, err)
+	}
+	err := setTestThingStatusSequence(stub, []byte{0x01}, 3, "active", "field install", "", alicePriv)
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(thingKey("01")), ""))
+	if err := setTestThingStatus(stub, []byte{0x01}, "active", "field install", "", alicePriv); err != nil {
+		HandleError(t, err)
+	}
+
+	bytes, err := stub.MockQuery("thing", []string{"alice01"})
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	var thing map[string]interface{}
+	json.Unmarshal(bytes, &thing)
+	if thing["Status"] != "active" || thing["StatusReason"] != "field install" || thing["StatusTimestamp"] != float64(1500000000) {
+		HandleError(t, fmt.Errorf("thing query returned status (%v) reason (%v) timestamp (%v)", thing["Status"], thing["StatusReason"], thing["StatusTimestamp"]))
+	}
+
+	//only the owner or a delegate can change the status
+	if err := setTestThingStatus(stub, []byte{0x02}, "retired", "", bobPub, bobPriv); err == nil {
+		HandleError(t, fmt.Errorf("a key that is not a delegate set the status"))
+	}
+	if err := setTestStatusDelegate(stub, alicePub, bobPub, false, alicePriv); err != nil {
+		HandleError(t, err)
+	}
+	if err := setTestThingStatus(stub, []byte{0x02}, "retired", "recalled", bobPub, bobPriv); err != nil {
+		HandleError(t, err)
+	}
+	if err := setTestThingStatus(stub, []byte{0x02}, "active", "", "", alicePriv); err == nil {
+		HandleError(t, fmt.Errorf("moved a thing out of retired"))
+	}
+	if err := setTestStatusDelegate(stub, alicePub, bobPub, true, alicePriv); err != nil {
+		HandleError(t, err)
+	}
+	if err := setTestThingStatus(stub, []byte{0x01}, "suspended", "", bobPub, bobPriv); err == nil {
+		HandleError(t, fmt.Errorf("a revoked delegate set the status"))
+	}
+	HandleError(t, checkThingsByStatus(stub, "retired", []string{"02"}))
+
+	//the grant signed before the revocation cannot be replayed
+	err = setTestStatusDelegateSequence(stub, alicePub, bobPub, 0, false, alicePriv)
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(statusDelegateKey(alicePub, bobPub)), ""))
+	if err := setTestThingStatus(stub, []byte{0x01}, "retired", "", bobPub, bobPriv); err == nil {
+		HandleError(t, fmt.Errorf("a revoked delegate retired a thing"))
+	}
+	bytes, err = stub.MockQuery("statusDelegate", []string{alicePub, bobPub})
+	if err != nil || string(bytes) != `{"DelegatePubkey":"`+bobPub+`","Sequence":2,"Revoked":true}` {
+		HandleError(t, fmt.Errorf("statusDelegate returned (%s): %v", bytes, err))
+	}
+
+}
@@ -0,0 +1,382 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	The owner of a spec issues signed update manifests for its devices (see client/manifest.go). Each
+	manifest is anchored, as signed, in a "Manifest:<SpecName>:<SequenceNumber in 20 digits>" state, so
+	that the manifests of a spec range in sequence order. The manifest query returns them to devices, and
+	validateManifest checks a manifest a device received against the registry and the device record.
+*/
+func manifestKey(specName string, sequenceNumber int64) string {
+	return compositeKey(manifestNamespace, specName, fmt.Sprintf("%020d", sequenceNumber))
+}
+
+/*
+	gets an issued manifest. Returns nil if the spec has no manifest with that sequence number.
+*/
+func getManifest(stub Stub, specName string, sequenceNumber int64) (*IOTRegistryStore.Manifest, error) {
+	key := manifestKey(specName, sequenceNumber)
+	manifestBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "Could not get Manifest (%s:%d) State", specName, sequenceNumber)
+	}
+	if len(manifestBytes) == 0 {
+		return nil, nil
+	}
+	manifest := IOTRegistryStore.Manifest{}
+	err = proto.Unmarshal(manifestBytes, &manifest)
+	if err != nil {
+		return nil, internalError(key, "Error unmarshalling Manifest (%s:%d): (%v)", specName, sequenceNumber, err.Error())
+	}
+	return &manifest, nil
+}
+
+/*
+	decodes a serialized UpdateManifest and checks its fields. field names the argument for errors.
+*/
+func decodeManifest(manifestBytes []byte, field string) (*IOTRegistryTX.UpdateManifest, error) {
+	manifest := &IOTRegistryTX.UpdateManifest{}
+	err := proto.Unmarshal(manifestBytes, manifest)
+	if err != nil {
+		return nil, invalidArgument(field, "Invalid manifest: %s", err.Error())
+	}
+	err = validateKeyComponent(field, manifest.SpecName)
+	if err != nil {
+		return nil, prefixError(err, "SpecName")
+	}
+	if manifest.SequenceNumber <= 0 {
+		return nil, invalidArgument(field, "SequenceNumber (%d) is not positive", manifest.SequenceNumber)
+	}
+	err = client.CheckContentHash(manifest.ImageDigest)
+	if err != nil {
+		return nil, invalidArgument(field, "ImageDigest: %s", err.Error())
+	}
+	if manifest.ImageSize < 0 {
+		return nil, invalidArgument(field, "ImageSize (%d) is negative", manifest.ImageSize)
+	}
+	if len(manifest.PayloadURI) != 0 {
+		uri, err := url.Parse(manifest.PayloadURI)
+		if err != nil || !uri.IsAbs() {
+			return nil, invalidArgument(field, "PayloadURI (%s) is not an absolute URI", manifest.PayloadURI)
+		}
+	}
+	if len(manifest.FirmwareVersion) != 0 {
+		err = validateKeyComponent(field, manifest.FirmwareVersion)
+		if err != nil {
+			return nil, prefixError(err, "FirmwareVersion")
+		}
+	}
+	things := make(map[string]bool)
+	for _, nonce := range manifest.Things {
+		if len(nonce) == 0 || things[string(nonce)] {
+			return nil, invalidArgument(field, "Things has an empty or repeated nonce (%s)", hex.EncodeToString(nonce))
+		}
+		things[string(nonce)] = true
+	}
+	for _, dependency := range manifest.Dependencies {
+		err = validateKeyComponent(field, dependency.SpecName)
+		if err != nil {
+			return nil, prefixError(err, "Dependencies")
+		}
+		if dependency.SpecName == manifest.SpecName || dependency.SequenceNumber <= 0 {
+			return nil, invalidArgument(field, "dependency (%s:%d) is not a manifest of another spec", dependency.SpecName, dependency.SequenceNumber)
+		}
+	}
+	for _, condition := range manifest.Conditions {
+		known := false
+		for _, conditionType := range client.ManifestConditionTypes {
+			known = known || condition.Type == conditionType
+		}
+		if !known || len(condition.Value) == 0 {
+			return nil, invalidArgument(field, "condition (%s:%s) is not one of %v with a value", condition.Type, condition.Value, client.ManifestConditionTypes)
+		}
+	}
+	return manifest, nil
+}
+
+/*
+	issueManifest anchors an update manifest signed by the owner of its spec. The sequence number must be
+	greater than that of every earlier manifest of the spec, the firmware release it names must be
+	published with the same image hash and must not be flagged vulnerable, the things it targets must have
+	its spec, and the manifests it depends on must have been issued. The validity window the manifest was
+	signed with is kept with it, as devices need it to verify the signature.
+	TX struct: 		IssueManifestTX
+	Store structs: 	Manifest
+*/
+type issueManifestHandler struct{ txType }
+
+func (issueManifestHandler) validate(tx proto.Message) error {
+	issueArgs := tx.(*IOTRegistryTX.IssueManifestTX)
+	if len(issueArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", issueArgs.Signature)
+	}
+	_, err := decodeManifest(issueArgs.Manifest, "Manifest")
+	return err
+}
+
+func (issueManifestHandler) authorize(stub Stub, tx proto.Message) error {
+	issueArgs := tx.(*IOTRegistryTX.IssueManifestTX)
+	manifest, _ := decodeManifest(issueArgs.Manifest, "Manifest")
+	return verifySpecOwner(stub, manifest.SpecName, issueArgs.Signature, client.SignedMessage(issueArgs, client.ManifestMessage(issueArgs.Manifest)))
+}
+
+func (issueManifestHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	issueArgs := tx.(*IOTRegistryTX.IssueManifestTX)
+	manifest, _ := decodeManifest(issueArgs.Manifest, "Manifest")
+	key := manifestKey(manifest.SpecName, manifest.SequenceNumber)
+	err := rangeScanFrom(stub, keyPrefix(manifestNamespace, manifest.SpecName), key, func(existing string, value []byte) error {
+		return failedPrecondition(key, "SequenceNumber (%d) is not greater than manifest (%s)", manifest.SequenceNumber, lastKeyComponent(existing))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.FirmwareVersion) != 0 {
+		release, err := getFirmwareRelease(stub, manifest.SpecName, manifest.FirmwareVersion)
+		if err != nil {
+			return nil, err
+		}
+		releaseKey := firmwareReleaseKey(manifest.SpecName, manifest.FirmwareVersion)
+		switch {
+		case release == nil:
+			return nil, notFound(releaseKey, "FirmwareRelease (%s:%s) is not published", manifest.SpecName, manifest.FirmwareVersion)
+		case release.ImageHash != manifest.ImageDigest:
+			return nil, failedPrecondition(releaseKey, "ImageDigest (%s) is not the image of FirmwareRelease (%s:%s)", manifest.ImageDigest, manifest.SpecName, manifest.FirmwareVersion)
+		case release.Vulnerable:
+			return nil, failedPrecondition(releaseKey, "FirmwareRelease (%s:%s) is flagged vulnerable", manifest.SpecName, manifest.FirmwareVersion)
+		}
+	}
+	for _, nonce := range manifest.Things {
+		thing, err := getThing(stub, nonce)
+		if err != nil {
+			return nil, err
+		}
+		if thing.SpecName != manifest.SpecName {
+			return nil, failedPrecondition(thingKey(hex.EncodeToString(nonce)), "Thing (%s) has spec (%s), not (%s)", hex.EncodeToString(nonce), thing.SpecName, manifest.SpecName)
+		}
+	}
+	for _, dependency := range manifest.Dependencies {
+		issued, err := getManifest(stub, dependency.SpecName, dependency.SequenceNumber)
+		if err != nil {
+			return nil, err
+		}
+		if issued == nil {
+			return nil, notFound(manifestKey(dependency.SpecName, dependency.SequenceNumber), "dependency (%s:%d) is not issued", dependency.SpecName, dependency.SequenceNumber)
+		}
+	}
+
+	spec, err := getSpec(stub, manifest.SpecName)
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	store := &IOTRegistryStore.Manifest{
+		SpecName:        manifest.SpecName,
+		SequenceNumber:  manifest.SequenceNumber,
+		Manifest:        issueArgs.Manifest,
+		Signature:       issueArgs.Signature,
+		SignerPubkey:    spec.RegistrantPubkey,
+		IssuedTimestamp: timestamp,
+		NotBefore:       issueArgs.NotBefore,
+		NotAfter:        issueArgs.NotAfter,
+	}
+	storeBytes, err := proto.Marshal(store)
+	if err != nil {
+		return nil, internalError(key, "error marshalling type IOTRegistry store :(%v)", err.Error())
+	}
+	err = stub.PutState(key, storeBytes)
+	if err != nil {
+		return nil, internalError(key, "Error putting Manifest state :(%v)", err.Error())
+	}
+	return nil, nil
+}
+
+/*
+	manifest returns the latest manifest of a spec, or the one with a sequence number, as issued and
+	decoded:
+	|		args {<SpecName>, [<SequenceNumber>]}
+	|		result {"SpecName","SequenceNumber","Manifest","Signature","SignerPubkey","IssuedTimestamp","NotBefore","NotAfter","UpdateManifest"}
+*/
+func queryManifest(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, invalidArgument("args", "expected a SpecName and an optional SequenceNumber")
+	}
+	err := validateKeyComponent("args", args[0])
+	if err != nil {
+		return nil, err
+	}
+	var manifest *IOTRegistryStore.Manifest
+	if len(args) == 2 {
+		sequenceNumber, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || sequenceNumber <= 0 {
+			return nil, invalidArgument("args", "Invalid SequenceNumber (%s)", args[1])
+		}
+		manifest, err = getManifest(stub, args[0], sequenceNumber)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err = rangeScan(stub, keyPrefix(manifestNamespace, args[0]), func(key string, value []byte) error {
+			manifest = &IOTRegistryStore.Manifest{}
+			err := proto.Unmarshal(value, manifest)
+			if err != nil {
+				return internalError(key, "Error unmarshalling Manifest: (%v)", err.Error())
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if manifest == nil {
+		return nil, notFound(keyPrefix(manifestNamespace, args[0]), "spec (%s) has no such manifest", args[0])
+	}
+	result := struct {
+		*IOTRegistryStore.Manifest
+		UpdateManifest *IOTRegistryTX.UpdateManifest
+	}{manifest, &IOTRegistryTX.UpdateManifest{}}
+	err = proto.Unmarshal(manifest.Manifest, result.UpdateManifest)
+	if err != nil {
+		return nil, internalError(manifestKey(manifest.SpecName, manifest.SequenceNumber), "Error unmarshalling UpdateManifest: (%v)", err.Error())
+	}
+	return json.Marshal(result)
+}
+
+/*
+	validateManifest checks a manifest a device received before it installs it:
+	|		args {<Manifest hex>, <Signature hex>, <Nonce hex of the device>, <current SequenceNumber of the device>}
+	|		result {"Valid":..,"Reason":..,"SpecName":..,"SequenceNumber":..}
+	The manifest is valid for the device if it was issued by the registry with that signature, its signer
+	still owns the spec, it targets the thing and is newer than the current sequence number, its firmware
+	release has not been flagged vulnerable since, and the thing meets its conditions.
+*/
+func queryValidateManifest(stub Stub, args []string) ([]byte, error) {
+	if len(args) != 4 {
+		return nil, invalidArgument("args", "expected a manifest, a signature, a nonce and a sequence number")
+	}
+	manifestBytes, err := hex.DecodeString(args[0])
+	if err != nil {
+		return nil, invalidArgument("args", "Invalid manifest expected hex")
+	}
+	manifest, err := decodeManifest(manifestBytes, "args")
+	if err != nil {
+		return nil, err
+	}
+	sig, err := hex.DecodeString(args[1])
+	if err != nil {
+		return nil, invalidArgument("args", "Invalid signature expected hex")
+	}
+	nonce, err := hex.DecodeString(args[2])
+	if err != nil {
+		return nil, invalidArgument("args", "Invalid nonce (%s) expected hex", args[2])
+	}
+	current, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil || current < 0 {
+		return nil, invalidArgument("args", "Invalid SequenceNumber (%s)", args[3])
+	}
+	thing, err := getThing(stub, nonce)
+	if err != nil {
+		return nil, err
+	}
+	result := struct {
+		Valid          bool
+		Reason         string `json:",omitempty"`
+		SpecName       string
+		SequenceNumber int64
+	}{SpecName: manifest.SpecName, SequenceNumber: manifest.SequenceNumber}
+	result.Reason, err = checkManifest(stub, manifest, manifestBytes, sig, thing, nonce, current)
+	if err != nil {
+		return nil, err
+	}
+	result.Valid = len(result.Reason) == 0
+	return json.Marshal(result)
+}
+
+/*
+	returns why a manifest is not valid for a thing, or "" if it is valid.
+*/
+func checkManifest(stub Stub, manifest *IOTRegistryTX.UpdateManifest, manifestBytes []byte, sig []byte,
+	thing *IOTRegistryStore.Thing, nonce []byte, current int64) (string, error) {
+
+	issued, err := getManifest(stub, manifest.SpecName, manifest.SequenceNumber)
+	if err != nil {
+		return "", err
+	}
+	if issued == nil {
+		return "manifest is not issued by the registry", nil
+	}
+	if !bytes.Equal(issued.Manifest, manifestBytes) {
+		return "manifest does not match the issued manifest", nil
+	}
+	spec, err := getSpec(stub, manifest.SpecName)
+	if err != nil {
+		return "", err
+	}
+	if spec.RegistrantPubkey != issued.SignerPubkey {
+		return "manifest signer no longer owns the spec", nil
+	}
+	signerPubKeyBytes, _ := hex.DecodeString(issued.SignerPubkey)
+	if verify(stub, signerPubKeyBytes, sig, client.SignedMessage(issued, client.ManifestMessage(manifestBytes)), "args") != nil {
+		return "manifest signature does not verify", nil
+	}
+	if thing.SpecName != manifest.SpecName {
+		return fmt.Sprintf("manifest is for spec (%s), the thing has spec (%s)", manifest.SpecName, thing.SpecName), nil
+	}
+	if thing.Status == "retired" {
+		return "thing is retired", nil
+	}
+	if len(manifest.Things) != 0 {
+		targeted := false
+		for _, target := range manifest.Things {
+			targeted = targeted || bytes.Equal(target, nonce)
+		}
+		if !targeted {
+			return "manifest does not target the thing", nil
+		}
+	}
+	if manifest.SequenceNumber <= current {
+		return fmt.Sprintf("manifest is not newer than sequence number (%d)", current), nil
+	}
+	if len(manifest.FirmwareVersion) != 0 {
+		release, err := getFirmwareRelease(stub, manifest.SpecName, manifest.FirmwareVersion)
+		if err != nil {
+			return "", err
+		}
+		if release != nil && release.Vulnerable {
+			return fmt.Sprintf("firmware release (%s) is flagged vulnerable: %s", release.Version, release.Advisory), nil
+		}
+	}
+	for _, condition := range manifest.Conditions {
+		switch {
+		case condition.Type == "firmwareVersion" && thing.FirmwareVersion != condition.Value:
+			return fmt.Sprintf("thing does not run firmware version (%s)", condition.Value), nil
+		case condition.Type == "status" && thing.Status != condition.Value:
+			return fmt.Sprintf("thing does not have status (%s)", condition.Value), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	checks the result of a validateManifest query. reason is a part of the expected Reason, or "" if the
+	manifest should be valid.
+*/
+func checkValidateManifest(stub *testStub, tx *IOTRegistryTX.IssueManifestTX, nonce byte, current int64, reason string) error {
+	args := []string{hex.EncodeToString(tx.Manifest), hex.EncodeToString(tx.Signature), hex.EncodeToString([]byte{nonce}), fmt.Sprint(current)}
+	bytes, err := stub.MockQuery("validateManifest", args)
+	if err != nil {
+		return err
+	}
+	result := struct {
+		Valid  bool
+		Reason string
+	}{}
+	err = json.Unmarshal(bytes, &result)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling json string %s", bytes)
+	}
+	if result.Valid != (reason == "") || !strings.Contains(result.Reason, reason) {
+		return fmt.Errorf("validateManifest of thing %d at %d returned (%s), expected (%s)", nonce, current, bytes, reason)
+	}
+	return nil
+}
+
+func TestManifests(t *testing.T) {
+	stub := newTestStub()
+	checkInit(t, stub, nil)
+	defer setTestClock(1500000000)()
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	bobPriv := "166cc93d9eadb573b329b5993b9671f1521679cea90fe52e398e66c1d6373abf"
+	bobPub := "02242a1c19bc831cd95a9e5492015043250cbc17d0eceb82612ce08736b8d753a6"
+	alice, _ := client.NewPrivateKeySigner(alicePriv)
+	bob, _ := client.NewPrivateKeySigner(bobPriv)
+
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := createRegistrant(t, stub, "Bob", "", bobPriv, bobPub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	for _, spec := range []struct{ name, pub, priv string }{{"sensor", alicePub, alicePriv}, {"radio", bobPub, bobPriv}} {
+		if err := registerSpec(t, stub, spec.name, spec.pub, "", spec.priv); err != nil {
+			HandleError(t, err)
+			return
+		}
+	}
+	for _, registration := range []struct {
+		nonce    byte
+		specName string
+	}{{1, "sensor"}, {2, "sensor"}, {3, "radio"}} {
+		tx, err := client.RegisterThing(alice, []byte{registration.nonce}, nil, nil, registration.specName, "")
+		if err == nil {
+			err = invokeTX(stub, "registerThing", tx)
+		}
+		if err != nil {
+			HandleError(t, err)
+			return
+		}
+	}
+	image := []byte("firmware image 1.0")
+	releaseTX, _ := client.PublishFirmware(alice, "sensor", "1.0", client.ContentHash(image), alicePub, nil)
+	if err := invokeTX(stub, "publishFirmware", releaseTX); err != nil {
+		HandleError(t, err)
+		return
+	}
+	radioTX, _ := client.IssueManifest(bob, &IOTRegistryTX.UpdateManifest{SpecName: "radio", SequenceNumber: 7, ImageDigest: client.ContentHash([]byte("radio"))})
+	if err := invokeTX(stub, "issueManifest", radioTX); err != nil {
+		HandleError(t, err)
+		return
+	}
+
+	manifest := &IOTRegistryTX.UpdateManifest{
+		SpecName:        "sensor",
+		SequenceNumber:  2,
+		Things:          [][]byte{{1}},
+		ImageDigest:     client.ContentHash(image),
+		ImageSize:       int64(len(image)),
+		PayloadURI:      "https://example.com/sensor-1.0.bin",
+		FirmwareVersion: "1.0",
+		Dependencies:    []*IOTRegistryTX.ManifestDependency{{SpecName: "radio", SequenceNumber: 7}},
+		Conditions:      []*IOTRegistryTX.ManifestCondition{{Type: "status", Value: "manufactured"}},
+	}
+	notAfter := time.Unix(1500003600, 0)
+	issue := func(signer client.Signer, change func(*IOTRegistryTX.UpdateManifest)) (*IOTRegistryTX.IssueManifestTX, error) {
+		changed := proto.Clone(manifest).(*IOTRegistryTX.UpdateManifest)
+		change(changed)
+		tx, _ := client.IssueManifest(signer, changed, client.ValidBetween(time.Time{}, notAfter))
+		return tx, invokeTX(stub, "issueManifest", tx)
+	}
+
+	//a manifest must be signed by the spec owner and refer to records of the registry
+	for _, rejected := range []struct {
+		signer client.Signer
+		change func(*IOTRegistryTX.UpdateManifest)
+		code   string
+		key    string
+		field  string
+	}{
+		{bob, func(*IOTRegistryTX.UpdateManifest) {}, client.CodeBadSignature, "", "Signature"},
+		{alice, func(m *IOTRegistryTX.UpdateManifest) { m.SequenceNumber = 0 }, client.CodeInvalidArgument, "", "Manifest"},
+		{alice, func(m *IOTRegistryTX.UpdateManifest) { m.ImageDigest = "md5:00" }, client.CodeInvalidArgument, "", "Manifest"},
+		{alice, func(m *IOTRegistryTX.UpdateManifest) { m.PayloadURI = "sensor.bin" }, client.CodeInvalidArgument, "", "Manifest"},
+		{alice, func(m *IOTRegistryTX.UpdateManifest) { m.Conditions[0].Type = "battery" }, client.CodeInvalidArgument, "", "Manifest"},
+		{alice, func(m *IOTRegistryTX.UpdateManifest) { m.SpecName = "unknown" }, client.CodeNotFound, displayKey(specKey("unknown")), ""},
+		{alice, func(m *IOTRegistryTX.UpdateManifest) { m.ImageDigest = client.ContentHash([]byte("other")) }, client.CodeFailedPrecondition, displayKey(firmwareReleaseKey("sensor", "1.0")), ""},
+		{alice, func(m *IOTRegistryTX.UpdateManifest) { m.FirmwareVersion = "9.9" }, client.CodeNotFound, displayKey(firmwareReleaseKey("sensor", "9.9")), ""},
+		{alice, func(m *IOTRegistryTX.UpdateManifest) { m.Things = [][]byte{{3}} }, client.CodeFailedPrecondition, displayKey(thingKey("03")), ""},
+		{alice, func(m *IOTRegistryTX.UpdateManifest) { m.Dependencies[0].SequenceNumber = 8 }, client.CodeNotFound, displayKey(manifestKey("radio", 8)), ""},
+	} {
+		_, err := issue(rejected.signer, rejected.change)
+		HandleError(t, checkErrorCode(err, rejected.code, rejected.key, rejected.field))
+	}
+	expiredTX, _ := client.IssueManifest(alice, manifest, client.ValidBetween(time.Time{}, time.Unix(1499990000, 0)))
+	HandleError(t, checkErrorCode(invokeTX(stub, "issueManifest", expiredTX), client.CodeFailedPrecondition, "", "NotAfter"))
+	tx, err := issue(alice, func(*IOTRegistryTX.UpdateManifest) {})
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	_, err = issue(alice, func(m *IOTRegistryTX.UpdateManifest) { m.SequenceNumber = 1 })
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(manifestKey("sensor", 1)), ""))
+	_, err = issue(alice, func(*IOTRegistryTX.UpdateManifest) {})
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(manifestKey("sensor", 2)), ""))
+
+	//devices retrieve the latest manifest and check it themselves
+	for _, args := range [][]string{{"sensor"}, {"sensor", "2"}} {
+		bytes, err := stub.MockQuery("manifest", args)
+		result := struct {
+			Manifest, Signature []byte
+			SignerPubkey        string
+			IssuedTimestamp     int64
+			NotBefore, NotAfter int64
+			UpdateManifest      IOTRegistryTX.UpdateManifest
+		}{}
+		if err == nil {
+			err = json.Unmarshal(bytes, &result)
+		}
+		pubKeyBytes, _ := hex.DecodeString(result.SignerPubkey)
+		if err == nil {
+			_, err = client.VerifyManifest(pubKeyBytes, result.Manifest, result.Signature, result.NotBefore, result.NotAfter)
+		}
+		if err == nil {
+			if _, unwindowed := client.VerifyManifest(pubKeyBytes, result.Manifest, result.Signature, 0, 0); unwindowed == nil {
+				err = fmt.Errorf("manifest verified without its validity window")
+			}
+		}
+		if err != nil || result.NotAfter != notAfter.Unix() || result.SignerPubkey != alicePub || result.IssuedTimestamp != 1500000000 || result.UpdateManifest.PayloadURI != manifest.PayloadURI {
+			HandleError(t, fmt.Errorf("manifest %v returned (%s): %v", args, bytes, err))
+		}
+	}
+	_, err = stub.MockQuery("manifest", []string{"sensor", "3"})
+	HandleError(t, checkErrorCode(err, client.CodeNotFound, displayKey(keyPrefix(manifestNamespace, "sensor")), ""))
+
+	//validateManifest checks the manifest against the registry and the device record
+	HandleError(t, checkValidateManifest(stub, tx, 1, 1, ""))
+	HandleError(t, checkValidateManifest(stub, tx, 1, 2, "not newer"))
+	HandleError(t, checkValidateManifest(stub, tx, 2, 1, "does not target"))
+	HandleError(t, checkValidateManifest(stub, tx, 3, 1, "spec (radio)"))
+	forged := proto.Clone(manifest).(*IOTRegistryTX.UpdateManifest)
+	forged.PayloadURI = "https://example.net/evil.bin"
+	forgedTX, _ := client.IssueManifest(alice, forged)
+	HandleError(t, checkValidateManifest(stub, forgedTX, 1, 1, "does not match"))
+	HandleError(t, checkValidateManifest(stub, &IOTRegistryTX.IssueManifestTX{Manifest: tx.Manifest, Signature: radioTX.Signature}, 1, 1, "signature"))
+	if err := setTestThingStatus(stub, []byte{1}, "provisioned", "", alicePub, alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+	HandleError(t, checkValidateManifest(stub, tx, 1, 1, "status (manufactured)"))
+	flagTX, _ := client.FlagFirmware(alice, "sensor", "1.0", "https://example.com/advisory")
+	if err := invokeTX(stub, "flagFirmware", flagTX); err != nil {
+		HandleError(t, err)
+		return
+	}
+	HandleError(t, checkValidateManifest(stub, tx, 1, 1, "flagged vulnerable"))
+}
@@ -0,0 +1,155 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+/*
+	Package merkleproof verifies inclusion and non-inclusion proofs of registry records against a state
+	root of the registry, without any chaincode or Fabric dependencies, so that constrained devices can
+	check a record given only a trusted root.
+
+	The registry commits to its records in a sparse Merkle tree of depth 256. A record with ledger key k
+	and value v is a leaf at the path sha256(k), following the bits of the path from the most significant
+	bit down, 0 to the left:
+	|		leaf		sha256(0x00 || path || sha256(v))
+	|		node		sha256(0x01 || left || right)
+	|		empty		32 zero bytes
+	A subtree holding a single leaf is represented by the leaf itself, so a leaf sits at the depth where
+	its path first differs from every other path, and a proof needs one sibling per level above it.
+*/
+package merkleproof
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+	// MaxDepth is the depth of the tree, the number of bits of a path.
+	MaxDepth = 8 * sha256.Size
+)
+
+// Empty is the hash of an empty subtree, and the root of an empty registry.
+var Empty = make([]byte, sha256.Size)
+
+/*
+	Leaf is the leaf a proof ends at. For a non-inclusion proof it is another record, whose path shares the
+	leading bits of the proven path down to the depth of the proof.
+*/
+type Leaf struct {
+	Path      []byte
+	ValueHash []byte
+}
+
+/*
+	Proof is the proof of a key: the leaf at the end of its path, if any, and the sibling hashes from the
+	root down to that leaf.
+*/
+type Proof struct {
+	Leaf     *Leaf `json:",omitempty"`
+	Siblings [][]byte
+}
+
+/*
+	returns the path of a ledger key.
+*/
+func Path(key string) []byte {
+	path := sha256.Sum256([]byte(key))
+	return path[:]
+}
+
+/*
+	returns the hash of a leaf.
+*/
+func LeafHash(path []byte, valueHash []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte{leafPrefix})
+	hash.Write(path)
+	hash.Write(valueHash)
+	return hash.Sum(nil)
+}
+
+/*
+	returns the hash of an inner node.
+*/
+func NodeHash(left []byte, right []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte{nodePrefix})
+	hash.Write(left)
+	hash.Write(right)
+	return hash.Sum(nil)
+}
+
+/*
+	returns the bit of a path at a depth, 0 for the most significant bit.
+*/
+func Bit(path []byte, depth int) int {
+	return int(path[depth/8]>>(7-uint(depth%8))) & 1
+}
+
+/*
+	verifies a proof for the record with ledger key against root. With a value it proves that the record
+	holds value; with a nil value it proves that the registry has no record with the key.
+*/
+func Verify(root []byte, key string, value []byte, proof *Proof) error {
+	if proof == nil {
+		return errors.New("proof is missing")
+	}
+	depth := len(proof.Siblings)
+	if depth > MaxDepth {
+		return fmt.Errorf("proof has %d siblings, more than %d", depth, MaxDepth)
+	}
+	for i, sibling := range proof.Siblings {
+		if len(sibling) != sha256.Size {
+			return fmt.Errorf("sibling %d is not %d bytes", i, sha256.Size)
+		}
+	}
+	path := Path(key)
+	leaf := proof.Leaf
+	if leaf != nil && (len(leaf.Path) != sha256.Size || len(leaf.ValueHash) != sha256.Size) {
+		return fmt.Errorf("leaf path and value hash must be %d bytes", sha256.Size)
+	}
+
+	current := Empty
+	switch {
+	case value != nil:
+		valueHash := sha256.Sum256(value)
+		if leaf == nil || !bytes.Equal(leaf.Path, path) {
+			return errors.New("proof does not end at the leaf of the key")
+		}
+		if !bytes.Equal(leaf.ValueHash, valueHash[:]) {
+			return errors.New("value does not match the leaf of the key")
+		}
+		current = LeafHash(path, valueHash[:])
+	case leaf != nil:
+		if bytes.Equal(leaf.Path, path) {
+			return errors.New("proof of non-inclusion ends at the leaf of the key")
+		}
+		for i := 0; i < depth; i++ {
+			if Bit(leaf.Path, i) != Bit(path, i) {
+				return errors.New("proof of non-inclusion ends at a leaf off the path of the key")
+			}
+		}
+		current = LeafHash(leaf.Path, leaf.ValueHash)
+	}
+
+	for i := depth - 1; i >= 0; i-- {
+		if Bit(path, i) == 0 {
+			current = NodeHash(current, proof.Siblings[i])
+		} else {
+			current = NodeHash(proof.Siblings[i], current)
+		}
+	}
+	if !bytes.Equal(current, root) {
+		return errors.New("proof does not lead to the root")
+	}
+	return nil
+}
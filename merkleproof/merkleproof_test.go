@@ -0,0 +1,98 @@
+package merkleproof
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+/*
+	finds two keys whose paths first differ at the given bit, the first one with a 0 there
+*/
+func keysDifferingAt(depth int) (string, string) {
+	for i := 0; ; i++ {
+		for j := 0; j < i; j++ {
+			a, b := Path(fmt.Sprint("key", i)), Path(fmt.Sprint("key", j))
+			first := 0
+			for first < MaxDepth && Bit(a, first) == Bit(b, first) {
+				first++
+			}
+			if first != depth {
+				continue
+			}
+			if Bit(a, depth) == 0 {
+				return fmt.Sprint("key", i), fmt.Sprint("key", j)
+			}
+			return fmt.Sprint("key", j), fmt.Sprint("key", i)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	left, right := keysDifferingAt(1)
+	leftValue, rightValue := []byte("left"), []byte("right")
+	leftHash, rightHash := sha256.Sum256(leftValue), sha256.Sum256(rightValue)
+	leftLeaf := &Leaf{Path(left), leftHash[:]}
+	rightLeaf := &Leaf{Path(right), rightHash[:]}
+
+	//two leaves below the child of the root on the side of their first bit
+	inner := NodeHash(LeafHash(leftLeaf.Path, leftLeaf.ValueHash), LeafHash(rightLeaf.Path, rightLeaf.ValueHash))
+	var root []byte
+	if Bit(leftLeaf.Path, 0) == 0 {
+		root = NodeHash(inner, Empty)
+	} else {
+		root = NodeHash(Empty, inner)
+	}
+
+	leftProof := &Proof{leftLeaf, [][]byte{Empty, LeafHash(rightLeaf.Path, rightLeaf.ValueHash)}}
+	if err := Verify(root, left, leftValue, leftProof); err != nil {
+		t.Error(err)
+	}
+	if err := Verify(root, left, rightValue, leftProof); err == nil {
+		t.Errorf("verified a wrong value")
+	}
+	if err := Verify(root, left, nil, leftProof); err == nil {
+		t.Errorf("verified the absence of an included key")
+	}
+	if err := Verify(root, right, rightValue, &Proof{rightLeaf, [][]byte{Empty, LeafHash(leftLeaf.Path, leftLeaf.ValueHash)}}); err != nil {
+		t.Error(err)
+	}
+	if err := Verify(bytes.Repeat([]byte{1}, 32), left, leftValue, leftProof); err == nil {
+		t.Errorf("verified against another root")
+	}
+	if err := Verify(root, left, leftValue, &Proof{leftLeaf, [][]byte{Empty, {1}}}); err == nil {
+		t.Errorf("verified with a short sibling")
+	}
+
+	//a key on the empty side of the root is absent
+	for i := 0; ; i++ {
+		key := fmt.Sprint("absent", i)
+		if Bit(Path(key), 0) == Bit(leftLeaf.Path, 0) {
+			continue
+		}
+		if err := Verify(root, key, nil, &Proof{nil, [][]byte{inner}}); err != nil {
+			t.Error(err)
+		}
+		if err := Verify(root, key, []byte("value"), &Proof{nil, [][]byte{inner}}); err == nil {
+			t.Errorf("verified an absent key with a value")
+		}
+		break
+	}
+
+	//a single leaf is the root, and proves the absence of other keys
+	single := LeafHash(leftLeaf.Path, leftLeaf.ValueHash)
+	if err := Verify(single, left, leftValue, &Proof{leftLeaf, nil}); err != nil {
+		t.Error(err)
+	}
+	if err := Verify(single, right, nil, &Proof{leftLeaf, nil}); err != nil {
+		t.Error(err)
+	}
+	if err := Verify(Empty, right, nil, &Proof{}); err != nil {
+		t.Error(err)
+	}
+	//the leaf of a non-inclusion proof must be on the path of the key
+	if err := Verify(root, right, nil, &Proof{leftLeaf, [][]byte{Empty, LeafHash(rightLeaf.Path, rightLeaf.ValueHash)}}); err == nil {
+		t.Errorf("verified absence with a leaf off the path")
+	}
+}
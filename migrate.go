@@ -0,0 +1,259 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	migrateKeys rewrites the states of the "<Namespace>:<component>:..." key layout into composite keys
+	(see keys.go). It should be run once, right after upgrading the chaincode, since the transactions
+	and queries of this version only read composite keys. Until it has run, every other Invoke fails with
+	FAILED_PRECONDITION on the "KeyLayout" key. It is signed by the admin key of the registry, and a second
+	run fails with FAILED_PRECONDITION.
+	Things registered before statuses existed get a "ThingStatus:manufactured:<Nonce>" index, which the
+	legacy layout did not write for them.
+	Legacy keys that do not parse are left in place and listed in the result:
+	|		{"Migrated":12,"Unrecognized":["Foo:bar"]}
+	TX struct: 		MigrateKeysTX
+	Store structs: 	every state, "KeyLayout" marker
+*/
+type migrateKeysHandler struct{ txType }
+
+const compositeKeyLayout = "composite"
+
+/*
+	splits the part of a legacy key after "<Namespace>:" into its components. Components that may contain
+	':' (aliases, spec and group names, typed alias values) are the ones the legacy layout left unsplit.
+*/
+var legacyKeyParsers = map[string]func(rest string) []string{
+	registrantNamespace: func(rest string) []string { return []string{rest} },
+	thingNamespace:      func(rest string) []string { return []string{rest} },
+	aliasNamespace:      func(rest string) []string { return []string{rest} },
+	specNamespace:       func(rest string) []string { return []string{rest} },
+	groupNamespace:      func(rest string) []string { return []string{rest} },
+	groupMemberNamespace: func(rest string) []string {
+		i := strings.LastIndex(rest, ":")
+		if i < 0 {
+			return nil
+		}
+		return []string{rest[:i], rest[i+1:]}
+	},
+	thingGroupNamespace:     func(rest string) []string { return strings.SplitN(rest, ":", 2) },
+	thingChildNamespace:     func(rest string) []string { return strings.SplitN(rest, ":", 2) },
+	thingStatusNamespace:    func(rest string) []string { return strings.SplitN(rest, ":", 2) },
+	statusDelegateNamespace: func(rest string) []string { return strings.SplitN(rest, ":", 2) },
+	typedAliasNamespace:     func(rest string) []string { return strings.SplitN(rest, ":", 3) },
+}
+
+var legacyKeyComponents = map[string]int{
+	groupMemberNamespace:    2,
+	thingGroupNamespace:     2,
+	thingChildNamespace:     2,
+	thingStatusNamespace:    2,
+	statusDelegateNamespace: 2,
+	typedAliasNamespace:     3,
+}
+
+/*
+	returns the composite key of a legacy key. ok is false if the key is not a legacy key.
+*/
+func migratedKey(legacyKey string) (key string, ok bool) {
+	i := strings.Index(legacyKey, ":")
+	if i < 0 {
+		return "", false
+	}
+	namespace := legacyKey[:i]
+	parse, known := legacyKeyParsers[namespace]
+	if !known {
+		return "", false
+	}
+	components := parse(legacyKey[i+1:])
+	expected, multi := legacyKeyComponents[namespace]
+	if !multi {
+		expected = 1
+	}
+	if len(components) != expected {
+		return "", false
+	}
+	for _, component := range components {
+		if validateKeyComponent("", component) != nil {
+			return "", false
+		}
+	}
+	return compositeKey(namespace, components...), true
+}
+
+/*
+	reports whether the KeyLayout marker is written, i.e. whether the ledger only has composite keys.
+*/
+func keysMigrated(stub Stub) (bool, error) {
+	layoutKey := compositeKey(keyLayoutNamespace)
+	layout, err := stub.GetState(layoutKey)
+	if err != nil {
+		return false, internalError(layoutKey, "Could not get KeyLayout State")
+	}
+	return string(layout) == compositeKeyLayout, nil
+}
+
+/*
+	fails with FAILED_PRECONDITION until migrateKeys has run.
+*/
+func checkKeysMigrated(stub Stub) error {
+	migrated, err := keysMigrated(stub)
+	if err != nil {
+		return err
+	}
+	if !migrated {
+		return failedPrecondition(compositeKey(keyLayoutNamespace), "the ledger has legacy keys, run migrateKeys first")
+	}
+	return nil
+}
+
+/*
+	called by Init: writes the KeyLayout marker if the ledger has no legacy keys, so that a new deployment
+	does not need migrateKeys. An upgraded ledger with legacy keys is left for migrateKeys.
+*/
+func initKeyLayout(stub Stub) error {
+	migrated, err := keysMigrated(stub)
+	if err != nil || migrated {
+		return err
+	}
+	legacy := false
+	err = rangeScan(stub, "", func(key string, value []byte) error {
+		if strings.HasPrefix(key, keyDelimiter) {
+			return nil
+		}
+		legacy = true
+		return errStopScan
+	})
+	if err != nil || legacy {
+		return err
+	}
+	layoutKey := compositeKey(keyLayoutNamespace)
+	err = stub.PutState(layoutKey, []byte(compositeKeyLayout))
+	if err != nil {
+		return internalError(layoutKey, "Error putting KeyLayout state :(%v)", err.Error())
+	}
+	return nil
+}
+
+func (migrateKeysHandler) validate(tx proto.Message) error {
+	migrateArgs := tx.(*IOTRegistryTX.MigrateKeysTX)
+	if len(migrateArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", migrateArgs.Signature)
+	}
+	return nil
+}
+
+func (migrateKeysHandler) authorize(stub Stub, tx proto.Message) error {
+	migrateArgs := tx.(*IOTRegistryTX.MigrateKeysTX)
+	return verifyAdmin(stub, migrateArgs.Signature, client.SignedMessage(migrateArgs, client.MigrateKeysMessage()), "Signature")
+}
+
+func (migrateKeysHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	layoutKey := compositeKey(keyLayoutNamespace)
+	migrated, err := keysMigrated(stub)
+	if err != nil {
+		return nil, err
+	}
+	if migrated {
+		return nil, failedPrecondition(layoutKey, "keys have already been migrated")
+	}
+
+	type migration struct {
+		from, to string
+		value    []byte
+	}
+	var migrations []migration
+	result := struct {
+		Migrated     int
+		Unrecognized []string
+	}{Unrecognized: []string{}}
+	//collect the legacy states first, since the stub may not allow writes while a range is open
+	err = rangeScan(stub, "", func(key string, value []byte) error {
+		if strings.HasPrefix(key, keyDelimiter) {
+			return nil
+		}
+		to, ok := migratedKey(key)
+		if !ok {
+			result.Unrecognized = append(result.Unrecognized, key)
+			return nil
+		}
+		migrations = append(migrations, migration{key, to, value})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range migrations {
+		existing, err := stub.GetState(m.to)
+		if err != nil {
+			return nil, internalError(m.to, "Could not get State")
+		}
+		if len(existing) != 0 {
+			return nil, alreadyExists(m.to, "legacy key (%s) conflicts with a state written after the upgrade", m.from)
+		}
+	}
+
+	for _, m := range migrations {
+		err = stub.PutState(m.to, m.value)
+		if err != nil {
+			return nil, internalError(m.to, "Error putting migrated state :(%v)", err.Error())
+		}
+		err = stub.DelState(m.from)
+		if err != nil {
+			return nil, internalError(m.from, "Error deleting legacy state :(%v)", err.Error())
+		}
+		err = indexLegacyThingStatus(stub, m.to, m.value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = stub.PutState(layoutKey, []byte(compositeKeyLayout))
+	if err != nil {
+		return nil, internalError(layoutKey, "Error putting KeyLayout state :(%v)", err.Error())
+	}
+	result.Migrated = len(migrations)
+	return json.Marshal(result)
+}
+
+/*
+	writes the status index of a migrated thing that has no status, as registerThing does for a new thing.
+	A thing that does not decode is left for checkConsistency.
+*/
+func indexLegacyThingStatus(stub Stub, key string, value []byte) error {
+	namespace, components, _ := splitCompositeKey(key)
+	if namespace != thingNamespace {
+		return nil
+	}
+	thing := IOTRegistryStore.Thing{}
+	if proto.Unmarshal(value, &thing) != nil || len(thing.Status) != 0 {
+		return nil
+	}
+	nonce, err := hex.DecodeString(components[0])
+	if err != nil {
+		return nil
+	}
+	statusKey := thingStatusKey(initialThingStatus, components[0])
+	err = stub.PutState(statusKey, nonce)
+	if err != nil {
+		return internalError(statusKey, "Error putting ThingStatus state :(%v)", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/hex"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	A thing may carry PrivateData: ciphertext that only its readers can decrypt, with the data key wrapped
+	for each reader (see client/private.go). The owner sets it at registration or with setPrivateData, and
+	grants or revokes readers with grantReader and revokeReader. The chaincode checks the structure of the
+	ciphertext and wrapped keys only; it never sees a data key or plaintext.
+	Revoking a reader removes its wrapped key, but a reader may have kept the data key, so the owner should
+	also rotate the data key with setPrivateData when the data itself must be protected from that reader.
+	The three transactions sign the current PrivateDataVersion of the thing, which each of them increments,
+	so that a signed change cannot be replayed, e.g. to restore a revoked reader or the data before a rotation.
+*/
+const (
+	maxPrivateDataSize    = 64 * 1024
+	maxPrivateDataReaders = 64
+)
+
+/*
+	checks the structure of private data and normalizes its reader pubkeys. Nil private data is valid.
+*/
+func validatePrivateData(privateData *IOTRegistryTX.EncryptedData) error {
+	if privateData == nil {
+		return nil
+	}
+	if len(privateData.Ciphertext) > maxPrivateDataSize {
+		return invalidArgument("PrivateData", "Ciphertext is %d bytes, more than %d", len(privateData.Ciphertext), maxPrivateDataSize)
+	}
+	if len(privateData.Readers) == 0 || len(privateData.Readers) > maxPrivateDataReaders {
+		return invalidArgument("PrivateData", "expected 1 to %d Readers, got %d", maxPrivateDataReaders, len(privateData.Readers))
+	}
+	readers := make(map[string]bool)
+	for i, reader := range privateData.Readers {
+		var err error
+		reader.ReaderPubkey, err = normalizePubkey("PrivateData", reader.ReaderPubkey)
+		if err != nil {
+			return prefixError(err, "reader %d", i)
+		}
+		if readers[reader.ReaderPubkey] {
+			return invalidArgument("PrivateData", "ReaderPubkey (%s) is repeated", reader.ReaderPubkey)
+		}
+		readers[reader.ReaderPubkey] = true
+	}
+	err := client.CheckPrivateData(privateData)
+	if err != nil {
+		return invalidArgument("PrivateData", "%s", err.Error())
+	}
+	return nil
+}
+
+/*
+	converts the private data of a transaction to its store type.
+*/
+func storedPrivateData(privateData *IOTRegistryTX.EncryptedData) *IOTRegistryStore.EncryptedData {
+	if privateData == nil {
+		return nil
+	}
+	stored := &IOTRegistryStore.EncryptedData{Algorithm: privateData.Algorithm, Ciphertext: privateData.Ciphertext}
+	for _, reader := range privateData.Readers {
+		stored.Readers = append(stored.Readers, &IOTRegistryStore.WrappedKey{ReaderPubkey: reader.ReaderPubkey, Key: reader.Key})
+	}
+	return stored
+}
+
+/*
+	fails unless privateDataVersion is the current PrivateDataVersion of the thing.
+*/
+func checkPrivateDataVersion(thing *IOTRegistryStore.Thing, nonce string, privateDataVersion int64) error {
+	if privateDataVersion != thing.PrivateDataVersion {
+		return failedPrecondition(thingKey(nonce), "PrivateDataVersion (%d) is not the current PrivateDataVersion (%d) of Thing (%s)", privateDataVersion, thing.PrivateDataVersion, nonce)
+	}
+	return nil
+}
+
+/*
+	setPrivateData replaces the private data of a thing, e.g. with ciphertext under a new data key after a
+	reader was revoked, or removes it when PrivateData is empty. It is signed by the owner of the thing.
+	TX struct: 		SetPrivateDataTX
+	Store structs: 	Thing
+*/
+type setPrivateDataHandler struct{ txType }
+
+func (setPrivateDataHandler) validate(tx proto.Message) error {
+	privateArgs := tx.(*IOTRegistryTX.SetPrivateDataTX)
+	if len(privateArgs.Nonce) == 0 {
+		return invalidArgument("Nonce", "length of Nonce is zero")
+	}
+	if len(privateArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", privateArgs.Signature)
+	}
+	return validatePrivateData(privateArgs.PrivateData)
+}
+
+func (setPrivateDataHandler) authorize(stub Stub, tx proto.Message) error {
+	privateArgs := tx.(*IOTRegistryTX.SetPrivateDataTX)
+	thing, err := getThing(stub, privateArgs.Nonce)
+	if err != nil {
+		return err
+	}
+	message := client.SignedMessage(privateArgs, client.SetPrivateDataMessage(privateArgs.Nonce, privateArgs.PrivateDataVersion, privateArgs.PrivateData))
+	return verifyThingOwner(stub, thing, privateArgs.Signature, message, "Signature")
+}
+
+func (setPrivateDataHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	privateArgs := tx.(*IOTRegistryTX.SetPrivateDataTX)
+	thing, err := getThing(stub, privateArgs.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	err = checkPrivateDataVersion(thing, hex.EncodeToString(privateArgs.Nonce), privateArgs.PrivateDataVersion)
+	if err != nil {
+		return nil, err
+	}
+	thing.PrivateData = storedPrivateData(privateArgs.PrivateData)
+	thing.PrivateDataVersion++
+	return nil, putThing(stub, privateArgs.Nonce, thing)
+}
+
+/*
+	grantReader adds a reader to the private data of a thing with the data key wrapped for it, and
+	revokeReader removes the wrapped key of a reader. Both are signed by the owner of the thing. The last
+	reader cannot be revoked, since no one could read the private data after it; setPrivateData replaces
+	the readers instead.
+	TX struct: 		PrivateDataReaderTX
+	Store structs: 	Thing
+*/
+type privateDataReaderHandler struct {
+	txType
+	function string
+}
+
+func (h privateDataReaderHandler) validate(tx proto.Message) error {
+	readerArgs := tx.(*IOTRegistryTX.PrivateDataReaderTX)
+	if len(readerArgs.Nonce) == 0 {
+		return invalidArgument("Nonce", "length of Nonce is zero")
+	}
+	if len(readerArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", readerArgs.Signature)
+	}
+	if readerArgs.Reader == nil {
+		return invalidArgument("Reader", "Reader is missing")
+	}
+	var err error
+	readerArgs.Reader.ReaderPubkey, err = normalizePubkey("Reader", readerArgs.Reader.ReaderPubkey)
+	if err != nil {
+		return err
+	}
+	if h.function == "revokeReader" {
+		if len(readerArgs.Reader.Key) != 0 {
+			return invalidArgument("Reader", "a revoked Reader has no Key")
+		}
+		return nil
+	}
+	err = client.CheckWrappedKey(readerArgs.Reader.Key)
+	if err != nil {
+		return invalidArgument("Reader", "%s", err.Error())
+	}
+	return nil
+}
+
+func (h privateDataReaderHandler) authorize(stub Stub, tx proto.Message) error {
+	readerArgs := tx.(*IOTRegistryTX.PrivateDataReaderTX)
+	thing, err := getThing(stub, readerArgs.Nonce)
+	if err != nil {
+		return err
+	}
+	message := client.SignedMessage(readerArgs, client.PrivateDataReaderMessage(h.function, readerArgs.Nonce, readerArgs.PrivateDataVersion, readerArgs.Reader))
+	return verifyThingOwner(stub, thing, readerArgs.Signature, message, "Signature")
+}
+
+func (h privateDataReaderHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	readerArgs := tx.(*IOTRegistryTX.PrivateDataReaderTX)
+	nonce := hex.EncodeToString(readerArgs.Nonce)
+	thing, err := getThing(stub, readerArgs.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if thing.PrivateData == nil {
+		return nil, failedPrecondition(thingKey(nonce), "Thing (%s) has no PrivateData", nonce)
+	}
+	err = checkPrivateDataVersion(thing, nonce, readerArgs.PrivateDataVersion)
+	if err != nil {
+		return nil, err
+	}
+	readers := thing.PrivateData.Readers
+	index := -1
+	for i, reader := range readers {
+		if reader.ReaderPubkey == readerArgs.Reader.ReaderPubkey {
+			index = i
+		}
+	}
+	if h.function == "revokeReader" {
+		if index < 0 {
+			return nil, notFound(thingKey(nonce), "(%s) is not a reader of Thing (%s)", readerArgs.Reader.ReaderPubkey, nonce)
+		}
+		if len(readers) == 1 {
+			return nil, failedPrecondition(thingKey(nonce), "(%s) is the last reader of Thing (%s)", readerArgs.Reader.ReaderPubkey, nonce)
+		}
+		thing.PrivateData.Readers = append(readers[:index], readers[index+1:]...)
+	} else {
+		if index >= 0 {
+			return nil, alreadyExists(thingKey(nonce), "(%s) is already a reader of Thing (%s)", readerArgs.Reader.ReaderPubkey, nonce)
+		}
+		if len(readers) >= maxPrivateDataReaders {
+			return nil, failedPrecondition(thingKey(nonce), "Thing (%s) already has %d readers", nonce, maxPrivateDataReaders)
+		}
+		thing.PrivateData.Readers = append(readers, &IOTRegistryStore.WrappedKey{ReaderPubkey: readerArgs.Reader.ReaderPubkey, Key: readerArgs.Reader.Key})
+	}
+	thing.PrivateDataVersion++
+	return nil, putThing(stub, readerArgs.Nonce, thing)
+}
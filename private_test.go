@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	returns the private data of a thing from the thing query
+*/
+func queryPrivateData(stub *testStub, alias string) (*IOTRegistryTX.EncryptedData, error) {
+	thingBytes, err := stub.MockQuery("thing", []string{alias})
+	if err != nil {
+		return nil, err
+	}
+	thing := struct{ PrivateData *IOTRegistryTX.EncryptedData }{}
+	err = json.Unmarshal(thingBytes, &thing)
+	if err != nil || thing.PrivateData == nil {
+		return nil, fmt.Errorf("thing (%s) has no private data: %v", alias, err)
+	}
+	return thing.PrivateData, nil
+}
+
+func TestPrivateData(t *testing.T) {
+	stub := newTestStub()
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	bobPriv := "166cc93d9eadb573b329b5993b9671f1521679cea90fe52e398e66c1d6373abf"
+	carolPriv := "3e4a1c0e1bfc4c0f2a6d1b7e8c9f0a1b2c3d4e5f60718293a4b5c6d7e8f90a1b"
+	alice, _ := client.NewPrivateKeySigner(alicePriv)
+	bob, _ := client.NewPrivateKeySigner(bobPriv)
+	carol, err := client.NewPrivateKeySigner(carolPriv)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, client.PubkeyHex(alice)); err != nil {
+		HandleError(t, err)
+		return
+	}
+	invoke := func(function string, tx proto.Message, err error) error {
+		if err != nil {
+			return err
+		}
+		args, err := client.EncodeArgs(tx)
+		if err != nil {
+			return err
+		}
+		_, err = stub.MockInvoke("2", function, []string{args})
+		return err
+	}
+	nonce := []byte{1}
+	plaintext := []byte(`{"InstallAddress":"1 Main St","CustomerID":"c-42"}`)
+	privateData, dataKey, err := client.EncryptPrivateData(plaintext, []string{client.PubkeyHex(alice), client.PubkeyHex(bob)})
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	thing, err := client.RegisterThing(alice, nonce, []string{"meter"}, nil, "", "", client.WithPrivateData(privateData))
+	HandleError(t, invoke("registerThing", thing, err))
+
+	stored, err := queryPrivateData(stub, "meter")
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	decrypted, err := client.DecryptPrivateData(stored, bobPriv)
+	if err != nil || !bytes.Equal(decrypted, plaintext) {
+		HandleError(t, fmt.Errorf("reader could not decrypt the private data (%s): %v", decrypted, err))
+	}
+	if _, err := client.DecryptPrivateData(stored, carolPriv); err == nil {
+		HandleError(t, fmt.Errorf("a key that is not a reader decrypted the private data"))
+	}
+
+	grantTX, err := client.GrantReader(alice, nonce, 0, dataKey, client.PubkeyHex(carol))
+	HandleError(t, invoke("grantReader", grantTX, err))
+	tx, err := client.GrantReader(alice, nonce, 1, dataKey, client.PubkeyHex(carol))
+	HandleError(t, checkErrorCode(invoke("grantReader", tx, err), client.CodeAlreadyExists, displayKey(thingKey("01")), ""))
+	tx, err = client.RevokeReader(alice, nonce, 1, client.PubkeyHex(bob))
+	HandleError(t, invoke("revokeReader", tx, err))
+	tx, err = client.RevokeReader(alice, nonce, 2, client.PubkeyHex(bob))
+	HandleError(t, checkErrorCode(invoke("revokeReader", tx, err), client.CodeNotFound, displayKey(thingKey("01")), ""))
+
+	stored, err = queryPrivateData(stub, "meter")
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	if decrypted, err := client.DecryptPrivateData(stored, carolPriv); err != nil || !bytes.Equal(decrypted, plaintext) {
+		HandleError(t, fmt.Errorf("granted reader could not decrypt the private data: %v", err))
+	}
+	if _, err := client.DecryptPrivateData(stored, bobPriv); err == nil {
+		HandleError(t, fmt.Errorf("revoked reader still has a wrapped key"))
+	}
+
+	//only the owner grants readers, and wrapped keys must be well formed
+	tx, err = client.GrantReader(bob, nonce, 2, dataKey, client.PubkeyHex(bob))
+	HandleError(t, checkErrorCode(invoke("grantReader", tx, err), client.CodeBadSignature, "", "Signature"))
+	malformed := &IOTRegistryTX.PrivateDataReaderTX{Nonce: nonce, Reader: &IOTRegistryTX.WrappedKey{ReaderPubkey: client.PubkeyHex(bob), Key: make([]byte, 166)}, PrivateDataVersion: 2}
+	malformed.Signature, err = alice.Sign(client.PrivateDataReaderMessage("grantReader", nonce, 2, malformed.Reader))
+	HandleError(t, checkErrorCode(invoke("grantReader", malformed, err), client.CodeInvalidArgument, "", "Reader"))
+
+	//rotating the data key replaces the private data
+	rotated, _, err := client.EncryptPrivateData(plaintext, []string{client.PubkeyHex(alice)})
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	setTX, err := client.SetPrivateData(alice, nonce, 2, rotated)
+	HandleError(t, invoke("setPrivateData", setTX, err))
+	stored, err = queryPrivateData(stub, "meter")
+	if err != nil {
+		HandleError(t, err)
+	} else if len(stored.Readers) != 1 || !bytes.Equal(stored.Ciphertext, rotated.Ciphertext) {
+		HandleError(t, fmt.Errorf("private data was not replaced: %v", stored))
+	}
+
+	//signed changes of an earlier PrivateDataVersion cannot be replayed, e.g. to restore a reader
+	HandleError(t, checkErrorCode(invoke("grantReader", grantTX, nil), client.CodeFailedPrecondition, displayKey(thingKey("01")), ""))
+	HandleError(t, checkErrorCode(invoke("setPrivateData", setTX, nil), client.CodeFailedPrecondition, displayKey(thingKey("01")), ""))
+	if thing := getTestThing(stub, nonce); thing == nil || thing.PrivateDataVersion != 3 {
+		HandleError(t, fmt.Errorf("unexpected PrivateDataVersion of Thing (01): %v", thing))
+	}
+
+	//the last reader cannot be revoked
+	tx, err = client.RevokeReader(alice, nonce, 3, client.PubkeyHex(alice))
+	HandleError(t, checkErrorCode(invoke("revokeReader", tx, err), client.CodeFailedPrecondition, displayKey(thingKey("01")), ""))
+	if stored, err := queryPrivateData(stub, "meter"); err != nil || len(stored.Readers) != 1 {
+		HandleError(t, fmt.Errorf("revoking the last reader changed the private data: %v", err))
+	}
+
+	rotated.Ciphertext = rotated.Ciphertext[:10]
+	setTX, err = client.SetPrivateData(alice, nonce, 3, rotated)
+	HandleError(t, checkErrorCode(invoke("setPrivateData", setTX, err), client.CodeInvalidArgument, "", "PrivateData"))
+}
@@ -0,0 +1,28 @@
+#!/bin/sh
+# Builds and tests the Fabric 1.x adapter (fabric1.go, fabric1_test.go) in a separate GOPATH.
+#
+# The vendor tree of this repository holds the Fabric 0.6 shim, which has the same import path as the
+# Fabric 1.x shim, so the fabric1 build cannot use it. This script copies the repository into its own
+# GOPATH without vendor/github.com/hyperledger, checks out Fabric next to it (the shim and protos/peer
+# find their own dependencies in Fabric's vendor tree) and runs the tests with -tags fabric1.
+#
+#	FABRIC_VERSION	Fabric tag to test against (default v1.4.12)
+#	FABRIC1_GOPATH	GOPATH to use, kept between runs so that Fabric is only cloned once (default a temporary directory)
+set -e
+
+FABRIC_VERSION=${FABRIC_VERSION:-v1.4.12}
+FABRIC1_GOPATH=${FABRIC1_GOPATH:-$(mktemp -d)}
+repo=$(cd "$(dirname "$0")/.." && pwd)
+dest=$FABRIC1_GOPATH/src/github.com/Trusted-IoT-Alliance/IOTRegistry
+fabric=$FABRIC1_GOPATH/src/github.com/hyperledger/fabric
+
+if [ ! -d "$fabric" ]; then
+	git clone --quiet --depth 1 --branch "$FABRIC_VERSION" https://github.com/hyperledger/fabric "$fabric"
+fi
+rm -rf "$dest"
+mkdir -p "$dest"
+(cd "$repo" && tar cf - --exclude ./.git --exclude ./vendor/github.com/hyperledger .) | (cd "$dest" && tar xf -)
+
+cd "$dest"
+GOPATH=$FABRIC1_GOPATH GO111MODULE=off go vet -tags fabric1 .
+GOPATH=$FABRIC1_GOPATH GO111MODULE=off go test -tags fabric1 "$@" .
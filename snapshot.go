@@ -0,0 +1,347 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/merkleproof"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	Snapshots copy the records of a registry to another deployment (see client/snapshot.go). The
+	exportSnapshot query pages through the namespaces below, in their order, so that registrants and specs
+	come before the things that refer to them and things before their aliases and indexes. The config, the
+	key layout and the state tree are not exported: the importing registry has its own config, and its tree
+	is updated by the records it imports. importSnapshot writes the records of a page, signed by the
+	AdminPubkey of the config, and skips records the ledger already holds, so a page can be imported again.
+	It keeps the Checksum of the last imported page in a "SnapshotImport" state, and only takes the page
+	that chains to it, a first page, which starts the chain over, or the last imported page itself, which
+	a client may send again after a timeout.
+*/
+var snapshotNamespaces = []struct {
+	namespace  string
+	components int
+	record     func() proto.Message
+}{
+	{registrantNamespace, 1, func() proto.Message { return &IOTRegistryStore.Registrant{} }},
+	{specNamespace, 1, func() proto.Message { return &IOTRegistryStore.Spec{} }},
+	{firmwareReleaseNamespace, 2, func() proto.Message { return &IOTRegistryStore.FirmwareRelease{} }},
+	{thingNamespace, 1, func() proto.Message { return &IOTRegistryStore.Thing{} }},
+	{aliasNamespace, 1, func() proto.Message { return &IOTRegistryStore.Alias{} }},
+	{typedAliasNamespace, 3, func() proto.Message { return &IOTRegistryStore.Alias{} }},
+	{thingChildNamespace, 2, nil},
+	{thingStatusNamespace, 2, nil},
+	{groupNamespace, 1, func() proto.Message { return &IOTRegistryStore.Group{} }},
+	{groupMemberNamespace, 2, nil},
+	{groupVersionNamespace, 1, nil},
+	{thingGroupNamespace, 2, nil},
+	{statusDelegateNamespace, 2, nil},
+	{thingFirmwareNamespace, 3, nil},
+	{firmwareHistoryNamespace, 2, func() proto.Message { return &IOTRegistryStore.FirmwareReport{} }},
+	{manifestNamespace, 2, func() proto.Message { return &IOTRegistryStore.Manifest{} }},
+	{credentialNamespace, 2, func() proto.Message { return &IOTRegistryStore.Credential{} }},
+}
+
+const (
+	defaultSnapshotPageSize = 100
+	maxSnapshotPageSize     = 1000
+)
+
+/*
+	exportSnapshot returns a page of the snapshot of the registry as a client.SnapshotPage:
+	|		args {[<PageToken>], [<PageSize>]}
+	The first page is exported without a token, or with an empty one, and every further page with the
+	NextPageToken of the page before it, "<hex of the last key exported>:<Checksum>". PageSize defaults
+	to 100 records and is at most 1000.
+*/
+func queryExportSnapshot(stub Stub, args []string) ([]byte, error) {
+	if len(args) > 2 {
+		return nil, invalidArgument("args", "expected at most a page token and a page size")
+	}
+	pageSize := defaultSnapshotPageSize
+	if len(args) == 2 {
+		size, err := strconv.Atoi(args[1])
+		if err != nil || size < 1 || size > maxSnapshotPageSize {
+			return nil, invalidArgument("args", "page size (%s) must be a number from 1 to %d", args[1], maxSnapshotPageSize)
+		}
+		pageSize = size
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	root, err := newStateTree(stub).load(0, merkleproof.Empty)
+	if err != nil {
+		return nil, err
+	}
+	page := &client.SnapshotPage{
+		Version:      client.SnapshotVersion,
+		BlindAliases: config.BlindAliases,
+		AliasSalt:    config.AliasSalt,
+		StateRoot:    root.nodeHash(),
+		Records:      []client.SnapshotRecord{},
+	}
+
+	first, start := 0, ""
+	if len(args) > 0 && len(args[0]) != 0 {
+		var lastKey string
+		lastKey, page.PrevChecksum, err = parseSnapshotPageToken(args[0])
+		if err != nil {
+			return nil, err
+		}
+		namespace, _, _ := splitCompositeKey(lastKey)
+		for first < len(snapshotNamespaces) && snapshotNamespaces[first].namespace != namespace {
+			first++
+		}
+		if first == len(snapshotNamespaces) {
+			return nil, invalidArgument("args", "page token does not name a snapshot record")
+		}
+		start = lastKey + keyDelimiter
+	}
+
+	//one record more than the page holds tells whether there is a next page
+	var lastKey string
+	more := false
+	for _, exported := range snapshotNamespaces[first:] {
+		prefix := keyPrefix(exported.namespace)
+		if !strings.HasPrefix(start, prefix) {
+			start = prefix
+		}
+		err = rangeScanFrom(stub, prefix, start, func(key string, value []byte) error {
+			if len(page.Records) == pageSize {
+				more = true
+				return errStopScan
+			}
+			_, components, _ := splitCompositeKey(key)
+			page.Records = append(page.Records, client.SnapshotRecord{Namespace: exported.namespace, Components: components, Value: value})
+			lastKey = key
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if more {
+			break
+		}
+	}
+	page.Checksum = client.SnapshotChecksum(page.PrevChecksum, page.Records)
+	if more {
+		page.NextPageToken = hex.EncodeToString([]byte(lastKey)) + ":" + page.Checksum
+	}
+	return json.Marshal(page)
+}
+
+func parseSnapshotPageToken(token string) (lastKey string, checksum string, err error) {
+	parts := strings.Split(token, ":")
+	if len(parts) != 2 || len(parts[1]) != 2*sha256.Size {
+		return "", "", invalidArgument("args", "invalid page token (%s)", token)
+	}
+	keyBytes, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return "", "", invalidArgument("args", "invalid page token (%s)", token)
+	}
+	return string(keyBytes), parts[1], nil
+}
+
+func snapshotImportKey() string {
+	return compositeKey(snapshotImportNamespace)
+}
+
+/*
+	decodes a snapshot page and checks its checksum, and the namespace, components and value of each of
+	its records.
+*/
+func decodeSnapshotPage(pageBytes []byte) (*client.SnapshotPage, error) {
+	page := &client.SnapshotPage{}
+	decoder := json.NewDecoder(bytes.NewReader(pageBytes))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(page)
+	if err != nil {
+		return nil, invalidArgument("Page", "Invalid snapshot page: %s", err.Error())
+	}
+	err = client.CheckSnapshotPage(page)
+	if err != nil {
+		return nil, invalidArgument("Page", "%s", err.Error())
+	}
+	for i, record := range page.Records {
+		known := false
+		for _, imported := range snapshotNamespaces {
+			if imported.namespace != record.Namespace {
+				continue
+			}
+			known = true
+			if len(record.Components) != imported.components {
+				return nil, invalidArgument("Page", "record %d has %d components, %s keys have %d", i, len(record.Components), record.Namespace, imported.components)
+			}
+			if len(record.Value) == 0 {
+				return nil, invalidArgument("Page", "record %d has no value", i)
+			}
+			if imported.record != nil {
+				err = proto.Unmarshal(record.Value, imported.record())
+				if err != nil {
+					return nil, invalidArgument("Page", "record %d is not a %s record: (%v)", i, record.Namespace, err.Error())
+				}
+			}
+		}
+		if !known {
+			return nil, invalidArgument("Page", "record %d has namespace (%s), which snapshots do not hold", i, record.Namespace)
+		}
+		for _, component := range record.Components {
+			err = validateKeyComponent("Page", component)
+			if err != nil {
+				return nil, prefixError(err, "record %d", i)
+			}
+		}
+	}
+	return page, nil
+}
+
+/*
+	importSnapshot imports a page of a snapshot exported by exportSnapshot. It is signed by the AdminPubkey
+	of the config, and fails on a registry without one. The alias blinding of the page must match the
+	config. A record the ledger already holds is skipped, and one that differs from the ledger fails the
+	page. The PrevChecksum of the page must be the Checksum of the last imported page, or empty for the
+	first page of an export, so the pages of a snapshot are imported in order, without gaps and from a
+	single export. The last imported page may be sent again, and leaves all of its records unchanged. Things must also refer to registrants, and aliases to things, that exist in the ledger
+	or come earlier in the page.
+	TX struct: 		ImportSnapshotTX
+	Store structs: 	the records of the page
+*/
+type importSnapshotHandler struct{ txType }
+
+func (importSnapshotHandler) validate(tx proto.Message) error {
+	importArgs := tx.(*IOTRegistryTX.ImportSnapshotTX)
+	if len(importArgs.Signature) == 0 {
+		return invalidArgument("Signature", "length of Signature (%s) is zero", importArgs.Signature)
+	}
+	_, err := decodeSnapshotPage(importArgs.Page)
+	return err
+}
+
+func (importSnapshotHandler) authorize(stub Stub, tx proto.Message) error {
+	importArgs := tx.(*IOTRegistryTX.ImportSnapshotTX)
+	message := client.SignedMessage(importArgs, client.ImportSnapshotMessage(importArgs.Page))
+	return verifyAdmin(stub, importArgs.Signature, message, "Signature")
+}
+
+func (importSnapshotHandler) apply(stub Stub, tx proto.Message) ([]byte, error) {
+	importArgs := tx.(*IOTRegistryTX.ImportSnapshotTX)
+	page, _ := decodeSnapshotPage(importArgs.Page)
+	config, err := getConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	if page.BlindAliases != config.BlindAliases || page.AliasSalt != config.AliasSalt {
+		return nil, failedPrecondition(configKey(), "the alias blinding of the snapshot does not match the config")
+	}
+	importKey := snapshotImportKey()
+	lastChecksum, err := stub.GetState(importKey)
+	if err != nil {
+		return nil, internalError(importKey, "Could not get SnapshotImport State")
+	}
+	result := struct {
+		Written   int
+		Unchanged int
+	}{}
+	//the page imported last is imported again, by a retry, without changes
+	if len(lastChecksum) != 0 && page.Checksum == string(lastChecksum) {
+		result.Unchanged = len(page.Records)
+		return json.Marshal(result)
+	}
+	if len(page.PrevChecksum) != 0 && page.PrevChecksum != string(lastChecksum) {
+		return nil, failedPrecondition(importKey, "PrevChecksum (%s) of the page is not the Checksum (%s) of the last imported page", page.PrevChecksum, lastChecksum)
+	}
+
+	type write struct {
+		key   string
+		value []byte
+	}
+	var writes []write
+	pending := make(map[string][]byte)
+	exists := func(key string) (bool, error) {
+		if _, ok := pending[key]; ok {
+			return true, nil
+		}
+		value, err := stub.GetState(key)
+		if err != nil {
+			return false, internalError(key, "Could not get State")
+		}
+		return len(value) != 0, nil
+	}
+	for i, record := range page.Records {
+		key := compositeKey(record.Namespace, record.Components...)
+		existing, ok := pending[key]
+		if !ok {
+			existing, err = stub.GetState(key)
+			if err != nil {
+				return nil, internalError(key, "Could not get State")
+			}
+		}
+		if len(existing) != 0 {
+			if !bytes.Equal(existing, record.Value) {
+				return nil, alreadyExists(key, "snapshot record differs from the ledger")
+			}
+			result.Unchanged++
+			continue
+		}
+
+		var dependency, dependent string
+		switch record.Namespace {
+		case thingNamespace:
+			thing := IOTRegistryStore.Thing{}
+			err = proto.Unmarshal(record.Value, &thing)
+			if err != nil {
+				return nil, invalidArgument("Page", "record %d is not a %s record: (%v)", i, record.Namespace, err.Error())
+			}
+			dependency, dependent = registrantKey(thing.RegistrantPubkey), "Registrant"
+		case aliasNamespace, typedAliasNamespace:
+			alias := IOTRegistryStore.Alias{}
+			err = proto.Unmarshal(record.Value, &alias)
+			if err != nil {
+				return nil, invalidArgument("Page", "record %d is not a %s record: (%v)", i, record.Namespace, err.Error())
+			}
+			dependency, dependent = thingKey(hex.EncodeToString(alias.Nonce)), "Thing"
+		}
+		if len(dependency) != 0 {
+			ok, err := exists(dependency)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, failedPrecondition(key, "%s (%s) of the snapshot record does not exist", dependent, displayKey(dependency))
+			}
+		}
+		pending[key] = record.Value
+		writes = append(writes, write{key, record.Value})
+	}
+
+	for _, w := range writes {
+		err = stub.PutState(w.key, w.value)
+		if err != nil {
+			return nil, internalError(w.key, "Error putting snapshot state :(%v)", err.Error())
+		}
+	}
+	err = stub.PutState(importKey, []byte(page.Checksum))
+	if err != nil {
+		return nil, internalError(importKey, "Error putting SnapshotImport state :(%v)", err.Error())
+	}
+	result.Written = len(writes)
+	return json.Marshal(result)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	exports every page of the snapshot of a registry, checking that the pages form a checksum chain.
+*/
+func exportSnapshot(stub *testStub, pageSize string) ([][]byte, error) {
+	var pages [][]byte
+	token, prevChecksum := "", ""
+	for {
+		pageBytes, err := stub.MockQuery("exportSnapshot", []string{token, pageSize})
+		if err != nil {
+			return nil, err
+		}
+		page := client.SnapshotPage{}
+		err = json.Unmarshal(pageBytes, &page)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshalling json string %s", pageBytes)
+		}
+		if page.PrevChecksum != prevChecksum || client.CheckSnapshotPage(&page) != nil {
+			return nil, fmt.Errorf("page %d does not continue the checksum chain: %s", len(pages), pageBytes)
+		}
+		pages = append(pages, pageBytes)
+		if len(page.NextPageToken) == 0 {
+			return pages, nil
+		}
+		token, prevChecksum = page.NextPageToken, page.Checksum
+	}
+}
+
+/*
+	imports a snapshot page signed by signer and returns the Written and Unchanged counts.
+*/
+func importSnapshotPage(stub *testStub, signer client.Signer, page []byte) (written int, unchanged int, err error) {
+	tx, err := client.ImportSnapshot(signer, page)
+	if err != nil {
+		return 0, 0, err
+	}
+	args, err := client.EncodeArgs(tx)
+	if err != nil {
+		return 0, 0, err
+	}
+	bytes, err := stub.MockInvoke("2", "importSnapshot", []string{args})
+	if err != nil {
+		return 0, 0, err
+	}
+	result := struct{ Written, Unchanged int }{}
+	err = json.Unmarshal(bytes, &result)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error unmarshalling json string %s", bytes)
+	}
+	return result.Written, result.Unchanged, nil
+}
+
+func TestSnapshot(t *testing.T) {
+	source := newTestStub()
+	checkInit(t, source, nil)
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	bobPriv := "166cc93d9eadb573b329b5993b9671f1521679cea90fe52e398e66c1d6373abf"
+	bobPub := "02242a1c19bc831cd95a9e5492015043250cbc17d0eceb82612ce08736b8d753a6"
+	admin, err := client.GeneratePrivateKeySigner()
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	adminConfig := fmt.Sprintf(`{"AdminPubkey":"%s"}`, client.PubkeyHex(admin))
+
+	if err := createRegistrant(t, source, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := createRegistrant(t, source, "Bob", "", bobPriv, bobPub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := registerSpec(t, source, "spec A", alicePub, "", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+	typed := []*IOTRegistryTX.TypedAlias{{Type: "mac", Value: "00:11:22:33:44:55"}, {Type: "serial", Value: "SN1", Scoped: true}}
+	if err := registerTypedThing(t, source, []byte{1}, []string{"a1"}, typed, alicePub, "spec A", "", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+	if err := registerThing(t, source, []byte{2}, []string{"b1", "b2"}, bobPub, "spec B", "", bobPriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+	records := 0
+	for key := range source.State {
+		namespace, _, _ := splitCompositeKey(key)
+		for _, exported := range snapshotNamespaces {
+			if namespace == exported.namespace {
+				records++
+			}
+		}
+	}
+
+	pages, err := exportSnapshot(source, "3")
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	if len(pages) != (records+2)/3 {
+		HandleError(t, fmt.Errorf("exported %d records in %d pages", records, len(pages)))
+	}
+
+	//pages are imported in the order of their chain
+	target := newTestStub()
+	checkInit(t, target, []string{adminConfig})
+	_, _, err = importSnapshotPage(target, admin, pages[1])
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(snapshotImportKey()), ""))
+
+	//the records of a page must not refer to records of later pages
+	unchained := client.SnapshotPage{}
+	json.Unmarshal(pages[1], &unchained)
+	unchained.PrevChecksum = ""
+	unchained.Checksum = client.SnapshotChecksum("", unchained.Records)
+	unchainedBytes, _ := json.Marshal(unchained)
+	_, _, err = importSnapshotPage(target, admin, unchainedBytes)
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(thingKey("01")), ""))
+
+	total := 0
+	for i, page := range pages {
+		written, _, err := importSnapshotPage(target, admin, page)
+		if err != nil {
+			HandleError(t, err)
+			return
+		}
+		total += written
+		if i == 1 {
+			//the page imported last can be sent again, as after a timeout
+			written, unchanged, err := importSnapshotPage(target, admin, page)
+			if err != nil || written != 0 || unchanged == 0 {
+				HandleError(t, fmt.Errorf("retried page wrote %d, left %d unchanged: %v", written, unchanged, err))
+			}
+		}
+		if i == 0 && len(pages) > 2 {
+			//a page that skips one does not chain
+			_, _, err = importSnapshotPage(target, admin, pages[2])
+			HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(snapshotImportKey()), ""))
+		}
+	}
+	if total != records {
+		HandleError(t, fmt.Errorf("imported %d of %d records", total, records))
+	}
+	sourceRoot, _ := source.MockQuery("stateRoot", nil)
+	targetRoot, _ := target.MockQuery("stateRoot", nil)
+	if string(sourceRoot) != string(targetRoot) {
+		HandleError(t, fmt.Errorf("imported registry has root (%s), expected (%s)", targetRoot, sourceRoot))
+	}
+	if specName, err := queryThingSpec(target, "mac:00:11:22:33:44:55"); err != nil || specName != "spec A" {
+		HandleError(t, fmt.Errorf("imported thing returned spec (%s): %v", specName, err))
+	}
+
+	//a page can be imported again
+	for _, page := range pages {
+		written, unchanged, err := importSnapshotPage(target, admin, page)
+		if err != nil || written != 0 || unchanged == 0 {
+			HandleError(t, fmt.Errorf("reimport wrote %d, left %d unchanged: %v", written, unchanged, err))
+		}
+	}
+
+	//a record that differs from the ledger fails the page
+	conflicting := client.SnapshotPage{}
+	json.Unmarshal(pages[0], &conflicting)
+	conflicting.Records[0].Value, _ = proto.Marshal(&IOTRegistryStore.Registrant{RegistrantName: "Mallory"})
+	conflicting.Checksum = client.SnapshotChecksum(conflicting.PrevChecksum, conflicting.Records)
+	conflictingBytes, _ := json.Marshal(conflicting)
+	_, _, err = importSnapshotPage(target, admin, conflictingBytes)
+	HandleError(t, checkErrorCode(err, client.CodeAlreadyExists, conflicting.Records[0].Namespace+":"+strings.Join(conflicting.Records[0].Components, ":"), ""))
+
+	//as does a page whose records do not match its checksum
+	conflicting.Checksum = strings.Repeat("0", 64)
+	conflictingBytes, _ = json.Marshal(conflicting)
+	_, _, err = importSnapshotPage(target, admin, conflictingBytes)
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "Page"))
+
+	//imports are signed by the admin, and a registry without one takes none
+	bob, _ := client.NewPrivateKeySigner(bobPriv)
+	_, _, err = importSnapshotPage(target, bob, pages[0])
+	HandleError(t, checkErrorCode(err, client.CodeBadSignature, "", "Signature"))
+	_, _, err = importSnapshotPage(source, admin, pages[0])
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(configKey()), ""))
+
+	//the alias blinding of the snapshot must match the registry
+	blinded := newTestStub()
+	checkInit(t, blinded, []string{fmt.Sprintf(`{"AdminPubkey":"%s","BlindAliases":true,"AliasSalt":"00112233445566778899aabbccddeeff"}`, client.PubkeyHex(admin))})
+	_, _, err = importSnapshotPage(blinded, admin, pages[0])
+	HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, displayKey(configKey()), ""))
+
+	for _, args := range [][]string{{"", "0"}, {"", "1001"}, {"nothex:" + strings.Repeat("0", 64)}, {"00:00"}} {
+		_, err := source.MockQuery("exportSnapshot", args)
+		HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "args"))
+	}
+}
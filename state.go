@@ -0,0 +1,136 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryStore"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	gets the "Thing:<Nonce>" state and unmarshalls it. Returns an error if the thing does not exist.
+*/
+func getThing(stub Stub, nonce []byte) (*IOTRegistryStore.Thing, error) {
+	key := thingKey(hex.EncodeToString(nonce))
+	thingBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "Could not get Thing (%s) State", hex.EncodeToString(nonce))
+	}
+	if len(thingBytes) == 0 {
+		return nil, notFound(key, "Thing (%s) does not exist", hex.EncodeToString(nonce))
+	}
+	thing := IOTRegistryStore.Thing{}
+	err = proto.Unmarshal(thingBytes, &thing)
+	if err != nil {
+		return nil, internalError(key, "Error unmarshalling Thing (%s): (%v)", hex.EncodeToString(nonce), err.Error())
+	}
+	return &thing, nil
+}
+
+/*
+	marshalls a thing and puts it to the "Thing:<Nonce>" state.
+*/
+func putThing(stub Stub, nonce []byte, thing *IOTRegistryStore.Thing) error {
+	key := thingKey(hex.EncodeToString(nonce))
+	thingBytes, err := proto.Marshal(thing)
+	if err != nil {
+		return internalError(key, "error marshalling type IOTRegistry store :(%v)", err.Error())
+	}
+	err = stub.PutState(key, thingBytes)
+	if err != nil {
+		return internalError(key, "Error putting thing state :(%v)", err.Error())
+	}
+	return nil
+}
+
+/*
+	gets the "Spec:<SpecName>" state and unmarshalls it. Returns an error if the spec does not exist.
+*/
+func getSpec(stub Stub, specName string) (*IOTRegistryStore.Spec, error) {
+	key := specKey(specName)
+	specBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "Could not get Spec (%s) State", specName)
+	}
+	if len(specBytes) == 0 {
+		return nil, notFound(key, "Spec (%s) does not exist", specName)
+	}
+	spec := IOTRegistryStore.Spec{}
+	err = proto.Unmarshal(specBytes, &spec)
+	if err != nil {
+		return nil, internalError(key, "Error unmarshalling Spec (%s): (%v)", specName, err.Error())
+	}
+	return &spec, nil
+}
+
+/*
+	verifies a signature made by the registrant owning a thing. field names the signature field for errors.
+*/
+func verifyThingOwner(stub Stub, thing *IOTRegistryStore.Thing, sig []byte, message string, field string) error {
+	ownerPubKeyBytes, err := hex.DecodeString(thing.RegistrantPubkey)
+	if err != nil {
+		return internalError("", "Error decoding registrantPubkey: %s", err.Error())
+	}
+	return verify(stub, ownerPubKeyBytes, sig, message, field)
+}
+
+/*
+	calls fn for every state whose key starts with prefix, in key order.
+	The range is filtered on the prefix as well, since not every stub honours the range bounds.
+*/
+func rangeScan(stub Stub, prefix string, fn func(key string, value []byte) error) error {
+	return rangeScanFrom(stub, prefix, prefix, fn)
+}
+
+/*
+	errStopScan is returned by the fn of a range scan to end the scan early, without an error.
+*/
+var errStopScan = errors.New("stop scan")
+
+/*
+	calls fn for every state whose key starts with prefix and is not before start, in key order, e.g. to
+	resume a paged scan.
+*/
+func rangeScanFrom(stub Stub, prefix string, start string, fn func(key string, value []byte) error) error {
+	iter, err := stub.RangeQueryState(start, prefix+"\xff")
+	if err != nil {
+		return internalError(prefix, "Could not query range (%s): (%v)", prefix, err.Error())
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		key, value, err := iter.Next()
+		if err != nil {
+			return internalError(prefix, "Could not query range (%s): (%v)", prefix, err.Error())
+		}
+		if !strings.HasPrefix(key, prefix) || key < start {
+			continue
+		}
+		err = fn(key, value)
+		if err == errStopScan {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+	returns the timestamp of the current transaction in seconds since the epoch.
+	It is a variable so that tests can set the clock, since the mock stub does not implement GetTxTimestamp.
+*/
+var txTimestamp = func(stub Stub) (int64, error) {
+	return stub.TxTimestamp()
+}
@@ -0,0 +1,430 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/merkleproof"
+)
+
+/*
+	The registry commits to its records (registrants, things, aliases, typed aliases and specs) in a sparse
+	Merkle tree, see the merkleproof package for its layout. Each node of the tree is kept in a state
+	|		"StateTreeNode:<Depth>:<Path hex, masked to Depth bits>"
+	holding 0x00 || path || value hash for a leaf, or 0x01 || hash for an inner node; empty subtrees have
+	no state. Invoke records the writes of a transaction to committed namespaces, updates the tree after
+	the transaction applied, and stores the new root in a "StateRoot:<TxID>" state. Init builds the tree
+	from the existing records when a ledger written before the tree has none.
+	Every update rewrites the root node, so on Fabric 1.x two transactions of a block that both write
+	committed records conflict on it (MVCC_READ_CONFLICT), and the second is invalidated and must be
+	resubmitted. This keeps a root for every transaction, which a proof can name, at the cost of
+	serializing those writes.
+	The proof query proves a record, or its absence, against the current root, and the stateRoot query
+	returns the root after a transaction.
+*/
+var stateTreeNamespaces = []string{registrantNamespace, thingNamespace, aliasNamespace, typedAliasNamespace, specNamespace}
+
+const (
+	stateTreeLeaf  = 0x00
+	stateTreeInner = 0x01
+)
+
+func stateTreeNodeKey(depth int, path []byte) string {
+	masked := make([]byte, len(path))
+	for i := 0; i < depth; i++ {
+		if merkleproof.Bit(path, i) == 1 {
+			masked[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return compositeKey(stateTreeNodeNamespace, strconv.Itoa(depth), hex.EncodeToString(masked))
+}
+
+func stateRootKey(txID string) string {
+	return compositeKey(stateRootNamespace, txID)
+}
+
+/*
+	reports whether a ledger key holds a record committed to by the state tree.
+*/
+func isStateTreeKey(key string) bool {
+	namespace, _, ok := splitCompositeKey(key)
+	if !ok {
+		return false
+	}
+	for _, committed := range stateTreeNamespaces {
+		if namespace == committed {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	A stateTreeNode is a leaf, with a path and value hash, or an inner node with its hash. A nil node is an
+	empty subtree.
+*/
+type stateTreeNode struct {
+	path      []byte
+	valueHash []byte
+	hash      []byte
+}
+
+func (n *stateTreeNode) isLeaf() bool {
+	return n != nil && n.path != nil
+}
+
+func (n *stateTreeNode) nodeHash() []byte {
+	switch {
+	case n == nil:
+		return merkleproof.Empty
+	case n.isLeaf():
+		return merkleproof.LeafHash(n.path, n.valueHash)
+	}
+	return n.hash
+}
+
+/*
+	stateTree reads and updates the nodes of the tree. Updated nodes are kept in nodes until flush, since a
+	Fabric 1.x stub does not read back the writes of the running transaction.
+*/
+type stateTree struct {
+	stub  Stub
+	nodes map[string]*stateTreeNode
+}
+
+func newStateTree(stub Stub) *stateTree {
+	return &stateTree{stub, make(map[string]*stateTreeNode)}
+}
+
+func (t *stateTree) load(depth int, path []byte) (*stateTreeNode, error) {
+	key := stateTreeNodeKey(depth, path)
+	if node, ok := t.nodes[key]; ok {
+		return node, nil
+	}
+	nodeBytes, err := t.stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "Could not get StateTreeNode State")
+	}
+	switch {
+	case len(nodeBytes) == 0:
+		return nil, nil
+	case len(nodeBytes) == 1+2*sha256.Size && nodeBytes[0] == stateTreeLeaf:
+		return &stateTreeNode{path: nodeBytes[1 : 1+sha256.Size], valueHash: nodeBytes[1+sha256.Size:]}, nil
+	case len(nodeBytes) == 1+sha256.Size && nodeBytes[0] == stateTreeInner:
+		return &stateTreeNode{hash: nodeBytes[1:]}, nil
+	}
+	return nil, internalError(key, "StateTreeNode is malformed")
+}
+
+func (t *stateTree) store(depth int, path []byte, node *stateTreeNode) {
+	t.nodes[stateTreeNodeKey(depth, path)] = node
+}
+
+/*
+	sets the leaf at path to valueHash, or removes it if valueHash is nil, in the subtree at depth, and
+	returns the new root node of that subtree. A subtree left with a single leaf collapses into the leaf.
+*/
+func (t *stateTree) set(depth int, path []byte, valueHash []byte) (*stateTreeNode, error) {
+	node, err := t.load(depth, path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case node == nil || (node.isLeaf() && bytes.Equal(node.path, path)):
+		if valueHash == nil {
+			return nil, nil
+		}
+		return &stateTreeNode{path: path, valueHash: valueHash}, nil
+	case node.isLeaf():
+		if valueHash == nil {
+			return node, nil
+		}
+		//push the other leaf down a level, and insert below it
+		t.store(depth+1, node.path, node)
+	}
+
+	child, err := t.set(depth+1, path, valueHash)
+	if err != nil {
+		return nil, err
+	}
+	t.store(depth+1, path, child)
+	siblingPath := append([]byte{}, path...)
+	siblingPath[depth/8] ^= 0x80 >> uint(depth%8)
+	sibling, err := t.load(depth+1, siblingPath)
+	if err != nil {
+		return nil, err
+	}
+	if child == nil && (sibling == nil || sibling.isLeaf()) {
+		t.store(depth+1, siblingPath, nil)
+		return sibling, nil
+	}
+	if sibling == nil && child.isLeaf() {
+		t.store(depth+1, path, nil)
+		return child, nil
+	}
+	if merkleproof.Bit(path, depth) == 0 {
+		return &stateTreeNode{hash: merkleproof.NodeHash(child.nodeHash(), sibling.nodeHash())}, nil
+	}
+	return &stateTreeNode{hash: merkleproof.NodeHash(sibling.nodeHash(), child.nodeHash())}, nil
+}
+
+/*
+	sets the record with a ledger key to value, or removes it if value is nil.
+*/
+func (t *stateTree) update(key string, value []byte) error {
+	path := merkleproof.Path(key)
+	var valueHash []byte
+	if value != nil {
+		hash := sha256.Sum256(value)
+		valueHash = hash[:]
+	}
+	root, err := t.set(0, path, valueHash)
+	if err != nil {
+		return err
+	}
+	t.store(0, path, root)
+	return nil
+}
+
+/*
+	writes the updated nodes in key order and returns the root hash.
+*/
+func (t *stateTree) flush() ([]byte, error) {
+	keys := make([]string, 0, len(t.nodes))
+	for key := range t.nodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		node := t.nodes[key]
+		var err error
+		switch {
+		case node == nil:
+			err = t.stub.DelState(key)
+		case node.isLeaf():
+			err = t.stub.PutState(key, append(append([]byte{stateTreeLeaf}, node.path...), node.valueHash...))
+		default:
+			err = t.stub.PutState(key, append([]byte{stateTreeInner}, node.hash...))
+		}
+		if err != nil {
+			return nil, internalError(key, "Error writing StateTreeNode state :(%v)", err.Error())
+		}
+	}
+	root, err := t.load(0, merkleproof.Empty)
+	if err != nil {
+		return nil, err
+	}
+	return root.nodeHash(), nil
+}
+
+/*
+	returns the proof of a ledger key against the current root.
+*/
+func (t *stateTree) prove(key string) (*merkleproof.Proof, error) {
+	path := merkleproof.Path(key)
+	proof := &merkleproof.Proof{Siblings: [][]byte{}}
+	siblingPath := append([]byte{}, path...)
+	for depth := 0; ; depth++ {
+		node, err := t.load(depth, path)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return proof, nil
+		}
+		if node.isLeaf() {
+			proof.Leaf = &merkleproof.Leaf{Path: node.path, ValueHash: node.valueHash}
+			return proof, nil
+		}
+		siblingPath[depth/8] ^= 0x80 >> uint(depth%8)
+		sibling, err := t.load(depth+1, siblingPath)
+		if err != nil {
+			return nil, err
+		}
+		siblingPath[depth/8] ^= 0x80 >> uint(depth%8)
+		proof.Siblings = append(proof.Siblings, sibling.nodeHash())
+	}
+}
+
+/*
+	stateRecorder is the Stub passed to the apply phase of a transaction. It records the last value written
+	to each committed record, nil for a deletion, for the state tree.
+*/
+type stateRecorder struct {
+	Stub
+	writes map[string][]byte
+}
+
+func newStateRecorder(stub Stub) *stateRecorder {
+	return &stateRecorder{stub, make(map[string][]byte)}
+}
+
+func (r *stateRecorder) PutState(key string, value []byte) error {
+	if isStateTreeKey(key) {
+		r.writes[key] = value
+	}
+	return r.Stub.PutState(key, value)
+}
+
+func (r *stateRecorder) DelState(key string) error {
+	if isStateTreeKey(key) {
+		r.writes[key] = nil
+	}
+	return r.Stub.DelState(key)
+}
+
+/*
+	applies the recorded writes of a transaction to the state tree and stores its root for the transaction.
+	A transaction that wrote no committed record leaves the tree and the roots unchanged.
+*/
+func (r *stateRecorder) commit() error {
+	if len(r.writes) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(r.writes))
+	for key := range r.writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tree := newStateTree(r.Stub)
+	for _, key := range keys {
+		err := tree.update(key, r.writes[key])
+		if err != nil {
+			return err
+		}
+	}
+	root, err := tree.flush()
+	if err != nil {
+		return err
+	}
+	return putStateRoot(r.Stub, root)
+}
+
+func putStateRoot(stub Stub, root []byte) error {
+	key := stateRootKey(stub.GetTxID())
+	err := stub.PutState(key, root)
+	if err != nil {
+		return internalError(key, "Error putting StateRoot state :(%v)", err.Error())
+	}
+	return nil
+}
+
+/*
+	builds the state tree from the existing records if the ledger has records but no tree, as after an
+	upgrade from a version without it.
+*/
+func initStateTree(stub Stub) error {
+	root, err := newStateTree(stub).load(0, merkleproof.Empty)
+	if err != nil || root != nil {
+		return err
+	}
+	tree := newStateTree(stub)
+	for _, namespace := range stateTreeNamespaces {
+		err = rangeScan(stub, keyPrefix(namespace), func(key string, value []byte) error {
+			return tree.update(key, value)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(tree.nodes) == 0 {
+		return nil
+	}
+	rootHash, err := tree.flush()
+	if err != nil {
+		return err
+	}
+	return putStateRoot(stub, rootHash)
+}
+
+/*
+	proof proves a record or its absence against the current state root:
+	|		args {<Namespace>, <component>...}, e.g. {"Thing", <Nonce hex>} or {"Alias", <alias>}
+	The components are those of the ledger key, so aliases of a registry that blinds them are given in
+	their blinded form. It returns JSON with the root, the value of the record if it exists, and the
+	proof, which merkleproof.Verify checks:
+	|		{"Root":..,"Key":..,"Value":..,"Proof":{"Leaf":{"Path":..,"ValueHash":..},"Siblings":[..]}}
+	Root, Value and the hashes of the proof are base64 encoded, Key is the ledger key.
+*/
+func queryProof(stub Stub, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, invalidArgument("args", "expected a namespace and the components of a key")
+	}
+	for _, component := range args[1:] {
+		err := validateKeyComponent("args", component)
+		if err != nil {
+			return nil, err
+		}
+	}
+	key := compositeKey(args[0], args[1:]...)
+	if !isStateTreeKey(key) {
+		return nil, invalidArgument("args", "namespace (%s) is not committed to by the state tree", args[0])
+	}
+	tree := newStateTree(stub)
+	root, err := tree.load(0, merkleproof.Empty)
+	if err != nil {
+		return nil, err
+	}
+	result := struct {
+		Root  []byte
+		Key   string
+		Value []byte `json:",omitempty"`
+		Proof *merkleproof.Proof
+	}{Root: root.nodeHash(), Key: key}
+	result.Value, err = stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "Could not get State")
+	}
+	result.Proof, err = tree.prove(key)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
+
+/*
+	stateRoot returns the state root after a transaction, or the current root without args:
+	|		args {[<TxID>]}
+	|		{"Root":..}
+	A transaction that wrote no committed record has no root of its own.
+*/
+func queryStateRoot(stub Stub, args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return nil, invalidArgument("args", "expected at most a TxID")
+	}
+	result := struct{ Root []byte }{}
+	if len(args) == 0 {
+		root, err := newStateTree(stub).load(0, merkleproof.Empty)
+		if err != nil {
+			return nil, err
+		}
+		result.Root = root.nodeHash()
+		return json.Marshal(result)
+	}
+	err := validateKeyComponent("args", args[0])
+	if err != nil {
+		return nil, err
+	}
+	key := stateRootKey(args[0])
+	result.Root, err = stub.GetState(key)
+	if err != nil {
+		return nil, internalError(key, "Could not get StateRoot State")
+	}
+	if len(result.Root) == 0 {
+		return nil, notFound(key, "transaction (%s) has no state root", args[0])
+	}
+	return json.Marshal(result)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/merkleproof"
+)
+
+/*
+	computes the root of the records of the ledger from scratch, and counts the nodes of the tree
+*/
+func referenceStateRoot(leaves []*stateTreeNode, depth int) ([]byte, int) {
+	switch len(leaves) {
+	case 0:
+		return merkleproof.Empty, 0
+	case 1:
+		return leaves[0].nodeHash(), 1
+	}
+	var left, right []*stateTreeNode
+	for _, leaf := range leaves {
+		if merkleproof.Bit(leaf.path, depth) == 0 {
+			left = append(left, leaf)
+		} else {
+			right = append(right, leaf)
+		}
+	}
+	leftHash, leftNodes := referenceStateRoot(left, depth+1)
+	rightHash, rightNodes := referenceStateRoot(right, depth+1)
+	return merkleproof.NodeHash(leftHash, rightHash), 1 + leftNodes + rightNodes
+}
+
+/*
+	checks a state tree against the records of a ledger: its root and the number of its node states
+*/
+func checkStateTreeRoot(state map[string][]byte, root []byte) error {
+	var leaves []*stateTreeNode
+	nodes := 0
+	for key, value := range state {
+		if isStateTreeKey(key) {
+			valueHash := sha256.Sum256(value)
+			leaves = append(leaves, &stateTreeNode{path: merkleproof.Path(key), valueHash: valueHash[:]})
+		}
+		if strings.HasPrefix(key, keyPrefix(stateTreeNodeNamespace)) {
+			nodes++
+		}
+	}
+	expected, expectedNodes := referenceStateRoot(leaves, 0)
+	if !bytes.Equal(root, expected) || nodes != expectedNodes {
+		return fmt.Errorf("state root (%x) with %d nodes, expected (%x) with %d nodes", root, nodes, expected, expectedNodes)
+	}
+	return nil
+}
+
+/*
+	checks the state tree of the test ledger and a proof of every record
+*/
+func checkStateTree(stub *testStub) error {
+	rootBytes, err := stub.MockQuery("stateRoot", nil)
+	if err != nil {
+		return err
+	}
+	root := struct{ Root []byte }{}
+	json.Unmarshal(rootBytes, &root)
+	err = checkStateTreeRoot(stub.State, root.Root)
+	if err != nil {
+		return err
+	}
+	for key := range stub.State {
+		if !isStateTreeKey(key) {
+			continue
+		}
+		namespace, components, _ := splitCompositeKey(key)
+		if err := checkProof(stub, root.Root, append([]string{namespace}, components...), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+	queries the proof of a key and verifies it, expecting the record to be present or absent
+*/
+func checkProof(stub *testStub, root []byte, args []string, present bool) error {
+	proofBytes, err := stub.MockQuery("proof", args)
+	if err != nil {
+		return err
+	}
+	result := struct {
+		Root  []byte
+		Key   string
+		Value []byte
+		Proof *merkleproof.Proof
+	}{}
+	err = json.Unmarshal(proofBytes, &result)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling json string %s", proofBytes)
+	}
+	if (result.Value != nil) != present || !bytes.Equal(result.Root, root) {
+		return fmt.Errorf("proof of %v returned (%s)", args, proofBytes)
+	}
+	return merkleproof.Verify(root, result.Key, result.Value, result.Proof)
+}
+
+func TestStateTree(t *testing.T) {
+	stub := newTestStub()
+	checkInit(t, stub, nil)
+	HandleError(t, checkStateTree(stub))
+
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	alicePub := "02ca4a8c7dc5090f924cde2264af240d76f6d58a5d2d15c8c5f59d95c70bd9e4dc"
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, alicePub); err != nil {
+		HandleError(t, err)
+		return
+	}
+	HandleError(t, checkStateTree(stub))
+	for i := 0; i < 24; i++ {
+		alias := fmt.Sprintf("sensor %d", i)
+		if err := registerThing(t, stub, []byte{byte(i + 1)}, []string{alias}, alicePub, "spec", "", alicePriv); err != nil {
+			HandleError(t, err)
+			return
+		}
+	}
+	if err := registerSpec(t, stub, "spec", alicePub, "data", alicePriv); err != nil {
+		HandleError(t, err)
+		return
+	}
+	HandleError(t, checkStateTree(stub))
+
+	//the root of the last transaction is the current root
+	rootBytes, _ := stub.MockQuery("stateRoot", nil)
+	txBytes, err := stub.MockQuery("stateRoot", []string{"3"})
+	if err != nil || string(txBytes) != string(rootBytes) {
+		HandleError(t, fmt.Errorf("root of the last transaction (%s) is not the current root (%s): %v", txBytes, rootBytes, err))
+	}
+	_, err = stub.MockQuery("stateRoot", []string{"unknown"})
+	if err == nil {
+		HandleError(t, fmt.Errorf("found a root for an unknown transaction"))
+	}
+
+	//absent records are proven absent
+	root := struct{ Root []byte }{}
+	json.Unmarshal(rootBytes, &root)
+	for _, args := range [][]string{{"Thing", "ff"}, {"Alias", "sensor 99"}, {"Spec", "other"}} {
+		HandleError(t, checkProof(stub, root.Root, args, false))
+	}
+	if _, err := stub.MockQuery("proof", []string{"Config"}); err == nil {
+		HandleError(t, fmt.Errorf("proved a key outside the state tree"))
+	}
+
+	//Init builds the tree of a ledger that has none
+	for key := range stub.State {
+		if strings.HasPrefix(key, keyPrefix(stateTreeNodeNamespace)) {
+			delete(stub.State, key)
+		}
+	}
+	checkInit(t, stub, nil)
+	HandleError(t, checkStateTree(stub))
+}
+
+/*
+	memoryStub is a Stub over a map, for the state tree alone
+*/
+type memoryStub struct {
+	state map[string][]byte
+}
+
+func (s memoryStub) GetState(key string) ([]byte, error) { return s.state[key], nil }
+func (s memoryStub) PutState(key string, value []byte) error {
+	s.state[key] = value
+	return nil
+}
+func (s memoryStub) DelState(key string) error {
+	delete(s.state, key)
+	return nil
+}
+func (s memoryStub) RangeQueryState(startKey, endKey string) (StateIterator, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+func (s memoryStub) TxTimestamp() (int64, error) { return 0, nil }
+func (s memoryStub) GetTxID() string             { return "memory" }
+
+func TestStateTreeUpdates(t *testing.T) {
+	stub := memoryStub{make(map[string][]byte)}
+	update := func(keys []string, value []byte) []byte {
+		tree := newStateTree(stub)
+		for _, key := range keys {
+			if value == nil {
+				stub.DelState(key)
+			} else {
+				stub.PutState(key, value)
+			}
+			HandleError(t, tree.update(key, value))
+		}
+		root, err := tree.flush()
+		HandleError(t, err)
+		return root
+	}
+	var keys []string
+	for i := 0; i < 200; i++ {
+		keys = append(keys, thingKey(fmt.Sprintf("%02x", i)))
+	}
+
+	//inserts one at a time and in a batch, updates, and removals back to an empty tree
+	for i := 0; i < 100; i++ {
+		HandleError(t, checkStateTreeRoot(stub.state, update(keys[i:i+1], []byte{byte(i)})))
+	}
+	HandleError(t, checkStateTreeRoot(stub.state, update(keys[100:], []byte("batch"))))
+	HandleError(t, checkStateTreeRoot(stub.state, update(keys[50:150], []byte("updated"))))
+	HandleError(t, checkStateTreeRoot(stub.state, update([]string{thingKey("absent")}, nil)))
+	for i := 0; i < 200; i += 40 {
+		HandleError(t, checkStateTreeRoot(stub.state, update(keys[i:i+40], nil)))
+	}
+	if len(stub.state) != 0 {
+		HandleError(t, fmt.Errorf("%d states left in an empty tree", len(stub.state)))
+	}
+}
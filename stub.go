@@ -0,0 +1,36 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+/*
+	Stub is the part of the chaincode stub that the registry uses. The business logic is written against
+	it rather than a shim, and a thin adapter per shim generation implements it:
+	|		fabric06.go		Fabric 0.6 shim, Init/Invoke/Query with function and args (the default build)
+	|		fabric1.go		Fabric 1.x shim, Init/Invoke returning pb.Response (build tag fabric1)
+	TxTimestamp returns the timestamp of the transaction in seconds since the epoch.
+	GetTxID returns the ID of the transaction, which both shim generations provide under that name.
+*/
+type Stub interface {
+	GetState(key string) ([]byte, error)
+	PutState(key string, value []byte) error
+	DelState(key string) error
+	RangeQueryState(startKey, endKey string) (StateIterator, error)
+	TxTimestamp() (int64, error)
+	GetTxID() string
+}
+
+/*
+	StateIterator iterates over the states of a range query in key order.
+*/
+type StateIterator interface {
+	HasNext() bool
+	Next() (string, []byte, error)
+	Close() error
+}
@@ -0,0 +1,75 @@
+/*
+Copyright (c) 2016 Skuchain,Inc
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"reflect"
+
+	IOTRegistryTX "github.com/Trusted-IoT-Alliance/IOTRegistry/IOTRegistryTX"
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+	proto "github.com/golang/protobuf/proto"
+)
+
+/*
+	checkValidity checks the validity window of a signed transaction (see client/validity.go) against the
+	transaction timestamp, allowing the MaxClockSkew of the config on either side. The window is part of
+	the signed message, so it cannot be widened without invalidating the signature.
+	With RequireValidity in the config every transaction type that has a window must set one.
+	issueCredential has no window of its own, see checkCredentialValidity.
+*/
+func checkValidity(stub Stub, tx proto.Message) error {
+	if issueArgs, ok := tx.(*IOTRegistryTX.IssueCredentialTX); ok {
+		return checkCredentialValidity(stub, issueArgs)
+	}
+	if !hasValidityWindow(tx) {
+		return nil
+	}
+	notBefore, notAfter := client.ValidityWindow(tx)
+	if notBefore < 0 {
+		return invalidArgument("NotBefore", "NotBefore (%d) is negative", notBefore)
+	}
+	if notAfter < 0 {
+		return invalidArgument("NotAfter", "NotAfter (%d) is negative", notAfter)
+	}
+	if notBefore != 0 && notAfter != 0 && notAfter < notBefore {
+		return invalidArgument("NotAfter", "NotAfter (%d) is before NotBefore (%d)", notAfter, notBefore)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	if notBefore == 0 && notAfter == 0 {
+		if config.RequireValidity {
+			return invalidArgument("NotAfter", "the registry requires a validity window (NotBefore/NotAfter)")
+		}
+		return nil
+	}
+	timestamp, err := txTimestamp(stub)
+	if err != nil {
+		return err
+	}
+	skew := config.maxClockSkew()
+	if notBefore != 0 && timestamp+skew < notBefore {
+		return registryError(client.CodeFailedPrecondition, "", "NotBefore", "transaction is not valid before (%d), timestamp is (%d)", notBefore, timestamp)
+	}
+	if notAfter != 0 && timestamp-skew > notAfter {
+		return registryError(client.CodeFailedPrecondition, "", "NotAfter", "transaction expired at (%d), timestamp is (%d)", notAfter, timestamp)
+	}
+	return nil
+}
+
+/*
+	reports whether a TX message has NotBefore/NotAfter fields; transactions without a signature of
+	their own, such as issueCredential, have none.
+*/
+func hasValidityWindow(tx proto.Message) bool {
+	v := reflect.ValueOf(tx)
+	return v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().FieldByName("NotAfter").IsValid()
+}
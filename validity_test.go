@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Trusted-IoT-Alliance/IOTRegistry/client"
+)
+
+func TestValidityWindows(t *testing.T) {
+	now := int64(1500000000)
+	defer setTestClock(now)()
+	alicePriv := "94d7fe7308a452fdf019a0424d9c48ba9b66bdbca565c6fa3b1bf9c646ebac20"
+	signer, err := client.NewPrivateKeySigner(alicePriv)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	at := func(offset int64) time.Time {
+		if offset == 0 {
+			return time.Time{}
+		}
+		return time.Unix(now+offset, 0)
+	}
+	registerSpecAt := func(stub *testStub, name string, notBefore int64, notAfter int64) error {
+		spec, err := client.RegisterSpec(signer, name, "", client.ValidBetween(at(notBefore), at(notAfter)))
+		if err != nil {
+			return err
+		}
+		args, err := client.EncodeArgs(spec)
+		if err != nil {
+			return err
+		}
+		_, err = stub.MockInvoke("2", "registerSpec", []string{args})
+		return err
+	}
+
+	stub := newTestStub()
+	checkInit(t, stub, []string{`{"MaxClockSkew":60}`})
+	if err := createRegistrant(t, stub, "Alice", "", alicePriv, client.PubkeyHex(signer)); err != nil {
+		HandleError(t, err)
+		return
+	}
+	tests := []struct {
+		name      string
+		notBefore int64
+		notAfter  int64
+		field     string
+	}{
+		{"open", 0, 0, ""},
+		{"current", -3600, 3600, ""},
+		{"within skew", 30, 3600, ""},
+		{"expired within skew", -3600, -30, ""},
+		{"not yet valid", 120, 3600, "NotBefore"},
+		{"expired", -3600, -120, "NotAfter"},
+	}
+	for _, test := range tests {
+		err := registerSpecAt(stub, test.name, test.notBefore, test.notAfter)
+		if len(test.field) == 0 {
+			HandleError(t, err)
+		} else {
+			HandleError(t, checkErrorCode(err, client.CodeFailedPrecondition, "", test.field))
+		}
+	}
+
+	//the window is signed, so it cannot be moved
+	spec, err := client.RegisterSpec(signer, "moved", "", client.ValidBetween(at(-7200), at(-3600)))
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	spec.NotAfter = now + 3600
+	args, err := client.EncodeArgs(spec)
+	if err != nil {
+		HandleError(t, err)
+		return
+	}
+	_, err = stub.MockInvoke("2", "registerSpec", []string{args})
+	HandleError(t, checkErrorCode(err, client.CodeBadSignature, "", "Signature"))
+
+	err = registerSpecAt(stub, "reversed", 3600, -3600)
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "NotAfter"))
+
+	stub = newTestStub()
+	checkInit(t, stub, []string{`{"RequireValidity":true}`})
+	for _, window := range [][2]int64{{0, 0}, {-60, 60}} {
+		registrant, err := client.CreateRegistrant(signer, "Alice", "", client.ValidBetween(at(window[0]), at(window[1])))
+		if err != nil {
+			HandleError(t, err)
+			return
+		}
+		args, err := client.EncodeArgs(registrant)
+		if err != nil {
+			HandleError(t, err)
+			return
+		}
+		_, err = stub.MockInvoke("1", "createRegistrant", []string{args})
+		if window[1] == 0 {
+			HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "NotAfter"))
+		} else {
+			HandleError(t, err)
+		}
+	}
+	err = registerSpecAt(stub, "unbounded", 0, 0)
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "NotAfter"))
+	HandleError(t, registerSpecAt(stub, "bounded", 0, 60))
+
+	_, err = newTestStub().MockInit("1", "", []string{`{"MaxClockSkew":-1}`})
+	HandleError(t, checkErrorCode(err, client.CodeInvalidArgument, "", "args"))
+}